@@ -1,55 +1,138 @@
 package action
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
 	"github.com/akristianlopez/action/lexer"
 	"github.com/akristianlopez/action/nsina"
 	"github.com/akristianlopez/action/object"
 	"github.com/akristianlopez/action/optimizer"
 	"github.com/akristianlopez/action/parser"
 	"github.com/akristianlopez/action/semantic"
-	"github.com/gin-gonic/gin"
 )
 
 type Action struct {
-	ctx      *gin.Context
-	db       *sql.DB
-	dbname   string
-	error    []string
-	warnings []string
+	ctx         context.Context
+	db          *sql.DB
+	dialect     object.Dialect
+	diagnostics []diagnostic.Diagnostic
+	err         error // dialecte inconnu: les exécutions échouent
+	loader      semantic.ModuleLoader
+	source      semantic.ActionSource
+	backend     nsina.Backend
 }
 
-func NewAction(ctx *gin.Context, db *sql.DB, dbname string) *Action {
-	return &Action{ctx: ctx, db: db, dbname: dbname, error: make([]string, 0)}
+// defaultBackend est la façon d'exécuter des nouvelles actions et des nouveaux compilateurs
+var defaultBackend = nsina.TreeWalker
+
+// NewAction prépare l'exécution d'actions sur db pour le compte de principal. dbname désigne un
+// dialecte enregistré avec object.RegisterDialect (postgres, mysql, mariadb, sqlite, sqlserver...).
+// principal est attaché à ctx: les callbacks le retrouvent avec object.PrincipalFrom.
+// Un dialecte inconnu fait échouer Interpret, Execute, Generate, Expression et Check (voir Err)
+func NewAction(ctx context.Context, principal *object.Principal, db *sql.DB, dbname string) *Action {
+	dialect, err := object.LookupDialect(dbname)
+	if principal == nil {
+		principal = object.NewPrincipal()
+	}
+	return &Action{ctx: object.WithPrincipal(ctx, principal), db: db, dialect: dialect, diagnostics: make([]diagnostic.Diagnostic, 0),
+		err: err, backend: defaultBackend}
+}
+
+// Err renvoie l'erreur de configuration de l'action (dialecte inconnu), nil s'il n'y en a pas
+func (action *Action) Err() error {
+	return action.err
+}
+
+// configured signale l'erreur de configuration de l'action, s'il y en a une
+func (action *Action) configured() bool {
+	if action.err == nil {
+		return true
+	}
+	action.report(configError(action.err))
+	return false
 }
-func (action *Action) Interpret(src string, canHandle func(ctx *gin.Context, table, field, operation string, mode bool) (bool, string),
-	hasFilter func(ctx *gin.Context, table string) bool, getFilter func(ctx *gin.Context, table, newName string) (ast.Expression, bool),
+
+func configError(err error) diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{Code: diagnostic.UnknownDialect, Severity: diagnostic.Error, Source: diagnostic.Engine,
+		Message: err.Error()}
+}
+
+// Principal renvoie l'utilisateur pour le compte duquel les actions s'exécutent
+func (action *Action) Principal() *object.Principal {
+	return object.PrincipalFrom(action.ctx)
+}
+
+// SetModuleLoader définit la fonction qui fournit le source des modules importés par import "..." as x.
+// Sans loader, une action qui importe un module est refusée
+func (action *Action) SetModuleLoader(loader semantic.ModuleLoader) {
+	action.loader = loader
+}
+
+// SetActionSource définit la fonction qui fournit, par son nom, le source d'une action appelée
+// par run "nom"(...). Sans elle, une action qui en appelle une autre est refusée
+func (action *Action) SetActionSource(source semantic.ActionSource) {
+	action.source = source
+}
+
+// SetBackend choisit la façon d'exécuter les actions: nsina.TreeWalker (par défaut) parcourt l'arbre
+// de l'action, nsina.Bytecode la traduit d'abord en bytecode pour la machine virtuelle, plus rapide
+// sur les calculs et les boucles. Le résultat est le même
+func (action *Action) SetBackend(backend nsina.Backend) {
+	action.backend = backend
+}
+
+// evaluate exécute prog dans env selon le backend de l'action. Les traductions en bytecode qui
+// échouent sont signalées par des avertissements
+// evaluate exécute prog et renvoie les avertissements de traduction propres à cette exécution
+func (action *Action) evaluate(prog *ast.Action, env *object.Environment) (object.Object, []diagnostic.Diagnostic) {
+	if action.backend == nsina.Bytecode {
+		code := nsina.Compile(prog)
+		return code.Run(env), translationWarnings(code)
+	}
+	return nsina.Eval(prog, env), nil
+}
+
+// translationWarnings décrit les parties de code dont la traduction a échoué et qu'Eval exécute
+func translationWarnings(code *nsina.Program) []diagnostic.Diagnostic {
+	res := make([]diagnostic.Diagnostic, 0, len(code.Failures()))
+	for _, f := range code.Failures() {
+		res = append(res, diagnostic.Diagnostic{Code: diagnostic.TranslationFailed, Severity: diagnostic.Warning,
+			Source: diagnostic.Engine, Message: f.Error(), Span: diagnostic.At(f.Line(), f.Column())})
+	}
+	return res
+}
+func (action *Action) Interpret(src string, canHandle func(ctx context.Context, table, field, operation string, mode bool) (bool, string),
+	hasFilter func(ctx context.Context, table string) bool, getFilter func(ctx context.Context, table, newName string) (ast.Expression, bool),
 	params map[string]object.Object, disableUpdate, disabledDDL bool,
 	serviceExists func(serviceName string) bool,
-	signature func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error),
-	external func(ctx *gin.Context, srv, name string, args map[string]object.Object) (object.Object, bool),
-	emit func(ctx *gin.Context, subject string, message any) bool,
-	idps func(ctx *gin.Context, arg ...string) error) (object.Object, []string) {
+	signature func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error),
+	external func(ctx context.Context, srv, name string, args map[string]object.Object) (object.Object, bool),
+	emit func(ctx context.Context, subject string, message any) bool,
+	idps func(ctx context.Context, arg ...string) error) (object.Object, []diagnostic.Diagnostic) {
+	if !action.configured() {
+		return object.NULL, action.ErrorDiagnostics()
+	}
 	lex := lexer.New(src)
 	p := parser.New(lex)
 	act := p.ParseAction()
 	if p.Errors() != nil && len(p.Errors()) != 0 {
-		for _, msg := range p.Errors() {
-			action.error = append(action.error, msg.String())
-		}
-		return object.NULL, action.error
+		action.report(p.Diagnostics()...)
+		return object.NULL, action.ErrorDiagnostics()
 	}
+	action.report(p.Warnings()...)
 	analyzer := semantic.NewSemanticAnalyzer(action.ctx, action.db, canHandle, serviceExists, signature, false)
-	errors := analyzer.Analyze(act)
-	if len(analyzer.Warnings) > 0 {
-		action.setWarnings(append(action.Warnings(), analyzer.Warnings...))
-	}
-	if len(errors) > 0 {
-		action.error = append(action.error, errors...)
-		return object.NULL, action.error
+	analyzer.SetModuleLoader(action.loader)
+	analyzer.SetActionSource(action.source)
+	analyzer.Analyze(act)
+	action.report(analyzer.Diagnostics...)
+	if len(analyzer.Errors) > 0 {
+		return object.NULL, action.ErrorDiagnostics()
 	}
 	opt := optimizer.NewOptimizer()
 	optimizedProgram := opt.Optimize(act)
@@ -57,170 +140,196 @@ func (action *Action) Interpret(src string, canHandle func(ctx *gin.Context, tab
 	// if len(opt.Warnings) > 0 {
 	// 	action.setWarnings(append(action.Warnings(), opt.Warnings...))
 	// }
-	env := object.NewEnvironment(action.ctx, action.db, hasFilter, getFilter, action.dbname, params,
+	env := object.NewEnvironment(action.ctx, action.db, hasFilter, getFilter, action.dialect, params,
 		disableUpdate, disabledDDL, signature, external, emit, idps)
-	result := nsina.Eval(optimizedProgram, env)
-	return result, action.AllMessages()
+	result, warnings := action.evaluate(optimizedProgram, env)
+	return result, append(action.Diagnostics(), warnings...)
 }
-func (action *Action) Execute(prog *ast.Action, hasFilter func(ctx *gin.Context, table string) bool, getFilter func(ctx *gin.Context, table, newName string) (ast.Expression, bool),
+func (action *Action) Execute(prog *ast.Action, hasFilter func(ctx context.Context, table string) bool, getFilter func(ctx context.Context, table, newName string) (ast.Expression, bool),
 	params map[string]object.Object, disableUpdate, disabledDDL bool, serviceExists func(serviceName string) bool,
-	signature func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error),
-	external func(ctx *gin.Context, srv, name string, args map[string]object.Object) (object.Object, bool),
-	emit func(ctx *gin.Context, subject string, message any) bool,
-	idps func(ctx *gin.Context, arg ...string) error) object.Object {
-	env := object.NewEnvironment(action.ctx, action.db, hasFilter, getFilter, action.dbname, params,
+	signature func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error),
+	external func(ctx context.Context, srv, name string, args map[string]object.Object) (object.Object, bool),
+	emit func(ctx context.Context, subject string, message any) bool,
+	idps func(ctx context.Context, arg ...string) error) object.Object {
+	if action.err != nil {
+		return &object.Error{Message: "Nsina: " + action.err.Error()}
+	}
+	env := object.NewEnvironment(action.ctx, action.db, hasFilter, getFilter, action.dialect, params,
 		disableUpdate, disabledDDL, signature, external, emit, idps)
 	//Register the User object in the symbol table to be used in the expression analysis
-	result := nsina.Eval(prog, env)
+	result, _ := action.evaluate(prog, env)
 	return result
 }
-func (action *Action) Generate(src string, canHandle func(ctx *gin.Context, table, field, operation string, mode bool) (bool, string), serviceExists func(serviceName string) bool,
-	signature func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)) (*ast.Action, []string) {
+func (action *Action) Generate(src string, canHandle func(ctx context.Context, table, field, operation string, mode bool) (bool, string), serviceExists func(serviceName string) bool,
+	signature func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)) (*ast.Action, []diagnostic.Diagnostic) {
+	if !action.configured() {
+		return nil, action.ErrorDiagnostics()
+	}
 	lex := lexer.New(src)
 	p := parser.New(lex)
 	act := p.ParseAction()
 	if p.Errors() != nil && len(p.Errors()) != 0 {
-		for _, msg := range p.Errors() {
-			action.error = append(action.error, msg.String())
-		}
-		return nil, action.error
+		action.report(p.Diagnostics()...)
+		return nil, action.ErrorDiagnostics()
 	}
+	action.report(p.Warnings()...)
 	analyzer := semantic.NewSemanticAnalyzer(action.ctx, action.db, canHandle, serviceExists, signature, false)
-	errors := analyzer.Analyze(act)
+	analyzer.SetModuleLoader(action.loader)
+	analyzer.SetActionSource(action.source)
+	analyzer.Analyze(act)
+	action.report(analyzer.Diagnostics...)
 	if len(analyzer.Warnings) > 0 {
-		action.setWarnings(append(action.Warnings(), analyzer.Warnings...))
-		action.error = append(action.error, errors...)
-		return nil, action.Warnings()
+		return nil, diagnostic.Warnings(action.diagnostics)
 	}
-	if len(errors) > 0 {
-		action.error = append(action.error, errors...)
-		return nil, action.error
+	if len(analyzer.Errors) > 0 {
+		return nil, action.ErrorDiagnostics()
 	}
 	opt := optimizer.NewOptimizer()
 	optimizedProgram := opt.Optimize(act)
-	if len(opt.Warnings) > 0 {
-		action.setWarnings(append(action.Warnings(), opt.Warnings...))
-	}
+	action.report(opt.Diagnostics...)
 	return optimizedProgram, nil
 }
-func (action *Action) Expression(src, table, newName string, canHandle func(ctx *gin.Context, table, field, operation string, mode bool) (bool, string)) (ast.Expression, []string) {
+func (action *Action) Expression(src, table, newName string, canHandle func(ctx context.Context, table, field, operation string, mode bool) (bool, string)) (ast.Expression, []diagnostic.Diagnostic) {
+	if !action.configured() {
+		return nil, action.ErrorDiagnostics()
+	}
 	lex := lexer.New(src)
 	p := parser.New(lex)
 	act := p.ParseExpression()
 	if p.Errors() != nil && len(p.Errors()) != 0 {
-		for _, msg := range p.Errors() {
-			action.error = append(action.error, msg.String())
-		}
-		return nil, action.error
+		action.report(p.Diagnostics()...)
+		return nil, action.ErrorDiagnostics()
 	}
+	action.report(p.Warnings()...)
 	analyzer := semantic.NewSemanticAnalyzer(action.ctx, action.db, canHandle, nil, nil, false)
 	analyzer.AnalyzeExpression(table, newName, act)
-	if len(analyzer.Warnings) > 0 {
-		action.setWarnings(append(action.Warnings(), analyzer.Warnings...))
-	}
+	action.report(analyzer.Diagnostics...)
 	if len(analyzer.Errors) > 0 {
-		action.error = append(action.error, analyzer.Errors...)
-		return nil, action.error
+		return nil, action.ErrorDiagnostics()
 	}
-	return act, action.error
+	return act, action.ErrorDiagnostics()
 }
-func (action *Action) Check(src, id, table, newName string, canHandle func(ctx *gin.Context, table, field, operation string, mode bool) (bool, string), serviceExists func(serviceName string) bool,
-	signature func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error), mode bool) (bool, []string) {
+func (action *Action) Check(src, id, table, newName string, canHandle func(ctx context.Context, table, field, operation string, mode bool) (bool, string), serviceExists func(serviceName string) bool,
+	signature func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error), mode bool) (bool, []diagnostic.Diagnostic) {
+	if !action.configured() {
+		return false, action.ErrorDiagnostics()
+	}
 	lex := lexer.New(src)
 	p := parser.New(lex)
 	switch strings.ToLower(id) {
 	case "action":
 		act := p.ParseAction()
 		if p.Errors() != nil && len(p.Errors()) != 0 {
-			for _, msg := range p.Errors() {
-				action.error = append(action.error, msg.String())
-			}
-			return false, action.error
+			action.report(p.Diagnostics()...)
+			return false, action.ErrorDiagnostics()
 		}
+		action.report(p.Warnings()...)
 		analyzer := semantic.NewSemanticAnalyzer(action.ctx, action.db, canHandle, serviceExists, signature, mode)
+		analyzer.SetModuleLoader(action.loader)
+		analyzer.SetActionSource(action.source)
 		analyzer.Analyze(act)
-		if len(analyzer.Warnings) > 0 {
-			action.setWarnings(append(action.Warnings(), analyzer.Warnings...))
-		}
+		action.report(analyzer.Diagnostics...)
 		if len(analyzer.Errors) > 0 {
-			action.error = append(action.error, analyzer.Errors...)
-			return false, action.AllMessages()
+			return false, action.Diagnostics()
 		}
 		opt := optimizer.NewOptimizer()
 		opt.Optimize(act)
-		if len(opt.Warnings) > 0 {
-			action.setWarnings(append(action.Warnings(), opt.Warnings...))
-			return false, action.AllMessages()
+		if len(opt.Diagnostics) > 0 {
+			action.report(opt.Diagnostics...)
+			return false, action.Diagnostics()
 		}
-		return true, nil
+		return true, action.WarningDiagnostics()
 	case "expression":
 		act := p.ParseExpression()
 		if p.Errors() != nil && len(p.Errors()) != 0 {
-			for _, msg := range p.Errors() {
-				action.error = append(action.error, msg.String())
-			}
-			return false, action.error
+			action.report(p.Diagnostics()...)
+			return false, action.ErrorDiagnostics()
 		}
+		action.report(p.Warnings()...)
 		analyzer := semantic.NewSemanticAnalyzer(action.ctx, action.db, canHandle, nil, nil, mode)
 		analyzer.AnalyzeExpression(table, newName, act)
-		if len(analyzer.Warnings) > 0 {
-			action.setWarnings(append(action.Warnings(), analyzer.Warnings...))
-		}
+		action.report(analyzer.Diagnostics...)
 		if len(analyzer.Errors) > 0 {
-			action.error = append(action.error, analyzer.Errors...)
-			return false, action.error
+			return false, action.ErrorDiagnostics()
 		}
-		return true, nil
+		return true, action.WarningDiagnostics()
 	default:
-		res := make([]string, 0)
-		res = append(res, "Invalid id")
-		return false, nil
+		action.report(diagnostic.Diagnostic{Code: diagnostic.UnsupportedCheck, Severity: diagnostic.Error, Source: diagnostic.Engine,
+			Message: fmt.Sprintf("Invalid id '%s': expected 'action' or 'expression'", id)})
+		return false, action.ErrorDiagnostics()
 	}
 }
+func (action *Action) report(diags ...diagnostic.Diagnostic) {
+	action.diagnostics = append(action.diagnostics, diags...)
+}
+
+// Diagnostics renvoie les erreurs puis les avertissements accumulés
+func (action *Action) Diagnostics() []diagnostic.Diagnostic {
+	res := diagnostic.Errors(action.diagnostics)
+	return append(res, diagnostic.Warnings(action.diagnostics)...)
+}
+func (action *Action) ErrorDiagnostics() []diagnostic.Diagnostic {
+	return diagnostic.Errors(action.diagnostics)
+}
+func (action *Action) WarningDiagnostics() []diagnostic.Diagnostic {
+	return diagnostic.Warnings(action.diagnostics)
+}
+
+// Errors, Warnings et AllMessages renvoient la forme textuelle des diagnostics
 func (action *Action) Errors() []string {
-	return action.error
+	return diagnostic.Strings(action.ErrorDiagnostics())
 }
 func (action *Action) Warnings() []string {
-	return action.warnings
+	return diagnostic.Strings(action.WarningDiagnostics())
 }
 func (action *Action) AllMessages() []string {
-	messages := make([]string, 0)
-	messages = append(messages, action.error...)
-	messages = append(messages, action.warnings...)
-	return messages
+	return diagnostic.Strings(action.Diagnostics())
 }
 func (action *Action) HasErrors() bool {
-	return len(action.error) > 0
+	return diagnostic.HasErrors(action.diagnostics)
 }
 func (action *Action) HasWarnings() bool {
-	return len(action.warnings) > 0
-}
-func (action *Action) setWarnings(warnings []string) {
-	action.warnings = warnings
+	return len(action.WarningDiagnostics()) > 0
 }
 
 func (action *Action) ClearMessages() {
-	action.error = make([]string, 0)
-	action.warnings = make([]string, 0)
+	action.diagnostics = make([]diagnostic.Diagnostic, 0)
 }
 func (action *Action) ClearErrors() {
-	action.error = make([]string, 0)
+	action.diagnostics = action.WarningDiagnostics()
 }
 func (action *Action) ClearWarnings() {
-	action.warnings = make([]string, 0)
+	action.diagnostics = action.ErrorDiagnostics()
 }
-func (action *Action) Signature(src string) ([]*ast.StructField, *ast.TypeAnnotation, []*ast.StructStatement, []string) {
+func (action *Action) Signature(src string) ([]*ast.StructField, *ast.TypeAnnotation, []*ast.StructStatement, []diagnostic.Diagnostic) {
 	lex := lexer.New(src)
 	p := parser.New(lex)
 	args, retType, otherTypes := p.ParseSignature()
 	if p.Errors() != nil && len(p.Errors()) != 0 {
-		for _, msg := range p.Errors() {
-			action.error = append(action.error, msg.String())
-		}
-		return nil, nil, nil, action.error
+		action.report(p.Diagnostics()...)
+		return nil, nil, nil, action.ErrorDiagnostics()
 	}
 	return args, retType, otherTypes, nil
 }
+
+// EncodeResult écrit en JSON le résultat d'une action selon le type de retour déclaré dans src
+func (action *Action) EncodeResult(src string, result object.Object) ([]byte, error) {
+	_, retType, structs, diags := action.Signature(src)
+	if len(diags) > 0 {
+		return nil, errors.New(diags[0].String())
+	}
+	return object.NewJSONCodec(structs).Marshal(result, retType)
+}
+
+// DecodeParams lit un corps JSON {"nom": valeur, ...} en paramètres typés de l'action src,
+// prêts à être passés à Interpret ou Execute
+func (action *Action) DecodeParams(src string, body []byte) (map[string]object.Object, error) {
+	declared, _, structs, diags := action.Signature(src)
+	if len(diags) > 0 {
+		return nil, errors.New(diags[0].String())
+	}
+	return object.NewJSONCodec(structs).DecodeParams(body, declared)
+}
 func (action *Action) GetDefaultSQLValueAddress(s string) any {
 	return nsina.GetDefaultSQLValueAddress(s)
 }
@@ -0,0 +1,757 @@
+package action
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/nsina"
+	"github.com/akristianlopez/action/object"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Les tests passent deux fois: avec l'évaluateur puis avec la machine virtuelle, qui doit
+// donner les mêmes résultats
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 {
+		defaultBackend = nsina.Bytecode
+		code = m.Run()
+	}
+	os.Exit(code)
+}
+
+// Plusieurs actions interprétées en même temps ne doivent pas se partager d'état.
+// À lancer avec go test -race
+func TestConcurrentInterpret(t *testing.T) {
+	const count = 300
+	var wg sync.WaitGroup
+	errs := make(chan error, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := object.NewPrincipal()
+			user.Set("id", fmt.Sprint(i))
+			src := fmt.Sprintf(`action "Concurrent"()
+				function fact(n: integer) : integer {
+					if n <= 1 {
+						return 1
+					}
+					return n * fact(n - 1)
+				}
+				start
+					let p = {x: %d, y: 2}
+					let z: integer = 0
+					catch {
+						z = 10 / (p.x - %d)
+						z = z + 1
+					}
+					return fact(5) + p.x + z
+				stop
+				`, i, i)
+			act := NewAction(context.Background(), user, nil, "sqlite")
+			res, msgs := act.Interpret(src, nil, nil, nil, nil, false, false, nil, nil, nil, nil, nil)
+			if act.HasErrors() {
+				errs <- fmt.Errorf("action %d: %v", i, msgs)
+				return
+			}
+			// la division par zéro est interceptée: z n'est incrémenté qu'une fois
+			v, ok := res.(*object.Integer)
+			if !ok || v.Value != int64(121+i) {
+				errs <- fmt.Errorf("action %d: expected %d, got %s", i, 121+i, res.Inspect())
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// La division entière par zéro est une erreur d'exécution, que catch peut intercepter
+func TestDivisionByZero(t *testing.T) {
+	for _, expr := range []string{"10 / n", "10 % n"} {
+		src := fmt.Sprintf(`action "Zero"(n: integer): integer
+			start
+				return %s
+			stop
+			`, expr)
+		act := NewAction(context.Background(), nil, nil, "sqlite")
+		params := map[string]object.Object{"n": &object.Integer{Value: 0}}
+		res, msgs := act.Interpret(src, nil, nil, nil, params, false, false, nil, nil, nil, nil, nil)
+		if act.HasErrors() {
+			t.Fatal(msgs)
+		}
+		if e, ok := res.(*object.Error); !ok || !strings.Contains(e.Message, "Division by zero") {
+			t.Errorf("%s: expected a division by zero error, got %s", expr, res.Inspect())
+		}
+	}
+}
+
+// openSQLite crée une base sqlite temporaire et y exécute stmts
+func openSQLite(t *testing.T, stmts ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// sqlite renvoie INTEGER et REAL, qui doivent donner integer et float à l'analyse comme à l'exécution
+func TestSQLiteColumnTypes(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Article (id INTEGER PRIMARY KEY, prix REAL, stock INTEGER)",
+		"INSERT INTO Article (id, prix, stock) VALUES (1, 2.5, 10), (2, 4.0, 3)")
+	src := `action "Stock"(): float
+		start
+			let total: float = 0.0
+			let lignes = select Article.id, Article.prix, Article.stock from Article;
+			for let r of lignes {
+				total = total + r.prix * r.stock + r.id + 1
+			}
+			return total
+		stop
+		`
+	act := NewAction(context.Background(), nil, db, "sqlite")
+	res, msgs := act.Interpret(src, allowAll, nil, nil, nil, false, false, nil, nil, nil, nil, nil)
+	if act.HasErrors() {
+		t.Fatal(msgs)
+	}
+	if f, ok := res.(*object.Float); !ok || f.Value != 42 {
+		t.Fatalf("expected 42, got %s", res.Inspect())
+	}
+}
+
+func allowAll(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+	return true, ""
+}
+
+func TestCheckDiagnostics(t *testing.T) {
+	src := `action "Diagnostics"()
+		start
+			let x = 1
+			let x = 2
+			return x + y
+		stop
+		`
+	act := NewAction(context.Background(), nil, nil, "sqlite")
+	ok, diags := act.Check(src, "action", "", "", allowAll, nil, nil, false)
+	if ok {
+		t.Fatal("expected errors")
+	}
+	codes := make(map[string]diagnostic.Diagnostic)
+	for _, d := range diags {
+		codes[d.Code] = d
+	}
+	d, found := codes[diagnostic.AlreadyDeclared]
+	if !found || d.Severity != diagnostic.Error || d.Span.Start.Line != 4 {
+		t.Fatalf("expected %s at line 4, got %v", diagnostic.AlreadyDeclared, diags)
+	}
+	if len(d.Related) != 1 || d.Related[0].Span.Start.Line != 3 {
+		t.Errorf("expected the first declaration at line 3, got %v", d.Related)
+	}
+	d, found = codes[diagnostic.UndeclaredName]
+	if !found || d.Span.Start.Line == 0 || strings.Contains(d.Message, "line:") {
+		t.Errorf("expected %s with its position, got %v", diagnostic.UndeclaredName, diags)
+	}
+
+	act.ClearMessages()
+	ok, diags = act.Check("action \"Syntax\"()\nstart\n\tlet x = (1 + 2\n\treturn x\nstop\n", "action", "", "", allowAll, nil, nil, false)
+	if ok || len(diags) == 0 || diags[0].Source != diagnostic.Parser || diags[0].Code != diagnostic.ExpectedToken {
+		t.Fatalf("expected a parser error, got %v", diags)
+	}
+	if len(diags[0].Fixes) != 1 || diags[0].Fixes[0].NewText != ")" {
+		t.Errorf("expected a fix inserting ')', got %v", diags[0].Fixes)
+	}
+
+	act.ClearMessages()
+	ok, diags = act.Check("1 == 1", "statement", "", "", allowAll, nil, nil, false)
+	if ok || len(diags) != 1 || diags[0].Code != diagnostic.UnsupportedCheck {
+		t.Fatalf("expected an unsupported check error, got %v", diags)
+	}
+}
+
+// HAVING précède ORDER BY et LIMIT dans la requête générée
+func TestHavingBeforeOrderBy(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Vente (id INTEGER PRIMARY KEY, region TEXT, montant INTEGER)",
+		"INSERT INTO Vente (id, region, montant) VALUES (1, 'est', 10), (2, 'est', 20), (3, 'ouest', 5), (4, 'nord', 40)")
+	src := `action "Regions"(): integer
+		start
+			let lignes = select Vente.region, sum(Vente.montant) as total from Vente group by Vente.region
+				having sum(Vente.montant) > 10 order by Vente.region limit 5;
+			let n: integer = 0
+			for let r of lignes {
+				n = n + 1
+			}
+			return n
+		stop
+		`
+	act := NewAction(context.Background(), nil, db, "sqlite")
+	res, msgs := act.Interpret(src, allowAll, nil, nil, nil, false, false, nil, nil, nil, nil, nil)
+	if act.HasErrors() {
+		t.Fatal(msgs)
+	}
+	// est (30) et nord (40)
+	if res.Inspect() != "2" {
+		t.Fatalf("expected 2 regions, got %s", res.Inspect())
+	}
+}
+
+func TestUnknownDialect(t *testing.T) {
+	src := `action "Un"(): integer
+		start
+			return 1
+		stop
+		`
+	act := NewAction(context.Background(), nil, nil, "postgresql")
+	if act.Err() == nil {
+		t.Fatal("expected an error for the dialect postgresql")
+	}
+	res, diags := act.Interpret(src, allowAll, nil, nil, nil, false, false, nil, nil, nil, nil, nil)
+	if len(diags) != 1 || diags[0].Code != diagnostic.UnknownDialect || !strings.Contains(diags[0].Message, "postgresql") {
+		t.Fatalf("expected an unknown dialect error, got %s %v", res.Inspect(), diags)
+	}
+	act = NewAction(context.Background(), nil, nil, "mssql")
+	if ok, diags := act.Check("1 == 1", "expression", "", "", allowAll, nil, nil, false); ok ||
+		len(diags) != 1 || diags[0].Code != diagnostic.UnknownDialect {
+		t.Fatalf("expected an unknown dialect error, got %v", diags)
+	}
+	act = NewAction(context.Background(), nil, nil, "mssql")
+	if e, diags := act.Expression("1 == 1", "", "", allowAll); e != nil || len(diags) != 1 || diags[0].Code != diagnostic.UnknownDialect {
+		t.Fatalf("expected an unknown dialect error, got %v", diags)
+	}
+	if ca, diags := NewCompiler(nil, "mssql", allowAll, nil, nil).Compile(context.Background(), nil, src, ""); ca != nil ||
+		len(diags) != 1 || diags[0].Code != diagnostic.UnknownDialect {
+		t.Fatalf("expected an unknown dialect error, got %v", diags)
+	}
+	if act := NewAction(context.Background(), nil, nil, "SQLServer"); act.Err() != nil {
+		t.Fatal(act.Err())
+	}
+}
+
+// Les valeurs passent en paramètres liés: une apostrophe ne peut ni casser ni détourner la requête
+func TestBoundValues(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Client (id INTEGER PRIMARY KEY, nom TEXT)",
+		"INSERT INTO Client (id, nom) VALUES (1, 'Ann'), (2, 'Bob'), (3, 'Cy')")
+	src := `action "Clients"(valeur: string): integer
+		start
+			insert into Client (id, nom) values (10, valeur);
+			update Client set nom = valeur where Client.id == 2;
+			delete from Client where Client.nom == valeur and Client.id == 3;
+			let lus = select Client.id from Client where Client.nom == valeur order by Client.id limit 5 offset 0;
+			let n: integer = 0
+			for let r of lus {
+				n = n + 1
+			}
+			return n
+		stop
+		`
+	for _, valeur := range []string{"O'Brien", "x' or '1'='1", "'; drop table Client; --"} {
+		if _, err := db.Exec("DELETE FROM Client WHERE id NOT IN (1, 2, 3)"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE Client SET nom = 'Bob' WHERE id = 2"); err != nil {
+			t.Fatal(err)
+		}
+		params := map[string]object.Object{"valeur": &object.String{Value: valeur}}
+		act := NewAction(context.Background(), nil, db, "sqlite")
+		res, msgs := act.Interpret(src, allowAll, nil, nil, params, false, false, nil, nil, nil, nil, nil)
+		if act.HasErrors() || isError(res) {
+			t.Fatalf("%s: %s %v", valeur, res.Inspect(), msgs)
+		}
+		// la ligne insérée et la ligne 2 portent la valeur, telle quelle
+		if res.Inspect() != "2" {
+			t.Errorf("%s: expected 2 rows, got %s", valeur, res.Inspect())
+		}
+		rows, err := db.Query("SELECT id, nom FROM Client ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for rows.Next() {
+			var id int
+			var nom string
+			if err := rows.Scan(&id, &nom); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%d:%s", id, nom))
+		}
+		rows.Close()
+		want := fmt.Sprintf("[1:Ann 2:%s 3:Cy 10:%s]", valeur, valeur)
+		if fmt.Sprint(got) != want {
+			t.Errorf("%s: expected %s, got %v", valeur, want, got)
+		}
+	}
+
+	// LIMIT et OFFSET sont liés eux aussi
+	src = `action "Page"(): integer
+		start
+			let lus = select Client.id from Client where Client.id > 1 order by Client.id limit 2 offset 1;
+			let n: integer = 0
+			for let r of lus {
+				n = n + r.id
+			}
+			return n
+		stop
+		`
+	act := NewAction(context.Background(), nil, db, "sqlite")
+	if res, msgs := act.Interpret(src, allowAll, nil, nil, nil, false, false, nil, nil, nil, nil, nil); res.Inspect() != "13" {
+		t.Fatalf("expected the rows 3 and 10, got %s %v", res.Inspect(), msgs)
+	}
+}
+
+func isError(o object.Object) bool {
+	_, ok := o.(*object.Error)
+	return ok
+}
+
+func TestProtected(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Journal (id INTEGER PRIMARY KEY, msg TEXT)")
+	db.SetMaxOpenConns(1)
+	rows := func() string {
+		var ids []int
+		r, err := db.Query("SELECT id FROM Journal ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		for r.Next() {
+			var id int
+			if err := r.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return fmt.Sprint(ids)
+	}
+	run := func(ctx context.Context, src string, emit func(ctx context.Context, subject string, message any) bool) object.Object {
+		t.Helper()
+		act := NewAction(ctx, nil, db, "sqlite")
+		res, msgs := act.Interpret(src, allowAll, nil, nil, nil, false, false, nil, nil, nil, emit, nil)
+		if act.HasErrors() {
+			t.Fatal(msgs)
+		}
+		return res
+	}
+
+	// l'erreur du bloc interne n'annule que son point de sauvegarde; le bloc externe valide le reste
+	res := run(context.Background(), `action "Imbrique"(): integer
+		start
+			protected {
+				insert into Journal (id, msg) values (1, 'externe');
+				catch {
+					protected {
+						insert into Journal (id, msg) values (2, 'interne');
+						insert into Journal (id, msg) values (1, 'doublon');
+					}
+				}
+				insert into Journal (id, msg) values (3, 'externe');
+			}
+			return 0
+		stop
+		`, nil)
+	if isError(res) {
+		t.Fatal(res.Inspect())
+	}
+	if got := rows(); got != "[1 3]" {
+		t.Fatalf("expected the rows 1 and 3, got %s", got)
+	}
+
+	// une erreur dans le bloc externe annule tout, points de sauvegarde validés compris
+	res = run(context.Background(), `action "Echec"(): integer
+		start
+			protected {
+				insert into Journal (id, msg) values (4, 'externe');
+				protected {
+					insert into Journal (id, msg) values (5, 'interne');
+				}
+				insert into Journal (id, msg) values (1, 'doublon');
+			}
+			return 0
+		stop
+		`, nil)
+	if !isError(res) {
+		t.Fatalf("expected an error, got %s", res.Inspect())
+	}
+	if got := rows(); got != "[1 3]" {
+		t.Fatalf("expected the rows 1 and 3, got %s", got)
+	}
+
+	// la transaction suit le contexte de la requête: son annulation arrête le bloc ouvert
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res = run(ctx, `action "Annule"(): integer
+		start
+			protected {
+				insert into Journal (id, msg) values (6, 'avant');
+				emit("annuler", 6);
+				insert into Journal (id, msg) values (7, 'après');
+			}
+			return 0
+		stop
+		`, func(ctx context.Context, subject string, message any) bool {
+		cancel()
+		return true
+	})
+	if !isError(res) {
+		t.Fatalf("expected an error, got %s", res.Inspect())
+	}
+	if got := rows(); got != "[1 3]" {
+		t.Fatalf("expected the rows 1 and 3, got %s", got)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	src := "action \"Escapes\"()\nstart\n" +
+		"\tlet s = \"say \\\"hi\\\"\\tit\\'s\\n\\\\ \\u{e9}\"\n" +
+		"\tlet r = `line 1\r\n\t\"line\" \\n 2`\n" +
+		"\treturn s + '|' + r\nstop\n"
+	act := NewAction(context.Background(), nil, nil, "sqlite")
+	res, msgs := act.Interpret(src, nil, nil, nil, nil, false, false, nil, nil, nil, nil, nil)
+	if act.HasErrors() {
+		t.Fatal(msgs)
+	}
+	want := "say \"hi\"\tit's\n\\ é|line 1\n\t\"line\" \\n 2"
+	if v, ok := res.(*object.String); !ok || v.Value != want {
+		t.Fatalf("expected %q, got %s", want, res.Inspect())
+	}
+
+	// une chaîne entre guillemets s'arrête en fin de ligne: le texte sur plusieurs lignes
+	// s'écrit entre accents graves ou avec \n
+	act = NewAction(context.Background(), nil, nil, "sqlite")
+	ok, diags := act.Check("action \"Open\"()\nstart\n\tlet s = \"line 1\nline 2\"\n\treturn s\nstop\n", "action", "", "", allowAll, nil, nil, false)
+	if ok || len(diags) == 0 {
+		t.Fatalf("expected lexical errors, got %v", diags)
+	}
+	if d := diags[0]; d.Code != diagnostic.UnterminatedString || d.Span.Start != (diagnostic.Position{Line: 3, Column: 10}) {
+		t.Errorf("expected %s at line 3, column 10, got %v", diagnostic.UnterminatedString, d)
+	}
+	src = "action \"Lines\"()\nstart\n\treturn `line 1\nline 2` == \"line 1\\nline 2\"\nstop\n"
+	act = NewAction(context.Background(), nil, nil, "sqlite")
+	if res, msgs = act.Interpret(src, nil, nil, nil, nil, false, false, nil, nil, nil, nil, nil); act.HasErrors() || res.Inspect() != "true" {
+		t.Fatalf("expected the raw and escaped strings to match, got %s %v", res.Inspect(), msgs)
+	}
+
+	// une séquence inconnue est gardée telle qu'écrite, avec un avertissement
+	src = "action \"Unknown\"()\nstart\n\tlet x = 'a\\qb'\n\treturn x\nstop\n"
+	act = NewAction(context.Background(), nil, nil, "sqlite")
+	ok, diags = act.Check(src, "action", "", "", allowAll, nil, nil, false)
+	if !ok || len(diags) != 1 {
+		t.Fatalf("expected a single warning, got %v", diags)
+	}
+	if d := diags[0]; d.Code != diagnostic.UnknownEscape || d.Severity != diagnostic.Warning || d.Span.Start != (diagnostic.Position{Line: 3, Column: 12}) {
+		t.Errorf("expected a %s warning at line 3, column 12, got %v", diagnostic.UnknownEscape, d)
+	}
+	act = NewAction(context.Background(), nil, nil, "sqlite")
+	res, _ = act.Interpret(src, nil, nil, nil, nil, false, false, nil, nil, nil, nil, nil)
+	if v, ok := res.(*object.String); !ok || v.Value != `a\qb` {
+		t.Errorf("expected %q, got %s", `a\qb`, res.Inspect())
+	}
+}
+
+func TestResultJSON(t *testing.T) {
+	src := `action "Commande"(client: string, lignes: array of Ligne, livraison: date) : Facture
+		type Ligne struct {
+			sku: string,
+			qte: integer,
+			prix: decimal(10,2)
+		}
+		type Facture struct {
+			client: string,
+			livraison: date,
+			total: decimal(10,2),
+			lignes: array of Ligne,
+			delai: duration,
+			taux: float
+		}
+		start
+			let total: decimal(10,2) = 0
+			for let l of lignes {
+				total = total + l.qte * l.prix
+			}
+			let f: Facture = Facture{client: client, livraison: livraison, total: total, lignes: lignes, delai: #2d#, taux: 1}
+			return f
+		stop
+		`
+	body := `{"client": "Ngo", "lignes": [{"sku": "a", "qte": 2, "prix": "1.5"}, {"sku": "b", "qte": 1, "prix": 19.99}], "Livraison": "2024-03-01"}`
+	act := NewAction(context.Background(), object.NewPrincipal(), nil, "sqlite")
+	params, err := act.DecodeParams(src, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := params["livraison"].(*object.Date); !ok || d.Inspect() != "2024-03-01" {
+		t.Fatalf("expected the date 2024-03-01, got %v", params["livraison"])
+	}
+	res, msgs := act.Interpret(src, allowAll, nil, nil, params, false, false, nil, nil, nil, nil, nil)
+	if act.HasErrors() {
+		t.Fatal(msgs)
+	}
+	data, err := act.EncodeResult(src, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"client":"Ngo","livraison":"2024-03-01","total":22.99,"lignes":[{"sku":"a","qte":2,"prix":1.50},{"sku":"b","qte":1,"prix":19.99}],"delai":"2d","taux":1}`
+	if string(data) != want {
+		t.Fatalf("expected %s, got %s", want, data)
+	}
+
+}
+
+func TestCompiledAction(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, nom TEXT, salaire INT)",
+		"INSERT INTO Emp (id, nom, salaire) VALUES (1, 'Ann', 1000), (2, 'Bob', 1500), (3, 'Cy', 2000)")
+	src := `action "Masse"(seuil: integer, bonus: integer): integer
+		function fact(n: integer): integer {
+			if n <= 1 {
+				return 1
+			}
+			return n * fact(n - 1)
+		}
+		start
+			let lignes = select Emp.salaire from Emp where Emp.salaire >= seuil;
+			let total: integer = 0
+			for let r of lignes {
+				total = total + r.salaire
+			}
+			catch {
+				let z = 1 / 0
+			}
+			let hauts = filter([1, 2, 3], function(x: integer): boolean { return x > 1 })
+			return total + fact(length(hauts)) + bonus
+		stop
+		`
+	// l'utilisateur "stagiaire" ne peut pas lire la table Emp
+	canHandle := func(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+		if p := object.PrincipalFrom(ctx); p != nil && p.Get("role") == "stagiaire" && strings.EqualFold(table, "emp") {
+			return false, "Access denied to " + table
+		}
+		return true, ""
+	}
+	var analyses atomic.Int32
+	counting := func(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+		if field == "" {
+			analyses.Add(1)
+		}
+		return canHandle(ctx, table, field, operation, mode)
+	}
+	comp := NewCompiler(db, "sqlite", counting, nil, nil)
+	ctx := context.Background()
+	ca, diags := comp.Compile(ctx, nil, src, "v1")
+	if ca == nil {
+		t.Fatal(diags)
+	}
+	params, err := ca.DecodeParams([]byte(`{"seuil": 1500, "bonus": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := analyses.Load()
+	if again, _ := comp.Compile(ctx, nil, src, "v1"); again != ca {
+		t.Fatal("expected the cached program")
+	}
+	// seules les réponses de canHandle sont vérifiées à nouveau, une fois chacune
+	if n := analyses.Load() - before; n != 1 {
+		t.Fatalf("expected one permission check on Emp, got %d", n)
+	}
+
+	const count = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := map[string]object.Object{"seuil": params["seuil"], "bonus": &object.Integer{Value: int64(i)}}
+			res := ca.Execute(ctx, nil, p, nil, nil, false, false, nil, nil, nil)
+			v, ok := res.(*object.Integer)
+			if !ok || v.Value != int64(3502+i) {
+				errs <- fmt.Errorf("execution %d: expected %d, got %s", i, 3502+i, res.Inspect())
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if data, err := ca.EncodeResult(&object.Integer{Value: 3502}); err != nil || string(data) != "3502" {
+		t.Errorf("expected 3502, got %s (%v)", data, err)
+	}
+
+	// un autre schéma ou d'autres droits donnent un autre programme
+	if other, _ := comp.Compile(ctx, nil, src, "v2"); other == nil || other == ca {
+		t.Fatal("expected a new program for the schema v2")
+	}
+	// deux versions utilisées en même temps gardent chacune leur programme
+	if again, _ := comp.Compile(ctx, nil, src, "v1"); again != ca {
+		t.Fatal("expected the program of the schema v1 to stay in the cache")
+	}
+	stagiaire := object.NewPrincipal()
+	stagiaire.Set("role", "stagiaire")
+	if res := ca.Execute(ctx, stagiaire, params, nil, nil, false, false, nil, nil, nil); !isError(res) {
+		t.Fatalf("expected an error for other permissions, got %s", res.Inspect())
+	}
+	if denied, diags := comp.Compile(ctx, stagiaire, src, "v2"); denied != nil || !diagnostic.HasErrors(diags) {
+		t.Fatalf("expected the access to Emp to be denied, got %v", diags)
+	}
+}
+
+// Les compilations simultanées d'un même source n'en font qu'une et le cache reste borné
+func TestCompilerCache(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, salaire INTEGER)")
+	src := `action "Cache"(): integer
+		start
+			let lignes = select Emp.salaire from Emp;
+			let n: integer = 0
+			for let r of lignes {
+				n = n + 1
+			}
+			return n
+		stop
+		`
+	var mu sync.Mutex
+	questions := make(map[string]int)
+	canHandle := func(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+		role := object.PrincipalFrom(ctx).Get("role")
+		mu.Lock()
+		questions[role]++
+		mu.Unlock()
+		return role != "stagiaire", "Access denied to " + table
+	}
+	user := func(role string) *object.Principal {
+		p := object.NewPrincipal()
+		p.Set("role", role)
+		return p
+	}
+	comp := NewCompiler(db, "sqlite", canHandle, nil, nil)
+	ctx := context.Background()
+
+	const count = 50
+	programs := make(chan *CompiledAction, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ca, _ := comp.Compile(ctx, user("agent"), src, "v1")
+			programs <- ca
+		}()
+	}
+	wg.Wait()
+	close(programs)
+	first := <-programs
+	for ca := range programs {
+		if ca == nil || ca != first {
+			t.Fatal("expected every caller to get the same program")
+		}
+	}
+	if n := comp.lru.Len(); n != 1 {
+		t.Fatalf("expected one program in the cache, got %d", n)
+	}
+
+	// trouver le programme en cache pose une fois chaque question de sa compilation
+	if ca, _ := comp.Compile(ctx, user("chef"), src, "v1"); ca != first {
+		t.Fatal("expected the cached program for the same permissions")
+	}
+	if _, diags := comp.Compile(ctx, user("stagiaire"), src, "v1"); !diagnostic.HasErrors(diags) {
+		t.Fatalf("expected the access to Emp to be denied, got %v", diags)
+	}
+	mu.Lock()
+	questions["chef"] = 0
+	mu.Unlock()
+	comp.Compile(ctx, user("chef"), src, "v1")
+	mu.Lock()
+	asked := questions["chef"]
+	mu.Unlock()
+	if len(first.checks) == 0 || asked != len(first.checks) {
+		t.Fatalf("expected %d question(s) to canHandle, got %d", len(first.checks), asked)
+	}
+
+	comp.SetCacheSize(2)
+	for i := 0; i < 5; i++ {
+		other := strings.Replace(src, "n + 1", fmt.Sprintf("n + %d", i+2), 1)
+		if ca, diags := comp.Compile(ctx, user("agent"), other, "v1"); ca == nil {
+			t.Fatal(diags)
+		}
+	}
+	if n := comp.lru.Len(); n != 2 || len(comp.cache) != 2 {
+		t.Fatalf("expected 2 programs in the cache, got %d for %d source(s)", n, len(comp.cache))
+	}
+	if ca, _ := comp.Compile(ctx, user("agent"), src, "v1"); ca == nil || ca == first {
+		t.Fatal("expected the least recently used program to be compiled again")
+	}
+
+	// changer de backend pendant des compilations ne garde pas de programme de l'ancien backend
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			comp.Compile(ctx, user("agent"), src, fmt.Sprint("v", i))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		comp.SetModuleLoader(nil)
+		comp.SetActionSource(nil)
+		comp.SetBackend(nsina.Bytecode)
+	}()
+	wg.Wait()
+	if ca, _ := comp.Compile(ctx, user("agent"), src, "v9"); ca == nil || ca.code == nil {
+		t.Fatal("expected a program translated for the bytecode backend")
+	}
+}
+
+// Les rôles de l'utilisateur sont lus par les filtres de lignes dans sysuser.roles
+func TestSysUserRoles(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, service TEXT)",
+		"INSERT INTO Emp (id, service) VALUES (1, 'ventes'), (2, 'achats'), (3, 'ventes')")
+	src := `action "Visibles"(): integer
+		start
+			let n: integer = 0
+			for let e of select Emp.id from Emp; {
+				n = n + 1
+			}
+			return n
+		stop
+		`
+	for _, tt := range []struct {
+		roles    []string
+		expected string
+	}{{nil, "2"}, {[]string{"Agent", "chef"}, "3"}} {
+		p := object.NewPrincipal()
+		p.Set("service", "ventes")
+		p.Roles = tt.roles
+		act := NewAction(context.Background(), p, db, "sqlite")
+		filter, diags := act.Expression(`Emp.service == sysuser.service or contains(sysuser.roles, "chef")`, "Emp", "", allowAll)
+		if filter == nil {
+			t.Fatal(diags)
+		}
+		hasFilter := func(ctx context.Context, table string) bool { return strings.EqualFold(table, "Emp") }
+		getFilter := func(ctx context.Context, table, newName string) (ast.Expression, bool) { return filter, true }
+		res, msgs := act.Interpret(src, allowAll, hasFilter, getFilter, nil, false, false, nil, nil, nil, nil, nil)
+		if act.HasErrors() {
+			t.Fatal(msgs)
+		}
+		if res.Inspect() != tt.expected {
+			t.Errorf("roles %v: expected %s row(s), got %s", tt.roles, tt.expected, res.Inspect())
+		}
+		if p.HasRole("CHEF") != (len(tt.roles) > 0) {
+			t.Errorf("roles %v: unexpected HasRole result", tt.roles)
+		}
+	}
+}
@@ -168,6 +168,39 @@ func (st *SetType) String() string {
 	return fmt.Sprintf("{%s}", out)
 }
 
+// MapType - Type dictionnaire: map of K to V
+type MapType struct {
+	Token token.Token
+	Key   *TypeAnnotation
+	Value *TypeAnnotation
+}
+
+func (mt *MapType) String() string {
+	return fmt.Sprintf("map of %s to %s", mt.Key.String(), mt.Value.String())
+}
+
+// FunctionType - Type d'une fonction: function(integer, string): boolean
+type FunctionType struct {
+	Token      token.Token
+	Parameters []*TypeAnnotation
+	ReturnType *TypeAnnotation
+}
+
+func (ft *FunctionType) String() string {
+	out := "function("
+	for i, p := range ft.Parameters {
+		if i > 0 {
+			out += ", "
+		}
+		out += p.String()
+	}
+	out += ")"
+	if ft.ReturnType != nil {
+		out += ": " + ft.ReturnType.String()
+	}
+	return out
+}
+
 // RangeConstraint - contrainte de plage
 type RangeConstraint struct {
 	Min Expression
@@ -214,6 +247,18 @@ func (fl *FloatLiteral) Column() int          { return fl.Token.Column }
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
+// DecimalLiteral - littéral décimal exact (19.99m); Value est le nombre sans le suffixe
+type DecimalLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (dl *DecimalLiteral) expressionNode()      {}
+func (dl *DecimalLiteral) Line() int            { return dl.Token.Line }
+func (dl *DecimalLiteral) Column() int          { return dl.Token.Column }
+func (dl *DecimalLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DecimalLiteral) String() string       { return dl.Token.Literal }
+
 // StringLiteral - littéral chaîne
 type StringLiteral struct {
 	Token token.Token
@@ -241,11 +286,12 @@ func (b *BooleanLiteral) Column() int          { return b.Token.Column }
 func (b *BooleanLiteral) TokenLiteral() string { return b.Token.Literal }
 func (b *BooleanLiteral) String() string       { return b.Token.Literal }
 
-// DateTimeLiteral - littéral date/time
+// DateTimeLiteral - littéral date, time ou datetime (#2024-01-15 14:30:00 Europe/Paris#)
 type DateTimeLiteral struct {
-	Token  token.Token
-	Value  string
-	IsTime bool
+	Token      token.Token
+	Value      string
+	IsTime     bool
+	IsDateTime bool
 }
 
 func (dt *DateTimeLiteral) expressionNode()      {}
@@ -479,6 +525,7 @@ func (ws *WhileStatement) Column() int {
 type ForEachStatement struct {
 	Token    token.Token
 	Variable *Identifier
+	Value    *Identifier // Seconde variable (valeur) pour un dictionnaire: for let k, v of m
 	Iterator Expression
 	Body     *BlockStatement
 }
@@ -491,6 +538,9 @@ func (fe *ForEachStatement) String() string {
 	if fe.Variable != nil {
 		out += fe.Variable.String()
 	}
+	if fe.Value != nil {
+		out += ", " + fe.Value.String()
+	}
 	out += fmt.Sprintf(" Of (%s)", fe.Iterator.String())
 	if fe.Body == nil {
 		out += " " + fe.Body.String()
@@ -538,6 +588,33 @@ func (fs *FunctionStatement) Column() int {
 	return fs.Token.Column
 }
 
+// FunctionLiteral - Fonction anonyme: function(x: integer): boolean { ... }
+type FunctionLiteral struct {
+	Token      token.Token
+	Parameters []*FunctionParameter
+	ReturnType *TypeAnnotation
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) String() string {
+	out := "function("
+	for i, p := range fl.Parameters {
+		if i > 0 {
+			out += ", "
+		}
+		out += p.String()
+	}
+	out += ")"
+	if fl.ReturnType != nil {
+		out += " : " + fl.ReturnType.String()
+	}
+	return out + " " + fl.Body.String()
+}
+func (fl *FunctionLiteral) expressionNode() {}
+func (fl *FunctionLiteral) Line() int       { return fl.Token.Line }
+func (fl *FunctionLiteral) Column() int     { return fl.Token.Column }
+
 // FunctionParameter - paramètre de fonction
 type FunctionParameter struct {
 	Token token.Token
@@ -580,6 +657,26 @@ func (ss *StructStatement) Column() int {
 	return ss.Token.Column
 }
 
+// ImportStatement - import "lib/finance" as fin. Module est le module chargé lors de l'analyse sémantique
+type ImportStatement struct {
+	Token  token.Token
+	Path   string
+	Alias  *Identifier
+	Module *Action
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return fmt.Sprintf("import %q as %s", is.Path, is.Alias.String())
+}
+func (is *ImportStatement) Line() int {
+	return is.Token.Line
+}
+func (is *ImportStatement) Column() int {
+	return is.Token.Column
+}
+
 // StructField - champ de structure
 type StructField struct {
 	Token token.Token
@@ -1449,6 +1546,83 @@ func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) Line() int       { return al.Token.Line }
 func (al *ArrayLiteral) Column() int     { return al.Token.Column }
 
+// MapLiteral - Littéral de dictionnaire: map{k: v, ...}
+type MapLiteral struct {
+	Token token.Token
+	Pairs []MapPair
+}
+
+// MapPair - couple clé/valeur d'un littéral de dictionnaire
+type MapPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MapLiteral) String() string {
+	var out string
+	out += "map{"
+	for i, pair := range ml.Pairs {
+		if i > 0 {
+			out += ", "
+		}
+		out += pair.Key.String() + ": " + pair.Value.String()
+	}
+	out += "}"
+	return out
+}
+func (ml *MapLiteral) expressionNode() {}
+func (ml *MapLiteral) Line() int       { return ml.Token.Line }
+func (ml *MapLiteral) Column() int     { return ml.Token.Column }
+
+// JSONPathExpression - Chemin dans une valeur json: j.$.items[0].price
+type JSONPathExpression struct {
+	Token token.Token // le '$'
+	Left  Expression
+	Steps []JSONPathStep
+}
+
+// JSONPathStep - étape d'un chemin json: un nom de champ ou un index entre crochets
+type JSONPathStep struct {
+	Key   string
+	Index Expression
+}
+
+func (jp *JSONPathExpression) TokenLiteral() string { return jp.Token.Literal }
+func (jp *JSONPathExpression) String() string {
+	var out strings.Builder
+	out.WriteString(jp.Left.String() + ".$")
+	for _, step := range jp.Steps {
+		if step.Index != nil {
+			out.WriteString("[" + step.Index.String() + "]")
+			continue
+		}
+		if isPlainKey(step.Key) {
+			out.WriteString("." + step.Key)
+			continue
+		}
+		out.WriteString(fmt.Sprintf(".%q", step.Key))
+	}
+	return out.String()
+}
+func (jp *JSONPathExpression) expressionNode() {}
+func (jp *JSONPathExpression) Line() int       { return jp.Token.Line }
+func (jp *JSONPathExpression) Column() int     { return jp.Token.Column }
+
+// isPlainKey indique un nom de champ qui s'écrit sans guillemets dans un chemin json
+func isPlainKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
 // IndexExpression - Accès par index
 type IndexExpression struct {
 	Token token.Token
@@ -1489,6 +1663,26 @@ func (se *SliceExpression) expressionNode() {}
 func (se *SliceExpression) Line() int       { return se.Token.Line }
 func (se *SliceExpression) Column() int     { return se.Token.Column }
 
+// RunExpression - run "Calcul Paie"(emp_id: 12). Action est l'action appelée, chargée lors de l'analyse sémantique
+type RunExpression struct {
+	Token     token.Token
+	Name      string
+	Arguments []StructFieldLit
+	Action    *Action
+}
+
+func (re *RunExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RunExpression) String() string {
+	args := make([]string, 0, len(re.Arguments))
+	for _, arg := range re.Arguments {
+		args = append(args, arg.Name.String()+": "+arg.Value.String())
+	}
+	return fmt.Sprintf("run %q(%s)", re.Name, strings.Join(args, ", "))
+}
+func (re *RunExpression) expressionNode() {}
+func (re *RunExpression) Line() int       { return re.Token.Line }
+func (re *RunExpression) Column() int     { return re.Token.Column }
+
 // ArrayFunctionCall - Appel de fonction de tableau
 type ArrayFunctionCall struct {
 	Token     token.Token
@@ -1499,7 +1693,10 @@ type ArrayFunctionCall struct {
 
 func (af *ArrayFunctionCall) TokenLiteral() string { return af.Token.Literal }
 func (af *ArrayFunctionCall) String() string {
-	out := af.Function.String() + "(" + af.Array.String()
+	out := af.Function.String() + "("
+	if af.Array != nil {
+		out += af.Array.String()
+	}
 	for _, arg := range af.Arguments {
 		out += ", " + arg.String()
 	}
@@ -1558,12 +1755,20 @@ type TypeAnnotation struct {
 	ArrayType   *ArrayType // Pour les tableaux
 	Constraints *TypeConstraints
 	SetType     *SetType
+	MapType     *MapType // Pour les dictionnaires
+	FuncType    *FunctionType
 }
 
 func (ta *TypeAnnotation) String() string {
 	if ta.ArrayType != nil {
 		return ta.ArrayType.String()
 	}
+	if ta.MapType != nil {
+		return ta.MapType.String()
+	}
+	if ta.FuncType != nil {
+		return ta.FuncType.String()
+	}
 	out := ta.Type
 	if ta.Constraints != nil {
 		out += ta.Constraints.String()
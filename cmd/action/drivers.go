@@ -0,0 +1,6 @@
+package main
+
+// Pilotes database/sql disponibles pour --db. Les autres moteurs s'ajoutent par un import anonyme
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,396 @@
+// Commande action: exécute, vérifie ou affiche un fichier d'action (.act) hors d'un serveur gin.
+// Les modules importés par import "chemin" as x et les actions appelées par run "nom"(...)
+// sont lus dans le répertoire du fichier.
+//
+//	action run   [--db dsn] [--dialect nom] [--driver nom] [--user nom=valeur]... [--param nom=valeur]... fichier.act
+//	action check [--db dsn] [--dialect nom] [--driver nom] [--user nom=valeur]... fichier.act
+//	action fmt   fichier.act
+//	action ast   fichier.act
+//	action lsp   [--config fichier]
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/akristianlopez/action"
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/formatter"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/lsp"
+	"github.com/akristianlopez/action/nsina"
+	"github.com/akristianlopez/action/object"
+	"github.com/akristianlopez/action/parser"
+	"github.com/akristianlopez/action/semantic"
+)
+
+const usage = `usage: action <commande> [options] fichier.act
+
+commandes:
+  run    exécute l'action et affiche son résultat en JSON
+  check  analyse l'action sans l'exécuter
+  fmt    vérifie l'action et l'affiche dans sa mise en page canonique
+  ast    affiche l'arbre syntaxique de l'action en JSON
+  lsp    démarre le serveur de langage pour l'éditeur (stdin/stdout)
+`
+
+// params accumule les options --param nom=valeur
+type params map[string]string
+
+func (p params) String() string { return fmt.Sprint(map[string]string(p)) }
+func (p params) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid parameter '%s': expected name=value", s)
+	}
+	p[strings.ToLower(strings.TrimSpace(name))] = value
+	return nil
+}
+
+type options struct {
+	dsn     string
+	dialect string
+	driver  string
+	params  params
+	user    params
+	files   []string
+	vm      bool
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd := args[0]
+	if cmd == "lsp" {
+		return serveLSP(args[1:], os.Stdin, stdout, stderr)
+	}
+	opts, err := parseOptions(cmd, args[1:], stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if len(opts.files) != 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	src, err := os.ReadFile(opts.files[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	switch cmd {
+	case "run":
+		return runAction(string(src), opts, stdout, stderr)
+	case "check":
+		return checkAction(string(src), opts, stdout, stderr)
+	case "fmt":
+		return fmtAction(string(src), stdout, stderr)
+	case "ast":
+		return astAction(string(src), stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command '%s'\n%s", cmd, usage)
+		return 2
+	}
+}
+
+// parseOptions accepte les options avant comme après le nom du fichier
+func parseOptions(cmd string, args []string, stderr io.Writer) (*options, error) {
+	opts := &options{params: params{}, user: params{}}
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.dsn, "db", "", "chaîne de connexion à la base de données")
+	fs.StringVar(&opts.dialect, "dialect", "sqlite", "dialecte SQL (postgres, mysql, mariadb, sqlite, sqlserver)")
+	fs.StringVar(&opts.driver, "driver", "", "pilote database/sql (par défaut déduit du dialecte)")
+	fs.Var(opts.params, "param", "paramètre de l'action, nom=valeur (répétable)")
+	fs.Var(opts.user, "user", "attribut de l'utilisateur exposé par sysuser, nom=valeur (répétable)")
+	fs.BoolVar(&opts.vm, "vm", false, "exécute l'action avec la machine virtuelle (bytecode)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	for fs.NArg() > 0 {
+		opts.files = append(opts.files, fs.Arg(0))
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := object.GetDialect(opts.dialect); !ok {
+		return nil, fmt.Errorf("unknown dialect '%s'", opts.dialect)
+	}
+	return opts, nil
+}
+
+// driverName renvoie le pilote database/sql habituel pour un dialecte
+func driverName(opts *options) string {
+	if opts.driver != "" {
+		return opts.driver
+	}
+	switch strings.ToLower(opts.dialect) {
+	case "sqlite", "sqlite3":
+		return "sqlite3"
+	case "mysql", "mariadb":
+		return "mysql"
+	default:
+		return strings.ToLower(opts.dialect)
+	}
+}
+
+func openDB(opts *options) (*sql.DB, error) {
+	if opts.dsn == "" {
+		return nil, nil
+	}
+	db, err := sql.Open(driverName(opts), opts.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// newContext renvoie un contexte annulé par Ctrl+C
+func newContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// principal construit l'utilisateur à partir des options --user
+func principal(opts *options) *object.Principal {
+	p := object.NewPrincipal()
+	for name, value := range opts.user {
+		if name == "roles" {
+			p.Roles = strings.Split(value, ",")
+			continue
+		}
+		p.Set(name, value)
+	}
+	return p
+}
+
+// Hors serveur, l'utilisateur du terminal a tous les droits et aucun service externe n'est disponible
+func canHandle(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+	return true, ""
+}
+func serviceExists(serviceName string) bool { return false }
+func signature(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error) {
+	return nil, nil, fmt.Errorf("service '%s' is not available", serviceName)
+}
+
+func runAction(src string, opts *options, stdout, stderr io.Writer) int {
+	db, err := openDB(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if db != nil {
+		defer db.Close()
+	}
+	ctx, cancel := newContext()
+	defer cancel()
+	act := action.NewAction(ctx, principal(opts), db, opts.dialect)
+	act.SetModuleLoader(semantic.DirLoader(filepath.Dir(opts.files[0])))
+	act.SetActionSource(semantic.ActionSource(semantic.DirLoader(filepath.Dir(opts.files[0]))))
+	if opts.vm {
+		act.SetBackend(nsina.Bytecode)
+	}
+	declared, _, _, msgs := act.Signature(src)
+	if len(msgs) > 0 {
+		printDiagnostics(stderr, msgs)
+		return 1
+	}
+	var values map[string]object.Object
+	body, err := paramsJSON(declared, opts.params)
+	if err == nil {
+		values, err = act.DecodeParams(src, body)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	result, msgs := act.Interpret(src, canHandle, nil, nil, values, false, false, serviceExists, signature, nil, nil, nil)
+	if act.HasErrors() {
+		printDiagnostics(stderr, msgs)
+		return 1
+	}
+	if e, ok := result.(*object.Error); ok {
+		fmt.Fprintln(stderr, e.Message)
+		return 1
+	}
+	if act.HasWarnings() {
+		printDiagnostics(stderr, act.WarningDiagnostics())
+	}
+	data, err := act.EncodeResult(src, result)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	out.WriteByte('\n')
+	out.WriteTo(stdout)
+	return 0
+}
+
+func checkAction(src string, opts *options, stdout, stderr io.Writer) int {
+	db, err := openDB(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if db != nil {
+		defer db.Close()
+	}
+	ctx, cancel := newContext()
+	defer cancel()
+	act := action.NewAction(ctx, principal(opts), db, opts.dialect)
+	act.SetModuleLoader(semantic.DirLoader(filepath.Dir(opts.files[0])))
+	act.SetActionSource(semantic.ActionSource(semantic.DirLoader(filepath.Dir(opts.files[0]))))
+	ok, msgs := act.Check(src, "action", "", "", canHandle, serviceExists, signature, false)
+	printDiagnostics(stderr, msgs)
+	if !ok {
+		return 1
+	}
+	fmt.Fprintln(stdout, "ok")
+	return 0
+}
+
+func parse(src string, stderr io.Writer) *ast.Action {
+	p := parser.New(lexer.New(src))
+	act := p.ParseAction()
+	if len(p.Errors()) != 0 {
+		printDiagnostics(stderr, p.Diagnostics())
+		return nil
+	}
+	return act
+}
+
+// fmtAction affiche l'action dans la mise en page canonique du package formatter
+func fmtAction(src string, stdout, stderr io.Writer) int {
+	out, err := formatter.Format(src)
+	var se *formatter.SyntaxError
+	if errors.As(err, &se) {
+		printDiagnostics(stderr, se.Diagnostics)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprint(stdout, out)
+	return 0
+}
+
+func astAction(src string, stdout, stderr io.Writer) int {
+	act := parse(src, stderr)
+	if act == nil {
+		return 1
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(act); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// serveLSP sert le Language Server Protocol sur in/out. La base et canHandle viennent de --config,
+// par défaut du fichier .action-lsp.json du répertoire courant
+func serveLSP(args []string, in io.Reader, out, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("config", lsp.ConfigFile, "fichier de configuration du serveur de langage")
+	fs.Bool("stdio", true, "communique sur l'entrée et la sortie standard (seul mode disponible)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg, err := lsp.LoadConfig(*path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	db, err := cfg.Open()
+	if err != nil {
+		// l'éditeur reste utilisable sans base: seules les tables et colonnes manquent
+		fmt.Fprintln(stderr, err)
+	}
+	if db != nil {
+		defer db.Close()
+	}
+	ctx, cancel := newContext()
+	defer cancel()
+	if err := lsp.NewServer(ctx, cfg, db).Serve(in, out); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// printDiagnostics affiche un diagnostic par ligne: gravité, code puis message
+func printDiagnostics(w io.Writer, diags []diagnostic.Diagnostic) {
+	for _, d := range diags {
+		if d.Message != "" {
+			fmt.Fprintf(w, "%s %s: %s\n", d.Severity, d.Code, d.String())
+		}
+	}
+}
+
+// paramsJSON écrit les valeurs de la ligne de commande en un objet JSON {"nom": valeur, ...},
+// décodé ensuite comme le corps d'une requête HTTP. Les tableaux, ensembles, dictionnaires, structures,
+// booléens et json s'écrivent en JSON (--param ids=[1,2]); les autres valeurs sont prises telles quelles
+func paramsJSON(declared []*ast.StructField, values params) ([]byte, error) {
+	types := make(map[string]*ast.TypeAnnotation)
+	for _, p := range declared {
+		types[strings.ToLower(p.Name.Value)] = p.Type
+	}
+	body := make(map[string]json.RawMessage)
+	for name, value := range values {
+		ta, ok := types[name]
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' is not declared by the action", name)
+		}
+		if ta == nil {
+			return nil, fmt.Errorf("parameter '%s': the parameter has no type", name)
+		}
+		raw := json.RawMessage(value)
+		if quoted(ta) {
+			raw, _ = json.Marshal(value)
+		} else if !json.Valid(raw) {
+			return nil, fmt.Errorf("parameter '%s': '%s' is not a valid json value", name, value)
+		}
+		body[name] = raw
+	}
+	return json.Marshal(body)
+}
+
+// quoted indique si la valeur d'un paramètre de type ta s'écrit sans guillemets sur la ligne de commande
+func quoted(ta *ast.TypeAnnotation) bool {
+	if ta.ArrayType != nil || ta.SetType != nil || ta.MapType != nil {
+		return false
+	}
+	switch strings.ToLower(ta.Type) {
+	case "integer", "float", "decimal", "numeric", "string", "date", "time", "datetime", "duration":
+		return true
+	}
+	return false
+}
@@ -1,14 +0,0 @@
-module github.com/akristianlopez/action/main
-
-go 1.25.4
-
-require github.com/akristianlopez/action/parser v0.0.0-20260101182116-3431003c7e20
-
-require github.com/akristianlopez/action/object v0.0.0-20260101182116-3431003c7e20 // indirect
-
-require (
-	github.com/akristianlopez/action/ast v0.0.0-20260101182116-3431003c7e20 // indirect
-	github.com/akristianlopez/action/lexer v0.0.0-20260101182116-3431003c7e20 // indirect
-	github.com/akristianlopez/action/nsina v0.0.0-20260101182116-3431003c7e20
-	github.com/akristianlopez/action/token v0.0.0-20260101182116-3431003c7e20 // indirect
-)
@@ -0,0 +1,376 @@
+package action
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"sync"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/nsina"
+	"github.com/akristianlopez/action/object"
+	"github.com/akristianlopez/action/optimizer"
+	"github.com/akristianlopez/action/parser"
+	"github.com/akristianlopez/action/semantic"
+)
+
+// Compiler analyse et optimise une action une seule fois. Le programme obtenu est gardé en cache,
+// indexé par l'empreinte du source et la version du schéma de la base, et s'exécute ensuite autant
+// de fois que nécessaire, y compris en parallèle.
+//
+// L'analyse dépend aussi des droits de l'utilisateur (canHandle): chaque programme garde les
+// questions posées à canHandle et leurs réponses, et n'est réutilisé que pour un utilisateur
+// qui obtient les mêmes réponses.
+//
+// Le cache garde au plus SetCacheSize programmes; les moins récemment utilisés sont oubliés.
+// Deux Compile simultanés du même source ne le compilent qu'une fois.
+type Compiler struct {
+	db            *sql.DB
+	dialect       object.Dialect
+	canHandle     func(ctx context.Context, table, field, operation string, mode bool) (bool, string)
+	serviceExists func(serviceName string) bool
+	signature     func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)
+	loader        semantic.ModuleLoader
+	source        semantic.ActionSource
+	backend       nsina.Backend
+	err           error // dialecte inconnu: les compilations échouent
+
+	mu       sync.Mutex
+	reset    int                        // nombre d'appels à Reset: une compilation commencée avant n'est pas gardée
+	cache    map[string][]*list.Element // par version du schéma et empreinte du source, une entrée par jeu de droits
+	lru      *list.List                 // programmes en cache, du plus au moins récemment utilisé
+	size     int                        // nombre maximal de programmes en cache
+	inflight map[string]chan struct{}   // compilations en cours, fermé quand elles se terminent
+}
+
+// defaultCacheSize est le nombre de programmes gardés en cache par défaut
+const defaultCacheSize = 512
+
+// NewCompiler prépare la compilation d'actions sur db. dbname désigne un dialecte enregistré avec
+// object.RegisterDialect; canHandle, serviceExists et signature sont ceux passés à Interpret
+func NewCompiler(db *sql.DB, dbname string, canHandle func(ctx context.Context, table, field, operation string, mode bool) (bool, string),
+	serviceExists func(serviceName string) bool,
+	signature func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)) *Compiler {
+	dialect, err := object.LookupDialect(dbname)
+	return &Compiler{db: db, dialect: dialect, canHandle: canHandle, serviceExists: serviceExists,
+		signature: signature, backend: defaultBackend, err: err, cache: make(map[string][]*list.Element),
+		lru: list.New(), size: defaultCacheSize, inflight: make(map[string]chan struct{})}
+}
+
+// Err renvoie l'erreur de configuration du compilateur (dialecte inconnu), nil s'il n'y en a pas
+func (c *Compiler) Err() error {
+	return c.err
+}
+
+// SetModuleLoader définit la fonction qui fournit le source des modules importés. Le contenu des
+// modules ne fait pas partie de la clé du cache: appeler Reset quand ils changent
+func (c *Compiler) SetModuleLoader(loader semantic.ModuleLoader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loader = loader
+}
+
+// SetActionSource définit la fonction qui fournit le source des actions appelées par run. Comme
+// pour les modules, appeler Reset quand elles changent
+func (c *Compiler) SetActionSource(source semantic.ActionSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.source = source
+}
+
+// SetBackend choisit la façon d'exécuter les actions compilées (voir Action.SetBackend). Avec
+// nsina.Bytecode, la traduction est faite une fois par Compile. Le cache est vidé
+func (c *Compiler) SetBackend(backend nsina.Backend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backend = backend
+	c.clear()
+}
+
+// Reset vide le cache
+func (c *Compiler) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clear()
+}
+
+// SetCacheSize fixe le nombre maximal de programmes gardés en cache (512 par défaut). Chaque jeu
+// de droits différent pour un même source compte pour un programme
+func (c *Compiler) SetCacheSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = max(size, 1)
+	c.evict()
+}
+
+// Compile renvoie le programme de src pour l'utilisateur principal, depuis le cache quand c'est
+// possible. schemaVersion identifie l'état du schéma de la base et fait partie de la clé du cache:
+// les programmes compilés pour une autre version ne sont plus utilisés et finissent par en sortir.
+//
+// Trouver le programme en cache coûte un appel à canHandle par question posée lors de sa
+// compilation; une même question n'est posée qu'une fois par appel, quel que soit le nombre de
+// programmes en cache pour src
+func (c *Compiler) Compile(ctx context.Context, principal *object.Principal, src, schemaVersion string) (*CompiledAction, []diagnostic.Diagnostic) {
+	if c.err != nil {
+		return nil, []diagnostic.Diagnostic{configError(c.err)}
+	}
+	if principal == nil {
+		principal = object.NewPrincipal()
+	}
+	ctx = object.WithPrincipal(ctx, principal)
+	sum := sha256.Sum256([]byte(src))
+	key := schemaVersion + "\x00" + hex.EncodeToString(sum[:])
+	answers := c.answers(ctx)
+
+	for {
+		if ca := c.lookup(key, answers); ca != nil {
+			return ca, ca.warnings
+		}
+		c.mu.Lock()
+		wait, busy := c.inflight[key]
+		if !busy {
+			c.inflight[key] = make(chan struct{})
+		}
+		c.mu.Unlock()
+		if !busy {
+			break
+		}
+		// le même source est en cours de compilation: son programme convient peut-être
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, []diagnostic.Diagnostic{{Code: diagnostic.Canceled, Severity: diagnostic.Error,
+				Source: diagnostic.Engine, Message: ctx.Err().Error()}}
+		}
+	}
+	defer func() {
+		c.mu.Lock()
+		close(c.inflight[key])
+		delete(c.inflight, key)
+		c.mu.Unlock()
+	}()
+	// un programme a pu être ajouté entre la recherche et l'enregistrement de la compilation
+	if ca := c.lookup(key, answers); ca != nil {
+		return ca, ca.warnings
+	}
+
+	c.mu.Lock()
+	reset, backend, loader, source := c.reset, c.backend, c.loader, c.source
+	c.mu.Unlock()
+	ca, diags := c.compile(ctx, src, backend, loader, source)
+	if ca == nil {
+		return nil, diags
+	}
+	ca.version = schemaVersion
+	ca.key = key
+	c.mu.Lock()
+	if c.reset == reset {
+		c.cache[key] = append(c.cache[key], c.lru.PushFront(ca))
+		c.evict()
+	}
+	c.mu.Unlock()
+	return ca, diags
+}
+
+// lookup cherche dans le cache un programme de key compilé pour les droits de answers
+func (c *Compiler) lookup(key string, answers func(permission) bool) *CompiledAction {
+	c.mu.Lock()
+	entries := make([]*CompiledAction, 0, len(c.cache[key]))
+	for _, e := range c.cache[key] {
+		entries = append(entries, e.Value.(*CompiledAction))
+	}
+	c.mu.Unlock()
+	// canHandle est appelé sans tenir le verrou
+	for _, ca := range entries {
+		if ca.allowed(answers) {
+			c.mu.Lock()
+			for _, e := range c.cache[key] {
+				if e.Value == ca {
+					c.lru.MoveToFront(e)
+				}
+			}
+			c.mu.Unlock()
+			return ca
+		}
+	}
+	return nil
+}
+
+// answers renvoie les réponses de canHandle pour ctx; chaque question n'est posée qu'une fois
+func (c *Compiler) answers(ctx context.Context) func(permission) bool {
+	seen := make(map[permission]bool)
+	return func(p permission) bool {
+		if c.canHandle == nil {
+			return true
+		}
+		ok, found := seen[p]
+		if !found {
+			ok, _ = c.canHandle(ctx, p.table, p.field, p.operation, p.mode)
+			seen[p] = ok
+		}
+		return ok
+	}
+}
+
+// clear vide le cache; c.mu est tenu
+func (c *Compiler) clear() {
+	c.reset++
+	c.cache = make(map[string][]*list.Element)
+	c.lru.Init()
+}
+
+// evict oublie les programmes les moins récemment utilisés au-delà de c.size; c.mu est tenu
+func (c *Compiler) evict() {
+	for c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		key := e.Value.(*CompiledAction).key
+		entries := c.cache[key]
+		for i, v := range entries {
+			if v == e {
+				entries = append(entries[:i:i], entries[i+1:]...)
+				break
+			}
+		}
+		if len(entries) == 0 {
+			delete(c.cache, key)
+		} else {
+			c.cache[key] = entries
+		}
+	}
+}
+
+// compile analyse src avec le backend et les sources de modules et d'actions lus sous c.mu
+func (c *Compiler) compile(ctx context.Context, src string, backend nsina.Backend, loader semantic.ModuleLoader,
+	source semantic.ActionSource) (*CompiledAction, []diagnostic.Diagnostic) {
+	p := parser.New(lexer.New(src))
+	act := p.ParseAction()
+	if len(p.Errors()) != 0 {
+		return nil, diagnostic.Errors(p.Diagnostics())
+	}
+	ca := &CompiledAction{compiler: c, name: act.ActionName, params: act.Paramters, returnType: act.ReturnType}
+	var structs []*ast.StructStatement
+	for _, stmt := range act.Statements {
+		if st, ok := stmt.(*ast.StructStatement); ok {
+			structs = append(structs, st)
+		}
+	}
+	ca.codec = object.NewJSONCodec(structs)
+
+	// les réponses de canHandle sont gardées pour vérifier les droits des utilisateurs suivants
+	ca.checks = make(map[permission]bool)
+	record := func(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+		ok, msg := true, ""
+		if c.canHandle != nil {
+			ok, msg = c.canHandle(ctx, table, field, operation, mode)
+		}
+		ca.checks[permission{table: table, field: field, operation: operation, mode: mode}] = ok
+		return ok, msg
+	}
+	analyzer := semantic.NewSemanticAnalyzer(ctx, c.db, record, c.serviceExists, c.signature, false)
+	analyzer.SetModuleLoader(loader)
+	analyzer.SetActionSource(source)
+	analyzer.Analyze(act)
+	if len(analyzer.Errors) > 0 {
+		return nil, diagnostic.Errors(analyzer.Diagnostics)
+	}
+	opt := optimizer.NewOptimizer()
+	ca.program = opt.Optimize(act)
+	ca.warnings = append(p.Warnings(), diagnostic.Warnings(analyzer.Diagnostics)...)
+	ca.warnings = append(ca.warnings, diagnostic.Warnings(opt.Diagnostics)...)
+	if backend == nsina.Bytecode {
+		ca.code = nsina.Compile(ca.program)
+		ca.warnings = append(ca.warnings, translationWarnings(ca.code)...)
+	}
+	return ca, ca.warnings
+}
+
+// permission est une question posée à canHandle pendant l'analyse
+type permission struct {
+	table, field, operation string
+	mode                    bool
+}
+
+// CompiledAction est une action analysée et optimisée. Elle n'est jamais modifiée après sa
+// compilation: Execute peut être appelée plusieurs fois, en parallèle
+type CompiledAction struct {
+	compiler   *Compiler
+	version    string
+	key        string // empreinte du source dans le cache
+	name       string
+	program    *ast.Action
+	code       *nsina.Program // traduction de program pour nsina.Bytecode
+	params     []*ast.StructField
+	returnType *ast.TypeAnnotation
+	codec      *object.JSONCodec
+	checks     map[permission]bool // réponses de canHandle lors de la compilation
+	warnings   []diagnostic.Diagnostic
+}
+
+// Name renvoie le nom de l'action
+func (ca *CompiledAction) Name() string {
+	return ca.name
+}
+
+// SchemaVersion renvoie la version du schéma pour laquelle l'action a été compilée
+func (ca *CompiledAction) SchemaVersion() string {
+	return ca.version
+}
+
+// Signature renvoie les paramètres et le type de retour déclarés par l'action
+func (ca *CompiledAction) Signature() ([]*ast.StructField, *ast.TypeAnnotation) {
+	return ca.params, ca.returnType
+}
+
+// Warnings renvoie les avertissements de l'analyse et de l'optimisation
+func (ca *CompiledAction) Warnings() []diagnostic.Diagnostic {
+	return ca.warnings
+}
+
+// allowed vérifie que answers donne les réponses de canHandle obtenues lors de la compilation
+func (ca *CompiledAction) allowed(answers func(permission) bool) bool {
+	for p, want := range ca.checks {
+		if answers(p) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Execute exécute l'action pour le compte de principal. Les droits de principal sont vérifiés:
+// s'ils diffèrent de ceux pour lesquels l'action a été compilée, il faut la compiler à nouveau.
+// Cette vérification coûte un appel à canHandle par question posée lors de la compilation
+func (ca *CompiledAction) Execute(ctx context.Context, principal *object.Principal, params map[string]object.Object,
+	hasFilter func(ctx context.Context, table string) bool, getFilter func(ctx context.Context, table, newName string) (ast.Expression, bool),
+	disableUpdate, disabledDDL bool,
+	external func(ctx context.Context, srv, name string, args map[string]object.Object) (object.Object, bool),
+	emit func(ctx context.Context, subject string, message any) bool,
+	idps func(ctx context.Context, arg ...string) error) object.Object {
+	if principal == nil {
+		principal = object.NewPrincipal()
+	}
+	ctx = object.WithPrincipal(ctx, principal)
+	if !ca.allowed(ca.compiler.answers(ctx)) {
+		return &object.Error{Message: "Nsina: the action '" + ca.name + "' was compiled for other permissions"}
+	}
+	env := object.NewEnvironment(ctx, ca.compiler.db, hasFilter, getFilter, ca.compiler.dialect, params,
+		disableUpdate, disabledDDL, ca.compiler.signature, external, emit, idps)
+	if ca.code != nil {
+		return ca.code.Run(env)
+	}
+	return nsina.Eval(ca.program, env)
+}
+
+// DecodeParams lit un corps JSON {"nom": valeur, ...} en paramètres typés de l'action
+func (ca *CompiledAction) DecodeParams(body []byte) (map[string]object.Object, error) {
+	return ca.codec.DecodeParams(body, ca.params)
+}
+
+// EncodeResult écrit en JSON le résultat de l'action selon son type de retour
+func (ca *CompiledAction) EncodeResult(result object.Object) ([]byte, error) {
+	return ca.codec.Marshal(result, ca.returnType)
+}
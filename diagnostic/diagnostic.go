@@ -0,0 +1,179 @@
+// Package diagnostic décrit les erreurs et avertissements produits par l'analyse d'une action
+// (parser, semantic, optimizer) sous une forme exploitable par un éditeur ou un client d'API:
+// un code stable, une gravité, une étendue dans le source, des emplacements liés et des corrections proposées.
+package diagnostic
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota + 1
+	Warning
+	Information
+	Hint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Information:
+		return "information"
+	case Hint:
+		return "hint"
+	default:
+		return "unknown"
+	}
+}
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "error":
+		*s = Error
+	case "warning":
+		*s = Warning
+	case "information":
+		*s = Information
+	case "hint":
+		*s = Hint
+	default:
+		return fmt.Errorf("unknown severity '%s'", text)
+	}
+	return nil
+}
+
+// Origine d'un diagnostic
+const (
+	Parser    = "parser"
+	Semantic  = "semantic"
+	Optimizer = "optimizer"
+	Engine    = "engine"
+)
+
+// Codes stables, par origine. Le texte des messages peut changer, pas les codes.
+const (
+	// analyse syntaxique
+	SyntaxError     = "P001"
+	ExpectedToken   = "P002"
+	UnexpectedToken = "P003"
+	InvalidLiteral  = "P004"
+	// analyse lexicale
+	UnterminatedString = "P005"
+	InvalidEscape      = "P006"
+	UnknownEscape      = "P007"
+
+	// analyse sémantique
+	SemanticError     = "S001"
+	UndeclaredName    = "S002"
+	TypeMismatch      = "S003"
+	AlreadyDeclared   = "S004"
+	UnknownName       = "S005"
+	InvalidExpression = "S006"
+	InvalidArguments  = "S007"
+	NotAllowed        = "S008"
+	Canceled          = "S009"
+
+	// optimisation
+	OptimizerNote = "O001"
+	DeadCode      = "O002"
+	UnusedName    = "O003"
+	Unreachable   = "O004"
+
+	// moteur d'exécution
+	UnknownDialect    = "E001"
+	UnsupportedCheck  = "E002"
+	TranslationFailed = "E003"
+)
+
+// Position dans le source; lignes et colonnes commencent à 1, 0 quand elles sont inconnues
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span est l'étendue concernée; End vaut Start quand seule la position de départ est connue
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func At(line, column int) Span {
+	return Span{Start: Position{Line: line, Column: column}, End: Position{Line: line, Column: column}}
+}
+
+// Related désigne un autre emplacement utile à la compréhension du diagnostic (première déclaration...)
+type Related struct {
+	Span    Span   `json:"span"`
+	Message string `json:"message"`
+}
+
+// Fix propose une correction: remplacer Span par NewText. Sans NewText ni Span, c'est un simple conseil
+type Fix struct {
+	Title   string `json:"title"`
+	Span    Span   `json:"span"`
+	NewText string `json:"newText,omitempty"`
+}
+
+type Diagnostic struct {
+	Code     string    `json:"code"`
+	Severity Severity  `json:"severity"`
+	Source   string    `json:"source"`
+	Message  string    `json:"message"`
+	Span     Span      `json:"span"`
+	Related  []Related `json:"related,omitempty"`
+	Fixes    []Fix     `json:"fixes,omitempty"`
+}
+
+// String reprend la forme textuelle historique des messages: "message. line:l, column:c"
+func (d Diagnostic) String() string {
+	if d.Span.Start.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("%s. line:%d, column:%d", d.Message, d.Span.Start.Line, d.Span.Start.Column)
+}
+
+// Errors renvoie les diagnostics de gravité Error
+func Errors(list []Diagnostic) []Diagnostic {
+	return filter(list, Error)
+}
+
+// Warnings renvoie les diagnostics de gravité Warning
+func Warnings(list []Diagnostic) []Diagnostic {
+	return filter(list, Warning)
+}
+
+func HasErrors(list []Diagnostic) bool {
+	for _, d := range list {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Strings renvoie la forme textuelle de chaque diagnostic
+func Strings(list []Diagnostic) []string {
+	res := make([]string, 0, len(list))
+	for _, d := range list {
+		res = append(res, d.String())
+	}
+	return res
+}
+
+func filter(list []Diagnostic, severity Severity) []Diagnostic {
+	res := make([]Diagnostic, 0)
+	for _, d := range list {
+		if d.Severity == severity {
+			res = append(res, d)
+		}
+	}
+	return res
+}
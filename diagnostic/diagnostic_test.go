@@ -0,0 +1,19 @@
+package diagnostic
+
+import "testing"
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		d   Diagnostic
+		str string
+	}{
+		{Diagnostic{Code: UndeclaredName, Message: "Non declared variable 'x'", Span: At(3, 7)}, "Non declared variable 'x'. line:3, column:7"},
+		{Diagnostic{Code: DeadCode, Message: "Dead code eliminated: if statement has empty body", Span: At(5, 2)}, "Dead code eliminated: if statement has empty body. line:5, column:2"},
+		{Diagnostic{Code: Canceled, Message: "Cancled by the user"}, "Cancled by the user"},
+	}
+	for _, tt := range tests {
+		if tt.d.String() != tt.str {
+			t.Errorf("String() = %q, expected %q", tt.d.String(), tt.str)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+// Package formatter réécrit le source d'une action dans une mise en page canonique: mots-clés en
+// minuscules, un cran d'indentation par bloc, espaces normalisés, champs de structure alignés.
+// Contrairement aux méthodes String() de ast, il garde les commentaires (* ... *) et les sauts de ligne.
+package formatter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/parser"
+	"github.com/akristianlopez/action/token"
+)
+
+// Indent est l'indentation d'un bloc
+const Indent = "\t"
+
+// SyntaxError est renvoyée quand le source ne peut pas être formaté parce qu'il ne se parse pas
+type SyntaxError struct {
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	return strings.Join(diagnostic.Strings(e.Diagnostics), "\n")
+}
+
+// ErrChanged signale un formatage qui aurait modifié le programme; le source est alors laissé tel quel
+var ErrChanged = errors.New("formatting would change the meaning of the action")
+
+// Format renvoie src mis en page. Le résultat est stable: Format(Format(src)) == Format(src)
+func Format(src string) (string, error) {
+	if err := check(src); err != nil {
+		return "", err
+	}
+	out := render(scan(src))
+	if !sameTokens(src, out) {
+		return "", ErrChanged
+	}
+	return out, nil
+}
+
+func check(src string) error {
+	p := parser.New(lexer.New(src))
+	p.ParseAction()
+	if len(p.Errors()) != 0 {
+		return &SyntaxError{Diagnostics: p.Diagnostics()}
+	}
+	return nil
+}
+
+// sameTokens vérifie que seuls les blancs, les commentaires et la casse des mots-clés ont changé
+func sameTokens(a, b string) bool {
+	la, lb := lexer.New(a), lexer.New(b)
+	for {
+		ta, tb := la.NextToken(), lb.NextToken()
+		keyword := ta.Type != token.IDENT && token.LookupIdent(strings.ToLower(ta.Literal)) == ta.Type ||
+			isJoinWord(ta.Type, ta.Literal)
+		if ta.Type != tb.Type || ta.Literal != tb.Literal && !(keyword && strings.EqualFold(ta.Literal, tb.Literal)) {
+			return false
+		}
+		if ta.Type == token.EOF {
+			return true
+		}
+	}
+}
+
+// item est un jeton ou un commentaire, avec ce qui le sépare de l'élément précédent
+type item struct {
+	typ      token.TokenType // token.COMMENT pour un commentaire
+	text     string
+	breaks   int  // sauts de ligne avant l'élément
+	spaced   bool // blancs ou commentaire avant l'élément
+	adjacent bool // rien entre l'élément précédent et celui-ci
+}
+
+// scan découpe src en jetons avec le lexer et récupère entre eux les commentaires qu'il ignore
+func scan(src string) []item {
+	l := lexer.New(src)
+	items := make([]item, 0)
+	prev := 0
+	for {
+		t := l.NextToken()
+		end, _ := l.GetCursorPosition()
+		end = min(end, len(src))
+		// blancs et commentaires entre le jeton précédent et celui-ci
+		i, breaks, spaced := prev, 0, false
+	gap:
+		for i < len(src) {
+			switch {
+			case src[i] == '\n':
+				breaks++
+				spaced = true
+				i++
+			case src[i] == ' ' || src[i] == '\t' || src[i] == '\r':
+				spaced = true
+				i++
+			case strings.HasPrefix(src[i:], "(*"):
+				j := strings.Index(src[i+2:], "*)")
+				if j < 0 {
+					j = len(src) - i - 4
+				}
+				items = append(items, item{typ: token.COMMENT, text: src[i : i+j+4], breaks: breaks, spaced: spaced || breaks > 0})
+				i += j + 4
+				breaks, spaced = 0, true
+				continue
+			default:
+				break gap
+			}
+		}
+		if t.Type == token.EOF {
+			return items
+		}
+		it := item{typ: t.Type, text: src[i:max(end, i)], breaks: breaks, spaced: spaced, adjacent: i == prev}
+		if t.Type != token.IDENT && token.LookupIdent(strings.ToLower(it.text)) == t.Type {
+			it.text = strings.ToLower(it.text)
+		}
+		// inner, left... ne sont des mots-clés que devant join
+		if t.Type == token.JOIN {
+			for k := len(items) - 1; k >= 0 && isJoinWord(items[k].typ, items[k].text); k-- {
+				items[k].text = strings.ToLower(items[k].text)
+			}
+		}
+		items = append(items, it)
+		prev = end
+	}
+}
+
+// joinWords sont les identifiants qui qualifient un join; ils s'écrivent comme des mots-clés
+var joinWords = map[string]bool{"inner": true, "left": true, "right": true, "full": true, "cross": true, "outer": true}
+
+func isJoinWord(typ token.TokenType, text string) bool {
+	return typ == token.IDENT && joinWords[strings.ToLower(text)]
+}
+
+// frame est un bloc ouvert: { ( [ ou start
+type frame struct {
+	open   string
+	line   int  // ligne où il a été ouvert
+	indent bool // il a ajouté un cran d'indentation
+	fields bool // corps d'une déclaration type ... struct
+	query  bool // une instruction SQL y est en cours
+}
+
+type line struct {
+	indent int
+	text   strings.Builder
+	field  int // longueur du nom pour un champ de structure, -1 sinon
+	block  int // bloc struct du champ
+	blank  bool
+}
+
+type printer struct {
+	lines  []*line
+	stack  []*frame
+	level  int
+	prev   *item
+	unary  bool // le jeton précédent est un signe unaire
+	note   bool // l'élément précédent est un commentaire
+	blocks int
+	decl   int  // état de la reconnaissance de "type Nom struct {"
+	sql    bool // instruction SQL en cours hors de tout bloc
+}
+
+func render(items []item) string {
+	p := &printer{}
+	for k := range items {
+		it := &items[k]
+		var next *item
+		if k+1 < len(items) {
+			next = &items[k+1]
+		}
+		p.add(it, next)
+	}
+	return p.String()
+}
+
+func (p *printer) current() *line {
+	if len(p.lines) == 0 {
+		return nil
+	}
+	return p.lines[len(p.lines)-1]
+}
+
+// newline termine la ligne courante: un seul cran de plus pour les blocs qui y restent ouverts
+func (p *printer) newline(blank bool) {
+	for k := len(p.stack) - 1; k >= 0; k-- {
+		f := p.stack[k]
+		if f.line != len(p.lines)-1 {
+			break
+		}
+		if !f.indent {
+			f.indent = true
+			p.level++
+			break
+		}
+	}
+	if blank {
+		p.lines = append(p.lines, &line{blank: true, field: -1})
+	}
+	p.lines = append(p.lines, &line{indent: -1, field: -1})
+}
+
+func (p *printer) add(it, next *item) {
+	if p.current() == nil {
+		p.lines = append(p.lines, &line{indent: -1, field: -1})
+	} else if it.breaks > 0 {
+		p.newline(it.breaks > 1)
+	}
+	cur := p.current()
+	first := cur.indent < 0
+	switch {
+	case it.typ == token.RBRACE || it.typ == token.RPAREN || it.typ == token.RBRACKET:
+		p.close()
+	case it.typ == token.STOP && len(p.stack) == 1 && p.stack[0].open == "start":
+		p.close()
+	}
+	if first {
+		cur.indent = p.level
+		query := p.query()
+		if statement(it) {
+			*query = false
+		}
+		switch {
+		case it.typ == token.CASE || it.typ == token.DEFAULT && next != nil && next.typ == token.COLON:
+			cur.indent--
+		case p.level > 0 && continuation(it), *query && !sqlStatement(it) && continues(p.prev):
+			cur.indent++
+		}
+		if f := p.top(); f != nil && f.fields && next != nil && next.typ == token.COLON {
+			cur.field = len(it.text)
+			cur.block = p.blocks
+		}
+	} else if p.space(it, next) {
+		cur.text.WriteByte(' ')
+	}
+	cur.text.WriteString(it.text)
+
+	p.note = it.typ == token.COMMENT
+	if p.note {
+		return
+	}
+	p.unary = (it.typ == token.MINUS || it.typ == token.PLUS) && !operand(p.prev)
+	switch {
+	case sqlStatement(it):
+		*p.query() = true
+	case it.typ == token.SEMICOLON:
+		*p.query() = false
+	}
+	switch it.typ {
+	case token.LBRACE, token.LPAREN, token.LBRACKET:
+		f := &frame{open: it.text, line: len(p.lines) - 1}
+		if it.typ == token.LBRACE && p.decl == 3 {
+			f.fields = true
+			p.blocks++
+		}
+		p.stack = append(p.stack, f)
+	case token.START:
+		if len(p.stack) == 0 {
+			p.stack = append(p.stack, &frame{open: "start", line: len(p.lines) - 1})
+		}
+	}
+	p.decl = structState(p.decl, it)
+	p.prev = it
+}
+
+// structState reconnaît la suite type Nom struct {
+func structState(state int, it *item) int {
+	switch {
+	case it.typ == token.TYPE:
+		return 1
+	case state == 1 && it.typ == token.IDENT:
+		return 2
+	case state == 2 && it.typ == token.STRUCT:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func (p *printer) top() *frame {
+	if len(p.stack) == 0 {
+		return nil
+	}
+	return p.stack[len(p.stack)-1]
+}
+
+// query renvoie l'indicateur d'instruction SQL en cours du bloc courant
+func (p *printer) query() *bool {
+	if f := p.top(); f != nil {
+		return &f.query
+	}
+	return &p.sql
+}
+
+func (p *printer) close() {
+	f := p.top()
+	if f == nil {
+		return
+	}
+	p.stack = p.stack[:len(p.stack)-1]
+	if f.indent {
+		p.level--
+	}
+}
+
+// space indique s'il faut un blanc entre le jeton précédent et it, sur la même ligne
+func (p *printer) space(it, next *item) bool {
+	prev := p.prev
+	if it.typ == token.COMMENT || prev == nil || p.note {
+		return true
+	}
+	inBrackets := p.top() != nil && p.top().open == "["
+	switch it.typ {
+	case token.COMMA, token.SEMICOLON, token.RPAREN, token.RBRACKET, token.DOT:
+		return false
+	case token.COLON:
+		return false
+	case token.RBRACE:
+		return it.spaced
+	}
+	switch prev.typ {
+	case token.LPAREN, token.LBRACKET, token.DOT:
+		return false
+	case token.LBRACE:
+		return it.spaced
+	case token.COLON:
+		return !inBrackets
+	case token.LT, token.LAR:
+		if it.typ == token.MINUS && it.adjacent {
+			return false
+		}
+	}
+	if p.unary {
+		return false
+	}
+	switch it.typ {
+	case token.LBRACE:
+		// une accolade en fin de ligne ouvre un bloc; sinon ce peut être un littéral de structure
+		if next != nil && next.breaks > 0 {
+			return true
+		}
+		if operand(prev) || isWord(prev) {
+			return it.spaced
+		}
+	case token.LPAREN:
+		// appel de fonction, contrainte de type: on garde le choix de l'auteur
+		if operand(prev) || isWord(prev) {
+			return it.spaced
+		}
+	case token.LBRACKET:
+		if operand(prev) {
+			return false
+		}
+	}
+	return true
+}
+
+// operand indique un jeton qui termine une valeur: après lui, + et - sont binaires
+func operand(it *item) bool {
+	if it == nil {
+		return false
+	}
+	switch it.typ {
+	case token.IDENT, token.INT_LIT, token.FLOAT_LIT, token.DECIMAL_LIT, token.STRING_LIT, token.BOOL_LIT, token.NULL,
+		token.DATE_LIT, token.DATETIME_LIT, token.TIME_LIT, token.DURATION_LIT, token.RPAREN, token.RBRACKET, token.RBRACE:
+		return true
+	}
+	return false
+}
+
+func isWord(it *item) bool {
+	return it.text != "" && (it.text[0] == '_' || it.text[0] >= 'a' && it.text[0] <= 'z' || it.text[0] >= 'A' && it.text[0] <= 'Z')
+}
+
+// statement reconnaît les mots-clés qui commencent une instruction du langage
+func statement(it *item) bool {
+	switch it.typ {
+	case token.LET, token.RETURN, token.IF, token.FOR, token.SWITCH, token.CATCH, token.PROTECTED,
+		token.BREAK, token.CONTINUE, token.FUNCTION, token.TYPE, token.IMPORT:
+		return true
+	}
+	return false
+}
+
+// sqlStatement reconnaît les mots-clés qui commencent une instruction SQL
+func sqlStatement(it *item) bool {
+	switch it.typ {
+	case token.SELECT, token.INSERT, token.UPDATE, token.DELETE, token.CREATE, token.ALTER, token.DROP,
+		token.TRUNCATE, token.WITH:
+		return true
+	}
+	return false
+}
+
+// continues indique une ligne qui s'arrête au milieu d'une expression: virgule, opérateur ou mot-clé
+func continues(last *item) bool {
+	if last == nil || operand(last) {
+		return false
+	}
+	switch last.typ {
+	case token.SEMICOLON, token.LBRACE, token.LPAREN, token.LBRACKET, token.START:
+		return false
+	}
+	return true
+}
+
+// continuation reconnaît les lignes qui poursuivent une requête ou une condition
+func continuation(it *item) bool {
+	switch it.typ {
+	case token.FROM, token.WHERE, token.JOIN, token.ON, token.ORDER, token.GROUP, token.HAVING,
+		token.LIMIT, token.OFFSET, token.UNION, token.AND, token.OR, token.CONNECT, token.SET, token.VALUES,
+		token.ADD, token.MODIFY:
+		return true
+	case token.IDENT:
+		switch strings.ToLower(it.text) {
+		case "inner", "left", "right", "full", "cross", "outer":
+			return true
+		}
+	}
+	return false
+}
+
+// String assemble les lignes: champs de structure alignés, au plus une ligne vide, aucune en début
+// ou en fin de bloc
+func (p *printer) String() string {
+	align(p.lines)
+	var b strings.Builder
+	lines := make([]string, 0, len(p.lines))
+	for k, l := range p.lines {
+		if l.blank {
+			if len(lines) == 0 || lines[len(lines)-1] == "" || opens(lines[len(lines)-1]) ||
+				k+1 < len(p.lines) && closes(p.lines[k+1].text.String()) {
+				continue
+			}
+			lines = append(lines, "")
+			continue
+		}
+		text := strings.TrimRight(l.text.String(), " \t")
+		if text == "" {
+			continue
+		}
+		lines = append(lines, strings.Repeat(Indent, max(l.indent, 0))+text)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func opens(l string) bool {
+	l = strings.TrimSpace(l)
+	return strings.HasSuffix(l, "{") || strings.HasSuffix(l, "(") || strings.HasSuffix(l, "[") || l == "start"
+}
+
+func closes(l string) bool {
+	return strings.HasPrefix(l, "}") || strings.HasPrefix(l, ")") || strings.HasPrefix(l, "]") || l == "stop"
+}
+
+// align aligne le type des champs consécutifs d'une même structure
+func align(lines []*line) {
+	for k := 0; k < len(lines); {
+		if lines[k].field < 0 {
+			k++
+			continue
+		}
+		j, width := k, 0
+		for j < len(lines) && lines[j].field >= 0 && lines[j].block == lines[k].block {
+			width = max(width, lines[j].field)
+			j++
+		}
+		for _, l := range lines[k:j] {
+			text := l.text.String()
+			// le nom est suivi de ':' puis du type
+			name, rest := text[:l.field+1], strings.TrimLeft(text[l.field+1:], " ")
+			l.text.Reset()
+			l.text.WriteString(name + strings.Repeat(" ", width-l.field+1) + rest)
+		}
+		k = j
+	}
+}
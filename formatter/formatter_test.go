@@ -0,0 +1,207 @@
+package formatter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testCase struct {
+	name string
+	src  string
+	want string
+}
+
+var cases = []testCase{
+	{
+		name: "escapes and raw strings are kept",
+		src:  "action \"Strings\"()\nstart\n  let s = \"a\\\"b\\u{e9}\"+'\\n'\n      let r = `\n    (* pas un commentaire *)\n`\nreturn s+r\nstop",
+		want: "action \"Strings\"()\nstart\n\tlet s = \"a\\\"b\\u{e9}\" + '\\n'\n\tlet r = `\n    (* pas un commentaire *)\n`\n\treturn s + r\nstop\n",
+	},
+	{
+		name: "layout of action, start and stop",
+		src: `ACTION "Demo"( n : integer )
+START
+LET a=-1;let b = a+ -2
+RETURN a*b
+STOP`,
+		want: `action "Demo"(n: integer)
+start
+	let a = -1; let b = a + -2
+	return a * b
+stop
+`,
+	},
+	{
+		name: "comments are kept",
+		src: `action "Comments"()
+(* en-tête *)
+start
+    let a = 1 (* fin de ligne *)
+
+
+    (* avant le return *)
+  return a
+stop
+(* fin *)
+`,
+		want: `action "Comments"()
+(* en-tête *)
+start
+	let a = 1 (* fin de ligne *)
+
+	(* avant le return *)
+	return a
+stop
+(* fin *)
+`,
+	},
+	{
+		name: "struct fields are aligned",
+		src: `action "Struct"()
+TYPE Employe STRUCT {
+  id : integer(5)[1..99999],
+     date_embauche:date,
+  nom:string(50)
+}
+start
+	let e : Employe
+	return e
+stop
+`,
+		want: `action "Struct"()
+type Employe struct {
+	id:            integer(5)[1..99999],
+	date_embauche: date,
+	nom:           string(50)
+}
+start
+	let e: Employe
+	return e
+stop
+`,
+	},
+	{
+		name: "blocks, switch and function calls",
+		src: `action "Blocks"()
+FUNCTION double(x:integer):integer{
+return x*2
+}
+start
+let a = 1, b = 2
+  if a>b{
+  a=double(b)
+  } else {
+    b = 3
+  }
+  switch (a) {
+  case 1, 2:
+  b = 2
+  default:
+  b = 3
+  }
+  for let i = 0; i < 3; i = i + 1 {
+      a = a + i
+  }
+  return [a, b][0]
+stop
+`,
+		want: `action "Blocks"()
+function double(x: integer): integer {
+	return x * 2
+}
+start
+	let a = 1, b = 2
+	if a > b {
+		a = double(b)
+	} else {
+		b = 3
+	}
+	switch (a) {
+	case 1, 2:
+		b = 2
+	default:
+		b = 3
+	}
+	for let i = 0; i < 3; i = i + 1 {
+		a = a + i
+	}
+	return [a, b][0]
+stop
+`,
+	},
+	{
+		name: "SQL keywords and continuation lines",
+		src: `action "Query"()
+start
+  let r = SELECT
+  Emp.id,
+  Emp.nom
+  FROM Emp INNER JOIN Dept ON Emp.dept == Dept.id
+  WHERE Emp.id > 3 AND Emp.nom LIKE 'a%';
+  UPDATE Emp
+  SET salaire = salaire * 1.05
+  WHERE Emp.id == 1;
+  return r
+stop
+`,
+		want: `action "Query"()
+start
+	let r = select
+		Emp.id,
+		Emp.nom
+		from Emp inner join Dept on Emp.dept == Dept.id
+		where Emp.id > 3 and Emp.nom like 'a%';
+	update Emp
+		set salaire = salaire * 1.05
+		where Emp.id == 1;
+	return r
+stop
+`,
+	},
+}
+
+func TestFormat(t *testing.T) {
+	for _, c := range cases {
+		got, err := Format(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, c.want)
+		}
+	}
+}
+
+// Un source déjà formaté ne doit plus changer
+func TestIdempotence(t *testing.T) {
+	for _, c := range cases {
+		for _, src := range []string{c.src, c.want} {
+			once, err := Format(src)
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			twice, err := Format(once)
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+				continue
+			}
+			if once != twice {
+				t.Errorf("%s: not idempotent\n%s\n---\n%s", c.name, once, twice)
+			}
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	_, err := Format("action \"Broken\"()\nstart\n\tlet a = (1\nstop\n")
+	var se *SyntaxError
+	if !errors.As(err, &se) || len(se.Diagnostics) == 0 {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+	if !strings.Contains(se.Error(), "line:") {
+		t.Errorf("expected a position in %q", se.Error())
+	}
+}
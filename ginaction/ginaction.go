@@ -0,0 +1,80 @@
+// Package ginaction adapte le moteur d'actions aux requêtes gin: il construit, à partir de la
+// requête, le context.Context et l'utilisateur (object.Principal) attendus par action.NewAction.
+package ginaction
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/akristianlopez/action"
+	"github.com/akristianlopez/action/object"
+	"github.com/gin-gonic/gin"
+)
+
+// UserHeaderPrefix préfixe les en-têtes qui décrivent l'utilisateur (X-User-Id, X-User-Email...)
+const UserHeaderPrefix = "X-User-"
+
+type ginKey struct{}
+
+// Principal lit l'utilisateur dans les en-têtes X-User-* de la requête.
+// X-User-Roles donne ses rôles, séparés par des virgules, les autres en-têtes ses attributs
+func Principal(c *gin.Context) *object.Principal {
+	p := object.NewPrincipal()
+	if c == nil || c.Request == nil {
+		return p
+	}
+	for key, values := range c.Request.Header {
+		key = http.CanonicalHeaderKey(key)
+		if !strings.HasPrefix(key, UserHeaderPrefix) {
+			continue
+		}
+		if strings.EqualFold(key, UserHeaderPrefix+"Roles") {
+			for _, v := range values {
+				for _, role := range strings.Split(v, ",") {
+					if role = strings.TrimSpace(role); role != "" {
+						p.Roles = append(p.Roles, role)
+					}
+				}
+			}
+			continue
+		}
+		p.Set(strings.TrimPrefix(key, UserHeaderPrefix), values...)
+	}
+	return p
+}
+
+// Context renvoie le contexte de la requête, porteur de l'utilisateur et du contexte gin
+func Context(c *gin.Context) context.Context {
+	ctx := context.Background()
+	if c != nil && c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	ctx = context.WithValue(ctx, ginKey{}, c)
+	return object.WithPrincipal(ctx, Principal(c))
+}
+
+// Gin renvoie le contexte gin d'où provient ctx, pour les callbacks qui en ont besoin
+func Gin(ctx context.Context) (*gin.Context, bool) {
+	c, ok := ctx.Value(ginKey{}).(*gin.Context)
+	return c, ok && c != nil
+}
+
+// NewAction prépare l'exécution d'actions pour la requête c
+func NewAction(c *gin.Context, db *sql.DB, dbname string) *action.Action {
+	ctx := Context(c)
+	return action.NewAction(ctx, object.PrincipalFrom(ctx), db, dbname)
+}
+
+// Params lit le corps JSON de la requête c en paramètres typés de l'action src
+func Params(c *gin.Context, act *action.Action, src string) (map[string]object.Object, error) {
+	if c == nil || c.Request == nil || c.Request.Body == nil {
+		return act.DecodeParams(src, nil)
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, err
+	}
+	return act.DecodeParams(src, body)
+}
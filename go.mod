@@ -2,7 +2,12 @@ module github.com/akristianlopez/action
 
 go 1.25.5
 
-require github.com/gin-gonic/gin v1.11.0
+require (
+	github.com/gin-gonic/gin v1.11.0
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/shopspring/decimal v1.4.0
+	github.com/uniplaces/carbon v0.2.2
+)
 
 require (
 	github.com/bytedance/sonic v1.14.0 // indirect
@@ -26,7 +31,6 @@ require (
 	github.com/quic-go/quic-go v0.54.0 // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.3.0 // indirect
-	github.com/uniplaces/carbon v0.2.2 // indirect
 	go.uber.org/mock v0.5.0 // indirect
 	golang.org/x/arch v0.20.0 // indirect
 	golang.org/x/crypto v0.40.0 // indirect
@@ -1,11 +1,14 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/akristianlopez/action/diagnostic"
 	"github.com/akristianlopez/action/token"
 )
 
@@ -16,12 +19,49 @@ type Lexer struct {
 	ch           rune
 	line         int
 	column       int
+	cnt          *Lexer // position sauvegardée par SaveCnt
+	errors       []Error
+	warnings     []Error
 }
 
-var cnt *Lexer = nil
+// Error est une erreur lexicale (chaîne non terminée, séquence d'échappement invalide...)
+// ou un avertissement (séquence d'échappement inconnue)
+type Error struct {
+	Code    string // diagnostic.UnterminatedString, diagnostic.InvalidEscape, diagnostic.UnknownEscape
+	Message string
+	Line    int
+	Column  int
+}
+
+// Errors renvoie les erreurs lexicales rencontrées
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+// Warnings renvoie les avertissements lexicaux rencontrés
+func (l *Lexer) Warnings() []Error {
+	return l.warnings
+}
+
+func (l *Lexer) addError(code string, line, column int, format string, args ...any) {
+	l.errors = appendError(l.errors, Error{Code: code, Message: fmt.Sprintf(format, args...), Line: line, Column: column})
+}
+func (l *Lexer) addWarning(code string, line, column int, format string, args ...any) {
+	l.warnings = appendError(l.warnings, Error{Code: code, Message: fmt.Sprintf(format, args...), Line: line, Column: column})
+}
+
+// appendError ignore les doublons: le parser peut relire les mêmes jetons après RestoreCnt
+func appendError(list []Error, e Error) []Error {
+	for _, v := range list {
+		if v == e {
+			return list
+		}
+	}
+	return append(list, e)
+}
 
 func (l *Lexer) SaveCnt() {
-	cnt = &Lexer{
+	l.cnt = &Lexer{
 		position:     l.position,
 		readPosition: l.readPosition,
 		ch:           l.ch,
@@ -30,13 +70,13 @@ func (l *Lexer) SaveCnt() {
 	}
 }
 func (l *Lexer) RestoreCnt() {
-	if cnt != nil {
-		l.position = cnt.position
-		l.readPosition = cnt.readPosition
-		l.ch = cnt.ch
-		l.line = cnt.line
-		l.column = cnt.column
-		cnt = nil
+	if l.cnt != nil {
+		l.position = l.cnt.position
+		l.readPosition = l.cnt.readPosition
+		l.ch = l.cnt.ch
+		l.line = l.cnt.line
+		l.column = l.cnt.column
+		l.cnt = nil
 	}
 }
 
@@ -153,6 +193,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COLON, l.ch, l.line, l.column)
 	case '.':
 		tok = newToken(token.DOT, l.ch, l.line, l.column)
+	case '$':
+		tok = newToken(token.DOLLAR, l.ch, l.line, l.column)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch, l.line, l.column)
 	case ')':
@@ -175,6 +217,11 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = l.readString()
 		tok.Line = l.line
 		tok.Column = l.column
+	case '`':
+		tok.Type = token.STRING_LIT
+		tok.Literal = l.readRawString()
+		tok.Line = l.line
+		tok.Column = l.column
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -202,7 +249,7 @@ func (l *Lexer) NextToken() token.Token {
 }
 func (l *Lexer) isControlToken(t token.TokenType) bool {
 	switch t {
-	case token.TYPE, token.DATE, token.DURATION:
+	case token.TYPE, token.DATE, token.DURATION, token.JSON:
 		return true
 	default:
 		return false
@@ -250,7 +297,10 @@ func (l *Lexer) readDateTimeLiteral() token.Token {
 
 	literal := l.input[position:l.position]
 
-	// Déterminer si c'est une date ou un time
+	// Déterminer si c'est une date, un datetime ou un time
+	if isDateTimeLiteral(literal) {
+		return token.Token{Type: token.DATETIME_LIT, Literal: literal, Line: line, Column: column}
+	}
 	if isTimeLiteral(literal) {
 		return token.Token{Type: token.TIME_LIT, Literal: literal, Line: line, Column: column}
 	}
@@ -267,15 +317,26 @@ func isDateLiteral(literal string) bool {
 	dateStr := literal[1 : len(literal)-1] // enlever les #
 
 	_, err := time.Parse("2006-01-02", dateStr)
-	if err == nil {
-		return true
+	return err == nil
+}
+
+// isDateTimeLiteral reconnaît une date suivie d'une heure (séparées par un espace ou 'T'), avec
+// éventuellement des fractions de seconde, un décalage (Z, +02:00) et un nom de fuseau (Europe/Paris)
+func isDateTimeLiteral(literal string) bool {
+	if len(literal) < 4 {
+		return false
 	}
-	_, err = time.Parse("2006-01-02 15:04:05", dateStr)
-	if err == nil {
-		return true
+	value := literal[1 : len(literal)-1]
+	if k := strings.LastIndexByte(value, ' '); k > 0 && k+1 < len(value) && isLetter(rune(value[k+1])) {
+		value = value[:k]
 	}
-	_, err = time.Parse("2006-01-02 15:04", dateStr)
-	return err == nil
+	value = strings.Replace(value, " ", "T", 1)
+	for _, layout := range []string{"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00", "2006-01-02T15:04"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
 }
 
 func isTimeLiteral(literal string) bool {
@@ -318,6 +379,11 @@ func (l *Lexer) readNumber() token.Token {
 			l.readChar()
 		}
 	}
+	// suffixe m: décimal exact (19.99m)
+	if (l.ch == 'm' || l.ch == 'M') && !isLetter(l.peekChar()) && !isDigit(l.peekChar()) && l.peekChar() != '_' {
+		tokType = token.DECIMAL_LIT
+		l.readChar()
+	}
 
 	return token.Token{
 		Type:    tokType,
@@ -327,16 +393,94 @@ func (l *Lexer) readNumber() token.Token {
 	}
 }
 
+// readString lit une chaîne entre guillemets simples ou doubles et décode ses séquences d'échappement.
+// Elle ne peut pas contenir de fin de ligne: une chaîne non fermée s'arrête en fin de ligne. Un texte
+// sur plusieurs lignes s'écrit entre accents graves ou avec \n
 func (l *Lexer) readString() string {
-	position := l.position + 1
-	ch := l.ch
+	quote := l.ch
+	line, column := l.line, l.column
+	var b strings.Builder
 	for {
 		l.readChar()
-		if l.ch == ch || l.ch == 0 {
-			break
+		switch l.ch {
+		case quote:
+			return b.String()
+		case 0, '\n':
+			l.addError(diagnostic.UnterminatedString, line, column, "Unterminated string: a quoted string ends with its line, use `...` for text on several lines")
+			return b.String()
+		case '\\':
+			l.readEscape(&b)
+		default:
+			b.WriteRune(l.ch)
+		}
+	}
+}
+
+// readEscape décode la séquence qui suit la barre oblique inverse: \" \' \n \t \r \\ et \u{hex}
+func (l *Lexer) readEscape(b *strings.Builder) {
+	line, column := l.line, l.column
+	switch l.peekChar() {
+	case '"', '\'', '\\':
+		l.readChar()
+		b.WriteRune(l.ch)
+	case 'n':
+		l.readChar()
+		b.WriteRune('\n')
+	case 't':
+		l.readChar()
+		b.WriteRune('\t')
+	case 'r':
+		l.readChar()
+		b.WriteRune('\r')
+	case 'u':
+		l.readChar()
+		if l.peekChar() != '{' {
+			l.addError(diagnostic.InvalidEscape, line, column, "Invalid escape sequence '\\u': expected '{'")
+			b.WriteString("\\u")
+			return
+		}
+		l.readChar()
+		digits := ""
+		for isHexDigit(l.peekChar()) && len(digits) < 6 {
+			l.readChar()
+			digits += string(l.ch)
+		}
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if l.peekChar() != '}' || err != nil || code > unicode.MaxRune || code >= 0xD800 && code <= 0xDFFF {
+			l.addError(diagnostic.InvalidEscape, line, column, "Invalid escape sequence '\\u{%s': expected 1 to 6 hexadecimal digits of a code point and '}'", digits)
+			b.WriteString("\\u{" + digits)
+			return
+		}
+		l.readChar()
+		b.WriteRune(rune(code))
+	default:
+		// séquence inconnue: le texte est gardé tel qu'écrit, barre oblique comprise; la fin de ligne
+		// ou de fichier est traitée par readString
+		if c := l.peekChar(); c != 0 && c != '\n' {
+			l.addWarning(diagnostic.UnknownEscape, line, column, "Unknown escape sequence '\\%c' kept as written, write '\\\\%c' for a backslash", c, c)
+		}
+		b.WriteRune('\\')
+	}
+}
+
+// readRawString lit une chaîne entre accents graves: sans échappement, elle peut s'étendre sur plusieurs lignes
+func (l *Lexer) readRawString() string {
+	line, column := l.line, l.column
+	var b strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '`':
+			return b.String()
+		case 0:
+			l.addError(diagnostic.UnterminatedString, line, column, "Unterminated raw string")
+			return b.String()
+		case '\r':
+			// fins de ligne Windows: le contenu ne dépend pas de l'éditeur
+		default:
+			b.WriteRune(l.ch)
 		}
 	}
-	return l.input[position:l.position]
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -361,6 +505,10 @@ func isDigit(ch rune) bool {
 	return unicode.IsDigit(ch)
 }
 
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func newToken(tokenType token.TokenType, ch rune, line, column int) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch), Line: line, Column: column}
 }
@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+)
+
+// ConfigFile est le nom du fichier de configuration cherché à la racine de l'espace de travail
+const ConfigFile = ".action-lsp.json"
+
+// Config remplace, dans l'éditeur, la base de données et le canHandle du serveur d'applications.
+//
+//	{
+//	  "database": {"driver": "sqlite3", "dsn": "dev.db", "dialect": "sqlite"},
+//	  "canHandle": {
+//	    "default": true,
+//	    "rules": [{"table": "emp", "field": "salaire", "operation": "read", "allow": false, "message": "..."}]
+//	  }
+//	}
+type Config struct {
+	Database  Database `json:"database"`
+	CanHandle Access   `json:"canHandle"`
+}
+
+type Database struct {
+	Driver  string `json:"driver"`
+	DSN     string `json:"dsn"`
+	Dialect string `json:"dialect"`
+}
+
+// Access décrit les droits simulés: la première règle qui correspond décide, sinon Default
+type Access struct {
+	Default *bool  `json:"default"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Rule s'applique quand chacun de Table, Field et Operation est vide ou égal (sans tenir compte de la casse)
+type Rule struct {
+	Table     string `json:"table"`
+	Field     string `json:"field"`
+	Operation string `json:"operation"`
+	Allow     bool   `json:"allow"`
+	Message   string `json:"message"`
+}
+
+// LoadConfig lit le fichier path. Un fichier absent donne la configuration par défaut: pas de base, tout est permis
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	// un chemin sqlite relatif s'entend depuis le fichier de configuration
+	if cfg.Database.DSN != "" && cfg.dialect() == "sqlite" && !strings.Contains(cfg.Database.DSN, ":") &&
+		!filepath.IsAbs(cfg.Database.DSN) {
+		cfg.Database.DSN = filepath.Join(filepath.Dir(path), cfg.Database.DSN)
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) dialect() string {
+	switch d := strings.ToLower(cfg.Database.Dialect); d {
+	case "", "sqlite3":
+		return "sqlite"
+	default:
+		return d
+	}
+}
+
+// Driver renvoie le pilote database/sql, déduit du dialecte quand il n'est pas précisé
+func (cfg *Config) Driver() string {
+	if cfg.Database.Driver != "" {
+		return cfg.Database.Driver
+	}
+	switch d := cfg.dialect(); d {
+	case "sqlite":
+		return "sqlite3"
+	case "mariadb":
+		return "mysql"
+	default:
+		return d
+	}
+}
+
+// Open ouvre la base décrite par la configuration, nil quand aucune n'est décrite
+func (cfg *Config) Open() (*sql.DB, error) {
+	if cfg.Database.DSN == "" {
+		return nil, nil
+	}
+	db, err := sql.Open(cfg.Driver(), cfg.Database.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Allowed a la signature du canHandle attendu par l'analyse sémantique
+func (cfg *Config) Allowed(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+	for _, r := range cfg.CanHandle.Rules {
+		if matches(r.Table, table) && matches(r.Field, field) && matches(r.Operation, operation) {
+			if r.Allow || r.Message != "" {
+				return r.Allow, r.Message
+			}
+			return false, denied(table, field, operation)
+		}
+	}
+	if cfg.CanHandle.Default == nil || *cfg.CanHandle.Default {
+		return true, ""
+	}
+	return false, denied(table, field, operation)
+}
+
+func matches(pattern, value string) bool {
+	return pattern == "" || pattern == "*" || strings.EqualFold(pattern, value)
+}
+
+func denied(table, field, operation string) string {
+	if field == "" {
+		return fmt.Sprintf("Operation '%s' is not allowed on '%s'", operation, table)
+	}
+	return fmt.Sprintf("Operation '%s' is not allowed on '%s.%s'", operation, table, field)
+}
+
+// Aucun service externe n'est disponible dans l'éditeur
+func serviceExists(serviceName string) bool { return false }
+func signature(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error) {
+	return nil, nil, fmt.Errorf("service '%s' is not available", serviceName)
+}
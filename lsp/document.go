@@ -0,0 +1,291 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/optimizer"
+	"github.com/akristianlopez/action/parser"
+	"github.com/akristianlopez/action/semantic"
+)
+
+// document est un fichier ouvert dans l'éditeur
+type document struct {
+	uri   string
+	text  string
+	lines []string
+	// dernière analyse sans erreur de syntaxe: elle sert au survol, à la définition et à la complétion
+	// pendant que l'utilisateur tape du code incomplet
+	last *analysis
+}
+
+// analysis garde le texte analysé: les positions des références s'y rapportent
+type analysis struct {
+	lines    []string
+	analyzer *semantic.SemanticAnalyzer
+}
+
+func splitLines(text string) []string {
+	lines := strings.Split(text, "\n")
+	for k, l := range lines {
+		lines[k] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// analyze enchaîne parser, semantic et optimizer sur le texte du document et renvoie leurs diagnostics
+func (s *Server) analyze(doc *document) (diags []diagnostic.Diagnostic) {
+	defer func() {
+		if r := recover(); r != nil {
+			diags = append(diags, diagnostic.Diagnostic{Code: diagnostic.SemanticError, Severity: diagnostic.Error,
+				Source: diagnostic.Semantic, Message: fmt.Sprintf("Analysis interrupted: %v", r)})
+		}
+	}()
+	p := parser.New(lexer.New(doc.text))
+	act := p.ParseAction()
+	if len(p.Errors()) != 0 {
+		return p.Diagnostics()
+	}
+	diags = append(diags, p.Warnings()...)
+	sa := semantic.NewSemanticAnalyzer(s.ctx, s.db, s.cfg.Allowed, serviceExists, signature, false)
+	loader := moduleLoader(doc.uri)
+	sa.SetModuleLoader(loader)
+	if loader != nil {
+		sa.SetActionSource(semantic.ActionSource(loader))
+	}
+	doc.last = &analysis{lines: doc.lines, analyzer: sa}
+	sa.Analyze(act)
+	diags = append(diags, sa.Diagnostics...)
+	if len(sa.Errors) == 0 {
+		opt := optimizer.NewOptimizer()
+		opt.Optimize(act)
+		diags = append(diags, opt.Diagnostics...)
+	}
+	return diags
+}
+
+// moduleLoader lit les modules importés et les actions appelées par run dans le répertoire du
+// document, quand c'est un fichier local
+func moduleLoader(uri string) semantic.ModuleLoader {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return nil
+	}
+	return semantic.DirLoader(filepath.Dir(filepath.FromSlash(u.Path)))
+}
+
+// Le lexer place un jeton à la colonne (base 1) qui suit son dernier caractère; un jeton en fin de ligne
+// est placé en colonne 0 de la ligne suivante. end renvoie la fin (exclue, base 0) correspondante
+func end(lines []string, line, column int) (int, int) {
+	line--
+	if column == 0 && line > 0 {
+		line--
+		if line < len(lines) {
+			return line, len(lines[line])
+		}
+	}
+	return line, max(column-1, 0)
+}
+
+// rangeOf renvoie l'étendue du nom signalé par le lexer en (line, column)
+func rangeOf(lines []string, name string, line, column int) Range {
+	l, e := end(lines, line, column)
+	if l < 0 || l >= len(lines) {
+		return Range{}
+	}
+	text := strings.ToLower(lines[l])
+	name = strings.ToLower(name)
+	e = min(e, len(text))
+	start := e - len(name)
+	if start < 0 || text[start:e] != name {
+		// les littéraux ne tombent pas toujours juste: on prend l'occurrence la plus proche avant e
+		start = strings.LastIndex(text[:min(e+1, len(text))], name)
+		if start < 0 {
+			start = max(strings.Index(text, name), 0)
+		}
+	}
+	return Range{Start: Position{Line: l, Character: start}, End: Position{Line: l, Character: start + len(name)}}
+}
+
+// wordRange renvoie l'étendue du mot qui se termine en (line, column) au sens du lexer
+func wordRange(lines []string, line, column int) Range {
+	l, e := end(lines, line, column)
+	if l < 0 || l >= len(lines) {
+		return Range{}
+	}
+	e = min(e, len(lines[l]))
+	start := e
+	for start > 0 && isWordChar(lines[l][start-1]) {
+		start--
+	}
+	if start == e && e < len(lines[l]) {
+		e++
+	}
+	return Range{Start: Position{Line: l, Character: start}, End: Position{Line: l, Character: e}}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func contains(r Range, p Position) bool {
+	return r.Start.Line == p.Line && r.Start.Character <= p.Character && p.Character <= r.End.Character
+}
+
+// toProtocol convertit les diagnostics de l'analyse en diagnostics LSP
+func toProtocol(uri string, lines []string, diags []diagnostic.Diagnostic) []Diagnostic {
+	res := make([]Diagnostic, 0, len(diags))
+	for _, d := range diags {
+		if d.Message == "" {
+			continue
+		}
+		item := Diagnostic{
+			Range:    spanRange(lines, d.Span),
+			Severity: int(d.Severity),
+			Code:     d.Code,
+			Source:   "action " + d.Source,
+			Message:  d.Message,
+		}
+		for _, r := range d.Related {
+			item.RelatedInformation = append(item.RelatedInformation, relatedInformation{
+				Location: Location{URI: uri, Range: spanRange(lines, r.Span)},
+				Message:  r.Message,
+			})
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+func spanRange(lines []string, span diagnostic.Span) Range {
+	if span.Start.Line == 0 {
+		return Range{}
+	}
+	return wordRange(lines, span.Start.Line, span.Start.Column)
+}
+
+// referenceAt renvoie la référence qui couvre la position p
+func (a *analysis) referenceAt(p Position) (*semantic.Reference, Range) {
+	for k := range a.analyzer.References {
+		ref := &a.analyzer.References[k]
+		if r := rangeOf(a.lines, ref.Name, ref.Line, ref.Column); contains(r, p) {
+			return ref, r
+		}
+	}
+	return nil, Range{}
+}
+
+// symbol cherche un symbole par son nom dans tous les scopes, à partir du scope global
+func (a *analysis) symbol(name string) *semantic.Symbol {
+	var find func(scope *semantic.Scope) *semantic.Symbol
+	find = func(scope *semantic.Scope) *semantic.Symbol {
+		if scope == nil {
+			return nil
+		}
+		if sym, ok := scope.Symbols[strings.ToLower(name)]; ok {
+			return sym
+		}
+		for _, child := range scope.Children {
+			if sym := find(child); sym != nil {
+				return sym
+			}
+		}
+		return nil
+	}
+	return find(a.analyzer.GlobalScope)
+}
+
+// declared renvoie les symboles déclarés dans le source, sans doublon
+func (a *analysis) declared() []*semantic.Symbol {
+	seen := make(map[*semantic.Symbol]bool)
+	res := make([]*semantic.Symbol, 0)
+	for _, ref := range a.analyzer.References {
+		if ref.Symbol != nil && !seen[ref.Symbol] && ref.Symbol.Declaration() != nil {
+			seen[ref.Symbol] = true
+			res = append(res, ref.Symbol)
+		}
+	}
+	return res
+}
+
+// describe rédige le survol d'une référence
+func describe(ref *semantic.Reference) string {
+	if ref.Owner != nil {
+		return fmt.Sprintf("(field) %s.%s: %s", ref.Owner.Name, ref.Name, typeName(ref.Type))
+	}
+	return describeSymbol(ref.Symbol)
+}
+
+func describeSymbol(sym *semantic.Symbol) string {
+	switch sym.Type {
+	case semantic.FunctionSymbol:
+		return "function " + sym.Name + functionSignature(sym)
+	case semantic.StructSymbol:
+		return "struct " + sym.Name + fields(sym.DataType)
+	case semantic.DbObjectSymbol:
+		return "table " + sym.Name + fields(sym.DataType)
+	case semantic.ParameterSymbol:
+		return "(parameter) " + sym.Name + ": " + typeName(sym.DataType)
+	default:
+		return "let " + sym.Name + ": " + typeName(sym.DataType)
+	}
+}
+
+func typeName(ti *semantic.TypeInfo) string {
+	if ti == nil {
+		return "any"
+	}
+	if ti.IsArray && ti.ElementType == nil {
+		return "Array of any"
+	}
+	if ti.IsArray && len(ti.ElementType.Fields) > 0 && strings.Trim(ti.ElementType.Name, "0123456789") == "" {
+		// ligne de select: le type n'a pas de nom, on montre ses colonnes
+		return "Array of" + fields(ti.ElementType)
+	}
+	return ti.String()
+}
+
+// functionSignature rend "(p1: t1, p2: t2): retour" d'après le scope de la fonction
+func functionSignature(sym *semantic.Symbol) string {
+	params := make([]*semantic.Symbol, 0)
+	if sym.Scope != nil && sym.Index >= 0 && sym.Index < len(sym.Scope.Children) {
+		for _, p := range sym.Scope.Children[sym.Index].Symbols {
+			if p.Type == semantic.ParameterSymbol {
+				params = append(params, p)
+			}
+		}
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].NoOrder < params[j].NoOrder })
+	args := make([]string, 0, len(params))
+	for _, p := range params {
+		name := p.Name
+		if p.Optional {
+			name += "?"
+		}
+		args = append(args, name+": "+typeName(p.DataType))
+	}
+	return fmt.Sprintf("(%s): %s", strings.Join(args, ", "), typeName(sym.DataType))
+}
+
+func fields(ti *semantic.TypeInfo) string {
+	if ti == nil || len(ti.Fields) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(ti.Fields))
+	for name := range ti.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(" {")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n\t%s: %s", name, typeName(ti.Fields[name]))
+	}
+	b.WriteString("\n}")
+	return b.String()
+}
@@ -0,0 +1,339 @@
+// Package lsp est un serveur Language Server Protocol pour les fichiers d'action: diagnostics à chaque
+// modification, survol, aller à la définition et complétion. Il s'appuie sur lexer, parser et
+// semantic.SemanticAnalyzer; la base de données et canHandle viennent d'un fichier de configuration local.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/akristianlopez/action/object"
+	"github.com/akristianlopez/action/semantic"
+	"github.com/akristianlopez/action/token"
+)
+
+type Server struct {
+	ctx      context.Context
+	cfg      *Config
+	db       *sql.DB
+	docs     map[string]*document
+	builtins []*semantic.Symbol
+	out      io.Writer
+	mu       sync.Mutex // sérialise les écritures sur out
+	ready    bool
+	shutdown bool
+}
+
+// NewServer prépare un serveur; db peut être nil, les tables et colonnes sont alors inconnues
+func NewServer(ctx context.Context, cfg *Config, db *sql.DB) *Server {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	s := &Server{ctx: object.WithPrincipal(ctx, object.NewPrincipal()), cfg: cfg, db: db, docs: make(map[string]*document)}
+	// les fonctions prédéfinies sont celles d'un analyseur neuf
+	sa := semantic.NewSemanticAnalyzer(s.ctx, nil, cfg.Allowed, serviceExists, signature, false)
+	for _, sym := range sa.GlobalScope.Symbols {
+		if sym.Type == semantic.FunctionSymbol {
+			s.builtins = append(s.builtins, sym)
+		}
+	}
+	sort.Slice(s.builtins, func(i, j int) bool { return s.builtins[i].Name < s.builtins[j].Name })
+	return s
+}
+
+// Serve traite les messages lus sur r jusqu'à la notification exit ou la fin de r
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	in := bufio.NewReader(r)
+	for {
+		body, err := readMessage(in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: parseError, Message: err.Error()})
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+		result, rerr := s.handle(&req)
+		if req.ID != nil {
+			s.reply(req.ID, result, rerr)
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, err *responseError) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result, Error: err})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(msg any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeMessage(s.out, msg)
+}
+
+func (s *Server) handle(req *request) (any, *responseError) {
+	if !s.ready && req.Method != "initialize" {
+		if req.ID == nil {
+			return nil, nil
+		}
+		return nil, &responseError{Code: serverNotInitialized, Message: "server not initialized"}
+	}
+	if s.shutdown && req.ID != nil {
+		return nil, &responseError{Code: invalidRequest, Message: "server is shutting down"}
+	}
+	switch req.Method {
+	case "initialize":
+		s.ready = true
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // texte complet à chaque modification
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]any{"name": "action-lsp"},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, nil
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := json.Unmarshal(req.Params, &p); err != nil || len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, nil
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var p positionParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &responseError{Code: invalidParams, Message: err.Error()}
+		}
+		doc, ok := s.docs[p.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		switch req.Method {
+		case "textDocument/hover":
+			return s.hover(doc, p.Position), nil
+		case "textDocument/definition":
+			return s.definition(doc, p.Position), nil
+		default:
+			return s.completion(doc, p.Position), nil
+		}
+	default:
+		if req.ID == nil {
+			return nil, nil
+		}
+		return nil, &responseError{Code: methodNotFound, Message: fmt.Sprintf("method '%s' is not supported", req.Method)}
+	}
+}
+
+// update analyse le nouveau texte du document et publie ses diagnostics
+func (s *Server) update(uri, text string) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		doc = &document{uri: uri}
+		s.docs[uri] = doc
+	}
+	doc.text = text
+	doc.lines = splitLines(text)
+	diags := s.analyze(doc)
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: toProtocol(uri, doc.lines, diags)})
+}
+
+func (s *Server) hover(doc *document, p Position) *Hover {
+	if doc.last == nil {
+		return nil
+	}
+	ref, r := doc.last.referenceAt(p)
+	if ref == nil {
+		return nil
+	}
+	return &Hover{Contents: markupContent{Kind: "markdown", Value: "```action\n" + describe(ref) + "\n```"}, Range: &r}
+}
+
+// definition renvoie la déclaration du symbole let, function, struct ou paramètre sous le curseur
+func (s *Server) definition(doc *document, p Position) *Location {
+	if doc.last == nil {
+		return nil
+	}
+	ref, _ := doc.last.referenceAt(p)
+	if ref == nil || ref.Symbol == nil {
+		return nil
+	}
+	id := ref.Symbol.Declaration()
+	if id == nil {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: rangeOf(doc.last.lines, id.Value, id.Token.Line, id.Token.Column)}
+}
+
+// completion propose les champs après "nom.", sinon les mots-clés, les fonctions, les symboles déclarés et les tables
+func (s *Server) completion(doc *document, p Position) []CompletionItem {
+	line := ""
+	if p.Line >= 0 && p.Line < len(doc.lines) {
+		line = doc.lines[p.Line]
+		line = line[:min(max(p.Character, 0), len(line))]
+	}
+	prefix := trailingWord(line)
+	before := line[:len(line)-len(prefix)]
+	if strings.HasSuffix(before, ".") {
+		return filterPrefix(s.members(doc, trailingWord(strings.TrimSuffix(before, "."))), prefix)
+	}
+	items := make([]CompletionItem, 0)
+	for _, k := range token.Keywords() {
+		items = append(items, CompletionItem{Label: k, Kind: keywordItem})
+	}
+	for _, sym := range s.builtins {
+		items = append(items, CompletionItem{Label: sym.Name, Kind: functionItem, Detail: functionSignature(sym)})
+	}
+	if doc.last != nil {
+		for _, sym := range doc.last.declared() {
+			item := CompletionItem{Label: sym.Name, Kind: variableItem, Detail: describeSymbol(sym)}
+			switch sym.Type {
+			case semantic.FunctionSymbol:
+				item.Kind = functionItem
+			case semantic.StructSymbol:
+				item.Kind = structItem
+				item.Detail = "struct " + sym.Name
+			}
+			items = append(items, item)
+		}
+	}
+	for _, t := range s.tables() {
+		items = append(items, CompletionItem{Label: t, Kind: classItem, Detail: "table"})
+	}
+	return filterPrefix(items, prefix)
+}
+
+// members propose les champs d'une variable, d'une structure ou les colonnes d'une table
+func (s *Server) members(doc *document, owner string) []CompletionItem {
+	items := make([]CompletionItem, 0)
+	if owner == "" {
+		return items
+	}
+	if doc.last != nil {
+		if sym := doc.last.symbol(owner); sym != nil && sym.DataType != nil && len(sym.DataType.Fields) > 0 {
+			for name, ti := range sym.DataType.Fields {
+				items = append(items, CompletionItem{Label: name, Kind: fieldItem, Detail: typeName(ti)})
+			}
+			sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+			return items
+		}
+	}
+	for _, c := range s.columns(owner) {
+		items = append(items, CompletionItem{Label: c[0], Kind: fieldItem, Detail: c[1]})
+	}
+	return items
+}
+
+func trailingWord(line string) string {
+	k := len(line)
+	for k > 0 && isWordChar(line[k-1]) {
+		k--
+	}
+	return line[k:]
+}
+
+func filterPrefix(items []CompletionItem, prefix string) []CompletionItem {
+	if prefix == "" {
+		return items
+	}
+	prefix = strings.ToLower(prefix)
+	res := make([]CompletionItem, 0)
+	for _, it := range items {
+		if strings.HasPrefix(strings.ToLower(it.Label), prefix) {
+			res = append(res, it)
+		}
+	}
+	return res
+}
+
+// tables renvoie les tables et vues de la base que canHandle laisse lire
+func (s *Server) tables() []string {
+	if s.db == nil {
+		return nil
+	}
+	query := "SELECT table_name FROM information_schema.tables WHERE table_schema NOT IN ('information_schema', 'pg_catalog')"
+	if s.cfg.dialect() == "sqlite" {
+		query = "SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'"
+	}
+	rows, err := s.db.QueryContext(s.ctx, query)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	res := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) != nil {
+			continue
+		}
+		if ok, _ := s.cfg.Allowed(s.ctx, name, "", "read", false); ok {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// columns renvoie le nom et le type en base des colonnes lisibles de table
+func (s *Server) columns(table string) [][2]string {
+	if s.db == nil || trailingWord(table) != table {
+		return nil
+	}
+	if ok, _ := s.cfg.Allowed(s.ctx, table, "", "read", false); !ok {
+		return nil
+	}
+	rows, err := s.db.QueryContext(s.ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil
+	}
+	res := make([][2]string, 0, len(types))
+	for _, c := range types {
+		if ok, _ := s.cfg.Allowed(s.ctx, table, c.Name(), "read", false); ok {
+			res = append(res, [2]string{c.Name(), strings.ToLower(c.DatabaseTypeName())})
+		}
+	}
+	return res
+}
@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const source = `action "Lsp"()
+type Point struct {
+	x: integer,
+	y: integer
+}
+function double(n: integer): integer {
+	return n * 2
+}
+start
+	let p = Point{x: 1, y: 2}
+	let total = double(p.x)
+	let noms = select Emp.nom from Emp;
+	return total + y
+stop
+`
+
+// session rejoue une suite de messages et renvoie les réponses par id et les notifications
+func session(t *testing.T, db *sql.DB, cfg *Config, msgs ...map[string]any) (map[int]json.RawMessage, []json.RawMessage) {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range msgs {
+		m["jsonrpc"] = "2.0"
+		if err := writeMessage(&in, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := NewServer(context.Background(), cfg, db).Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[int]json.RawMessage)
+	notes := make([]json.RawMessage, 0)
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg struct {
+			ID     *int            `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Error != nil {
+			t.Fatalf("request %d: %s", *msg.ID, msg.Error.Message)
+		}
+		if msg.ID == nil {
+			notes = append(notes, msg.Params)
+			continue
+		}
+		results[*msg.ID] = msg.Result
+	}
+	return results, notes
+}
+
+func at(id int, method string, line, character int) map[string]any {
+	return map[string]any{"id": id, "method": method, "params": map[string]any{
+		"textDocument": map[string]any{"uri": "file:///lsp.act"},
+		"position":     map[string]any{"line": line, "character": character},
+	}}
+}
+
+func TestServer(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "lsp.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE Emp (id INTEGER PRIMARY KEY, nom TEXT, salaire REAL)"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{CanHandle: Access{Rules: []Rule{{Table: "emp", Field: "salaire", Allow: false}}}}
+	lines := strings.Split(source, "\n")
+	col := func(line int, s string) int { return strings.Index(lines[line], s) + 1 }
+
+	results, notes := session(t, db, cfg,
+		map[string]any{"id": 1, "method": "initialize", "params": map[string]any{}},
+		map[string]any{"method": "initialized", "params": map[string]any{}},
+		map[string]any{"method": "textDocument/didOpen", "params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///lsp.act", "version": 1, "text": source},
+		}},
+		at(2, "textDocument/hover", 10, col(10, "total")),
+		at(3, "textDocument/definition", 10, col(10, "double")),
+		at(4, "textDocument/hover", 11, col(11, ".nom")+1),
+		at(5, "textDocument/completion", 11, col(11, ".nom")),
+		at(6, "textDocument/completion", 12, 0),
+		map[string]any{"id": 7, "method": "shutdown"},
+		map[string]any{"method": "exit"},
+	)
+
+	// diagnostics: y n'est pas déclaré à la ligne 12
+	if len(notes) != 1 {
+		t.Fatalf("expected one publishDiagnostics, got %d", len(notes))
+	}
+	var published publishDiagnosticsParams
+	json.Unmarshal(notes[0], &published)
+	found := false
+	for _, d := range published.Diagnostics {
+		if d.Code == "S002" && d.Range.Start.Line == 12 && lines[12][d.Range.Start.Character:d.Range.End.Character] == "y" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected S002 on 'y' at line 12, got %+v", published.Diagnostics)
+	}
+
+	var hover Hover
+	json.Unmarshal(results[2], &hover)
+	if !strings.Contains(hover.Contents.Value, "let total: integer") {
+		t.Errorf("unexpected hover %q", hover.Contents.Value)
+	}
+	var loc Location
+	json.Unmarshal(results[3], &loc)
+	if loc.Range.Start != (Position{Line: 5, Character: strings.Index(lines[5], "double")}) {
+		t.Errorf("unexpected definition %+v", loc)
+	}
+	json.Unmarshal(results[4], &hover)
+	if !strings.Contains(hover.Contents.Value, "(field) Emp.nom: string") {
+		t.Errorf("unexpected hover %q", hover.Contents.Value)
+	}
+
+	labels := func(raw json.RawMessage) string {
+		var items []CompletionItem
+		json.Unmarshal(raw, &items)
+		res := make([]string, 0, len(items))
+		for _, it := range items {
+			res = append(res, it.Label)
+		}
+		return fmt.Sprint(res)
+	}
+	if got := labels(results[5]); got != "[id nom]" {
+		t.Errorf("expected the readable columns of Emp, got %s", got)
+	}
+	all := labels(results[6])
+	for _, want := range []string{"select", "length", "double", "total", "Point", "Emp"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("completion does not propose %s: %s", want, all)
+		}
+	}
+}
+
+func TestConfigAllowed(t *testing.T) {
+	deny := false
+	cfg := &Config{CanHandle: Access{Default: &deny, Rules: []Rule{
+		{Table: "emp", Operation: "read", Allow: true},
+		{Table: "emp", Field: "salaire", Allow: false, Message: "secret"},
+	}}}
+	if ok, _ := cfg.Allowed(context.Background(), "Emp", "nom", "read", false); !ok {
+		t.Error("expected emp to be readable")
+	}
+	if ok, msg := cfg.Allowed(context.Background(), "emp", "salaire", "update", false); ok || msg != "secret" {
+		t.Errorf("expected salaire to be denied, got %v %q", ok, msg)
+	}
+	if ok, msg := cfg.Allowed(context.Background(), "dept", "", "read", false); ok || msg == "" {
+		t.Errorf("expected the default to deny, got %v %q", ok, msg)
+	}
+}
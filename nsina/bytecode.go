@@ -0,0 +1,851 @@
+package nsina
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+	"github.com/akristianlopez/action/token"
+)
+
+// Bytecode: Compile traduit une action optimisée en instructions pour la machine virtuelle de vm.go.
+// Les variables de l'action, des fonctions et des blocs y occupent des cases numérotées au lieu
+// d'environnements chaînés. Ce qui n'a pas de traduction (SQL, foreach, catch, ...) reste confié à
+// Eval, dans une portée où sont déclarées les variables locales qu'il utilise. Une instruction ou une
+// fonction dont le résultat pourrait différer de celui d'Eval n'est pas traduite et reste à Eval
+
+// Backend désigne la façon d'exécuter une action
+type Backend int
+
+const (
+	TreeWalker Backend = iota // Eval parcourt l'arbre de l'action
+	Bytecode                  // Compile traduit l'action, Run l'exécute
+)
+
+type opcode byte
+
+const (
+	opConst       opcode = iota // k: empile la constante k
+	opTrue                      // empile un nouveau booléen vrai
+	opFalse                     // empile un nouveau booléen faux
+	opNull                      // empile un nouveau null
+	opNil                       // empile nil, la valeur d'un bloc vide
+	opDefault                   // t n: empile le paramètre n de l'action, ou la valeur par défaut du type t
+	opGetLocal                  // s: empile la case s
+	opGetEnv                    // n: empile la variable de l'identifiant n, lue dans l'environnement
+	opGetStruct                 // n: empile la variable à gauche du TypeMember n, lue dans l'environnement
+	opDeclare                   // s t: let: range le sommet, converti vers le type t, dans la case s
+	opSetLocal                  // s n: affecte le sommet à la case s de l'identifiant n
+	opSetEnv                    // n: affecte le sommet à la variable de l'identifiant n
+	opPrefix                    // o: applique l'opérateur préfixe o au sommet
+	opInfix                     // o: applique l'opérateur o aux deux valeurs du sommet
+	opIndex                     // élément d'un tableau, d'un ensemble, d'un dictionnaire ou d'une chaîne
+	opMember                    // n: champ du TypeMember n de la structure au sommet
+	opJump                      // a: saute en a
+	opJumpIfFalse               // a: dépile la condition, saute en a si elle est fausse
+	opIif                       // f a b: condition d'un iif, saute en a si elle est fausse; le repli f finit en b
+	opCallee                    // c: cherche la fonction de l'appel c
+	opCall                      // c: appelle la fonction avec les arguments du sommet
+	opEval                      // f: confie le repli f à Eval
+	opLast                      // dépile la valeur de l'instruction
+	opLastNull                  // la valeur de l'instruction est NULL
+	opReturn                    // dépile la valeur renvoyée
+)
+
+// noTarget: pas de boucle où reprendre après un break ou un continue
+const noTarget = 0xFFFF
+
+// Program est une action traduite par Compile. Run ne le modifie pas: un même programme
+// s'exécute plusieurs fois, y compris en parallèle
+type Program struct {
+	action     *ast.Action
+	slots      int                           // cases des variables de l'action, communes à ses instructions
+	statements []*unit                       // par instruction de l'action; nil: instruction évaluée par Eval
+	functions  map[*ast.BlockStatement]*unit // corps des fonctions traduites
+	failures   []*TranslationError
+}
+
+// TranslationError signale une instruction ou une fonction dont la traduction a échoué de façon
+// inattendue (arbre incomplet). Elle reste à Eval: le résultat est le même, mais ce n'est pas le
+// bytecode qui s'exécute
+type TranslationError struct {
+	Node   ast.Node // instruction ou fonction de l'action
+	Reason string
+}
+
+func (e *TranslationError) Error() string {
+	return "Bytecode translation failed: " + e.Reason
+}
+
+// Line et Column situent le nœud dans le source, 0 quand sa position est inconnue
+func (e *TranslationError) Line() int {
+	if n, ok := e.Node.(interface{ Line() int }); ok {
+		return n.Line()
+	}
+	return 0
+}
+func (e *TranslationError) Column() int {
+	if n, ok := e.Node.(interface{ Column() int }); ok {
+		return n.Column()
+	}
+	return 0
+}
+
+// unit est le bytecode d'une instruction de l'action ou du corps d'une fonction
+type unit struct {
+	code      []byte
+	consts    []object.Object
+	nodes     []ast.Node // identifiants et membres lus ou affectés
+	names     []string   // opérateurs et types
+	fallbacks []*fallback
+	calls     []*call
+	slots     int
+}
+
+// fallback est un nœud confié à Eval
+type fallback struct {
+	node      ast.Node
+	statement bool
+	global    bool    // instruction de l'action: Eval s'exécute dans son environnement
+	locals    []local // cases déclarées dans la portée d'Eval, puis relues
+	brk, cont int     // où reprendre quand une instruction renvoie break ou continue
+}
+
+type local struct {
+	name string
+	slot int
+}
+
+// call est l'appel d'une fonction déclarée par l'action
+type call struct {
+	node     *ast.ArrayFunctionCall
+	argc     int
+	fallback int // l'appel entier est confié à Eval quand le nom ne désigne pas une fonction
+	end      int // adresse qui suit l'appel
+}
+
+// Compiled renvoie le nombre d'instructions de l'action et de fonctions traduites en bytecode
+func (p *Program) Compiled() (statements, functions int) {
+	for _, u := range p.statements {
+		if u != nil {
+			statements++
+		}
+	}
+	return statements, len(p.functions)
+}
+
+// Failures renvoie les traductions qui ont échoué. Une instruction que Compile choisit de laisser à
+// Eval (SQL, catch...) n'en fait pas partie
+func (p *Program) Failures() []*TranslationError {
+	return p.failures
+}
+
+// Compile traduit program, déjà analysé et optimisé. Les variables de l'action occupent des cases
+// communes à toutes ses instructions; celles que lisent ses fonctions, les types, les imports et les
+// déclarations de fonctions restent à Eval. Le corps des fonctions et les autres instructions sont
+// traduits quand c'est possible
+func Compile(program *ast.Action) *Program {
+	if p, ok := compileAction(program, true); ok {
+		return p
+	}
+	// une instruction confiée à Eval ne peut recevoir les cases qu'elle lit: les variables de
+	// l'action restent dans l'environnement
+	p, _ := compileAction(program, false)
+	return p
+}
+
+// compileAction traduit program; avec slots, les variables de l'action sont rangées dans des cases.
+// ok est faux quand une instruction restée à Eval lit une de ces cases sans pouvoir la recevoir
+func compileAction(program *ast.Action, slots bool) (p *Program, ok bool) {
+	p = &Program{action: program, statements: make([]*unit, len(program.Statements)),
+		functions: make(map[*ast.BlockStatement]*unit)}
+	c := &compiler{functions: make(map[string]*ast.FunctionStatement), free: make(map[string]bool),
+		limited: make(map[string]bool)}
+	c.survey(program)
+	top, next := newScope(nil, 0), 0
+	for i, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.FunctionStatement:
+			if s.Body == nil {
+				continue
+			}
+			c.action = false
+			u, err := c.translate(s, newScope(nil, 0), 0, func() {
+				for _, param := range s.Parameters {
+					if param.Name == nil {
+						c.fail(s, "parameter without a name")
+						return
+					}
+					if _, exists := c.scope.names[strings.ToLower(param.Name.Value)]; exists {
+						c.failed = true
+						return
+					}
+					c.declare(param.Name.Value)
+				}
+				c.block(s.Body.Statements)
+			})
+			if err != nil {
+				p.failures = append(p.failures, err)
+			}
+			if u != nil {
+				p.functions[s.Body] = u
+			}
+		case *ast.StructStatement, *ast.ImportStatement:
+			// déclarations de types et de modules: Eval les range dans l'environnement de l'action
+		default:
+			switch stmt.(type) {
+			case *ast.LetStatement, *ast.BlockStatement:
+				if !slots {
+					continue
+				}
+			}
+			c.action = true
+			names := maps.Clone(top.names)
+			u, err := c.translate(s, top, next, func() { c.statement(s) })
+			if err != nil {
+				p.failures = append(p.failures, err)
+			}
+			if u == nil {
+				// les variables déclarées par une traduction abandonnée restent à Eval
+				top.names = names
+				if u, _ = c.translate(s, top, next, func() { c.fallback(s, true) }); u == nil {
+					return p, false
+				}
+			}
+			next = c.next
+			p.slots = max(p.slots, u.slots)
+			// une instruction entièrement confiée à Eval sans case à lui passer n'a pas besoin de bytecode
+			if len(u.fallbacks) == 1 && u.fallbacks[0].node == stmt && len(u.fallbacks[0].locals) == 0 {
+				u = nil
+			}
+			p.statements[i] = u
+		}
+	}
+	return p, true
+}
+
+type compiler struct {
+	u      *unit
+	scope  *scope
+	next   int // première case libre
+	loops  []*loop
+	failed bool
+	err    *TranslationError // arbre incomplet: la traduction a échoué de façon inattendue
+	action bool              // l'unité est une instruction de l'action, sa première portée celle de l'action
+
+	functions map[string]*ast.FunctionStatement
+	free      map[string]bool // noms lus par une fonction dans la portée de son appelant
+	limited   map[string]bool // variables et fonctions soumises à des contraintes
+}
+
+// scope est une portée de l'unité: ses variables et les noms cherchés plus loin avant d'y être déclarés
+type scope struct {
+	names  map[string]int
+	missed map[string]bool
+	outer  *scope
+	base   int
+}
+
+func newScope(outer *scope, base int) *scope {
+	return &scope{names: map[string]int{}, missed: map[string]bool{}, outer: outer, base: base}
+}
+
+type loop struct {
+	breaks, continues []int // sauts à diriger vers la fin ou la reprise de la boucle
+	fallbacks         []*fallback
+}
+
+// survey relève les fonctions de l'action, les noms qu'elles lisent hors de leurs paramètres et de
+// leurs variables, et les noms soumis à des contraintes. Une fonction déclarée s'exécute dans la
+// portée de son appelant: une variable locale qui porte un de ces noms doit rester dans un environnement
+func (c *compiler) survey(program *ast.Action) {
+	for _, stmt := range program.Statements {
+		fn, ok := stmt.(*ast.FunctionStatement)
+		if !ok || fn.Name == nil {
+			continue
+		}
+		c.functions[strings.ToLower(fn.Name.Value)] = fn
+		if fn.ReturnType != nil && fn.ReturnType.Constraints != nil {
+			c.limited[strings.ToLower(fn.Name.Value)] = true
+		}
+		bound := make(map[string]bool)
+		for _, param := range fn.Parameters {
+			bind(bound, param.Name)
+		}
+		inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.LetStatement:
+				bind(bound, n.Name)
+			case *ast.FunctionParameter:
+				bind(bound, n.Name)
+			case *ast.ForEachStatement:
+				bind(bound, n.Variable)
+				bind(bound, n.Value)
+			}
+			return true
+		})
+		for _, name := range identifiers(fn.Body) {
+			if !bound[name] {
+				c.free[name] = true
+			}
+		}
+	}
+	inspect(program, func(n ast.Node) bool {
+		if let, ok := n.(*ast.LetStatement); ok && let.Name != nil && let.Type != nil && let.Type.Constraints != nil {
+			c.limited[strings.ToLower(let.Name.Value)] = true
+		}
+		return true
+	})
+}
+
+// bind ajoute à bound le nom d'une variable déclarée
+func bind(bound map[string]bool, id *ast.Identifier) {
+	if id != nil {
+		bound[strings.ToLower(id.Value)] = true
+	}
+}
+
+// translate traduit l'unité de node dans la portée sc, dont next est la première case libre; nil
+// quand elle doit rester à Eval. L'erreur signale un arbre que le traducteur ne sait pas lire
+func (c *compiler) translate(node ast.Node, sc *scope, next int, body func()) (*unit, *TranslationError) {
+	c.u, c.scope, c.next, c.loops, c.failed, c.err = &unit{slots: next}, sc, next, nil, false, nil
+	body()
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.failed || len(c.u.code) >= noTarget {
+		return nil, nil
+	}
+	return c.u, nil
+}
+
+// fail abandonne la traduction d'un nœud incomplet de l'arbre
+func (c *compiler) fail(node ast.Node, format string, args ...any) {
+	c.failed = true
+	if c.err == nil {
+		c.err = &TranslationError{Node: node, Reason: fmt.Sprintf(format, args...)}
+	}
+}
+
+func (c *compiler) emit(op opcode, operands ...int) int {
+	pos := len(c.u.code)
+	c.u.code = append(c.u.code, byte(op))
+	for _, o := range operands {
+		if o < 0 || o > noTarget {
+			c.failed = true
+		}
+		c.u.code = binary.BigEndian.AppendUint16(c.u.code, uint16(o))
+	}
+	return pos
+}
+
+// patch dirige vers l'adresse courante l'opérande n de l'instruction en pos
+func (c *compiler) patch(pos, n int) {
+	c.patchTo(pos, n, len(c.u.code))
+}
+
+func (c *compiler) patchTo(pos, n, addr int) {
+	if addr >= noTarget {
+		c.failed = true
+		return
+	}
+	binary.BigEndian.PutUint16(c.u.code[pos+1+2*n:], uint16(addr))
+}
+
+func (c *compiler) constant(o object.Object) int {
+	c.u.consts = append(c.u.consts, o)
+	return len(c.u.consts) - 1
+}
+
+func (c *compiler) node(n ast.Node) int {
+	c.u.nodes = append(c.u.nodes, n)
+	return len(c.u.nodes) - 1
+}
+
+func (c *compiler) name(s string) int {
+	for k, name := range c.u.names {
+		if name == s {
+			return k
+		}
+	}
+	c.u.names = append(c.u.names, s)
+	return len(c.u.names) - 1
+}
+
+func (c *compiler) enterScope() {
+	c.scope = newScope(c.scope, c.next)
+}
+
+func (c *compiler) leaveScope() {
+	c.next = c.scope.base
+	c.scope = c.scope.outer
+}
+
+// resolve cherche la case d'une variable locale
+func (c *compiler) resolve(name string) (int, bool) {
+	name = strings.ToLower(name)
+	for s := c.scope; s != nil; s = s.outer {
+		if slot, ok := s.names[name]; ok {
+			return slot, true
+		}
+		s.missed[name] = true
+	}
+	return 0, false
+}
+
+// declare range une nouvelle variable locale dans une case
+func (c *compiler) declare(name string) int {
+	name = strings.ToLower(name)
+	// dans une boucle while, Eval lirait encore la variable du tour précédent
+	if c.free[name] || c.limited[name] || c.scope.missed[name] {
+		c.failed = true
+	}
+	if slot, exists := c.scope.names[name]; exists {
+		return slot
+	}
+	slot := c.next
+	c.next++
+	if c.next > c.u.slots {
+		c.u.slots = c.next
+	}
+	c.scope.names[name] = slot
+	return slot
+}
+
+func (c *compiler) block(statements []ast.Statement) {
+	if len(statements) == 0 {
+		c.emit(opNil)
+		c.emit(opLast)
+		return
+	}
+	for _, stmt := range statements {
+		c.statement(stmt)
+	}
+}
+
+func (c *compiler) scopedBlock(node ast.Node, block *ast.BlockStatement) {
+	if block == nil {
+		c.fail(node, "block expected")
+		return
+	}
+	c.enterScope()
+	c.block(block.Statements)
+	c.leaveScope()
+}
+
+func (c *compiler) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case nil:
+		c.emit(opNil)
+		c.emit(opLast)
+	case *ast.ExpressionStatement:
+		c.expression(s.Expression)
+		c.emit(opLast)
+	case *ast.LetStatement:
+		c.let(s)
+	case *ast.AssignmentStatement:
+		c.assignment(s, true)
+	case *ast.BlockStatement:
+		c.block(s.Statements)
+	case *ast.IfStatement:
+		c.expression(s.Condition)
+		jf := c.emit(opJumpIfFalse, 0)
+		c.scopedBlock(s, s.Then)
+		j := c.emit(opJump, 0)
+		c.patch(jf, 0)
+		if s.Else != nil {
+			c.scopedBlock(s, s.Else)
+		} else {
+			c.emit(opLastNull)
+		}
+		c.patch(j, 0)
+	case *ast.ForStatement:
+		c.enterScope()
+		if s.Init != nil {
+			c.statement(s.Init)
+		}
+		start := len(c.u.code)
+		jf := -1
+		if s.Condition != nil {
+			c.expression(s.Condition)
+			jf = c.emit(opJumpIfFalse, 0)
+		}
+		l := c.enterLoop()
+		c.scopedBlock(s, s.Body)
+		update := len(c.u.code)
+		if s.Update != nil {
+			c.statement(s.Update)
+		}
+		c.emit(opJump, start)
+		if jf >= 0 {
+			c.patch(jf, 0)
+		}
+		c.leaveLoop(l, len(c.u.code), update)
+		c.emit(opLastNull)
+		c.leaveScope()
+	case *ast.WhileStatement:
+		start := len(c.u.code)
+		c.expression(s.Condition)
+		jf := c.emit(opJumpIfFalse, 0)
+		l := c.enterLoop()
+		c.scopedBlock(s, s.Body)
+		c.emit(opJump, start)
+		c.patch(jf, 0)
+		c.leaveLoop(l, len(c.u.code), start)
+		c.emit(opLastNull)
+	case *ast.ReturnStatement:
+		c.expression(s.ReturnValue)
+		c.emit(opReturn)
+	case *ast.BreakStatement:
+		if len(c.loops) == 0 {
+			c.failed = true
+			return
+		}
+		l := c.loops[len(c.loops)-1]
+		l.breaks = append(l.breaks, c.emit(opJump, 0))
+	case *ast.ContinueStatement:
+		if len(c.loops) == 0 {
+			c.failed = true
+			return
+		}
+		l := c.loops[len(c.loops)-1]
+		l.continues = append(l.continues, c.emit(opJump, 0))
+	case *ast.FunctionStatement, *ast.StructStatement, *ast.ImportStatement, *ast.FallthroughStatement:
+		c.failed = true
+	default:
+		c.fallback(stmt, true)
+	}
+}
+
+func (c *compiler) enterLoop() *loop {
+	l := &loop{}
+	c.loops = append(c.loops, l)
+	return l
+}
+
+func (c *compiler) leaveLoop(l *loop, end, next int) {
+	c.loops = c.loops[:len(c.loops)-1]
+	for _, pos := range l.breaks {
+		c.patchTo(pos, 0, end)
+	}
+	for _, pos := range l.continues {
+		c.patchTo(pos, 0, next)
+	}
+	for _, f := range l.fallbacks {
+		f.brk, f.cont = end, next
+	}
+}
+
+// let range la variable dans une case quand sa valeur ne peut être un curseur et qu'elle
+// n'a pas de contraintes; sinon l'unité reste à Eval
+func (c *compiler) let(s *ast.LetStatement) {
+	if s.Name == nil {
+		c.fail(s, "let without a name")
+		return
+	}
+	typ := ""
+	if s.Type != nil {
+		typ = scalarType(s.Type)
+		if typ == "" {
+			c.failed = true
+			return
+		}
+	} else if !c.scalar(s.Value) {
+		c.failed = true
+		return
+	}
+	switch {
+	case s.Value != nil:
+		c.expression(s.Value)
+	case s.Type != nil:
+		c.emit(opDefault, c.name(s.Type.Type), c.name(s.Name.Value))
+	default:
+		c.emit(opConst, c.constant(object.NULL))
+	}
+	c.emit(opDeclare, c.declare(s.Name.Value), c.name(typ))
+	c.emit(opLast)
+}
+
+// scalarType renvoie le type simple, sans contraintes, d'une variable
+func scalarType(t *ast.TypeAnnotation) string {
+	if t.Constraints != nil || t.ArrayType != nil || t.SetType != nil || t.MapType != nil || t.FuncType != nil {
+		return ""
+	}
+	switch typ := strings.ToLower(t.Type); typ {
+	case "integer", "float", "decimal", "string", "boolean":
+		return typ
+	}
+	return ""
+}
+
+// scalar indique que la valeur d'une variable sans type déclaré ne peut être un curseur
+func (c *compiler) scalar(e ast.Expression) bool {
+	switch e := e.(type) {
+	case nil, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.DecimalLiteral, *ast.StringLiteral,
+		*ast.BooleanLiteral, *ast.NullLiteral, *ast.PrefixExpression, *ast.InfixExpression:
+		return true
+	case *ast.Identifier:
+		_, ok := c.resolve(e.Value)
+		return ok
+	case *ast.IifExpression:
+		return c.scalar(e.TrueExpr) && c.scalar(e.FalseExpr)
+	case *ast.ArrayFunctionCall:
+		fn := c.functions[strings.ToLower(e.Function.Value)]
+		return fn != nil && fn.ReturnType != nil && scalarType(fn.ReturnType) != ""
+	}
+	return false
+}
+
+func (c *compiler) assignment(s *ast.AssignmentStatement, statement bool) {
+	target, ok := s.Variable.(*ast.Identifier)
+	if !ok {
+		c.fallback(s, statement)
+		return
+	}
+	c.expression(s.Value)
+	if slot, ok := c.resolve(target.Value); ok {
+		c.emit(opSetLocal, slot, c.node(target))
+	} else {
+		c.emit(opSetEnv, c.node(target))
+	}
+	if statement {
+		c.emit(opLast)
+	}
+}
+
+func (c *compiler) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case nil:
+		c.emit(opNil)
+	case *ast.IntegerLiteral:
+		c.emit(opConst, c.constant(&object.Integer{Value: e.Value}))
+	case *ast.FloatLiteral:
+		c.emit(opConst, c.constant(&object.Float{Value: e.Value}))
+	case *ast.StringLiteral:
+		c.emit(opConst, c.constant(&object.String{Value: e.Value}))
+	case *ast.DecimalLiteral:
+		if d := evalDecimalLiteral(e); !isError(d) {
+			c.emit(opConst, c.constant(d))
+		} else {
+			c.fallback(e, false)
+		}
+	case *ast.BooleanLiteral:
+		if e.Value {
+			c.emit(opTrue)
+		} else {
+			c.emit(opFalse)
+		}
+	case *ast.NullLiteral:
+		c.emit(opNull)
+	case *ast.Identifier:
+		if slot, ok := c.resolve(e.Value); ok {
+			c.emit(opGetLocal, slot)
+		} else {
+			c.emit(opGetEnv, c.node(e))
+		}
+	case *ast.PrefixExpression:
+		c.expression(e.Right)
+		c.emit(opPrefix, c.name(e.Operator))
+	case *ast.InfixExpression:
+		if _, ok := e.Right.(*ast.SQLSelectStatement); ok {
+			c.fallback(e, false)
+			return
+		}
+		c.expression(e.Left)
+		c.expression(e.Right)
+		c.emit(opInfix, c.name(e.Operator))
+	case *ast.IifExpression:
+		c.expression(e.Condition)
+		jf := c.emit(opIif, c.addFallback(e, false), 0, 0)
+		c.expression(e.TrueExpr)
+		j := c.emit(opJump, 0)
+		c.patch(jf, 1)
+		c.expression(e.FalseExpr)
+		c.patch(j, 0)
+		c.patch(jf, 2)
+	case *ast.AssignmentStatement:
+		c.assignment(e, false)
+	case *ast.ArrayFunctionCall:
+		c.call(e)
+	case *ast.TypeMember:
+		left, ok := e.Left.(*ast.Identifier)
+		if !ok || e.Right == nil {
+			c.fallback(e, false)
+			return
+		}
+		n := c.node(e)
+		if slot, ok := c.resolve(left.Value); ok {
+			c.emit(opGetLocal, slot)
+		} else {
+			c.emit(opGetStruct, n)
+		}
+		c.emit(opMember, n)
+	case *ast.IndexExpression:
+		c.expression(e.Left)
+		c.expression(e.Index)
+		c.emit(opIndex)
+	case *ast.FunctionLiteral:
+		// la fonction garderait la portée de la traduction, pas celle d'Eval
+		c.failed = true
+	default:
+		c.fallback(e, false)
+	}
+}
+
+// call traduit l'appel d'une fonction déclarée par l'action; les autres appels sont confiés à Eval
+func (c *compiler) call(e *ast.ArrayFunctionCall) {
+	if e.Function == nil {
+		c.fail(e, "call without a function name")
+		return
+	}
+	if _, local := c.resolve(e.Function.Value); local || c.functions[strings.ToLower(e.Function.Value)] == nil {
+		c.fallback(e, false)
+		return
+	}
+	args := make([]ast.Expression, 0, len(e.Arguments)+1)
+	for _, arg := range append([]ast.Expression{e.Array}, e.Arguments...) {
+		if arg != nil {
+			args = append(args, arg)
+		}
+	}
+	site := &call{node: e, argc: len(args), fallback: c.addFallback(e, false)}
+	c.u.calls = append(c.u.calls, site)
+	k := len(c.u.calls) - 1
+	c.emit(opCallee, k)
+	for _, arg := range args {
+		c.expression(arg)
+	}
+	c.emit(opCall, k)
+	site.end = len(c.u.code)
+}
+
+// fallback confie node à Eval
+func (c *compiler) fallback(node ast.Node, statement bool) {
+	c.emit(opEval, c.addFallback(node, statement))
+}
+
+func (c *compiler) addFallback(node ast.Node, statement bool) int {
+	f := &fallback{node: node, statement: statement, global: statement && c.action && c.scope.outer == nil,
+		brk: noTarget, cont: noTarget}
+	for _, name := range identifiers(node) {
+		if slot, ok := c.resolve(name); ok {
+			f.locals = append(f.locals, local{name: name, slot: slot})
+		}
+	}
+	if len(f.locals) > 0 && !escapeFree(node, c.functions) {
+		c.failed = true
+	}
+	if statement && len(c.loops) > 0 {
+		l := c.loops[len(c.loops)-1]
+		l.fallbacks = append(l.fallbacks, f)
+	}
+	c.u.fallbacks = append(c.u.fallbacks, f)
+	return len(c.u.fallbacks) - 1
+}
+
+// escapeFree vérifie que les fonctions anonymes de node ne survivent pas à son évaluation: elles
+// garderaient la portée du repli, dont les variables ne suivent plus les cases. Seules celles
+// passées directement à map, filter, reduce, sort_by, any, all ou find sont acceptées
+func escapeFree(node ast.Node, functions map[string]*ast.FunctionStatement) bool {
+	passed := make(map[*ast.FunctionLiteral]bool)
+	ok := true
+	inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ArrayFunctionCall:
+			name := strings.ToLower(n.Function.Value)
+			if functions[name] != nil {
+				break
+			}
+			switch name {
+			case "map", "filter", "reduce", "sort_by", "any", "all", "find":
+				for _, arg := range n.Arguments {
+					if fn, isFn := arg.(*ast.FunctionLiteral); isFn {
+						passed[fn] = true
+					}
+				}
+			}
+		case *ast.FunctionLiteral:
+			if !passed[n] || (n.ReturnType != nil && n.ReturnType.FuncType != nil) {
+				ok = false
+				return false
+			}
+			inspect(n.Body, func(inner ast.Node) bool {
+				if _, isFn := inner.(*ast.FunctionLiteral); isFn {
+					ok = false
+				}
+				return ok
+			})
+		}
+		return ok
+	})
+	return ok
+}
+
+// identifiers renvoie les noms des identifiants de node, en minuscules
+func identifiers(node ast.Node) []string {
+	var names []string
+	seen := make(map[string]bool)
+	inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok {
+			name := strings.ToLower(id.Value)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		return true
+	})
+	return names
+}
+
+var (
+	nodeType   = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	actionType = reflect.TypeOf((*ast.Action)(nil))
+	tokenType  = reflect.TypeOf(token.Token{})
+)
+
+// inspect appelle fn pour chaque nœud de l'arbre de node, en profondeur; fn renvoie false pour ne
+// pas descendre dans les enfants. Le parcours passe par la réflexion pour n'oublier aucun type de
+// nœud: un identifiant manqué serait une variable locale absente de la portée d'Eval. Les actions
+// appelées par run et les modules importés ne sont pas parcourus
+func inspect(node ast.Node, fn func(ast.Node) bool) {
+	seen := make(map[uintptr]bool)
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Pointer:
+			if v.IsNil() || seen[v.Pointer()] || (v.Type() == actionType && len(seen) > 0) {
+				return
+			}
+			seen[v.Pointer()] = true
+			if v.Type().Implements(nodeType) && v.CanInterface() && !fn(v.Interface().(ast.Node)) {
+				return
+			}
+			walk(v.Elem())
+		case reflect.Struct:
+			if v.Type() == tokenType {
+				return
+			}
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i))
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Map:
+			for iter := v.MapRange(); iter.Next(); {
+				walk(iter.Value())
+			}
+		}
+	}
+	walk(reflect.ValueOf(node))
+}
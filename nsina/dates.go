@@ -0,0 +1,530 @@
+package nsina
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Fonctions de dates qui tiennent compte du fuseau et de la langue:
+//
+//	now(tz?)                         instant courant (datetime) dans le fuseau tz, UTC par défaut
+//	today(tz?)                       date du jour dans le fuseau tz
+//	convert_tz(d, from, to)          l'heure affichée par d, lue dans le fuseau from, convertie dans to
+//	format_date(d, pattern, locale?) d rendu selon pattern (yyyy-MM-dd HH:mm...), locale fr ou en
+//	parsedate(s, pattern?, locale?)  et de même parsetime, parsedatetime
+//
+// Lettres des motifs: yyyy yy, MMMM (mois en toutes lettres) MMM (abrégé) MM M, dd d,
+// EEEE (jour de la semaine) EEE, HH H (0-23), hh h (1-12), a (AM/PM), mm m, ss s, S (fraction de seconde),
+// XXX (Z ou +01:00), Z (+0100), z (abréviation du fuseau), VV (nom du fuseau). Le texte entre
+// apostrophes est recopié tel quel, '' donne une apostrophe.
+
+type dateNames struct {
+	months, shortMonths, days, shortDays []string
+}
+
+var locales = map[string]*dateNames{
+	"en": {
+		months: []string{"January", "February", "March", "April", "May", "June", "July", "August",
+			"September", "October", "November", "December"},
+		shortMonths: []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		days:        []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		shortDays:   []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	},
+	"fr": {
+		months: []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août",
+			"septembre", "octobre", "novembre", "décembre"},
+		shortMonths: []string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        []string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   []string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+}
+
+// locale renvoie les noms de la langue demandée: "fr", "fr-FR", "en_US"...; anglais par défaut
+func locale(name string) (*dateNames, error) {
+	lang := strings.ToLower(name)
+	if k := strings.IndexAny(lang, "-_"); k >= 0 {
+		lang = lang[:k]
+	}
+	if lang == "" {
+		lang = "en"
+	}
+	names, ok := locales[lang]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale '%s'", name)
+	}
+	return names, nil
+}
+
+// location renvoie le fuseau IANA name (Europe/Paris, UTC...)
+func location(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone '%s'", name)
+	}
+	return loc, nil
+}
+
+// patternItem est une lettre répétée du motif (field) ou du texte à recopier (text)
+type patternItem struct {
+	field string
+	text  string
+}
+
+func splitPattern(pattern string) ([]patternItem, error) {
+	items := make([]patternItem, 0)
+	runes := []rune(pattern)
+	for k := 0; k < len(runes); {
+		c := runes[k]
+		switch {
+		case c == '\'':
+			end := k + 1
+			var b strings.Builder
+			for ; end < len(runes); end++ {
+				if runes[end] == '\'' {
+					if end+1 < len(runes) && runes[end+1] == '\'' {
+						b.WriteRune('\'')
+						end++
+						continue
+					}
+					break
+				}
+				b.WriteRune(runes[end])
+			}
+			if end == k+1 && end < len(runes) {
+				b.WriteRune('\'') // ''
+			} else if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated quote in pattern '%s'", pattern)
+			}
+			items = append(items, patternItem{text: b.String()})
+			k = end + 1
+		case unicode.IsLetter(c):
+			end := k
+			for end < len(runes) && runes[end] == c {
+				end++
+			}
+			field := string(runes[k:end])
+			if !strings.ContainsRune("yMdEHhamsSXZzV", c) {
+				return nil, fmt.Errorf("unknown pattern letter '%c' in '%s'", c, pattern)
+			}
+			items = append(items, patternItem{field: field})
+			k = end
+		default:
+			items = append(items, patternItem{text: string(c)})
+			k++
+		}
+	}
+	return items, nil
+}
+
+// formatDate rend t selon pattern dans la langue names
+func formatDate(t time.Time, pattern string, names *dateNames) (string, error) {
+	items, err := splitPattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, it := range items {
+		if it.field == "" {
+			b.WriteString(it.text)
+			continue
+		}
+		n := len(it.field)
+		switch it.field[0] {
+		case 'y':
+			if n == 2 {
+				fmt.Fprintf(&b, "%02d", t.Year()%100)
+			} else {
+				fmt.Fprintf(&b, "%0*d", n, t.Year())
+			}
+		case 'M':
+			switch {
+			case n >= 4:
+				b.WriteString(names.months[t.Month()-1])
+			case n == 3:
+				b.WriteString(names.shortMonths[t.Month()-1])
+			default:
+				fmt.Fprintf(&b, "%0*d", n, int(t.Month()))
+			}
+		case 'd':
+			fmt.Fprintf(&b, "%0*d", n, t.Day())
+		case 'E':
+			if n >= 4 {
+				b.WriteString(names.days[t.Weekday()])
+			} else {
+				b.WriteString(names.shortDays[t.Weekday()])
+			}
+		case 'H':
+			fmt.Fprintf(&b, "%0*d", n, t.Hour())
+		case 'h':
+			h := t.Hour() % 12
+			if h == 0 {
+				h = 12
+			}
+			fmt.Fprintf(&b, "%0*d", n, h)
+		case 'a':
+			b.WriteString(t.Format("PM"))
+		case 'm':
+			fmt.Fprintf(&b, "%0*d", n, t.Minute())
+		case 's':
+			fmt.Fprintf(&b, "%0*d", n, t.Second())
+		case 'S':
+			b.WriteString(fmt.Sprintf("%09d", t.Nanosecond())[:min(n, 9)])
+		case 'X':
+			b.WriteString(t.Format("Z07:00"))
+		case 'Z':
+			b.WriteString(t.Format("-0700"))
+		case 'z':
+			b.WriteString(t.Format("MST"))
+		case 'V':
+			b.WriteString(t.Location().String())
+		}
+	}
+	return b.String(), nil
+}
+
+// parseDate lit s selon pattern; les noms de mois et de jours sont ceux de names ou, à défaut, de l'anglais.
+// Sans décalage dans s, l'heure est celle du fuseau loc
+func parseDate(s, pattern string, names *dateNames, loc *time.Location) (time.Time, error) {
+	items, err := splitPattern(pattern)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fail := func() (time.Time, error) {
+		return time.Time{}, fmt.Errorf("'%s' does not match the pattern '%s'", s, pattern)
+	}
+	year, month, day, hour, minute, second, nanos := 1, 1, 1, 0, 0, 0, 0
+	pm, hour12 := -1, false
+	rest := s
+	for k, it := range items {
+		if it.field == "" {
+			if !strings.HasPrefix(rest, it.text) {
+				return fail()
+			}
+			rest = rest[len(it.text):]
+			continue
+		}
+		n := len(it.field)
+		// un champ numérique suivi d'un autre champ numérique a une largeur fixe
+		width := 2
+		if k+1 < len(items) && items[k+1].field != "" {
+			width = n
+		}
+		switch it.field[0] {
+		case 'y':
+			w := 4
+			if n == 2 {
+				w = 2
+			}
+			v, ok := readNumber(&rest, w)
+			if !ok {
+				return fail()
+			}
+			if n == 2 {
+				v += 2000
+			}
+			year = v
+		case 'M':
+			if n >= 3 {
+				v, ok := readName(&rest, names, n == 3, true)
+				if !ok {
+					return fail()
+				}
+				month = v + 1
+				continue
+			}
+			v, ok := readNumber(&rest, width)
+			if !ok {
+				return fail()
+			}
+			month = v
+		case 'E':
+			if _, ok := readName(&rest, names, n < 4, false); !ok {
+				return fail()
+			}
+		case 'd', 'H', 'h', 'm', 's':
+			v, ok := readNumber(&rest, width)
+			if !ok {
+				return fail()
+			}
+			switch it.field[0] {
+			case 'd':
+				day = v
+			case 'H':
+				hour = v
+			case 'h':
+				hour, hour12 = v, true
+			case 'm':
+				minute = v
+			default:
+				second = v
+			}
+		case 'S':
+			digits := 0
+			for digits < len(rest) && digits < 9 && rest[digits] >= '0' && rest[digits] <= '9' {
+				digits++
+			}
+			if digits == 0 {
+				return fail()
+			}
+			fmt.Sscanf(rest[:digits]+strings.Repeat("0", 9-digits), "%d", &nanos)
+			rest = rest[digits:]
+		case 'a':
+			switch {
+			case len(rest) >= 2 && strings.EqualFold(rest[:2], "AM"):
+				pm = 0
+			case len(rest) >= 2 && strings.EqualFold(rest[:2], "PM"):
+				pm = 1
+			default:
+				return fail()
+			}
+			rest = rest[2:]
+		case 'X', 'Z':
+			if strings.HasPrefix(rest, "Z") {
+				loc, rest = time.UTC, rest[1:]
+				continue
+			}
+			found := false
+			for _, layout := range []string{"-07:00", "-0700"} {
+				if !found && len(rest) >= len(layout) {
+					if z, err := time.Parse(layout, rest[:len(layout)]); err == nil {
+						loc, rest, found = z.Location(), rest[len(layout):], true
+					}
+				}
+			}
+			if !found {
+				return fail()
+			}
+		case 'z', 'V':
+			end := 0
+			for end < len(rest) && (unicode.IsLetter(rune(rest[end])) || strings.ContainsRune("/_+-", rune(rest[end]))) {
+				end++
+			}
+			if it.field[0] == 'V' {
+				l, err := location(rest[:end])
+				if err != nil {
+					return time.Time{}, err
+				}
+				loc = l
+			}
+			rest = rest[end:]
+		}
+	}
+	if rest != "" {
+		return fail()
+	}
+	if hour12 {
+		if hour < 1 || hour > 12 {
+			return fail()
+		}
+		hour %= 12
+	}
+	if pm == 1 {
+		hour += 12
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, second, nanos, loc)
+	// time.Date normalise 31/02 en 03/03: on refuse les valeurs hors limites
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != minute || t.Second() != second {
+		return time.Time{}, fmt.Errorf("'%s' is not a valid date for the pattern '%s'", s, pattern)
+	}
+	return t, nil
+}
+
+// readNumber lit de 1 à width chiffres en tête de *s
+func readNumber(s *string, width int) (int, bool) {
+	k, v := 0, 0
+	for k < len(*s) && k < width && (*s)[k] >= '0' && (*s)[k] <= '9' {
+		v = v*10 + int((*s)[k]-'0')
+		k++
+	}
+	if k == 0 {
+		return 0, false
+	}
+	*s = (*s)[k:]
+	return v, true
+}
+
+// readName reconnaît en tête de *s un nom de mois (months) ou de jour, complet ou abrégé, sans tenir compte
+// de la casse; le nom le plus long l'emporte. Il renvoie son rang (0 pour janvier ou dimanche)
+func readName(s *string, names *dateNames, short, months bool) (int, bool) {
+	best, length := -1, 0
+	for _, set := range []*dateNames{names, locales["en"]} {
+		lists := [][]string{set.days, set.shortDays}
+		if months {
+			lists = [][]string{set.months, set.shortMonths}
+		}
+		if short {
+			lists[0], lists[1] = lists[1], lists[0]
+		}
+		for _, list := range lists {
+			for k, name := range list {
+				if name != "" && len(name) > length && len(*s) >= len(name) && strings.EqualFold((*s)[:len(name)], name) {
+					best, length = k, len(name)
+				}
+			}
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	*s = (*s)[length:]
+	return best, true
+}
+
+// dateArgs évalue les arguments d'un appel: le premier est node.Array, les suivants node.Arguments
+func dateArgs(node *ast.ArrayFunctionCall, env *object.Environment) ([]object.Object, object.Object) {
+	args := make([]object.Object, 0, len(node.Arguments)+1)
+	if node.Array != nil {
+		args = append(args, Eval(node.Array, env))
+	}
+	for _, arg := range node.Arguments {
+		args = append(args, Eval(arg, env))
+	}
+	for _, arg := range args {
+		if isError(arg) {
+			return nil, arg
+		}
+	}
+	return args, nil
+}
+
+// stringArg renvoie l'argument k s'il est une chaîne, def s'il est absent
+func stringArg(name string, args []object.Object, k int, def string) (string, *object.Error) {
+	if k >= len(args) {
+		return def, nil
+	}
+	s, ok := args[k].(*object.String)
+	if !ok {
+		return "", newError("%s: argument %d must be a string, got %s", name, k+1, args[k].Type())
+	}
+	return s.Value, nil
+}
+
+// timeArg renvoie l'instant porté par un datetime, une date ou un time
+func timeArg(name string, arg object.Object) (time.Time, *object.Error) {
+	switch v := arg.(type) {
+	case *object.DateTime:
+		return v.Value, nil
+	case *object.Date:
+		return v.Value, nil
+	case *object.Time:
+		return v.Value, nil
+	}
+	return time.Time{}, newError("%s: a date, time or datetime is expected, got %s", name, arg.Type())
+}
+
+func evalDateFunction(node *ast.ArrayFunctionCall, env *object.Environment) object.Object {
+	name := strings.ToLower(node.Function.Value)
+	args, errObj := dateArgs(node, env)
+	if errObj != nil {
+		return errObj
+	}
+	count := map[string][2]int{"now": {0, 1}, "today": {0, 1}, "convert_tz": {3, 3}, "format_date": {2, 3},
+		"parsedate": {1, 3}, "parsetime": {1, 3}, "parsedatetime": {1, 3}}[name]
+	if len(args) < count[0] || len(args) > count[1] {
+		return newError("%s expects %d to %d argument(s), got %d", node.Function.Value, count[0], count[1], len(args))
+	}
+	switch name {
+	case "now", "today":
+		tz, e := stringArg(name, args, 0, "UTC")
+		if e != nil {
+			return e
+		}
+		loc, err := location(tz)
+		if err != nil {
+			return newError("%s: %s", name, err.Error())
+		}
+		now := time.Now().In(loc)
+		if name == "today" {
+			return &object.Date{Value: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+		}
+		return &object.DateTime{Value: now}
+	case "convert_tz":
+		t, e := timeArg(name, args[0])
+		if e != nil {
+			return e
+		}
+		from, e := stringArg(name, args, 1, "")
+		if e != nil {
+			return e
+		}
+		to, e := stringArg(name, args, 2, "")
+		if e != nil {
+			return e
+		}
+		fromLoc, err := location(from)
+		if err != nil {
+			return newError("%s: %s", name, err.Error())
+		}
+		toLoc, err := location(to)
+		if err != nil {
+			return newError("%s: %s", name, err.Error())
+		}
+		wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), fromLoc)
+		return &object.DateTime{Value: wall.In(toLoc)}
+	case "format_date":
+		t, e := timeArg(name, args[0])
+		if e != nil {
+			return e
+		}
+		pattern, e := stringArg(name, args, 1, "")
+		if e != nil {
+			return e
+		}
+		lang, e := stringArg(name, args, 2, "en")
+		if e != nil {
+			return e
+		}
+		names, err := locale(lang)
+		if err != nil {
+			return newError("%s: %s", name, err.Error())
+		}
+		s, err := formatDate(t, pattern, names)
+		if err != nil {
+			return newError("%s: %s", name, err.Error())
+		}
+		return &object.String{Value: s}
+	default: // parsedate, parsetime, parsedatetime
+		s, e := stringArg(name, args, 0, "")
+		if e != nil {
+			return e
+		}
+		pattern, e := stringArg(name, args, 1, "")
+		if e != nil {
+			return e
+		}
+		lang, e := stringArg(name, args, 2, "en")
+		if e != nil {
+			return e
+		}
+		var t time.Time
+		var err error
+		switch {
+		case pattern != "":
+			var names *dateNames
+			if names, err = locale(lang); err == nil {
+				t, err = parseDate(s, pattern, names, time.UTC)
+			}
+		case name == "parsedatetime":
+			if t, err = object.ParseDateTime(s); err != nil {
+				t, err = toTime(s)
+			}
+		default:
+			t, err = toTime(s)
+		}
+		if err != nil {
+			return newError("%s: %s", name, err.Error())
+		}
+		switch name {
+		case "parsedate":
+			return &object.Date{Value: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+		case "parsetime":
+			return &object.Time{Value: t}
+		}
+		return &object.DateTime{Value: t}
+	}
+}
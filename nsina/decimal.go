@@ -0,0 +1,134 @@
+package nsina
+
+import (
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+	"github.com/shopspring/decimal"
+)
+
+// Décimaux exacts: un decimal combiné à un entier ou à un float reste un decimal.
+// La division garde decimal.DivisionPrecision chiffres après la virgule; l'affectation à une
+// variable decimal(p,s) arrondit ensuite à s chiffres
+
+func evalDecimalLiteral(node *ast.DecimalLiteral) object.Object {
+	d, err := decimal.NewFromString(node.Value)
+	if err != nil {
+		return newError("Invalid decimal %s. line:%d, column:%d", node.String(), node.Line(), node.Column())
+	}
+	return &object.Decimal{Value: d}
+}
+
+func evalDecimalInfixExpression(operator string, left, right object.Object) object.Object {
+	l, lok := object.ToDecimal(left)
+	r, rok := object.ToDecimal(right)
+	if !lok || !rok {
+		return newError("Type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	}
+	switch operator {
+	case "+":
+		return &object.Decimal{Value: l.Value.Add(r.Value)}
+	case "-":
+		return &object.Decimal{Value: l.Value.Sub(r.Value)}
+	case "*":
+		return &object.Decimal{Value: l.Value.Mul(r.Value)}
+	case "/":
+		if r.Value.IsZero() {
+			return newError("Division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Decimal{Value: l.Value.Div(r.Value)}
+	case "<":
+		return &object.Boolean{Value: l.Value.LessThan(r.Value)}
+	case "<=":
+		return &object.Boolean{Value: l.Value.LessThanOrEqual(r.Value)}
+	case ">":
+		return &object.Boolean{Value: l.Value.GreaterThan(r.Value)}
+	case ">=":
+		return &object.Boolean{Value: l.Value.GreaterThanOrEqual(r.Value)}
+	case "==":
+		return &object.Boolean{Value: l.Value.Equal(r.Value)}
+	case "!=":
+		return &object.Boolean{Value: !l.Value.Equal(r.Value)}
+	}
+	return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// isDecimalOperation indique une opération entre un decimal et un nombre
+func isDecimalOperation(left, right object.Object) bool {
+	if left.Type() != object.DECIMAL_OBJ && right.Type() != object.DECIMAL_OBJ {
+		return false
+	}
+	_, lok := object.ToDecimal(left)
+	_, rok := object.ToDecimal(right)
+	return lok && rok
+}
+
+// aggregateDecimal calcule sum, min ou max d'une liste de nombres dont au moins un est un decimal
+func aggregateDecimal(fn string, args []object.Object) object.Object {
+	var result decimal.Decimal
+	for k, arg := range args {
+		d, ok := object.ToDecimal(arg)
+		if !ok {
+			return newError("'%s' Invalid datatype for %s", arg.Inspect(), fn)
+		}
+		switch {
+		case k == 0:
+			result = d.Value
+		case fn == "sum":
+			result = result.Add(d.Value)
+		case fn == "min" && d.Value.LessThan(result):
+			result = d.Value
+		case fn == "max" && d.Value.GreaterThan(result):
+			result = d.Value
+		}
+	}
+	return &object.Decimal{Value: result}
+}
+
+// evalDecimalFunction évalue round(x, places?, mode?) et parsedecimal(s)
+func evalDecimalFunction(node *ast.ArrayFunctionCall, env *object.Environment) object.Object {
+	name := strings.ToLower(node.Function.Value)
+	args, errObj := dateArgs(node, env)
+	if errObj != nil {
+		return errObj
+	}
+	if name == "parsedecimal" {
+		if len(args) != 1 {
+			return newError("%s requires only one argument", node.Function.Value)
+		}
+		s, ok := args[0].(*object.String)
+		if !ok {
+			return newError("Invalid type for %s: %s", node.Function.Value, args[0].Type())
+		}
+		d, err := decimal.NewFromString(strings.TrimSpace(s.Value))
+		if err != nil {
+			return newError("Invalid decimal value: %s", s.Value)
+		}
+		return &object.Decimal{Value: d}
+	}
+	if len(args) < 1 || len(args) > 3 {
+		return newError("%s expects 1 to 3 argument(s), got %d", node.Function.Value, len(args))
+	}
+	d, ok := object.ToDecimal(args[0])
+	if !ok {
+		return newError("Invalid type for %s: %s", node.Function.Value, args[0].Type())
+	}
+	places := int64(0)
+	if len(args) > 1 {
+		p, ok := args[1].(*object.Integer)
+		if !ok {
+			return newError("%s: the number of decimal places must be an integer, got %s", node.Function.Value, args[1].Type())
+		}
+		places = p.Value
+	}
+	mode, e := stringArg(name, args, 2, "half_up")
+	if e != nil {
+		return e
+	}
+	v, err := object.RoundDecimal(d.Value, int32(places), mode)
+	if err != nil {
+		return newError("%s: %s", node.Function.Value, err.Error())
+	}
+	return &object.Decimal{Value: v}
+}
@@ -0,0 +1,116 @@
+package nsina
+
+import (
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Valeurs json: parsejson rend des dictionnaires, des tableaux et des valeurs simples, parcourus
+// ensuite par j.$.items[0].price. Une étape absente du chemin donne null, comme un dictionnaire
+
+func evalJSONPath(node *ast.JSONPathExpression, env *object.Environment) object.Object {
+	cur := Eval(node.Left, env)
+	if isError(cur) {
+		return cur
+	}
+	for _, step := range node.Steps {
+		if res, ok := cur.(*object.SQLResult); ok && res.IsCursor() {
+			cur = readRows(res, "")
+			if isError(cur) {
+				return cur
+			}
+		}
+		var key object.Object = &object.String{Value: step.Key}
+		if step.Index != nil {
+			key = Eval(step.Index, env)
+			if isError(key) {
+				return key
+			}
+		}
+		cur = jsonStep(cur, key)
+		if cur == object.NULL {
+			return cur
+		}
+	}
+	return cur
+}
+
+// jsonStep renvoie l'élément key de cur: champ d'un dictionnaire ou d'une structure, élément d'un tableau
+func jsonStep(cur, key object.Object) object.Object {
+	switch c := cur.(type) {
+	case *object.Map:
+		if val, ok := c.Get(coerceNumber(c.KeyType, key)); ok {
+			return val
+		}
+	case *object.Struct:
+		name, ok := key.(*object.String)
+		if !ok {
+			break
+		}
+		if val, ok := c.Fields[name.Value]; ok {
+			return val
+		}
+		for field, val := range c.Fields {
+			if strings.EqualFold(field, name.Value) {
+				return val
+			}
+		}
+	case *object.Array:
+		i, ok := key.(*object.Integer)
+		if !ok {
+			break
+		}
+		idx := i.Value
+		if idx < 0 {
+			idx += int64(len(c.Elements))
+		}
+		if idx >= 0 && idx < int64(len(c.Elements)) {
+			return c.Elements[idx]
+		}
+	}
+	return object.NULL
+}
+
+// evalJSONFunction évalue parsejson(s) et tojson(x)
+func evalJSONFunction(node *ast.ArrayFunctionCall, env *object.Environment) object.Object {
+	args, errObj := dateArgs(node, env)
+	if errObj != nil {
+		return errObj
+	}
+	if len(args) != 1 {
+		return newError("%s requires only one argument", node.Function.Value)
+	}
+	if strings.EqualFold(node.Function.Value, "parsejson") {
+		s, ok := args[0].(*object.String)
+		if !ok {
+			return newError("Invalid type for %s: %s", node.Function.Value, args[0].Type())
+		}
+		val, err := object.DecodeJSON([]byte(s.Value))
+		if err != nil {
+			return newError("Invalid json value: %s", err.Error())
+		}
+		return val
+	}
+	val := args[0]
+	if res, ok := val.(*object.SQLResult); ok && res.IsCursor() {
+		val = readRows(res, "")
+		if isError(val) {
+			return val
+		}
+	}
+	data, err := object.EncodeJSON(val)
+	if err != nil {
+		return newError("%s: %s", node.Function.Value, err.Error())
+	}
+	return &object.String{Value: string(data)}
+}
+
+// jsonColumn lit la valeur d'une colonne json ou jsonb; un texte invalide reste une chaîne
+func jsonColumn(s string) object.Object {
+	if val, err := object.DecodeJSON([]byte(s)); err == nil {
+		return val
+	}
+	return &object.String{Value: s}
+}
@@ -0,0 +1,179 @@
+package nsina
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Fonctions anonymes: function(x: integer): boolean { ... } garde dans Env la portée où elle a été
+// créée; map, filter, reduce, sort_by, any, all et find l'appliquent aux éléments d'un tableau
+
+// applyFunction appelle fn avec des arguments déjà évalués. Une fonction anonyme s'exécute dans
+// la portée où elle a été créée, une fonction déclarée dans celle de l'appelant
+func applyFunction(name string, fn *object.Function, args []object.Object, env *object.Environment) object.Object {
+	leave, errObj := enterCall(name, fn, args)
+	if errObj != nil {
+		return errObj
+	}
+	defer leave()
+	outer := env
+	if fn.Env != nil {
+		outer = fn.Env
+	}
+	callEnv := object.NewEnclosedEnvironment(outer)
+	for k, param := range fn.Parameters {
+		callEnv.Declare(param.Name.Value, args[k])
+	}
+	val := Eval(fn.Body, callEnv)
+	endScope(callEnv, val)
+	if val == nil {
+		return nil
+	}
+	if val, ok := val.(*object.ReturnValue); ok {
+		return val.Value
+	}
+	return val
+}
+
+// enterCall vérifie le nombre d'arguments et la limite d'appels récursifs de fn, partagés par
+// applyFunction et la machine virtuelle; leave libère l'appel à son retour
+func enterCall(name string, fn *object.Function, args []object.Object) (leave func(), errObj object.Object) {
+	if fn.Maxcall == 0 {
+		return nil, newError("Nsina: %s", "Maximum recursive call limit reached for function "+name)
+	}
+	if len(args) != len(fn.Parameters) {
+		return nil, newError("Nsina: %s expects %d argument(s), got %d", name, len(fn.Parameters), len(args))
+	}
+	if fn.Maxcall > 0 {
+		fn.Maxcall = fn.Maxcall - 1
+	}
+	return func() {
+		if fn.Maxcall >= 0 {
+			fn.Maxcall = fn.Maxcall + 1
+		}
+	}, nil
+}
+
+// evalLambdaFunction évalue map, filter, reduce(tableau, fonction, initial), sort_by, any, all et find
+func evalLambdaFunction(node *ast.ArrayFunctionCall, env *object.Environment) object.Object {
+	name := strings.ToLower(node.Function.Value)
+	args, errObj := dateArgs(node, env)
+	if errObj != nil {
+		return errObj
+	}
+	if (name == "reduce" && len(args) != 3) || (name != "reduce" && len(args) != 2) {
+		return newError("Nsina: %s requires an array and a function", name)
+	}
+	if res, ok := args[0].(*object.SQLResult); ok && res.IsCursor() {
+		args[0] = readRows(res, "")
+		if isError(args[0]) {
+			return args[0]
+		}
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("Nsina: %s expects an array, got '%s'", name, node.Array.String())
+	}
+	fn, ok := args[1].(*object.Function)
+	if !ok {
+		return newError("Nsina: %s expects a function, got '%s'", name, node.Arguments[0].String())
+	}
+
+	switch name {
+	case "map":
+		result := &object.Array{Elements: make([]object.Object, 0, len(arr.Elements))}
+		for _, e := range arr.Elements {
+			val := applyFunction(name, fn, []object.Object{e}, env)
+			if isError(val) {
+				return val
+			}
+			if val == nil {
+				val = object.NULL
+			}
+			result.Elements = append(result.Elements, val)
+		}
+		return result
+	case "reduce":
+		acc := args[2]
+		for _, e := range arr.Elements {
+			acc = applyFunction(name, fn, []object.Object{acc, e}, env)
+			if isError(acc) {
+				return acc
+			}
+			if acc == nil {
+				acc = object.NULL
+			}
+		}
+		return acc
+	case "sort_by":
+		keys := make([]object.Object, len(arr.Elements))
+		for i, e := range arr.Elements {
+			keys[i] = applyFunction(name, fn, []object.Object{e}, env)
+			if isError(keys[i]) {
+				return keys[i]
+			}
+		}
+		idx := make([]int, len(arr.Elements))
+		for i := range idx {
+			idx[i] = i
+		}
+		var errCmp object.Object
+		sort.SliceStable(idx, func(i, j int) bool {
+			if errCmp != nil {
+				return false
+			}
+			less := evalInfixExpression("<", keys[idx[i]], keys[idx[j]], env)
+			if b, ok := less.(*object.Boolean); ok {
+				return b.Value
+			}
+			errCmp = less
+			return false
+		})
+		if errCmp != nil {
+			if isError(errCmp) {
+				return errCmp
+			}
+			return newError("Nsina: sort_by cannot compare the values returned by the function")
+		}
+		result := &object.Array{Elements: make([]object.Object, 0, len(idx)), ElementType: arr.ElementType}
+		for _, i := range idx {
+			result.Elements = append(result.Elements, arr.Elements[i])
+		}
+		return result
+	}
+
+	// filter, any, all et find: la fonction est un prédicat
+	result := &object.Array{Elements: []object.Object{}, ElementType: arr.ElementType}
+	for _, e := range arr.Elements {
+		val := applyFunction(name, fn, []object.Object{e}, env)
+		if isError(val) {
+			return val
+		}
+		b, ok := val.(*object.Boolean)
+		if !ok {
+			return newError("Nsina: the function passed to %s must return a boolean", name)
+		}
+		switch {
+		case name == "any" && b.Value:
+			return object.TRUE
+		case name == "all" && !b.Value:
+			return object.FALSE
+		case name == "find" && b.Value:
+			return e
+		case name == "filter" && b.Value:
+			result.Elements = append(result.Elements, e)
+		}
+	}
+	switch name {
+	case "any":
+		return object.FALSE
+	case "all":
+		return object.TRUE
+	case "find":
+		return object.NULL
+	}
+	return result
+}
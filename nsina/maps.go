@@ -0,0 +1,126 @@
+package nsina
+
+import (
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Dictionnaires: map of K to V. Les clés gardent leur ordre d'insertion, ce qui rend
+// keys(), values() et for let k, v of m déterministes
+
+func evalMapLiteral(node *ast.MapLiteral, env *object.Environment) object.Object {
+	m := object.NewMap("", "")
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+		value := Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+		if !m.Put(key, value) {
+			return newError("Invalid map key type %s. line:%d, column:%d", key.Type(), pair.Key.Line(), pair.Key.Column())
+		}
+	}
+	return m
+}
+
+// typeMap fixe le type des clés et des valeurs d'un dictionnaire et convertit les nombres déjà présents
+func typeMap(m *object.Map, mt *ast.MapType) {
+	if mt == nil || mt.Key == nil || mt.Value == nil {
+		return
+	}
+	m.KeyType = strings.ToLower(mt.Key.Type)
+	m.ValueType = strings.ToLower(mt.Value.Type)
+	for _, pair := range m.Entries() {
+		pair.Value = coerceNumber(m.ValueType, pair.Value)
+	}
+}
+
+func evalMapIndexExpression(m *object.Map, index object.Object) object.Object {
+	if val, ok := m.Get(coerceNumber(m.KeyType, index)); ok {
+		return val
+	}
+	return object.NULL
+}
+
+// assignMapElement réalise m[key] = value
+func assignMapElement(m *object.Map, key, value object.Object, target *ast.IndexExpression) object.Object {
+	value = coerceNumber(m.ValueType, value)
+	if !m.Put(coerceNumber(m.KeyType, key), value) {
+		return newError("Invalid map key type %s. line:%d, column:%d", key.Type(), target.Index.Line(), target.Index.Column())
+	}
+	return value
+}
+
+// evalMapFunction évalue keys(m), values(m), has_key(m, k) et delete(m, k)
+func evalMapFunction(node *ast.ArrayFunctionCall, env *object.Environment) object.Object {
+	name := strings.ToLower(node.Function.Value)
+	args, errObj := dateArgs(node, env)
+	if errObj != nil {
+		return errObj
+	}
+	if len(args) == 0 {
+		return newError("%s requires a map argument", node.Function.Value)
+	}
+	m, ok := args[0].(*object.Map)
+	if !ok {
+		return newError("%s expects a map, got %s", node.Function.Value, args[0].Type())
+	}
+	switch name {
+	case "keys", "values":
+		if len(args) != 1 {
+			return newError("%s requires only one argument", node.Function.Value)
+		}
+		res := &object.Array{Elements: []object.Object{}, ElementType: m.KeyType}
+		if name == "values" {
+			res.ElementType = m.ValueType
+		}
+		for _, pair := range m.Entries() {
+			if name == "keys" {
+				res.Elements = append(res.Elements, pair.Key)
+				continue
+			}
+			res.Elements = append(res.Elements, pair.Value)
+		}
+		return res
+	}
+	if len(args) != 2 {
+		return newError("%s requires two arguments", node.Function.Value)
+	}
+	key := coerceNumber(m.KeyType, args[1])
+	if name == "has_key" {
+		_, found := m.Get(key)
+		return &object.Boolean{Value: found}
+	}
+	return &object.Boolean{Value: m.Delete(key)}
+}
+
+// evalMapForEach exécute for let k of m et for let k, v of m
+func evalMapForEach(node *ast.ForEachStatement, m *object.Map, env *object.Environment) object.Object {
+	for _, pair := range m.Entries() {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Declare(node.Variable.Value, pair.Key)
+		if node.Value != nil {
+			loopEnv.Declare(node.Value.Value, pair.Value)
+		}
+		result := evalForBody(node.Body, loopEnv)
+		endScope(loopEnv, result)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.BREAK_OBJ {
+				return object.NULL
+			}
+			if rt == object.CONTINUE_OBJ {
+				continue
+			}
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	return object.NULL
+}
@@ -0,0 +1,46 @@
+package nsina
+
+import (
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Modules: import "lib/finance" as fin exécute les déclarations du module, chargé lors de l'analyse
+// sémantique, dans une portée à part; fin.f(...) appelle ensuite une fonction de cette portée
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if node.Module == nil {
+		return newError("Nsina: the module '%s' has not been loaded. line:%d, column:%d", node.Path,
+			node.Line(), node.Column())
+	}
+	modEnv := object.NewModuleEnvironment(env)
+	for _, stmt := range node.Module.Statements {
+		if res := Eval(stmt, modEnv); isError(res) {
+			return res
+		}
+	}
+	return env.Declare(node.Alias.Value, &object.Module{Name: node.Module.ActionName, Env: modEnv})
+}
+
+// evalModuleCall appelle la fonction d'un module; les arguments sont évalués dans la portée de l'appelant
+func evalModuleCall(node *ast.TypeExternalCall, m *object.Module, env *object.Environment) object.Object {
+	name := node.Action.Function.Value
+	obj, ok := m.Env.Get(name)
+	fn, isFn := obj.(*object.Function)
+	if !ok || !isFn {
+		return newError("Nsina: module '%s' has no function '%s'", node.Name.Value, name)
+	}
+	args := make([]object.Object, 0, len(node.Action.Arguments)+1)
+	if node.Action.Array != nil {
+		for _, arg := range append([]ast.Expression{node.Action.Array}, node.Action.Arguments...) {
+			val := Eval(arg, env)
+			if isError(val) {
+				return val
+			}
+			args = append(args, val)
+		}
+	}
+	return applyFunction(strings.ToLower(node.Name.Value+"."+name), fn, args, m.Env)
+}
@@ -10,15 +10,13 @@ import (
 
 	"github.com/akristianlopez/action/ast"
 	"github.com/akristianlopez/action/object"
+	"github.com/shopspring/decimal"
 	"github.com/uniplaces/carbon"
 	// _ "github.com/go-sql-driver/mysql" // Import du driver MySQL/MariaDB
 	// _ "github.com/lib/pq"              // Driver PostgreSQL
 	// _ "github.com/mattn/go-sqlite3"    // Import du driver SQLite
 )
 
-var struct_id int = 0
-var last_value object.Object
-var MAX_CALL int64 = 100
 var MAX_YEAR_DAYS = 0
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
@@ -35,6 +33,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Integer{Value: node.Value}
 	case *ast.FloatLiteral:
 		return &object.Float{Value: node.Value}
+	case *ast.DecimalLiteral:
+		return evalDecimalLiteral(node)
 	case *ast.StringLiteral:
 		// if strings.HasPrefix(node.Value, "'") {
 		// 	return &object.String{Value: fmt.Sprintf("%s", node.Value)}
@@ -55,6 +55,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalFunctionStatement(node, env)
 	case *ast.StructStatement:
 		return evalStructStatement(node, env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.PrefixExpression:
@@ -83,7 +85,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env)
 	case *ast.AssignmentStatement:
 		return evalAssignmentStatement(node, env)
 	case *ast.ForEachStatement:
@@ -94,6 +96,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalTypeMember(node, env)
 	case *ast.TypeExternalCall:
 		return evalContract(node, env)
+	case *ast.RunExpression:
+		return evalRunExpression(node, env)
 	case *ast.BetweenExpression:
 		return evalBetweenExpression(node, env)
 	case *ast.StructLiteral:
@@ -118,6 +122,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalSQLSelectStatement(node, object.NewEnclosedEnvironment(env))
 	case *ast.ArrayLiteral:
 		return evalArrayLiteral(node, env)
+	case *ast.MapLiteral:
+		return evalMapLiteral(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env, Maxcall: env.MaxCall()}
+	case *ast.JSONPathExpression:
+		return evalJSONPath(node, env)
 	case *ast.IndexExpression:
 		return evalIndexExpression(node, env)
 	case *ast.SliceExpression:
@@ -176,19 +186,33 @@ func evalIifExpression(node *ast.IifExpression, env *object.Environment) object.
 		return Eval(node.FalseExpr, env)
 	}
 	if condition.Type() == object.DBFIELD_OBJ {
-		TrueExpr := Eval(node.TrueExpr, env)
-		FalseExpr := Eval(node.FalseExpr, env)
-		return &object.DBField{OType: string(TrueExpr.Type()), Value: fmt.Sprintf("CASE WHEN %s THEN %s ELSE %s END", condition.Inspect(), TrueExpr.Inspect(), FalseExpr.Inspect())}
+		return evalIifDBField(node, condition, env)
 	}
 	return newError("Invalid condition type: %s", condition.Type())
 }
+
+// evalIifDBField traduit en CASE WHEN un iif dont la condition porte sur un champ de la base
+func evalIifDBField(node *ast.IifExpression, condition object.Object, env *object.Environment) object.Object {
+	TrueExpr := Eval(node.TrueExpr, env)
+	if isError(TrueExpr) {
+		return TrueExpr
+	}
+	FalseExpr := Eval(node.FalseExpr, env)
+	if isError(FalseExpr) {
+		return FalseExpr
+	}
+	t, targs := sqlOperand(TrueExpr)
+	f, fargs := sqlOperand(FalseExpr)
+	return &object.DBField{OType: string(TrueExpr.Type()), Value: fmt.Sprintf("CASE WHEN %s THEN %s ELSE %s END", condition.Inspect(), t, f),
+		Args: joinArgs(sqlArgs(condition), targs, fargs)}
+}
 func evalLikeExpression(node *ast.LikeExpression, env *object.Environment) object.Object {
 	// verifier si c'est un champ d'un objet bd si oui retourner une chaine de caractere
 	// evaluer le like
 	left := Eval(node.Left, env)
 	right := Eval(node.Right, env)
 	if left.Type() == object.DBFIELD_OBJ {
-		return evalDBFieldInfixExpression("LIKE", left, right)
+		return evalDBFieldInfixExpression("LIKE", left, right, env)
 	}
 	res := Like(left.Inspect(), right.Inspect())
 	if node.Not {
@@ -216,6 +240,11 @@ func Like(text, pattern string) bool {
 
 func evalContract(node *ast.TypeExternalCall, env *object.Environment) object.Object {
 	// Eval the action and return the result
+	if obj, ok := env.Get(node.Name.Value); ok {
+		if m, ok := obj.(*object.Module); ok {
+			return evalModuleCall(node, m, env)
+		}
+	}
 	args := make(map[string]object.Object)
 	ts, _, err := env.Signature(node.Name.Value, node.Action.Function.Value)
 	if err != nil {
@@ -265,6 +294,11 @@ func evalTypeMember(node *ast.TypeMember, env *object.Environment) object.Object
 	if !fl {
 		return newError("Invalid structure name '%s'", node.Left.String())
 	}
+	return typeMember(node, obj)
+}
+
+// typeMember lit le champ node.Right de obj, la valeur de node.Left
+func typeMember(node *ast.TypeMember, obj object.Object) object.Object {
 	if obj.Type() == object.DBOBJECT_OBJ { //DBOBJECT_OBJ
 		dbo := obj.(*object.DBStruct)
 		right, ok := node.Right.(*ast.Identifier)
@@ -313,30 +347,55 @@ func evalTypeMember(node *ast.TypeMember, env *object.Environment) object.Object
 }
 
 func evalAction(program *ast.Action, env *object.Environment) object.Object {
+	return runAction(program, env, func(_ int, statement ast.Statement) object.Object {
+		return Eval(statement, env)
+	})
+}
+
+// runAction exécute les instructions de l'action une à une par eval
+func runAction(program *ast.Action, env *object.Environment, eval func(i int, statement ast.Statement) object.Object) object.Object {
 	var result object.Object
-	last_value = object.NULL
+	env.SetLastValue(object.NULL)
 	env.Set("error", &object.String{Value: ""})
 	env.Set("rows_affected", &object.Integer{Value: -1})
 	defer env.ClearTrans()
-	for _, statement := range program.Statements {
+	defer env.CloseRows()
+	for i, statement := range program.Statements {
 		select {
 		case <-env.Context().Done():
 			return newError("%s: Canceled by the user", "Nsina")
 		default:
-			result = Eval(statement, env)
+			result = eval(i, statement)
 
 			switch res := result.(type) {
 			case *object.ReturnValue:
-				return res.Value
+				return actionResult(res.Value)
 			case *object.Error:
 				return res
 			}
 		}
 
 	}
+	return actionResult(result)
+}
+
+// actionResult lit entièrement un curseur renvoyé par l'action: ses lignes doivent survivre à la fermeture des curseurs
+func actionResult(result object.Object) object.Object {
+	if res, ok := result.(*object.SQLResult); ok && res.IsCursor() {
+		return readRows(res, "")
+	}
 	return result
 }
 
+// endScope ferme les curseurs de la portée qui se termine, sauf celui qu'elle renvoie
+func endScope(scope *object.Environment, result object.Object) {
+	if rv, ok := result.(*object.ReturnValue); ok {
+		result = rv.Value
+	}
+	scope.Detach(result)
+	scope.CloseCursors()
+}
+
 func evalLetStatement(let *ast.LetStatement, env *object.Environment) object.Object {
 	var value object.Object
 
@@ -352,6 +411,9 @@ func evalLetStatement(let *ast.LetStatement, env *object.Environment) object.Obj
 			if let.Type.Type == "" && let.Type.SetType != nil {
 				value = &object.Set{Key: let.Type.SetType.Key.Type, Elements: map[any]object.Object{}}
 			}
+			if let.Type.Type == "" && let.Type.MapType != nil {
+				value = object.NewMap("", "")
+			}
 			if let.Type.Type == "" && let.Type.ArrayType != nil {
 				// Bien vouloir pousser la reflexion pour la gestion des types recursifs des arrays
 				value = getDefaultValue(strings.ToLower("array of " + let.Type.ArrayType.ElementType.Type))
@@ -418,12 +480,28 @@ func evalLetStatement(let *ast.LetStatement, env *object.Environment) object.Obj
 		}
 	}
 	if let.Type != nil {
+		if res, ok := value.(*object.SQLResult); ok && res.IsCursor() && let.Type.ArrayType != nil {
+			value = readRows(res, strings.ToLower(let.Type.ArrayType.ElementType.Type))
+			if isError(value) {
+				return value
+			}
+		}
+		if res, ok := value.(*object.SQLResult); ok && res.IsCursor() && strings.EqualFold(let.Type.Type, "json") {
+			value = readRows(res, "")
+			if isError(value) {
+				return value
+			}
+		}
+		if d, ok := value.(*object.Date); ok && strings.EqualFold(let.Type.Type, "datetime") {
+			value = &object.DateTime{Value: d.Value}
+		}
+		value = coerceNumber(strings.ToLower(let.Type.Type), value)
 		env.Limit(let.Name.Value, defConstraints(let.Type, env))
+		value = env.Round(let.Name.Value, value)
 		if st, ok := value.(*object.Struct); ok && st.Name == "" && let.Type.Type != "" {
 			objtype := env.IsStructExist(st, env)
 			if objtype == "" {
-				struct_id++
-				objtype = fmt.Sprintf("%s_%d", "struct_id", struct_id)
+				objtype = fmt.Sprintf("%s_%d", "struct_id", env.NextStructID())
 				defType(objtype, value, env)
 			} else { //check if all values are ok
 				for k, v := range st.Fields {
@@ -443,6 +521,9 @@ func evalLetStatement(let *ast.LetStatement, env *object.Environment) object.Obj
 			set.Key = strings.ToLower(let.Type.SetType.Key.Type)
 			set.Value = strings.ToLower(let.Type.SetType.Value.Type)
 		}
+		if m, ok := value.(*object.Map); ok && m.KeyType == "" && let.Type.MapType != nil {
+			typeMap(m, let.Type.MapType)
+		}
 		// Bien vouloir pousser la reflexion pour la gestion des types recursifs des arrays
 		if arr, ok := value.(*object.Array); ok && arr.ElementType == "" && let.Type.ArrayType != nil {
 			arr.ElementType = strings.ToLower(let.Type.ArrayType.ElementType.Type)
@@ -454,6 +535,21 @@ func evalLetStatement(let *ast.LetStatement, env *object.Environment) object.Obj
 	return env.Declare(let.Name.Value, value)
 }
 
+// coerceNumber convertit un nombre affecté à une variable decimal ou float dans le type de la variable
+func coerceNumber(typeName string, value object.Object) object.Object {
+	switch typeName {
+	case "decimal":
+		if d, ok := object.ToDecimal(value); ok {
+			return d
+		}
+	case "float":
+		if d, ok := value.(*object.Decimal); ok {
+			return &object.Float{Value: d.Value.InexactFloat64()}
+		}
+	}
+	return value
+}
+
 func defType(objtype string, value object.Object, env *object.Environment) {
 	structObj := &object.Struct{
 		Name:   objtype,
@@ -476,50 +572,7 @@ func evalAssignmentStatement(node *ast.AssignmentStatement, env *object.Environm
 	// Gérer différentes cibles d'affectation
 	switch target := node.Variable.(type) {
 	case *ast.Identifier:
-		// Assignation simple à une variable env.HasLimits(target.Value)
-		if en := env.GetLimitEnv(target.Value); en != nil {
-			ok, msg := en.Valid(target.Value, value)
-			if !ok {
-				return newError(msg+".line:%d, column:%d", target.Value, target.Line(), target.Column())
-			}
-		}
-
-		val, ok := env.Get(target.Value)
-		if ok && val.Type() == object.ARRAY_OBJ {
-			v, o := value.(*object.Array)
-			if o && v.ElementType == "" {
-				v.ElementType = val.(*object.Array).ElementType
-			} else if o && v.ElementType != val.(*object.Array).ElementType {
-				return newError("Array type does not match. line:%d, column:%d", target.Line(), target.Column())
-			}
-		}
-		if ok && val.Type() == object.SET_OBJ {
-			v, o := value.(*object.Set)
-			if o && v.Key == "" || v.Value == "" {
-				v.Key = val.(*object.Set).Key
-				v.Value = val.(*object.Set).Value
-			} else if o {
-				if !strings.EqualFold(v.Key, val.(*object.Set).Key) {
-					return newError("Key type does not match. line:%d, column:%d", target.Line(), target.Column())
-				}
-				if !strings.EqualFold(v.Value, val.(*object.Set).Value) {
-					return newError("Value type does not match. line:%d, column:%d", target.Line(), target.Column())
-				}
-			}
-		}
-		if ok && val.Type() == object.STRUCT_OBJ {
-			v, o := value.(*object.Struct)
-			if o && v.Name == "" {
-				v.Name = val.(*object.Struct).Name
-			} else if o && v.Name != val.(*object.Struct).Name {
-				return newError("Struct type does not match. line:%d, column:%d", target.Line(), target.Column())
-			}
-		}
-		res := env.Set(target.Value, value)
-		if res == object.NULL {
-			return newError("Invalid name '%s'. line:%d, column:%d", target.Value, target.Line(), target.Column())
-		}
-		return value
+		return assignIdentifier(target, value, env)
 	case *ast.TypeMember:
 		obj, fl := env.Get(target.Left.String())
 		if !fl {
@@ -542,7 +595,9 @@ func evalAssignmentStatement(node *ast.AssignmentStatement, env *object.Environm
 			ob := obj.(*object.Struct)
 			if _, exists := ob.Fields[key.String()]; exists {
 
+				value = coerceNumber(strings.ToLower(string(ob.Fields[key.String()].Type())), value)
 				if en := env.GetLimitEnv(ob.Name + "." + key.String()); en != nil {
+					value = en.Round(ob.Name+"."+key.String(), value)
 					ok, msg := en.Valid(ob.Name+"."+key.String(), value)
 					if !ok {
 						return newError(msg+".line:%d, column:%d", key.Line(), key.Column())
@@ -571,6 +626,9 @@ func evalAssignmentStatement(node *ast.AssignmentStatement, env *object.Environm
 			set.Elements[getObjectValue(indexObj)] = value
 			return value
 		}
+		if m, ok := leftObj.(*object.Map); ok {
+			return assignMapElement(m, indexObj, value, target)
+		}
 		// Supporter les tableaux
 		if arr, ok := leftObj.(*object.Array); ok {
 			if indexObj.Type() != object.INTEGER_OBJ {
@@ -600,32 +658,92 @@ func evalAssignmentStatement(node *ast.AssignmentStatement, env *object.Environm
 
 }
 
+// assignIdentifier affecte value à la variable target
+func assignIdentifier(target *ast.Identifier, value object.Object, env *object.Environment) object.Object {
+	// Assignation simple à une variable env.HasLimits(target.Value)
+	if val, ok := env.Get(target.Value); ok {
+		value = coerceNumber(strings.ToLower(string(val.Type())), value)
+	}
+	if en := env.GetLimitEnv(target.Value); en != nil {
+		value = en.Round(target.Value, value)
+		ok, msg := en.Valid(target.Value, value)
+		if !ok {
+			return newError(msg+".line:%d, column:%d", target.Value, target.Line(), target.Column())
+		}
+	}
+
+	val, ok := env.Get(target.Value)
+	value = assignedValue(target, val, ok, value)
+	if isError(value) {
+		return value
+	}
+	res := env.Set(target.Value, value)
+	if res == object.NULL {
+		return newError("Invalid name '%s'. line:%d, column:%d", target.Value, target.Line(), target.Column())
+	}
+	return value
+}
+
+// assignedValue vérifie que value convient au type de val, la valeur actuelle de target
+func assignedValue(target *ast.Identifier, val object.Object, ok bool, value object.Object) object.Object {
+	if res, o := value.(*object.SQLResult); o && ok && res.IsCursor() && val.Type() == object.ARRAY_OBJ {
+		value = readRows(res, val.(*object.Array).ElementType)
+		if isError(value) {
+			return value
+		}
+	}
+	if ok && val.Type() == object.ARRAY_OBJ {
+		v, o := value.(*object.Array)
+		if o && v.ElementType == "" {
+			v.ElementType = val.(*object.Array).ElementType
+		} else if o && v.ElementType != val.(*object.Array).ElementType {
+			return newError("Array type does not match. line:%d, column:%d", target.Line(), target.Column())
+		}
+	}
+	if ok && val.Type() == object.SET_OBJ {
+		v, o := value.(*object.Set)
+		if o && v.Key == "" || v.Value == "" {
+			v.Key = val.(*object.Set).Key
+			v.Value = val.(*object.Set).Value
+		} else if o {
+			if !strings.EqualFold(v.Key, val.(*object.Set).Key) {
+				return newError("Key type does not match. line:%d, column:%d", target.Line(), target.Column())
+			}
+			if !strings.EqualFold(v.Value, val.(*object.Set).Value) {
+				return newError("Value type does not match. line:%d, column:%d", target.Line(), target.Column())
+			}
+		}
+	}
+	if old, o := val.(*object.Map); ok && o {
+		if v, isMap := value.(*object.Map); isMap && v.KeyType == "" {
+			v.KeyType, v.ValueType = old.KeyType, old.ValueType
+			for _, pair := range v.Entries() {
+				pair.Value = coerceNumber(v.ValueType, pair.Value)
+			}
+		} else if isMap && (!strings.EqualFold(v.KeyType, old.KeyType) || !strings.EqualFold(v.ValueType, old.ValueType)) {
+			return newError("Map type does not match. line:%d, column:%d", target.Line(), target.Column())
+		}
+	}
+	if ok && val.Type() == object.STRUCT_OBJ {
+		v, o := value.(*object.Struct)
+		if o && v.Name == "" {
+			v.Name = val.(*object.Struct).Name
+		} else if o && v.Name != val.(*object.Struct).Name {
+			return newError("Struct type does not match. line:%d, column:%d", target.Line(), target.Column())
+		}
+	}
+	return value
+}
+
 func formType(col *sql.ColumnType) *ast.TypeAnnotation {
 	if col == nil {
 		return nil
 	}
 
 	tab := strings.Split(col.DatabaseTypeName(), "(")
-	s := tab[0]
-	s = strings.ReplaceAll(strings.ToLower(s), "nvarchar2", "string")
-	s = strings.ReplaceAll(s, "nvarchar", "string")
-	s = strings.ReplaceAll(s, "varchar2", "string")
-	s = strings.ReplaceAll(s, "varchar", "string")
-	s = strings.ReplaceAll(s, "ntext", "string")
-	s = strings.ReplaceAll(s, "text", "string")
-	s = strings.ReplaceAll(s, "longtext", "string")
-	s = strings.ReplaceAll(s, "mediumtext", "string")
-	s = strings.ReplaceAll(s, "number", "integer")
-	s = strings.ReplaceAll(s, "int", "integer")
-	s = strings.ReplaceAll(s, "tinyint", "integer")
-	s = strings.ReplaceAll(s, "mediumint", "integer")
-	s = strings.ReplaceAll(s, "bigint", "integer")
-	s = strings.ReplaceAll(s, "decimal", "float")
-	s = strings.ReplaceAll(s, "numeric", "float")
-	s = strings.ReplaceAll(s, "double", "float")
-	s = strings.ReplaceAll(s, "blob", "string")
-
-	result := &ast.TypeAnnotation{Type: strings.ToLower(s)}
+	s, size := object.ActionType(tab[0])
+
+	result := &ast.TypeAnnotation{Type: s}
 	if len(tab) == 2 {
 		result.Constraints = &ast.TypeConstraints{MaxDigits: nil, DecimalPlaces: nil, MaxLength: nil, IntegerRange: nil}
 		t := tab[1][0 : len(tab[1])-1]
@@ -633,16 +751,16 @@ func formType(col *sql.ColumnType) *ast.TypeAnnotation {
 		if len(tb) == 1 {
 			i, er := strconv.ParseInt(tb[0], 10, 64)
 			if er == nil {
-				switch s {
-				case "int2", "integer2":
+				switch {
+				case size == 2:
 					result.Constraints.IntegerRange = &ast.RangeConstraint{Min: &ast.IntegerLiteral{Value: -32768}, Max: &ast.IntegerLiteral{Value: 32767}}
-				case "int4", "integer4":
+				case size == 4:
 					result.Constraints.IntegerRange = &ast.RangeConstraint{Min: &ast.IntegerLiteral{Value: -2147483648}, Max: &ast.IntegerLiteral{Value: 2147483647}}
-				case "int8", "integer8", "bigint":
+				case size == 8:
 					result.Constraints.IntegerRange = &ast.RangeConstraint{Min: &ast.IntegerLiteral{Value: -9223372036854775808}, Max: &ast.IntegerLiteral{Value: 9223372036854775807}}
-				case "integer", "float":
+				case s == "integer" || s == "float" || s == "decimal":
 					result.Constraints.MaxDigits = &ast.IntegerLiteral{Value: i}
-				case "string":
+				case s == "string":
 					result.Constraints.MaxLength = &ast.IntegerLiteral{Value: i}
 				default:
 					result.Constraints = nil
@@ -658,6 +776,9 @@ func formType(col *sql.ColumnType) *ast.TypeAnnotation {
 			case "float":
 				result.Constraints.MaxDigits = &ast.IntegerLiteral{Value: pr}
 				result.Constraints.MaxDigits = &ast.IntegerLiteral{Value: sc}
+			case "decimal":
+				result.Constraints.MaxDigits = &ast.IntegerLiteral{Value: pr}
+				result.Constraints.DecimalPlaces = &ast.IntegerLiteral{Value: sc}
 			default:
 				result.Constraints = nil
 				newError("Invalid constrants '%s'", col.DatabaseTypeName())
@@ -707,6 +828,23 @@ func defConstraints(ta *ast.TypeAnnotation, env *object.Environment) *object.Lim
 			result.Set("Max", Eval(tc.IntegerRange.Max, env))
 		}
 		return &result
+	case "decimal":
+		result.SetType(object.DECIMAL_OBJ)
+		if tc.MaxDigits != nil {
+			result.Set("Precision", Eval(tc.MaxDigits, env))
+		}
+		if tc.DecimalPlaces != nil {
+			result.Set("Scale", Eval(tc.DecimalPlaces, env))
+		} else if tc.MaxDigits != nil {
+			result.Set("Scale", &object.Integer{Value: 0})
+		}
+		if tc.IntegerRange != nil && tc.IntegerRange.Min != nil {
+			result.Set("Min", Eval(tc.IntegerRange.Min, env))
+		}
+		if tc.IntegerRange != nil && tc.IntegerRange.Max != nil {
+			result.Set("Max", Eval(tc.IntegerRange.Max, env))
+		}
+		return &result
 	case "string":
 		result.SetType(object.STRING_OBJ)
 		if tc.MaxLength != nil {
@@ -737,6 +875,15 @@ func defConstraints(ta *ast.TypeAnnotation, env *object.Environment) *object.Lim
 			result.Set("Max", Eval(tc.IntegerRange.Max, env))
 		}
 		return &result
+	case "datetime":
+		result.SetType(object.DATETIME_OBJ)
+		if tc.IntegerRange != nil && tc.IntegerRange.Min != nil {
+			result.Set("Min", Eval(tc.IntegerRange.Min, env))
+		}
+		if tc.IntegerRange != nil && tc.IntegerRange.Max != nil {
+			result.Set("Max", Eval(tc.IntegerRange.Max, env))
+		}
+		return &result
 	case "duration":
 		result.SetType(object.DURATION_OBJ)
 		if tc.IntegerRange != nil && tc.IntegerRange.Min != nil {
@@ -754,8 +901,10 @@ func getDefaultValue(typeName string) object.Object {
 	switch strings.ToLower(typeName) {
 	case "integer", "int", "int2", "int4", "int8", "smallint", "bigint":
 		return &object.Integer{Value: 0}
-	case "float", "float1", "float2", "float4", "float8", "decimal", "numeric", "double":
+	case "float", "float1", "float2", "float4", "float8", "double":
 		return &object.Float{Value: 0.0}
+	case "decimal", "numeric":
+		return &object.Decimal{}
 	case "string", "varchar", "varchar2", "nvarchar", "nvarchar2", "text", "ntext", "char", "nchar",
 		"longtext", "mediumtext", "tinytext":
 		return &object.String{Value: ""}
@@ -766,7 +915,7 @@ func getDefaultValue(typeName string) object.Object {
 	case "date":
 		return &object.Date{Value: time.Now()}
 	case "datetime":
-		return &object.Date{Value: time.Now()}
+		return &object.DateTime{Value: time.Now().UTC()}
 	case "array":
 		return &object.Array{Elements: []object.Object{}}
 	case "duration":
@@ -788,6 +937,8 @@ func GetDefaultValue(typeName string) object.Object {
 		return &object.Integer{Value: 0}
 	case "float":
 		return &object.Float{Value: 0.0}
+	case "decimal":
+		return &object.Decimal{}
 	case "string":
 		return &object.String{Value: ""}
 	case "boolean":
@@ -797,7 +948,7 @@ func GetDefaultValue(typeName string) object.Object {
 	case "date":
 		return &object.Date{Value: time.Now()}
 	case "datetime":
-		return &object.Date{Value: time.Now()}
+		return &object.DateTime{Value: time.Now().UTC()}
 	case "array":
 		return &object.Array{Elements: []object.Object{}}
 	case "duration":
@@ -818,7 +969,7 @@ func evalFunctionStatement(fn *ast.FunctionStatement, env *object.Environment) o
 		Parameters: fn.Parameters,
 		Body:       fn.Body,
 		Env:        nil,
-		Maxcall:    MAX_CALL,
+		Maxcall:    env.MaxCall(),
 	}
 	if fn.ReturnType != nil {
 		env.Limit(fn.Name.Value, defConstraints(fn.ReturnType, env))
@@ -866,9 +1017,10 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalForStatement(forStmt *ast.ForStatement, env *object.Environment) object.Object {
+func evalForStatement(forStmt *ast.ForStatement, env *object.Environment) (res object.Object) {
 	scope := object.NewEnclosedEnvironment(env)
 	bodyEnv := object.NewEnclosedEnvironment(scope)
+	defer func() { endScope(scope, res) }()
 
 	if forStmt.Init != nil {
 		initResult := Eval(forStmt.Init, scope) //env
@@ -893,6 +1045,7 @@ func evalForStatement(forStmt *ast.ForStatement, env *object.Environment) object
 		// Évaluer le corps
 		bodyEnv.Clear()
 		result := evalForBody(forStmt.Body, bodyEnv) //env
+		endScope(bodyEnv, result)
 
 		if result != nil {
 			rt := result.Type()
@@ -928,6 +1081,13 @@ func evalDateTimeLiteral(dt *ast.DateTimeLiteral) object.Object {
 	// Enlever les # et parser la date/time
 	// value := dt.Literal[1 : len(dt.Literal)-1]
 	value := dt.Value[1 : len(dt.Value)-1]
+	if dt.IsDateTime {
+		t, err := object.ParseDateTime(value)
+		if err != nil {
+			return newError("Invalid datetime: %s", err.Error())
+		}
+		return &object.DateTime{Value: t}
+	}
 	if dt.IsTime {
 		t, err := time.Parse("15:04:05", value)
 		if err != nil {
@@ -965,6 +1125,8 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 	v, _ := selectStmt.From.(*ast.FromIdentifier)
 	var filter string
 	filter = ""
+	// arguments liés, dans l'ordre où leurs marqueurs apparaissent dans chaque clause
+	var selectArgs, onArgs, filterArgs, whereArgs, havingArgs []any
 	if n, True := v.Value.(*ast.Identifier); True {
 		var expr ast.Expression
 
@@ -975,7 +1137,12 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 		}
 		if expr != nil {
 			env.SysUser()
-			filter = Eval(expr, env).Inspect()
+			f := Eval(expr, env)
+			if isError(f) {
+				return f
+			}
+			filter = f.Inspect()
+			filterArgs = append(filterArgs, sqlArgs(f)...)
 		}
 	}
 
@@ -995,6 +1162,7 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 			return exp
 		}
 		strFrom = fmt.Sprintf("%s %s JOIN %s ON %s", strFrom, step.Type, step.Table.String(), strings.ReplaceAll(exp.Inspect(), "==", "="))
+		onArgs = append(onArgs, sqlArgs(exp)...)
 		v, _ := selectStmt.From.(*ast.FromIdentifier)
 		if n, True := v.Value.(*ast.Identifier); True {
 			var (
@@ -1008,103 +1176,83 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 			}
 
 			if x && w != nil {
+				env.SysUser()
+				f := Eval(w, env)
+				if isError(f) {
+					return f
+				}
 				if filter == "" {
-					filter = fmt.Sprintf("(%s)", Eval(w, env).Inspect())
+					filter = fmt.Sprintf("(%s)", f.Inspect())
 				} else {
-					env.SysUser()
-					filter = fmt.Sprintf("%s And (%s)", filter, Eval(w, env).Inspect())
+					filter = fmt.Sprintf("%s And (%s)", filter, f.Inspect())
 				}
+				filterArgs = append(filterArgs, sqlArgs(f)...)
 			}
 		}
 	}
 	strSelect := ""
 	// Traiter la clause SELECT
 	for _, ex := range selectStmt.Select {
-		if e, True := ex.(*ast.SelectArgs); True {
-			if _, ok := e.Expr.(*ast.TypeMember); ok {
-				if len(strSelect) == 0 {
-					strSelect = Eval(e.Expr, env).Inspect()
-					if selectStmt.Distinct {
-						strSelect = fmt.Sprintf(`distinct(%s)`, strSelect)
-					}
-					if e.NewName != nil {
-						strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
-					}
-					continue
-				}
-				strSelect = fmt.Sprintf("%s, %s", strSelect, Eval(e.Expr, env).Inspect())
-				if e.NewName != nil {
-					strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
-				}
-				continue
-			}
-			if ident, ok := e.Expr.(*ast.Identifier); ok {
-				if ident.Value == "*" {
-					strSelect = ident.Value
-					break
-				}
-				if len(strSelect) == 0 {
-					strSelect = ident.Value
-					if selectStmt.Distinct {
-						strSelect = fmt.Sprintf(`distinct(%s)`, strSelect)
-					}
-					if e.NewName != nil {
-						strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
-					}
-					continue
-				}
-				strSelect = fmt.Sprintf("%s, %s", strSelect, ident.Value)
-				if e.NewName != nil {
-					strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
-				}
-				continue
-			}
-			if ident, ok := e.Expr.(*ast.StringLiteral); ok {
-				if ident.Value == "*" {
-					strSelect = ident.Value
-					break
-				}
-				if len(strSelect) == 0 {
-					strSelect = ident.Value
-					if e.NewName != nil {
-						strSelect = fmt.Sprintf(`'%s' as "%s"`, strSelect, e.NewName.Value)
-					}
-					continue
-				}
-				strSelect = fmt.Sprintf("%s, '%s'", strSelect, ident.Value)
-				if e.NewName != nil {
-					strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
-				}
-				continue
+		e, True := ex.(*ast.SelectArgs)
+		if !True {
+			return newError("Invalid argument '%s'", ex.String())
+		}
+		field := ""
+		distinct := false
+		switch expr := e.Expr.(type) {
+		case *ast.Identifier:
+			if expr.Value == "*" {
+				strSelect = expr.Value
+				break
 			}
-			if len(strSelect) == 0 {
-				strSelect = Eval(e.Expr, env).Inspect()
-				if e.NewName != nil {
-					strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
-				}
-				continue
+			field = expr.Value
+			distinct = true
+		case *ast.StringLiteral:
+			if expr.Value == "*" {
+				strSelect = expr.Value
+				break
 			}
-			strSelect = fmt.Sprintf("%s, %s", strSelect, Eval(e.Expr, env).Inspect())
-			if e.NewName != nil {
-				strSelect = fmt.Sprintf(`%s as "%s"`, strSelect, e.NewName.Value)
+			field = "?"
+			selectArgs = append(selectArgs, expr.Value)
+		default:
+			val := Eval(e.Expr, env)
+			if isError(val) {
+				return val
 			}
+			var args []any
+			field, args = sqlOperand(val)
+			selectArgs = append(selectArgs, args...)
+			_, distinct = e.Expr.(*ast.TypeMember)
+		}
+		if strSelect == "*" {
+			break
+		}
+		if len(strSelect) == 0 && distinct && selectStmt.Distinct {
+			field = fmt.Sprintf(`distinct(%s)`, field)
+		}
+		if e.NewName != nil {
+			field = fmt.Sprintf(`%s as %s`, field, env.Dialect().QuoteIdent(e.NewName.Value))
+		}
+		if len(strSelect) == 0 {
+			strSelect = field
 			continue
 		}
-		return newError("Invalid argument '%s'", ex.String())
+		strSelect = fmt.Sprintf("%s, %s", strSelect, field)
 	}
 
 	strSQL := fmt.Sprintf("SELECT %s\nFROM %s", strSelect, strFrom)
 	// Traiter la clause WHERE
 	if selectStmt.Where != nil {
 		whereResult := Eval(selectStmt.Where, env)
+		if isError(whereResult) {
+			return whereResult
+		}
+		whereArgs = sqlArgs(whereResult)
 		if filter != "" {
 			strSQL = fmt.Sprintf("%s\nWHERE ((%s) And (%s))", strSQL, whereResult.Inspect(), filter)
 		} else {
 			strSQL = fmt.Sprintf("%s\nWHERE (%s)", strSQL, whereResult.Inspect())
 		}
-		if isError(whereResult) {
-			return whereResult
-		}
 	} else {
 		if filter != "" {
 			strSQL = fmt.Sprintf("%s\nWHERE (%s)", strSQL, filter)
@@ -1122,6 +1270,14 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 		}
 		strSQL = fmt.Sprintf("%s\nGROUP BY \n%s", strSQL, strGroup)
 	}
+	if selectStmt.Having != nil {
+		strHaving := Eval(selectStmt.Having, env)
+		if isError(strHaving) {
+			return strHaving
+		}
+		havingArgs = sqlArgs(strHaving)
+		strSQL = fmt.Sprintf("%s\nHAVING(%s)", strSQL, strHaving.Inspect())
+	}
 	if selectStmt.OrderBy != nil {
 		strOrder := ""
 		for k, v := range selectStmt.OrderBy {
@@ -1133,16 +1289,13 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 		}
 		strSQL = fmt.Sprintf("%s\nORDER BY \n%s", strSQL, strOrder)
 	}
-	if selectStmt.Limit != nil {
-		exp := Eval(selectStmt.Limit, env)
-		if isError(exp) {
-			return exp
-		}
-		strSQL = fmt.Sprintf("%s\nLIMIT %s", strSQL, exp.Inspect())
+	limit, errObj := limitValue(selectStmt.Limit, env)
+	if errObj != nil {
+		return errObj
 	}
-	if selectStmt.Having != nil {
-		strHaving := Eval(selectStmt.Having, env)
-		strSQL = fmt.Sprintf("%s\nHAVING(%s)", strSQL, strHaving.Inspect())
+	offset, errObj := limitValue(selectStmt.Offset, env)
+	if errObj != nil {
+		return errObj
 	}
 	if strings.ToLower(stepName) != "" {
 		// Create a temporary structure to store data
@@ -1175,6 +1328,8 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 		env.Set(result.Name, &result)
 	}
 
+	args := joinArgs(selectArgs, onArgs, whereArgs, filterArgs, havingArgs)
+	strSQL, args = env.Dialect().Limit(strSQL, args, limit, offset, selectStmt.OrderBy != nil)
 	if selectStmt.Union != nil {
 		union := ""
 		if selectStmt.UnionAll {
@@ -1185,8 +1340,30 @@ func toString(selectStmt *ast.SQLSelectStatement, stepName string, env *object.E
 			return sqlObject
 		}
 		strSQL = fmt.Sprintf("%s\nUNION %s \n (%s)", strSQL, union, sqlObject.Inspect())
+		args = append(args, sqlArgs(sqlObject)...)
+	}
+	return &object.DBField{OType: string(object.DBOBJECT_OBJ), Value: strSQL, Args: args}
+}
+
+// limitValue évalue l'expression de LIMIT ou OFFSET; la valeur est nil quand la clause est absente
+func limitValue(exp ast.Expression, env *object.Environment) (any, object.Object) {
+	if exp == nil {
+		return nil, nil
+	}
+	val := Eval(exp, env)
+	if isError(val) {
+		return nil, val
+	}
+	n, ok := val.(*object.Integer)
+	if !ok {
+		return nil, newError("Nsina: LIMIT and OFFSET expect an integer, got %s", val.Type())
 	}
-	return &object.String{Value: strSQL}
+	return n.Value, nil
+}
+
+// firstRowSQL renvoie la requête qui lit au plus une ligne de table, afin d'en déduire la structure
+func firstRowSQL(table string, env *object.Environment) (string, []any) {
+	return env.Dialect().Limit(fmt.Sprintf("SELECT * FROM %s", table), nil, 1, nil, false)
 }
 
 func defineFromObject(exp ast.Expression, env *object.Environment) object.Object {
@@ -1203,12 +1380,12 @@ func defineFromObject(exp ast.Expression, env *object.Environment) object.Object
 				}
 				return env.Set(ex.Value, res)
 			}
-			strSQL := fmt.Sprintf("select * FROM %s LIMIT 1", ex.Value)
-			rows, err := env.Query(strSQL)
+			strSQL, args := firstRowSQL(ex.Value, env)
+			rows, err := env.Query(strSQL, args...)
 			if err != nil {
 				return newError("Nsina: %s", err.Error())
 			}
-			defer rows.Close()
+			defer env.Release(rows)
 			result := object.DBStruct{Name: strings.ToLower(ex.Value), Fields: make(map[string]object.Object)}
 			colt, err := rows.ColumnTypes()
 			if err != nil {
@@ -1233,12 +1410,12 @@ func defineFromObject(exp ast.Expression, env *object.Environment) object.Object
 				}
 				return env.Set(ex.Value, res)
 			}
-			strSQL := fmt.Sprintf("select * FROM %s LIMIT 1", ex.Value)
-			rows, err := env.Query(strSQL)
+			strSQL, args := firstRowSQL(ex.Value, env)
+			rows, err := env.Query(strSQL, args...)
 			if err != nil {
 				return newError("Nsina: %s", err.Error())
 			}
-			defer rows.Close()
+			defer env.Release(rows)
 			result := object.DBStruct{Name: strings.ToLower(ex.Value), Fields: make(map[string]object.Object)}
 			colt, err := rows.ColumnTypes()
 			if err != nil {
@@ -1313,11 +1490,11 @@ func evalSQLSelectStatement(selectStmt *ast.SQLSelectStatement, env *object.Envi
 	if isError(strSQl) {
 		return strSQl
 	}
-	rows, err := env.Query(strSQl.Inspect())
+	rows, err := env.Query(strSQl.Inspect(), sqlArgs(strSQl)...)
 	if err != nil {
 		return newError("%s", err.Error())
 	}
-	result.Rows = rows
+	env.SetRows(result, rows)
 	cols, err := rows.Columns()
 	if err != nil {
 		return newError("Nsina: %s", err.Error())
@@ -1375,15 +1552,10 @@ func evalIsExpression(node *ast.IsExpression, env *object.Environment) object.Ob
 		}
 		res := &object.DBField{}
 		res.SetType(string(object.BOOLEAN_OBJ))
-		if left.Type() == object.STRING_OBJ {
-			res.Value = fmt.Sprintf("(%s %s '%s')", left.Inspect(), op, right.Inspect())
-			return res
-		}
-		if right.Type() == object.STRING_OBJ {
-			res.Value = fmt.Sprintf("(%s %s '%s')", left.Inspect(), op, right.Inspect())
-			return res
-		}
-		res.Value = fmt.Sprintf("(%s %s %s)", left.Inspect(), op, right.Inspect())
+		l, largs := sqlOperand(left)
+		r, rargs := sqlOperand(right)
+		res.Value = fmt.Sprintf("(%s %s %s)", l, op, r)
+		res.Args = joinArgs(largs, rargs)
 		return res
 	}
 
@@ -1414,8 +1586,7 @@ func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.
 	if structObj.Name == "" {
 		objtype := env.IsStructExist(structObj, env)
 		if objtype == "" {
-			struct_id++
-			objtype = fmt.Sprintf("%s_%d", "struct_id", struct_id)
+			objtype = fmt.Sprintf("%s_%d", "struct_id", env.NextStructID())
 			defType(objtype, structObj, env)
 		}
 		structObj.Name = objtype
@@ -1449,13 +1620,14 @@ func evalStructLiteral(node *ast.StructLiteral, env *object.Environment) object.
 	return structObj
 }
 
-func evalIfStatement(node *ast.IfStatement, env *object.Environment) object.Object {
+func evalIfStatement(node *ast.IfStatement, env *object.Environment) (result object.Object) {
 	// Évaluer la condition
 	condition := Eval(node.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 	scope := object.NewEnclosedEnvironment(env)
+	defer func() { endScope(scope, result) }()
 	// Si la condition est vraie, évaluer le bloc conséquence
 	if isTruthy(condition) {
 		return evalBlockStatement(node.Then, scope)
@@ -1470,45 +1642,59 @@ func evalIfStatement(node *ast.IfStatement, env *object.Environment) object.Obje
 	return object.NULL
 }
 
-func evalCatchStatement(node *ast.CatchStatement, env *object.Environment) object.Object {
+func evalCatchStatement(node *ast.CatchStatement, env *object.Environment) (result object.Object) {
 	if node.Statements == nil {
 		return object.NULL
 	}
 	scope := object.NewEnclosedEnvironment(env)
+	defer func() { endScope(scope, result) }()
 	for _, stm := range node.Statements.Statements {
-		last_value = Eval(stm, scope)
-		if isError(last_value) {
-			scope.Set("error", &object.String{Value: last_value.Inspect()})
+		scope.SetLastValue(Eval(stm, scope))
+		if isError(scope.LastValue()) {
+			scope.Set("error", &object.String{Value: scope.LastValue().Inspect()})
 		}
 	}
-	result := last_value
-	last_value = object.NULL
+	result = scope.LastValue()
+	scope.SetLastValue(object.NULL)
+	// l'erreur est interceptée: elle ne remonte pas au bloc protected englobant
+	if isError(result) {
+		return object.NULL
+	}
 	return result
 }
-func evalProtectedStatement(node *ast.ProtectedStatement, env *object.Environment) object.Object {
+func evalProtectedStatement(node *ast.ProtectedStatement, env *object.Environment) (result object.Object) {
 	if node.Statements == nil {
 		return object.NULL
 	}
 	scope := object.NewEnclosedEnvironment(env)
+	defer func() { endScope(scope, result) }()
 	err := scope.StartTrans()
 	if err != nil {
 		return newError("%s", err.Error())
 	}
 	for _, stm := range node.Statements.Statements {
-		last_value = Eval(stm, scope)
-		if isError(last_value) {
-			scope.RollbackTrans()
-			return last_value
+		scope.SetLastValue(Eval(stm, scope))
+		if isError(scope.LastValue()) {
+			result = scope.LastValue()
+			scope.SetLastValue(object.NULL)
+			if err := scope.RollbackTrans(); err != nil {
+				return newError("%s (rollback: %s)", result.(*object.Error).Message, err.Error())
+			}
+			return result
 		}
 	}
-	scope.EndTrans()
-	result := last_value
-	last_value = object.NULL
+	if err := scope.EndTrans(); err != nil {
+		scope.RollbackTrans()
+		scope.SetLastValue(object.NULL)
+		return newError("%s", err.Error())
+	}
+	result = scope.LastValue()
+	scope.SetLastValue(object.NULL)
 	return result
 }
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	if right.Type() == object.DBFIELD_OBJ {
-		return &object.DBField{OType: right.(*object.DBField).OType, Value: fmt.Sprintf("%s %s", operator, right.Inspect())}
+		return &object.DBField{OType: right.(*object.DBField).OType, Value: fmt.Sprintf("%s %s", operator, right.Inspect()), Args: sqlArgs(right)}
 	}
 	switch strings.ToLower(operator) {
 	case "not":
@@ -1521,9 +1707,9 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return newError("Opérateur inconnu: %s%s", operator, right.Type())
 	}
 }
-func evalBooleanInfixExpression(operator string, left, right object.Object) object.Object {
+func evalBooleanInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	if left.Type() == object.DBFIELD_OBJ || right.Type() == object.DBFIELD_OBJ {
-		return evalDBFieldInfixExpression(operator, left, right)
+		return evalDBFieldInfixExpression(operator, left, right, env)
 	}
 	leftVal := left.(*object.Boolean).Value
 	rightVal := right.(*object.Boolean).Value
@@ -1533,27 +1719,31 @@ func evalBooleanInfixExpression(operator string, left, right object.Object) obje
 	return &object.Boolean{Value: leftVal || rightVal}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	switch {
 	case left.Type() == object.DBFIELD_OBJ || right.Type() == object.DBFIELD_OBJ:
-		return evalDBFieldInfixExpression(operator, left, right)
+		return evalDBFieldInfixExpression(operator, left, right, env)
 	case strings.ToLower(operator) == "and" || strings.ToLower(operator) == "or":
-		return evalBooleanInfixExpression(strings.ToLower(operator), left, right)
+		return evalBooleanInfixExpression(strings.ToLower(operator), left, right, env)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isDecimalOperation(left, right):
+		return evalDecimalInfixExpression(operator, left, right)
 	case (left.Type() == object.FLOAT_OBJ || left.Type() == object.INTEGER_OBJ) && (right.Type() == object.INTEGER_OBJ ||
 		right.Type() == object.FLOAT_OBJ):
 		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ || right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.DATETIME_OBJ || right.Type() == object.DATETIME_OBJ:
+		return evalDateTimeInfixExpression(operator, left, right)
 	case operator == "==":
 		if left.Type() == object.DBFIELD_OBJ || right.Type() == object.DBFIELD_OBJ {
-			return evalDBFieldInfixExpression(operator, left, right)
+			return evalDBFieldInfixExpression(operator, left, right, env)
 		}
 		return &object.Boolean{Value: left == right}
 	case operator == "!=":
 		if left.Type() == object.DBFIELD_OBJ || right.Type() == object.DBFIELD_OBJ {
-			return evalDBFieldInfixExpression(operator, left, right)
+			return evalDBFieldInfixExpression(operator, left, right, env)
 		}
 		return &object.Boolean{Value: left != right}
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
@@ -1735,13 +1925,13 @@ func AddDurationUsingCarbon(baseTime time.Time, d *object.Duration) *object.Date
 	seconds := nanos / nanosPerSec
 	nanos %= nanosPerSec
 
-	// 3. Application des ajouts en cascade via Carbon
-	c.AddYears(int(years))
-	c.AddMonths(int(months))
-	c.AddDays(int(days))
-	c.AddHours(int(hours))
-	c.AddMinutes(int(minutes))
-	c.AddSeconds(int(seconds))
+	// 3. Application des ajouts en cascade via Carbon (chaque appel renvoie une nouvelle valeur)
+	c = c.AddYears(int(years))
+	c = c.AddMonths(int(months))
+	c = c.AddDays(int(days))
+	c = c.AddHours(int(hours))
+	c = c.AddMinutes(int(minutes))
+	c = c.AddSeconds(int(seconds))
 
 	// Ajout du résidu strict de nanosecondes s'il y en a
 	if nanos > 0 {
@@ -1785,13 +1975,13 @@ func SubDurationUsingCarbon(baseTime time.Time, d *object.Duration) *object.Date
 	seconds := nanos / nanosPerSec
 	nanos %= nanosPerSec
 
-	// 3. Application des soustractions en cascade via Carbon
-	c.SubYears(int(years))
-	c.SubMonths(int(months))
-	c.SubDays(int(days))
-	c.SubHours(int(hours))
-	c.SubMinutes(int(minutes))
-	c.SubSeconds(int(seconds))
+	// 3. Application des soustractions en cascade via Carbon (chaque appel renvoie une nouvelle valeur)
+	c = c.SubYears(int(years))
+	c = c.SubMonths(int(months))
+	c = c.SubDays(int(days))
+	c = c.SubHours(int(hours))
+	c = c.SubMinutes(int(minutes))
+	c = c.SubSeconds(int(seconds))
 
 	// Soustraction du résidu strict de nanosecondes s'il y en a
 	if nanos > 0 {
@@ -1842,6 +2032,47 @@ func evalDateInfixExpression(operator string, left, right object.Object) object.
 	}
 	return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
+
+// evalDateTimeInfixExpression: datetime ± duration, datetime - datetime et comparaisons.
+// Une date est prise à minuit; la différence de deux datetime est la durée écoulée, signée
+func evalDateTimeInfixExpression(operator string, left, right object.Object) object.Object {
+	l, lok := object.ToDateTime(left)
+	r, rok := object.ToDateTime(right)
+	if lok && rok {
+		switch operator {
+		case "-":
+			return &object.Duration{Nanoseconds: int64(l.Value.Sub(r.Value))}
+		case "==":
+			return &object.Boolean{Value: l.Value.Equal(r.Value)}
+		case "!=":
+			return &object.Boolean{Value: !l.Value.Equal(r.Value)}
+		case "<":
+			return &object.Boolean{Value: l.Value.Before(r.Value)}
+		case "<=":
+			return &object.Boolean{Value: !l.Value.After(r.Value)}
+		case ">":
+			return &object.Boolean{Value: l.Value.After(r.Value)}
+		case ">=":
+			return &object.Boolean{Value: !l.Value.Before(r.Value)}
+		}
+		return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+	switch operator {
+	case "+":
+		if d, ok := right.(*object.Duration); ok && lok {
+			return &object.DateTime{Value: AddDurationUsingCarbon(l.Value, d).Value}
+		}
+		if d, ok := left.(*object.Duration); ok && rok {
+			return &object.DateTime{Value: AddDurationUsingCarbon(r.Value, d).Value}
+		}
+	case "-":
+		if d, ok := right.(*object.Duration); ok && lok {
+			return &object.DateTime{Value: SubDurationUsingCarbon(l.Value, d).Value}
+		}
+	}
+	return newError("Unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
@@ -1853,10 +2084,14 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 		return &object.Integer{Value: leftVal - rightVal}
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
+	case "/", "%":
+		if rightVal == 0 {
+			return newError("Division by zero: %d %s %d", leftVal, operator, rightVal)
+		}
+		if operator == "%" {
+			return &object.Integer{Value: leftVal % rightVal}
+		}
 		return &object.Integer{Value: leftVal / rightVal}
-	case "%":
-		return &object.Integer{Value: leftVal % rightVal}
 	case "<":
 		return &object.Boolean{Value: leftVal < rightVal}
 	case "<=":
@@ -1929,14 +2164,13 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	case "!=":
 		return &object.Boolean{Value: strings.Compare(left.Inspect(), right.Inspect()) != 0}
 	case "+":
-		leftVal := strings.Trim(left.(*object.String).Value, "'")
-		rightVal := strings.Trim(right.(*object.String).Value, "'")
-		return &object.String{Value: fmt.Sprintf("'%s'", leftVal+rightVal)}
+		// les guillemets font partie de la valeur: une chaîne peut commencer ou finir par \'
+		return &object.String{Value: left.(*object.String).Value + right.(*object.String).Value}
 	}
 	return newError("Invalid operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalDBFieldInfixExpression(operator string, left, right object.Object) object.Object {
+func evalDBFieldInfixExpression(operator string, left, right object.Object, env *object.Environment) object.Object {
 	roper := operator
 	switch operator {
 	case "==":
@@ -1945,30 +2179,56 @@ func evalDBFieldInfixExpression(operator string, left, right object.Object) obje
 		roper = "<>"
 	case "+":
 		if v, o := left.(*object.DBField); o && v.OType == string(object.STRING_OBJ) {
-			roper = "||"
+			roper = env.Dialect().Concat()
 		}
 		if v, o := right.(*object.DBField); o && v.OType == string(object.STRING_OBJ) {
-			roper = "||"
-		}
-	case "??":
-		if right.Type() == object.STRING_OBJ {
-			return &object.DBField{OType: left.(*object.DBField).OType, Value: fmt.Sprintf("coalesce(%s, '%s')", left.Inspect(), right.Inspect())}
+			roper = env.Dialect().Concat()
 		}
-		if right.Type() == object.DBFIELD_OBJ {
-			return &object.DBField{OType: right.(*object.DBField).OType, Value: fmt.Sprintf("coalesce(%s, %s)", left.Inspect(), right.Inspect())}
+	}
+	otype := ""
+	if v, o := left.(*object.DBField); o {
+		otype = v.OType
+	} else if v, o := right.(*object.DBField); o {
+		otype = v.OType
+	}
+	l, largs := sqlOperand(left)
+	r, rargs := sqlOperand(right)
+	if operator == "??" {
+		if v, o := right.(*object.DBField); o {
+			otype = v.OType
 		}
-		return &object.DBField{OType: left.(*object.DBField).OType, Value: fmt.Sprintf("coalesce(%s, %s)", left.Inspect(), right.Inspect())}
+		return &object.DBField{OType: otype, Value: env.Dialect().Coalesce(l, r), Args: joinArgs(largs, rargs)}
 	}
-	if left.Type() == object.STRING_OBJ || left.Type() == object.DATE_OBJ || left.Type() == object.TIME_OBJ {
-		return &object.DBField{OType: right.(*object.DBField).OType, Value: fmt.Sprintf("(%s %s %s)", fmt.Sprintf("'%s'", left.Inspect()), roper, right.Inspect())}
+	return &object.DBField{OType: otype, Value: fmt.Sprintf("(%s %s %s)", l, roper, r), Args: joinArgs(largs, rargs)}
+}
+
+// sqlOperand renvoie le fragment SQL d'une valeur et les arguments qui lui sont liés:
+// un champ de la base garde son expression, toute autre valeur devient un paramètre '?'
+func sqlOperand(obj object.Object) (string, []any) {
+	switch obj := obj.(type) {
+	case *object.DBField:
+		return obj.Inspect(), obj.Args
+	case *object.Null:
+		return "NULL", nil
+	default:
+		return "?", []any{getObjectValue(obj)}
 	}
-	if right.Type() == object.STRING_OBJ || right.Type() == object.DATE_OBJ || right.Type() == object.TIME_OBJ {
-		return &object.DBField{OType: left.(*object.DBField).OType, Value: fmt.Sprintf("(%s %s %s)", left.Inspect(), roper, fmt.Sprintf("'%s'", right.Inspect()))}
+}
+
+// sqlArgs renvoie les arguments liés d'un fragment SQL
+func sqlArgs(obj object.Object) []any {
+	if v, ok := obj.(*object.DBField); ok {
+		return v.Args
 	}
-	if left.Type() == object.DBFIELD_OBJ {
-		return &object.DBField{OType: left.(*object.DBField).OType, Value: fmt.Sprintf("(%s %s %s)", left.Inspect(), roper, right.Inspect())}
+	return nil
+}
+
+func joinArgs(lists ...[]any) []any {
+	var out []any
+	for _, l := range lists {
+		out = append(out, l...)
 	}
-	return &object.DBField{OType: right.(*object.DBField).OType, Value: fmt.Sprintf("(%s %s %s)", left.Inspect(), roper, right.Inspect())}
+	return out
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -1980,29 +2240,25 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ && right.Type() != object.FLOAT_OBJ {
-		return newError("Opérateur inconnu: -%s", right.Type())
-	}
-
 	switch right := right.(type) {
 	case *object.Integer:
 		return &object.Integer{Value: -right.Value}
 	case *object.Float:
 		return &object.Float{Value: -right.Value}
+	case *object.Decimal:
+		return &object.Decimal{Value: right.Value.Neg()}
 	default:
 		return newError("Opérateur inconnu: -%s", right.Type())
 	}
 }
 func evalPlusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ && right.Type() != object.FLOAT_OBJ {
-		return newError("Opérateur inconnu: -%s", right.Type())
-	}
-
 	switch right := right.(type) {
 	case *object.Integer:
 		return &object.Integer{Value: +right.Value}
 	case *object.Float:
 		return &object.Float{Value: +right.Value}
+	case *object.Decimal:
+		return right
 	default:
 		return newError("Opérateur inconnu: +%s", right.Type())
 	}
@@ -2049,101 +2305,11 @@ func evalSQLCreateObject(stmt *ast.SQLCreateObjectStatement, env *object.Environ
 		for _, constraint := range col.Constraints {
 			out += " " + constraint.String()
 		}
-		switch strings.ToLower(env.DBName()) {
-		case "postgres":
-			switch strings.ToLower(col.DataType.Name) {
-			case "integer":
-				switch col.DataType.Length.Value {
-				case 1, 2, 3, 4, 5: //smallint -32768 to 32767
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "smallint", out))
-				case 6, 7, 8, 9, 10, 11: //integer -2147483648 to 2147483647
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "integer", out))
-				default: //bigint -9223372036854775808 to 9223372036854775807
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "bigint", out))
-				}
-			case "float":
-				switch {
-				case col.DataType.Length.Value > 0:
-					if col.DataType.Length.Value < 0 || col.DataType.Length.Value > 131072 {
-						return newError("Scale value error: expected value between 0 and 131072, got %v", col.DataType.Scale.Value)
-					}
-					fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "NUMERIC", col.DataType.Length.Value, out))
-				default:
-					if col.DataType.Precision != nil {
-						if col.DataType.Precision.Value > 0 && col.DataType.Scale == nil {
-							if col.DataType.Precision.Value < 0 || col.DataType.Scale.Value > 131072 {
-								return newError("Scale value error: expected value between 0 and 131072, got %v", col.DataType.Scale.Value)
-							}
-							fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "NUMERIC", col.DataType.Precision.Value, out))
-						}
-						if col.DataType.Precision.Value > 0 && col.DataType.Scale != nil {
-							if col.DataType.Scale.Value < -1000 || col.DataType.Scale.Value > 1000 {
-								return newError("Scale value error: expected value between -1000 and 1000, got %v", col.DataType.Scale.Value)
-							}
-							fields = append(fields, fmt.Sprintf("%s %s(%d,%d) %s", col.Name.Value, "NUMERIC", col.DataType.Precision.Value, col.DataType.Scale.Value, out))
-						}
-					} else {
-						fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "FLOAT", out))
-					}
-				}
-			case "string":
-				switch {
-				case col.DataType.Length.Value < 65535: //smallint -32768 to 32767
-					fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "VARCHAR", col.DataType.Length.Value, out))
-				default: //bigint -9223372036854775808 to 9223372036854775807
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "TEXT", out))
-				}
-			case "duration":
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "interval", out))
-			default:
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, col.DataType.Name, out))
-			}
-		case "mariadb", "mysql":
-			switch strings.ToLower(col.DataType.Name) {
-			case "integer":
-				switch col.DataType.Length.Value {
-				case 1, 2, 3: //tinyint -128 to 127
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "tinyint", out))
-				case 4, 5: //smallint -32768 to 32767
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "smallint", out))
-				case 6, 7: //mediumint -8388608 to 8388607
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "mediumint", out))
-				case 8, 9, 10, 11: //integer -2147483648 to 2147483647
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "integer", out))
-				default: //bigint -9223372036854775808 to 9223372036854775807
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "bigint", out))
-				}
-			case "float":
-				switch {
-				case col.DataType.Length.Value > 0:
-					fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "DECIMAL", col.DataType.Length.Value, out))
-				default:
-					if col.DataType.Precision != nil {
-						if col.DataType.Precision.Value > 0 && col.DataType.Scale == nil {
-							fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "DECIMAL", col.DataType.Precision.Value, out))
-						}
-						if col.DataType.Precision.Value > 0 && col.DataType.Scale != nil {
-							fields = append(fields, fmt.Sprintf("%s %s(%d,%d) %s", col.Name.Value, "DECIMAL", col.DataType.Precision.Value, col.DataType.Scale.Value, out))
-						}
-					} else {
-						fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "DOUBLE", out))
-					}
-				}
-			case "string":
-				switch {
-				case col.DataType.Length.Value <= 65535: //VARCHAR
-					fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "VARCHAR", col.DataType.Length.Value, out))
-				default: //MEDIUMTEXT
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "MEDIUMTEXT", out))
-				}
-			case "duration":
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "interval", out))
-			default:
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, col.DataType.Name, out))
-			}
-		default:
-			return object.NULL
+		typ, err := env.Dialect().ColumnType(col.DataType)
+		if err != nil {
+			return newError("%s", err.Error())
 		}
+		fields = append(fields, fmt.Sprintf("%s %s%s", col.Name.Value, typ, out))
 	}
 	constraints := ""
 	if len(stmt.Constraints) > 0 {
@@ -2155,13 +2321,9 @@ func evalSQLCreateObject(stmt *ast.SQLCreateObjectStatement, env *object.Environ
 			constraints = fmt.Sprintf("%s, %s", constraints, con.String())
 		}
 	}
-	str := ""
-	if stmt.IfNotExists {
-		str = "IF NOT EXISTS"
-	}
 
 	// strSQL := stmt.String()
-	strSQL := fmt.Sprintf("CREATE TABLE %s %s(%s %s)", str, stmt.ObjectName.Value, strings.Join(fields, ", "), constraints)
+	strSQL := env.Dialect().CreateTable(stmt.ObjectName.Value, strings.Join(fields, ", ")+constraints, stmt.IfNotExists)
 	res, err := env.Exec(strSQL)
 	if err == nil {
 		r, _ := res.RowsAffected()
@@ -2210,114 +2372,41 @@ func evalSQLDropObject(stmt *ast.SQLDropObjectStatement, env *object.Environment
 	}
 }
 
-func stringCol(col *ast.SQLColumnDefinition, action, name, dbname string) (string, object.Object) {
-	fields := make([]string, 0)
-	out := ""
-	md := fmt.Sprintf(", ALTER COLUMN %s SET ", col.Name.Value)
-	act := "TYPE"
-	if action != "ALTER COLUMN" {
-		act = ""
-		md = ""
-	}
-	for _, constraint := range col.Constraints {
-		out += " " + md + constraint.String()
-	}
-	switch strings.ToLower(dbname) {
-	case "postgres":
-		switch strings.ToLower(col.DataType.Name) {
-		case "integer":
-			switch col.DataType.Length.Value {
-			case 1, 2, 3, 4, 5: //smallint -32768 to 32767
-				fields = append(fields, fmt.Sprintf("%s %s %s %s", col.Name.Value, act, "smallint", out))
-			case 6, 7, 8, 9, 10, 11: //integer -2147483648 to 2147483647
-				fields = append(fields, fmt.Sprintf("%s %s %s %s", col.Name.Value, act, "integer", out))
-			default: //bigint -9223372036854775808 to 9223372036854775807
-				fields = append(fields, fmt.Sprintf("%s %s %s %s", col.Name.Value, act, "bigint", out))
-			}
-		case "float":
-			switch {
-			case col.DataType.Length.Value > 0:
-				if col.DataType.Length.Value < 0 || col.DataType.Length.Value > 131072 {
-					return "", newError("Scale value error: expected value between 0 and 131072, got %v", col.DataType.Scale.Value)
-				}
-				fields = append(fields, fmt.Sprintf("%s %s %s(%d) %s", col.Name.Value, act, "NUMERIC", col.DataType.Length.Value, out))
-			default:
-				if col.DataType.Precision != nil {
-					if col.DataType.Precision.Value > 0 && col.DataType.Scale == nil {
-						if col.DataType.Precision.Value < 0 || col.DataType.Scale.Value > 131072 {
-							return "", newError("Scale value error: expected value between 0 and 131072, got %v", col.DataType.Scale.Value)
-						}
-						fields = append(fields, fmt.Sprintf("%s  %s %s(%d) %s", col.Name.Value, act, "NUMERIC", col.DataType.Precision.Value, out))
-					}
-					if col.DataType.Precision.Value > 0 && col.DataType.Scale != nil {
-						if col.DataType.Scale.Value < -1000 || col.DataType.Scale.Value > 1000 {
-							return "", newError("Scale value error: expected value between -1000 and 1000, got %v", col.DataType.Scale.Value)
-						}
-						fields = append(fields, fmt.Sprintf("%s %s %s(%d,%d) %s", col.Name.Value, act, "NUMERIC", col.DataType.Precision.Value, col.DataType.Scale.Value, out))
-					}
-				} else {
-					fields = append(fields, fmt.Sprintf("%s %s %s %s", col.Name.Value, act, "FLOAT", out))
-				}
-			}
-		case "string":
-			switch {
-			case col.DataType.Length.Value < 65535: //smallint -32768 to 32767
-				fields = append(fields, fmt.Sprintf("%s  %s %s(%d) %s", col.Name.Value, act, "VARCHAR", col.DataType.Length.Value, out))
-			default: //bigint -9223372036854775808 to 9223372036854775807
-				fields = append(fields, fmt.Sprintf("%s  %s %s %s", col.Name.Value, act, "TEXT", out))
-			}
-		case "duration":
-			fields = append(fields, fmt.Sprintf("%s %s  %s %s", col.Name.Value, act, "interval", out))
-		default:
-			fields = append(fields, fmt.Sprintf("%s %s  %s %s", col.Name.Value, act, col.DataType.Name, out))
-		}
-	case "mariadb", "mysql":
-		switch strings.ToLower(col.DataType.Name) {
-		case "integer":
-			switch col.DataType.Length.Value {
-			case 1, 2, 3: //tinyint -128 to 127
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "tinyint", out))
-			case 4, 5: //smallint -32768 to 32767
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "smallint", out))
-			case 6, 7: //mediumint -8388608 to 8388607
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "mediumint", out))
-			case 8, 9, 10, 11: //integer -2147483648 to 2147483647
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "integer", out))
-			default: //bigint -9223372036854775808 to 9223372036854775807
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "bigint", out))
-			}
-		case "float":
-			switch {
-			case col.DataType.Length.Value > 0:
-				fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "DECIMAL", col.DataType.Length.Value, out))
-			default:
-				if col.DataType.Precision != nil {
-					if col.DataType.Precision.Value > 0 && col.DataType.Scale == nil {
-						fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "DECIMAL", col.DataType.Precision.Value, out))
-					}
-					if col.DataType.Precision.Value > 0 && col.DataType.Scale != nil {
-						fields = append(fields, fmt.Sprintf("%s %s(%d,%d) %s", col.Name.Value, "DECIMAL", col.DataType.Precision.Value, col.DataType.Scale.Value, out))
-					}
-				} else {
-					fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "DOUBLE", out))
-				}
-			}
-		case "string":
-			switch {
-			case col.DataType.Length.Value <= 65535: //VARCHAR
-				fields = append(fields, fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "VARCHAR", col.DataType.Length.Value, out))
-			default: //MEDIUMTEXT
-				fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "MEDIUMTEXT", out))
+// sqliteCol traduit une définition de colonne vers les types SQLite.
+// Le nom de type déclaré est conservé autant que possible (VARCHAR(n), NUMERIC(p,s), DURATION)
+// afin que formType et getValueFromRealType retrouvent le type d'origine à la lecture.
+func sqliteCol(col *ast.SQLColumnDefinition, out string) (string, object.Object) {
+	switch strings.ToLower(col.DataType.Name) {
+	case "integer":
+		return fmt.Sprintf("%s %s %s", col.Name.Value, "INTEGER", out), object.NULL
+	case "float":
+		switch {
+		case col.DataType.Length != nil && col.DataType.Length.Value > 0:
+			return fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "NUMERIC", col.DataType.Length.Value, out), object.NULL
+		case col.DataType.Precision != nil && col.DataType.Precision.Value > 0:
+			if col.DataType.Scale != nil {
+				return fmt.Sprintf("%s %s(%d,%d) %s", col.Name.Value, "NUMERIC", col.DataType.Precision.Value, col.DataType.Scale.Value, out), object.NULL
 			}
-		case "duration":
-			fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, "interval", out))
+			return fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "NUMERIC", col.DataType.Precision.Value, out), object.NULL
 		default:
-			fields = append(fields, fmt.Sprintf("%s %s %s", col.Name.Value, col.DataType.Name, out))
+			return fmt.Sprintf("%s %s %s", col.Name.Value, "REAL", out), object.NULL
 		}
+	case "string":
+		if col.DataType.Length != nil && col.DataType.Length.Value > 0 {
+			return fmt.Sprintf("%s %s(%d) %s", col.Name.Value, "VARCHAR", col.DataType.Length.Value, out), object.NULL
+		}
+		return fmt.Sprintf("%s %s %s", col.Name.Value, "TEXT", out), object.NULL
+	case "boolean":
+		return fmt.Sprintf("%s %s %s", col.Name.Value, "BOOLEAN", out), object.NULL
+	case "date":
+		return fmt.Sprintf("%s %s %s", col.Name.Value, "DATE", out), object.NULL
+	case "time":
+		return fmt.Sprintf("%s %s %s", col.Name.Value, "TIMESTAMP", out), object.NULL
+	case "duration": // stockée en nanosecondes
+		return fmt.Sprintf("%s %s %s", col.Name.Value, "DURATION", out), object.NULL
 	default:
-		return "", newError("%s: Not supported", dbname)
+		return fmt.Sprintf("%s %s %s", col.Name.Value, col.DataType.Name, out), object.NULL
 	}
-	return fmt.Sprintf("ALTER TABLE %s %s %s", name, action, strings.Join(fields, ", ")), object.NULL
 }
 
 func evalSQLAlterObject(stmt *ast.SQLAlterObjectStatement, env *object.Environment) object.Object {
@@ -2327,36 +2416,9 @@ func evalSQLAlterObject(stmt *ast.SQLAlterObjectStatement, env *object.Environme
 
 	rows := int64(0)
 	for _, ac := range stmt.Actions {
-		if ac.Column == nil {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres", "mysql", "mariadb":
-				res, err := env.Exec(fmt.Sprintf("Alter table %s %s", stmt.ObjectName.Value, ac.String()))
-				if err != nil {
-					return newError("Nsina: %s", err.Error())
-				}
-				i, err := res.RowsAffected()
-				if err != nil {
-					return newError("Nsina: %s", err.Error())
-				}
-				rows += i
-			default:
-				return object.NULL
-			}
-			continue
-		}
-		act := strings.ToUpper(ac.Type)
-		if ac.Column != nil {
-			if act == "MODIFY" && strings.EqualFold(env.DBName(), "postgres") {
-				act = "ALTER COLUMN"
-			} else {
-				act = fmt.Sprintf("%s COLUMN", act)
-			}
-		} else if ac.Constraint != nil {
-			act = fmt.Sprintf("%s CONSTRAINT", act)
-		}
-		sql, er := stringCol(ac.Column, fmt.Sprintf("%s", act), stmt.ObjectName.Value, env.DBName())
-		if isError(er) {
-			return er
+		sql, err := env.Dialect().AlterTable(stmt.ObjectName.Value, ac)
+		if err != nil {
+			return newError("%s", err.Error())
 		}
 		res, err := env.Exec(sql)
 		// strSQL := stmt.String()
@@ -2385,25 +2447,14 @@ func evalSQLInsert(stmt *ast.SQLInsertStatement, env *object.Environment) object
 		strHeader := ""
 		strParams := ""
 
-		for k, set := range stmt.Columns {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				if strHeader == "" {
-					strHeader = fmt.Sprintf("%s", set.Value)
-					strParams = fmt.Sprintf("$%d", k+1)
-					continue
-				}
-				strHeader = fmt.Sprintf("%s, %s", strHeader, set.Value)
-				strParams = fmt.Sprintf("%s, $%d", strParams, k+1)
-			default:
-				if strHeader == "" {
-					strHeader = fmt.Sprintf("%s", set.Value)
-					strParams = fmt.Sprintf("%s", "?")
-					continue
-				}
-				strHeader = fmt.Sprintf("%s, %s", strHeader, set.Value)
-				strParams = fmt.Sprintf("%s, %s", strParams, "?")
+		for _, set := range stmt.Columns {
+			if strHeader == "" {
+				strHeader = fmt.Sprintf("%s", set.Value)
+				strParams = "?"
+				continue
 			}
+			strHeader = fmt.Sprintf("%s, %s", strHeader, set.Value)
+			strParams = fmt.Sprintf("%s, ?", strParams)
 		}
 
 		for _, set := range stmt.Values {
@@ -2449,7 +2500,7 @@ func evalSQLInsert(stmt *ast.SQLInsertStatement, env *object.Environment) object
 		return newError("Nsina: Invalid select statement '%s'", stmt.Select.String())
 	}
 	n, err := env.Exec(fmt.Sprintf("INSERT INTO %s(%s) %s", stmt.ObjectName.Value,
-		strHeader, strSQL.Inspect()))
+		strHeader, strSQL.Inspect()), sqlArgs(strSQL)...)
 	if err != nil {
 		return newError("%s", err.Error())
 	}
@@ -2483,12 +2534,12 @@ func defineObjectFromUpdateDelete(exp ast.Expression, env *object.Environment) o
 		// if ok && res.Type() == object.DBOBJECT_OBJ {
 		// 	return env.Set(from.Value, res)
 		// }
-		strSQL := fmt.Sprintf("select * FROM %s LIMIT 1", from.Value)
-		rows, err := env.Query(strSQL)
+		strSQL, args := firstRowSQL(from.Value, env)
+		rows, err := env.Query(strSQL, args...)
 		if err != nil {
 			return newError("Nsina: %s", err.Error())
 		}
-		defer rows.Close()
+		defer env.Release(rows)
 		result := object.DBStruct{Name: strings.ToLower(from.Value), Fields: make(map[string]object.Object)}
 		colt, err := rows.ColumnTypes()
 		if err != nil {
@@ -2526,7 +2577,7 @@ func evalSQLUpdate(stmt *ast.SQLUpdateStatement, env *object.Environment) object
 		if isError(filter) {
 			return filter
 		}
-		if !isTruthy(filter) {
+		if filter.Type() != object.DBFIELD_OBJ && !isTruthy(filter) {
 			return newError("Nsina: Invalid express '%s'", filter.Inspect())
 		}
 	}
@@ -2534,35 +2585,30 @@ func evalSQLUpdate(stmt *ast.SQLUpdateStatement, env *object.Environment) object
 	strValue := make([]any, 0)
 	strParams := ""
 
-	for k, set := range stmt.Set {
+	for _, set := range stmt.Set {
 		val := Eval(set.Value, scope)
-		switch strings.ToLower(env.DBName()) {
-		case "postgres":
-			if strParams == "" {
-				strParams = fmt.Sprintf("%s= $%d", set.Column.Value, k+1)
-				strValue = append(strValue, getObjectValue(val))
-				continue
-			}
-			strParams = fmt.Sprintf("%s, %s= $%d", strParams, set.Column.Value, k+1)
-		default:
-			if strParams == "" {
-				strParams = fmt.Sprintf("%s= ?", set.Column.Value)
-				strValue = append(strValue, getObjectValue(val))
-				continue
-			}
-			strParams = fmt.Sprintf("%s, %s= ?", strParams, set.Column.Value)
+		if isError(val) {
+			return val
+		}
+		v, args := sqlOperand(val)
+		if strParams == "" {
+			strParams = fmt.Sprintf("%s= %s", set.Column.Value, v)
+		} else {
+			strParams = fmt.Sprintf("%s, %s= %s", strParams, set.Column.Value, v)
 		}
-		strValue = append(strValue, getObjectValue(val))
+		strValue = append(strValue, args...)
 	}
 	strCond := ""
 	if filter != nil {
 		strCond = fmt.Sprintf("(%s)", filter.Inspect())
+		strValue = append(strValue, sqlArgs(filter)...)
 	}
 	if stmt.Where != nil {
 		condition := Eval(stmt.Where, scope)
 		if isError(condition) {
 			return condition
 		}
+		strValue = append(strValue, sqlArgs(condition)...)
 		if strCond == "" {
 			strCond = fmt.Sprintf("(%s)", condition.Inspect())
 		} else {
@@ -2611,13 +2657,15 @@ func evalSQLDelete(stmt *ast.SQLDeleteStatement, env *object.Environment) object
 			return condition
 		}
 		strSQL = fmt.Sprintf("DELETE FROM %s WHERE (%s)", stmt.From.Value, condition.Inspect())
+		args := sqlArgs(condition)
 		if filter != nil {
-			if !isTruthy(filter) {
+			if filter.Type() != object.DBFIELD_OBJ && !isTruthy(filter) {
 				return newError("Invalid expression '%s'", expr.String())
 			}
 			strSQL = fmt.Sprintf("DELETE FROM %s WHERE ((%s) And (%s))", stmt.From.Value, condition.Inspect(), filter.Inspect())
+			args = append(args, sqlArgs(filter)...)
 		}
-		result, err := scope.Exec(strSQL)
+		result, err := scope.Exec(strSQL, args...)
 		if err == nil {
 			rowsAffected, _ := result.RowsAffected()
 			env.Set("rows_affected", &object.Integer{Value: rowsAffected})
@@ -2629,7 +2677,7 @@ func evalSQLDelete(stmt *ast.SQLDeleteStatement, env *object.Environment) object
 		return newError("Nsina: %s", err.Error())
 	}
 	if filter != nil {
-		if !isTruthy(filter) {
+		if filter.Type() != object.DBFIELD_OBJ && !isTruthy(filter) {
 			return newError("Invalid expression '%s'", expr.String())
 		}
 		strSQL = fmt.Sprintf("DELETE FROM %s WHERE (%s)", stmt.From.Value, filter.Inspect())
@@ -2637,7 +2685,7 @@ func evalSQLDelete(stmt *ast.SQLDeleteStatement, env *object.Environment) object
 	if strSQL == "" {
 		return newError("Nsina: %s", "Invalid Where clause.")
 	}
-	result, err := scope.Exec(strSQL)
+	result, err := scope.Exec(strSQL, sqlArgs(filter)...)
 	if err == nil {
 		rowsAffected, _ := result.RowsAffected()
 		env.Set("rows_affected", &object.Integer{Value: rowsAffected})
@@ -2658,7 +2706,7 @@ func evalSQLTruncate(stmt *ast.SQLTruncateStatement, env *object.Environment) ob
 	if ok {
 		return newError("Can not empty '%s' because of an existing filter on it", stmt.ObjectName.Value)
 	}
-	res, err := env.Exec(fmt.Sprintf("TRUNCATE %s", stmt.ObjectName.Value))
+	res, err := env.Exec(env.Dialect().Truncate(stmt.ObjectName.Value))
 	if err != nil {
 		return newError("Nsina: %s", err.Error())
 	}
@@ -2744,15 +2792,19 @@ func getDefaultSQLValue(dataType string) object.Object {
 	switch strings.ToLower(dataType) {
 	case "integer2", "integer4", "integer8", "integer", "int", "int2", "int4", "int8", "smallint", "mediumint", "bigint":
 		return &object.Integer{Value: 0}
-	case "float", "numeric", "decimal", "double", "foat8", "float8", "double precision":
+	case "float", "double", "foat8", "float8", "double precision", "real":
 		return &object.Float{Value: 0.0}
+	case "numeric", "decimal":
+		return &object.Decimal{}
 	case "varchar", "string", "char", "nchar", "text", "nvarchar2", "varchar2", "mediumtext", "longtext":
 		return &object.String{Value: ""}
-	case "boolean", "bool":
+	case "boolean", "bool", "bit":
 		return object.FALSE
-	case "date", "datetime":
+	case "date":
 		return &object.Date{Value: time.Now()}
-	case "time", "timestamp":
+	case "datetime", "timestamptz", "datetimeoffset":
+		return &object.DateTime{Value: time.Now().UTC()}
+	case "time", "timestamp", "datetime2":
 		return &object.Time{Value: time.Now()}
 	case "duration", "interval":
 		return &object.Duration{Nanoseconds: 0, Original: ""}
@@ -2761,31 +2813,19 @@ func getDefaultSQLValue(dataType string) object.Object {
 	}
 }
 
-func escape(val, p string) string {
-	return strings.TrimSuffix(strings.TrimPrefix(val, p), p)
-}
-
 func getObjectValue(val object.Object) any {
 	if val == nil {
 		return object.NULL.Inspect()
 	}
 	switch val.Type() {
-	case object.INTEGER_OBJ:
-		return val.(*object.Integer).Value
-	case object.FLOAT_OBJ:
-		return val.(*object.Float).Value
-	case object.STRING_OBJ:
-		return escape(val.(*object.String).Value, "'")
-	case object.BOOLEAN_OBJ:
-		return val.(*object.Boolean).Value
-	case object.DATE_OBJ:
-		return val.(*object.Date).Value
-	case object.TIME_OBJ:
-		return val.(*object.Time).Value
-	case object.DURATION_OBJ:
-		return val.(*object.Duration).Nanoseconds
-	default:
+	case object.MAP_OBJ, object.ARRAY_OBJ, object.STRUCT_OBJ:
+		// valeur json: liée sous sa forme textuelle
+		if data, err := object.EncodeJSON(val); err == nil {
+			return string(data)
+		}
 		return object.NULL.Inspect()
+	default:
+		return object.GoValue(val)
 	}
 }
 
@@ -2797,19 +2837,22 @@ func getDefaultSQLValueAddress(s string) any {
 		"int8", "integer8", "int4", "integer4", "int2", "integer2", "duration", "interval":
 		v := int64(0)
 		return &v
-	case "float", "numeric", "decimal", "double":
+	case "float", "double", "real":
 		v := float64(0)
 		return &v
-	case "name", "varchar", "char", "mediumtext", "longtext", "text", "varchar2", "nvarchar", "nvarchar2":
+	case "numeric", "decimal":
+		v := decimal.Zero
+		return &v
+	case "name", "varchar", "char", "mediumtext", "longtext", "text", "varchar2", "nvarchar", "nvarchar2", "json", "jsonb":
 		v := ""
 		return &v
-	case "boolean", "bool":
+	case "boolean", "bool", "bit":
 		v := false
 		return &v
 	case "date":
 		v := time.Now()
 		return &v
-	case "time", "timestamp", "datetime":
+	case "time", "timestamp", "datetime", "datetime2", "timestamptz", "datetimeoffset":
 		v := time.Now()
 		return &v
 	default:
@@ -2821,6 +2864,167 @@ func GetDefaultSQLValueAddress(s string) any {
 	return getDefaultSQLValueAddress(s)
 }
 
+// sqlValue convertit une valeur lue par Scan selon le type de sa colonne
+func sqlValue(typ string, val any) object.Object {
+	t := strings.ToLower(strings.Split(typ, "(")[0])
+	switch v := val.(type) {
+	case nil:
+		return object.NULL
+	case int64:
+		switch t {
+		case "boolean", "bool", "bit":
+			return &object.Boolean{Value: v != 0}
+		case "duration", "interval":
+			return &object.Duration{Nanoseconds: v}
+		case "numeric", "decimal":
+			return &object.Decimal{Value: decimal.NewFromInt(v)}
+		}
+		return &object.Integer{Value: v}
+	case float64:
+		if t == "numeric" || t == "decimal" {
+			return &object.Decimal{Value: decimal.NewFromFloat(v)}
+		}
+		return &object.Float{Value: v}
+	case bool:
+		return &object.Boolean{Value: v}
+	case time.Time:
+		switch t {
+		case "time", "datetime2":
+			return &object.Time{Value: v}
+		case "datetime", "timestamptz", "datetimeoffset":
+			return &object.DateTime{Value: v}
+		}
+		return &object.Date{Value: v}
+	case []byte:
+		return sqlValue(typ, string(v))
+	case string:
+		switch t {
+		case "integer", "int", "smallint", "mediumint", "bigint", "tinyint",
+			"int8", "integer8", "int4", "integer4", "int2", "integer2":
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return &object.Integer{Value: i}
+			}
+		case "float", "double", "real":
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return &object.Float{Value: f}
+			}
+		case "numeric", "decimal":
+			if d, err := decimal.NewFromString(v); err == nil {
+				return &object.Decimal{Value: d}
+			}
+		case "boolean", "bool", "bit":
+			if b, err := strconv.ParseBool(v); err == nil {
+				return &object.Boolean{Value: b}
+			}
+		case "datetime", "timestamptz", "datetimeoffset":
+			if d, err := object.ParseDateTime(v); err == nil {
+				return &object.DateTime{Value: d}
+			}
+		case "date", "timestamp":
+			for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02", time.RFC3339} {
+				if d, err := time.Parse(layout, v); err == nil {
+					return &object.Date{Value: d}
+				}
+			}
+		case "json", "jsonb":
+			return jsonColumn(v)
+		}
+		return &object.String{Value: v}
+	default:
+		return &object.String{Value: fmt.Sprint(v)}
+	}
+}
+
+// scanRow lit l'enregistrement courant dans une structure du type name, un champ par colonne
+func scanRow(rows *sql.Rows, cols []*sql.ColumnType, names []string, name string) (*object.Struct, error) {
+	values := make([]any, len(cols))
+	args := make([]any, len(cols))
+	for k := range values {
+		args[k] = &values[k]
+	}
+	if err := rows.Scan(args...); err != nil {
+		return nil, err
+	}
+	row := &object.Struct{Name: name, Fields: make(map[string]object.Object)}
+	for k, col := range cols {
+		row.Fields[names[k]] = sqlValue(col.DatabaseTypeName(), values[k])
+	}
+	return row, nil
+}
+
+// nextRow lit la ligne suivante du curseur, NULL quand il est épuisé
+func nextRow(res *object.SQLResult) object.Object {
+	if !res.IsCursor() {
+		return object.NULL
+	}
+	cols, err := res.ColumnTypes()
+	if err != nil {
+		return newError("Nsina: %s", err.Error())
+	}
+	if !res.Rows.Next() {
+		err := res.Rows.Err()
+		res.Close()
+		if err != nil {
+			return newError("Nsina: %s", err.Error())
+		}
+		return object.NULL
+	}
+	row, err := scanRow(res.Rows, cols, res.Columns, "")
+	if err != nil {
+		return newError("Nsina: %s", err.Error())
+	}
+	return row
+}
+
+// fetchRows lit au plus n lignes du curseur; le tableau est vide quand il est épuisé
+func fetchRows(res *object.SQLResult, n int64) object.Object {
+	arr := &object.Array{Elements: make([]object.Object, 0)}
+	for k := int64(0); k < n; k++ {
+		row := nextRow(res)
+		if isError(row) {
+			return row
+		}
+		if row == object.NULL {
+			break
+		}
+		arr.Elements = append(arr.Elements, row)
+	}
+	return arr
+}
+
+// readRows lit toutes les lignes d'un SELECT dans un tableau de elementType et ferme le curseur.
+// Chaque ligne donne une structure, ou la valeur de l'unique colonne si elementType est un type simple
+func readRows(res *object.SQLResult, elementType string) object.Object {
+	defer res.Close()
+	if !res.IsCursor() {
+		return newError("Nsina: the cursor is closed")
+	}
+	cols, err := res.ColumnTypes()
+	if err != nil {
+		return newError("Nsina: %s", err.Error())
+	}
+	scalar := getDefaultValue(elementType) != object.NULL && !strings.HasPrefix(elementType, "array")
+	if scalar && len(cols) != 1 {
+		return newError("Nsina: 'array of %s' expects a single column, the query returns %d", elementType, len(cols))
+	}
+	arr := &object.Array{ElementType: elementType, Elements: make([]object.Object, 0)}
+	for res.Rows.Next() {
+		row, err := scanRow(res.Rows, cols, res.Columns, elementType)
+		if err != nil {
+			return newError("Nsina: %s", err.Error())
+		}
+		if scalar {
+			arr.Elements = append(arr.Elements, row.Fields[res.Columns[0]])
+			continue
+		}
+		arr.Elements = append(arr.Elements, row)
+	}
+	if err := res.Rows.Err(); err != nil {
+		return newError("Nsina: %s", err.Error())
+	}
+	return arr
+}
+
 func getValueFromRealType(typ string, val any) object.Object {
 	if val == nil {
 		return object.NULL
@@ -2830,15 +3034,21 @@ func getValueFromRealType(typ string, val any) object.Object {
 	case "integer", "int", "smallint", "mediumint", "bigint",
 		"int8", "integer8", "int4", "integer4", "int2", "integer2":
 		return &object.Integer{Value: *(val.(*int64))}
-	case "float", "numeric", "decimal", "double":
+	case "float", "double", "real":
 		return &object.Float{Value: *(val.(*float64))}
+	case "numeric", "decimal":
+		return &object.Decimal{Value: *(val.(*decimal.Decimal))}
 	case "name", "varchar", "char", "mediumtext", "longtext", "text", "varchar2", "nvarchar", "nvarchar2":
 		return &object.String{Value: *(val.(*string))}
-	case "boolean", "bool":
+	case "json", "jsonb":
+		return jsonColumn(*(val.(*string)))
+	case "boolean", "bool", "bit":
 		return &object.Boolean{Value: *(val.(*bool))}
-	case "date", "timestamp", "datetime":
+	case "date", "timestamp":
 		return &object.Date{Value: *(val.(*time.Time))}
-	case "time":
+	case "datetime", "timestamptz", "datetimeoffset":
+		return &object.DateTime{Value: *(val.(*time.Time))}
+	case "time", "datetime2":
 		return &object.Time{Value: *(val.(*time.Time))}
 	case "duration":
 		return &object.Duration{Nanoseconds: *(val.(*int64))}
@@ -2862,6 +3072,7 @@ func evalSQLWithStatement(stmt *ast.SQLWithStatement, env *object.Environment) o
 		sql = "WITH RECURSIVE"
 	}
 	var objSQL object.Object
+	var args []any
 	for i, cte := range stmt.CTEs {
 		if cte.Query.Union != nil {
 			objSQL = toString(cte.Query, cte.Name.Value, cteEnv)
@@ -2878,6 +3089,7 @@ func evalSQLWithStatement(stmt *ast.SQLWithStatement, env *object.Environment) o
 			cols = fmt.Sprintf("(%s)", cols)
 		}
 
+		args = append(args, sqlArgs(objSQL)...)
 		if i == 0 {
 			sql = fmt.Sprintf("%s %s %s AS (%s)", sql, cte.Name.Value, cols, objSQL.Inspect())
 		} else {
@@ -2922,11 +3134,11 @@ func evalSQLWithStatement(stmt *ast.SQLWithStatement, env *object.Environment) o
 	if isError(str) {
 		return str
 	}
-	rows, err := env.Query(fmt.Sprintf("%s %s", sql, str.Inspect()))
+	rows, err := env.Query(fmt.Sprintf("%s %s", sql, str.Inspect()), append(args, sqlArgs(str)...)...)
 	if err != nil {
 		return newError("%s", err.Error())
 	}
-	result.Rows = rows
+	env.SetRows(result, rows)
 	cols, err := rows.Columns()
 	if err != nil {
 		return newError("Nsina: %s", err.Error())
@@ -3280,10 +3492,16 @@ func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) obj
 	if isError(index) {
 		return index
 	}
+	return indexValue(left, index)
+}
 
+// indexValue renvoie l'élément index de left
+func indexValue(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.SET_OBJ:
 		return evalSetIndexExpression(left, index)
+	case left.Type() == object.MAP_OBJ:
+		return evalMapIndexExpression(left.(*object.Map), index)
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
@@ -3439,7 +3657,7 @@ func evalInExpression(node *ast.InExpression, env *object.Environment) object.Ob
 	var right object.Object
 
 	if val, ok := node.Right.(*ast.SQLSelectStatement); ok {
-		right = &object.DBField{OType: string(object.DBOBJECT_OBJ), Value: toString(val, "", env).Inspect()}
+		right = toString(val, "", env)
 	} else {
 		right = Eval(node.Right, env)
 	}
@@ -3464,23 +3682,17 @@ func evalInExpression(node *ast.InExpression, env *object.Environment) object.Ob
 		if node.Not {
 			strOper = "NOT IN"
 		}
+		args := sqlArgs(left)
 		for _, v := range right.Elements {
-			switch strings.ToLower(right.ElementType) {
-			case "string":
-				if strVal == "" {
-					strVal = fmt.Sprintf("'%s'", v.Inspect())
-					continue
-				}
-				strVal = fmt.Sprintf("%s, '%s'", strVal, v.Inspect())
-			default:
-				if strVal == "" {
-					strVal = v.Inspect()
-					continue
-				}
-				strVal = fmt.Sprintf("%s, %s", strVal, v.Inspect())
+			val, vargs := sqlOperand(v)
+			args = append(args, vargs...)
+			if strVal == "" {
+				strVal = val
+				continue
 			}
+			strVal = fmt.Sprintf("%s, %s", strVal, val)
 		}
-		return &object.DBField{OType: string(object.BOOLEAN_OBJ), Value: fmt.Sprintf("%s %s (%s)", left.Inspect(), strOper, strVal)}
+		return &object.DBField{OType: string(object.BOOLEAN_OBJ), Value: fmt.Sprintf("%s %s (%s)", left.Inspect(), strOper, strVal), Args: args}
 	case *object.String:
 		if left.Type() != object.STRING_OBJ {
 			return newError("L'opérateur IN sur les chaînes nécessite une chaîne à gauche")
@@ -3493,7 +3705,14 @@ func evalInExpression(node *ast.InExpression, env *object.Environment) object.Ob
 		}
 		return &object.Boolean{Value: contains}
 	case *object.DBField:
-		return &object.DBField{OType: string(object.BOOLEAN_OBJ), Value: fmt.Sprintf("%s IN (%s)", left.Inspect(), right.Inspect())}
+		l, largs := sqlOperand(left)
+		return &object.DBField{OType: string(object.BOOLEAN_OBJ), Value: fmt.Sprintf("%s IN (%s)", l, right.Inspect()), Args: joinArgs(largs, right.Args)}
+	case *object.Map:
+		_, ok := right.Get(coerceNumber(right.KeyType, left))
+		if node.Not {
+			return &object.Boolean{Value: !ok}
+		}
+		return &object.Boolean{Value: ok}
 	case *object.Set:
 		if left.Type() != object.DBFIELD_OBJ {
 			return newError("%s does not support in", right.Type())
@@ -3518,6 +3737,11 @@ func arrayContains(array *object.Array, element object.Object) bool {
 }
 
 func objectsEqual(a, b object.Object) bool {
+	if isDecimalOperation(a, b) {
+		x, _ := object.ToDecimal(a)
+		y, _ := object.ToDecimal(b)
+		return x.Value.Equal(y.Value)
+	}
 	if a.Type() != b.Type() {
 		if (a.Type() == object.INTEGER_OBJ && b.Type() == object.FLOAT_OBJ) ||
 			(b.Type() == object.INTEGER_OBJ && a.Type() == object.FLOAT_OBJ) {
@@ -3542,6 +3766,8 @@ func objectsEqual(a, b object.Object) bool {
 	case *object.Float:
 		b := b.(*object.Float)
 		return a.Value == b.Value
+	case *object.Decimal:
+		return a.Value.Equal(b.(*object.Decimal).Value)
 	case *object.String:
 		b := b.(*object.String)
 		return a.Value == b.Value
@@ -3572,45 +3798,51 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 	f, ok := env.Get(node.Function.Value)
 	if ok && f.Type() == object.FUNCTION_OBJ {
 		//run the function
-		ob := f.(*object.Function)
-		if ob.Maxcall == 0 {
-			return newError("Nsina: %s", "Maximum recursive call limit reached for function "+node.Function.Value)
-		}
-		if ob.Maxcall > 0 {
-			ob.Maxcall = ob.Maxcall - 1
-		}
-		defer func() {
-			if ob.Maxcall >= 0 {
-				ob.Maxcall = ob.Maxcall + 1
-			}
-		}()
-		callEnv := object.NewEnclosedEnvironment(env)
-		for k, field := range ob.Parameters {
-			if k == 0 {
-				val := Eval(node.Array, env)
-				if isError(val) {
-					return val
-				}
-				callEnv.Declare(field.Name.Value, val)
+		args := make([]object.Object, 0, len(node.Arguments)+1)
+		for _, arg := range append([]ast.Expression{node.Array}, node.Arguments...) {
+			if arg == nil {
 				continue
 			}
-			val := Eval(node.Arguments[k-1], env)
+			val := Eval(arg, env)
 			if isError(val) {
 				return val
 			}
-			callEnv.Declare(field.Name.Value, val)
-		}
-		val := Eval(ob.Body, callEnv)
-		if val == nil {
-			return nil
+			args = append(args, val)
 		}
-		if val, ok := val.(*object.ReturnValue); ok {
-			return val.Value
-		}
-		return val
+		return applyFunction(node.Function.Value, f.(*object.Function), args, env)
 	}
 	fn := strings.ToLower(node.Function.Value)
 	switch fn {
+	case "next", "fetch", "close":
+		arg := Eval(node.Array, env)
+		if isError(arg) {
+			return arg
+		}
+		res, ok := arg.(*object.SQLResult)
+		if !ok || res.Rows == nil {
+			return newError("Nsina: %s expects the result of a select, got '%s'", fn, node.Array.String())
+		}
+		switch fn {
+		case "next":
+			return nextRow(res)
+		case "close":
+			if err := res.Close(); err != nil {
+				return newError("Nsina: %s", err.Error())
+			}
+			return object.TRUE
+		}
+		if len(node.Arguments) != 1 {
+			return newError("Nsina: fetch requires the number of rows to read")
+		}
+		n := Eval(node.Arguments[0], env)
+		if isError(n) {
+			return n
+		}
+		size, ok := n.(*object.Integer)
+		if !ok || size.Value < 0 {
+			return newError("Nsina: fetch expects a positive number of rows, got '%s'", n.Inspect())
+		}
+		return fetchRows(res, size.Value)
 	case "idpcreaterole", "idpcreateuser", "idpdeleterole", "idpdeleteuser":
 		if len(node.Arguments) != 0 {
 			return newError("%s requires only one argument", strings.ToLower(node.Function.Value))
@@ -3645,12 +3877,10 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("EXTRACT(YEAR FROM TIMESTAMP '%s')", arg.Inspect())}
-			default:
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("YEAR(%s)", arg.Inspect())}
-			}
+			return &object.DBField{OType: string(object.INTEGER_OBJ), Value: env.Dialect().DatePart("YEAR", arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if dt, ok := arg.(*object.DateTime); ok {
+			return &object.Integer{Value: int64(dt.Value.Year())}
 		}
 		if arg.Type() == object.DURATION_OBJ {
 			return &object.Integer{Value: int64(arg.(*object.Duration).Years())}
@@ -3665,12 +3895,10 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("EXTRACT(MONTH FROM TIMESTAMP '%s')", arg.Inspect())}
-			default:
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("MONTH(%s)", arg.Inspect())}
-			}
+			return &object.DBField{OType: string(object.INTEGER_OBJ), Value: env.Dialect().DatePart("MONTH", arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if dt, ok := arg.(*object.DateTime); ok {
+			return &object.Integer{Value: int64(dt.Value.Month())}
 		}
 		if arg.Type() == object.DURATION_OBJ {
 			return &object.Integer{Value: int64(arg.(*object.Duration).Months())}
@@ -3685,12 +3913,10 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("EXTRACT(DAY FROM TIMESTAMP '%s')", arg.Inspect())}
-			default:
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("Day(%s)", arg.Inspect())}
-			}
+			return &object.DBField{OType: string(object.INTEGER_OBJ), Value: env.Dialect().DatePart("DAY", arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if dt, ok := arg.(*object.DateTime); ok {
+			return &object.Integer{Value: int64(dt.Value.Day())}
 		}
 		if arg.Type() == object.DURATION_OBJ {
 			return &object.Integer{Value: int64(arg.(*object.Duration).Days())}
@@ -3705,12 +3931,10 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("EXTRACT(HOUR FROM INTERVAL '%s')", arg.Inspect())}
-			default:
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("HOUR(%s)", arg.Inspect())}
-			}
+			return &object.DBField{OType: string(object.INTEGER_OBJ), Value: env.Dialect().DatePart("HOUR", arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if dt, ok := object.ToDateTime(arg); ok {
+			return &object.Integer{Value: int64(dt.Value.Hour())}
 		}
 		if arg.Type() == object.DURATION_OBJ {
 			return &object.Integer{Value: arg.(*object.Duration).Hours()}
@@ -3722,12 +3946,10 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("EXTRACT(MINUTE FROM INTERVAL '%s')", arg.Inspect())}
-			default:
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("MINUTE(%s)", arg.Inspect())}
-			}
+			return &object.DBField{OType: string(object.INTEGER_OBJ), Value: env.Dialect().DatePart("MINUTE", arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if dt, ok := object.ToDateTime(arg); ok {
+			return &object.Integer{Value: int64(dt.Value.Minute())}
 		}
 		if arg.Type() == object.DURATION_OBJ {
 			return &object.Integer{Value: arg.(*object.Duration).Minutes()}
@@ -3739,12 +3961,10 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			switch strings.ToLower(env.DBName()) {
-			case "postgres":
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("EXTRACT(SECOND FROM INTERVAL '%s')", arg.Inspect())}
-			default:
-				return &object.DBField{OType: string(object.INTEGER_OBJ), Value: fmt.Sprintf("SECOND(%s)", arg.Inspect())}
-			}
+			return &object.DBField{OType: string(object.INTEGER_OBJ), Value: env.Dialect().DatePart("SECOND", arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if dt, ok := object.ToDateTime(arg); ok {
+			return &object.Integer{Value: int64(dt.Value.Second())}
 		}
 		if arg.Type() == object.DURATION_OBJ {
 			return &object.Integer{Value: arg.(*object.Duration).Seconds()}
@@ -3757,10 +3977,11 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		arg := Eval(node.Array, env)
 		val := Eval(node.Arguments[0], env)
 		if arg.Type() == object.DBFIELD_OBJ {
+			v, vargs := sqlOperand(val)
 			if val.Type() == object.STRING_OBJ {
-				return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("coalesce(%s,%s)", arg.Inspect(), fmt.Sprintf("'%s'", val.Inspect()))}
+				return &object.DBField{OType: string(object.STRING_OBJ), Value: env.Dialect().Coalesce(arg.Inspect(), v), Args: joinArgs(sqlArgs(arg), vargs)}
 			}
-			return &object.DBField{OType: string(arg.Type()), Value: fmt.Sprintf("coalesce(%s,%s)", arg.Inspect(), val.Inspect())}
+			return &object.DBField{OType: string(arg.Type()), Value: env.Dialect().Coalesce(arg.Inspect(), v), Args: joinArgs(sqlArgs(arg), vargs)}
 		}
 		if arg.Type() == object.NULL.Type() {
 			return Eval(node.Arguments[0], env)
@@ -3772,7 +3993,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("Trim(%s)", arg.Inspect())}
+			return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("Trim(%s)", arg.Inspect()), Args: sqlArgs(arg)}
 		}
 		if arg.Type() == object.STRING_OBJ {
 			return &object.String{Value: strings.TrimSpace(arg.Inspect())}
@@ -3784,7 +4005,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("Upper(%s)", arg.Inspect())}
+			return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("Upper(%s)", arg.Inspect()), Args: sqlArgs(arg)}
 		}
 		if arg.Type() == object.STRING_OBJ {
 			return &object.String{Value: strings.ToUpper(arg.Inspect())}
@@ -3796,7 +4017,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		arg := Eval(node.Array, env)
 		if arg.Type() == object.DBFIELD_OBJ {
-			return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("%s(%s)", node.Function.Value, arg.Inspect())}
+			return &object.DBField{OType: string(object.STRING_OBJ), Value: fmt.Sprintf("%s(%s)", node.Function.Value, arg.Inspect()), Args: sqlArgs(arg)}
 		}
 		if arg.Type() == object.STRING_OBJ {
 			return &object.String{Value: strings.ToLower(arg.Inspect())}
@@ -3808,13 +4029,39 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 			if len(node.Arguments) > 0 {
 				return newError("Nsina: %s Too much arguments", node.Function.String())
 			}
-			return &object.DBField{OType: arg.(*object.DBField).OType, Value: fmt.Sprintf("%s(%s)", node.Function.Value, arg.Inspect())}
+			return &object.DBField{OType: arg.(*object.DBField).OType, Value: fmt.Sprintf("%s(%s)", node.Function.Value, arg.Inspect()), Args: sqlArgs(arg)}
+		}
+		if isError(arg) {
+			return arg
+		}
+		rest := make([]object.Object, 0, len(node.Arguments))
+		for _, k := range node.Arguments {
+			v := Eval(k, env)
+			if isError(v) {
+				return v
+			}
+			rest = append(rest, v)
+		}
+		// sum, min et max d'un tableau portent sur ses éléments
+		if arr, ok := arg.(*object.Array); ok && len(rest) == 0 && fn != "count" {
+			if len(arr.Elements) == 0 {
+				if fn == "sum" {
+					return getDefaultValue(arr.ElementType)
+				}
+				return object.NULL
+			}
+			arg, rest = arr.Elements[0], arr.Elements[1:]
+		}
+		isDecimal := arg.Type() == object.DECIMAL_OBJ
+		for _, v := range rest {
+			isDecimal = isDecimal || v.Type() == object.DECIMAL_OBJ
 		}
 		switch {
+		case isDecimal && fn != "count":
+			return aggregateDecimal(fn, append([]object.Object{arg}, rest...))
 		case arg.Type() == object.INTEGER_OBJ:
 			result := &object.Integer{Value: arg.(*object.Integer).Value}
-			for _, k := range node.Arguments {
-				arg = Eval(k, env)
+			for _, arg := range rest {
 				if v, ok := arg.(*object.Integer); ok {
 					switch fn {
 					case "sum":
@@ -3837,8 +4084,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 			return result
 		case arg.Type() == object.FLOAT_OBJ:
 			result := &object.Float{Value: arg.(*object.Float).Value}
-			for _, k := range node.Arguments {
-				arg = Eval(k, env)
+			for _, arg := range rest {
 				if v, ok := arg.(*object.Float); ok {
 					switch fn {
 					case "sum":
@@ -3861,8 +4107,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 			return result
 		case arg.Type() == object.STRING_OBJ:
 			result := &object.String{Value: arg.(*object.String).Value}
-			for _, k := range node.Arguments {
-				arg = Eval(k, env)
+			for _, arg := range rest {
 				if v, ok := arg.(*object.String); ok {
 					switch fn {
 					case "sum":
@@ -3899,7 +4144,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 			if arg.Type() == object.DBFIELD_OBJ {
 				if v1.Value > v2.Value {
 					return &object.DBField{OType: arg.(*object.DBField).OType, Value: fmt.Sprintf("%s(%s,%d,%d)", node.Function.Value,
-						arg.Inspect(), v1.Value, v2.Value)}
+						arg.Inspect(), v1.Value, v2.Value), Args: sqlArgs(arg)}
 				}
 				return newError("Invalid 'substr' parameters :%s(%s,%d,%d)", node.Function.Value,
 					arg.Inspect(), v1.Value, v2.Value)
@@ -3914,7 +4159,7 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		}
 		return newError("Nsina: Invalid operation: %s", node.String())
 	case "iserrorraised":
-		return &object.Boolean{Value: isError(last_value)}
+		return &object.Boolean{Value: isError(env.LastValue())}
 	case "tostring":
 		//TODO: A definir
 		val := Eval(node.Array, env)
@@ -4042,24 +4287,6 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		default:
 			return newError("Invalid type for toFloat: %s", val.Type())
 		}
-	case "parsedate", "parsetime", "parsedatetime":
-		if len(node.Arguments) != 0 {
-			return newError("%s requires only one argument", node.Function.Value)
-		}
-		val := Eval(node.Array, env)
-		if isError(val) {
-			return val
-		}
-		switch val.Type() {
-		case object.STRING_OBJ:
-			v, e := toTime(val.(*object.String).Value)
-			if e != nil {
-				return newError("Invalid date/time value: %s", val.(*object.String).Value)
-			}
-			return &object.Time{Value: v}
-		default:
-			return newError("Invalid type for %s: %s", node.Function.Value, val.Type())
-		}
 	case "parseduration":
 		if len(node.Arguments) != 0 {
 			return newError("%s requires only one argument", node.Function.Value)
@@ -4078,18 +4305,16 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 		default:
 			return newError("Invalid type for parseduration: %s", val.Type())
 		}
-	case "now":
-		if len(node.Arguments) != 0 || node.Array != nil {
-			return newError("now requires no arguments")
-		}
-		return &object.Time{Value: time.Now()}
-	case "today":
-		if len(node.Arguments) != 0 || node.Array != nil {
-			return newError("today requires no arguments")
-		}
-		now := time.Now()
-		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		return &object.Time{Value: today}
+	case "now", "today", "convert_tz", "format_date", "parsedate", "parsetime", "parsedatetime":
+		return evalDateFunction(node, env)
+	case "round", "parsedecimal":
+		return evalDecimalFunction(node, env)
+	case "keys", "values", "has_key", "delete":
+		return evalMapFunction(node, env)
+	case "parsejson", "tojson":
+		return evalJSONFunction(node, env)
+	case "map", "filter", "reduce", "sort_by", "any", "all", "find":
+		return evalLambdaFunction(node, env)
 	}
 	array := Eval(node.Array, env)
 	if isError(array) {
@@ -4099,6 +4324,9 @@ func evalArrayFunctionCall(node *ast.ArrayFunctionCall, env *object.Environment)
 	if array.Type() != object.ARRAY_OBJ {
 		switch strings.ToLower(node.Function.Value) {
 		case "len", "length":
+			if m, ok := array.(*object.Map); ok {
+				return &object.Integer{Value: int64(m.Len())}
+			}
 			return &object.Integer{Value: int64(len(array.Inspect()))}
 		case "tostring":
 			return &object.String{Value: array.Inspect()}
@@ -4287,15 +4515,15 @@ func NewFixedSizeArray(size int64, elementType string) *object.Array {
 		Size:        size,
 	}
 }
-func evalSwitchStatement(node *ast.SwitchStatement, env *object.Environment) object.Object {
+func evalSwitchStatement(node *ast.SwitchStatement, env *object.Environment) (result object.Object) {
 	// Évaluer l'expression du switch
 	scope := object.NewEnclosedEnvironment(env)
+	defer func() { endScope(scope, result) }()
 	switchValue := Eval(node.Expression, scope)
 	if isError(switchValue) {
 		return switchValue
 	}
 
-	var result object.Object
 	matched := false
 
 	// Vérifier chaque case
@@ -4430,6 +4658,7 @@ func evalWhileStatement(whileStmt *ast.WhileStatement, env *object.Environment)
 
 		// Évaluer le corps
 		result := evalForBody(whileStmt.Body, scope)
+		endScope(scope, result)
 
 		if result != nil {
 			rt := result.Type()
@@ -4584,13 +4813,25 @@ func evalBetweenExpression(node *ast.BetweenExpression, env *object.Environment)
 		return high
 	}
 
+	if value.Type() == object.DBFIELD_OBJ || low.Type() == object.DBFIELD_OBJ || high.Type() == object.DBFIELD_OBJ {
+		v, vargs := sqlOperand(value)
+		l, largs := sqlOperand(low)
+		h, hargs := sqlOperand(high)
+		op := "BETWEEN"
+		if node.Not {
+			op = "NOT BETWEEN"
+		}
+		return &object.DBField{OType: string(object.BOOLEAN_OBJ), Value: fmt.Sprintf("(%s %s %s AND %s)", v, op, l, h),
+			Args: joinArgs(vargs, largs, hargs)}
+	}
+
 	// Compare values
-	lowComp := evalInfixExpression("<", low, value)
+	lowComp := evalInfixExpression("<", low, value, env)
 	if isError(lowComp) {
 		return lowComp
 	}
 
-	highComp := evalInfixExpression("<", value, high)
+	highComp := evalInfixExpression("<", value, high, env)
 	if isError(highComp) {
 		return highComp
 	}
@@ -4621,35 +4862,26 @@ func evalForEachStatement(n ast.Node, env *object.Environment) object.Object {
 
 	switch coll := collection.(type) {
 	case *object.SQLResult:
-		if coll.Rows == nil {
+		if !coll.IsCursor() {
 			return object.NULL
 		}
-		defer coll.Rows.Close()
+		defer coll.Close()
 
-		_, err1 := coll.Rows.Columns()
-		cols, err2 := coll.Rows.ColumnTypes()
-		if err1 != nil {
-			return newError("Nsina; %s", err1.Error())
-		}
-		if err2 != nil {
-			return newError("Nsina; %s", err2.Error())
-		}
-
-		args := make([]any, 0)
-		for k := range coll.Columns {
-			args = append(args, getDefaultSQLValueAddress(cols[k].DatabaseTypeName()))
+		cols, err := coll.ColumnTypes()
+		if err != nil {
+			return newError("Nsina; %s", err.Error())
 		}
 		for coll.Rows.Next() {
 			loopEnv := object.NewEnclosedEnvironment(env)
-			coll.Rows.Scan(args...)
-			row := &object.Struct{Name: "", Fields: make(map[string]object.Object)}
-			for k, val := range args {
-				row.Fields[coll.Columns[k]] = getValueFromRealType(cols[k].DatabaseTypeName(), val)
+			row, err := scanRow(coll.Rows, cols, coll.Columns, "")
+			if err != nil {
+				return newError("Nsina: %s", err.Error())
 			}
 			//Traiter la lecture de l'enregistrement
 			loopEnv.Declare(node.Variable.Value, row) //el
 			// Évaluer le corps avec l'environnement local
 			result := evalForBody(node.Body, loopEnv)
+			endScope(loopEnv, result)
 			if result != nil {
 				rt := result.Type()
 
@@ -4685,6 +4917,7 @@ func evalForEachStatement(n ast.Node, env *object.Environment) object.Object {
 			loopEnv.Declare(node.Variable.Value, el)
 			// Évaluer le corps avec l'environnement local
 			result := evalForBody(node.Body, loopEnv)
+			endScope(loopEnv, result)
 			if result != nil {
 				rt := result.Type()
 
@@ -4713,6 +4946,7 @@ func evalForEachStatement(n ast.Node, env *object.Environment) object.Object {
 
 			// Évaluer le corps avec l'environnement local
 			result := evalForBody(node.Body, loopEnv)
+			endScope(loopEnv, result)
 			if result != nil {
 				rt := result.Type()
 
@@ -4732,6 +4966,8 @@ func evalForEachStatement(n ast.Node, env *object.Environment) object.Object {
 			}
 		}
 		return object.NULL
+	case *object.Map:
+		return evalMapForEach(node, coll, env)
 	default:
 		return newError("L'opérande de foreach n'est pas itérable: %s", collection.Type())
 	}
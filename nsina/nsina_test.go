@@ -1,5 +1,24 @@
 package nsina
 
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/object"
+	"github.com/akristianlopez/action/optimizer"
+	"github.com/akristianlopez/action/parser"
+	"github.com/akristianlopez/action/semantic"
+	_ "github.com/mattn/go-sqlite3"
+)
+
 // import (
 // 	"context"
 // 	"database/sql"
@@ -565,3 +584,850 @@ package nsina
 // 	}
 
 // }
+
+func allowAll(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+	return true, ""
+}
+
+// openSQLite ouvre une base sqlite temporaire et y exécute stmts
+func openSQLite(t testing.TB, stmts ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// build analyse et optimise src comme Action.Interpret, après avoir préparé l'analyseur avec setup
+// (chargeur de modules, source des actions appelées); errs renvoie les erreurs de syntaxe ou
+// d'analyse, prog est nil quand il y en a
+func build(db *sql.DB, src string, setup ...func(*semantic.SemanticAnalyzer)) (prog *ast.Action, errs []string) {
+	p := parser.New(lexer.New(src))
+	act := p.ParseAction()
+	if len(p.Errors()) != 0 {
+		for _, d := range p.Diagnostics() {
+			errs = append(errs, d.String())
+		}
+		return nil, errs
+	}
+	analyzer := semantic.NewSemanticAnalyzer(context.Background(), db, allowAll, nil, nil, false)
+	for _, f := range setup {
+		f(analyzer)
+	}
+	analyzer.Analyze(act)
+	if len(analyzer.Errors) > 0 {
+		return nil, analyzer.Errors
+	}
+	return optimizer.NewOptimizer().Optimize(act), nil
+}
+
+// execute exécute prog avec backend sur db
+func execute(prog *ast.Action, db *sql.DB, backend Backend, params map[string]object.Object) object.Object {
+	return evaluate(prog, environment(db, params), backend)
+}
+
+// environment prépare l'exécution sur db avec le dialecte sqlite, comme Action.Interpret pour un
+// utilisateur sans rôle
+func environment(db *sql.DB, params map[string]object.Object) *object.Environment {
+	dialect, _ := object.GetDialect("sqlite")
+	ctx := object.WithPrincipal(context.Background(), object.NewPrincipal())
+	return object.NewEnvironment(ctx, db, nil, nil, dialect, params, false, false, nil, nil, nil, nil)
+}
+
+// evaluate exécute prog dans env avec backend
+func evaluate(prog *ast.Action, env *object.Environment, backend Backend) object.Object {
+	if backend == Bytecode {
+		return Compile(prog).Run(env)
+	}
+	return Eval(prog, env)
+}
+
+// eachBackend lance test avec l'évaluateur puis avec la machine virtuelle, qui doit donner les
+// mêmes résultats
+func eachBackend(t *testing.T, test func(t *testing.T, backend Backend)) {
+	t.Run("TreeWalker", func(t *testing.T) { test(t, TreeWalker) })
+	t.Run("Bytecode", func(t *testing.T) { test(t, Bytecode) })
+}
+
+// interpret analyse src et l'exécute avec backend sur db; une erreur d'analyse arrête le test
+func interpret(t *testing.T, db *sql.DB, backend Backend, src string, params map[string]object.Object,
+	setup ...func(*semantic.SemanticAnalyzer)) object.Object {
+	t.Helper()
+	prog, errs := build(db, src, setup...)
+	if prog == nil {
+		t.Fatal(errs)
+	}
+	return execute(prog, db, backend, params)
+}
+
+// fields compare les champs de la structure res, décrits par Inspect, à want
+func fields(t *testing.T, res object.Object, want map[string]string) {
+	t.Helper()
+	st, ok := res.(*object.Struct)
+	if !ok {
+		t.Fatalf("expected a struct, got %s", res.Inspect())
+	}
+	for k, v := range want {
+		if got := st.Fields[k].Inspect(); got != v {
+			t.Errorf("%s: expected %s, got %s", k, v, got)
+		}
+	}
+}
+
+// result décrit le résultat d'une action; le JSON ne dépend pas de l'ordre de parcours des champs
+// d'une structure
+func result(prog *ast.Action, res object.Object) string {
+	if res == nil {
+		return "nil"
+	}
+	var structs []*ast.StructStatement
+	for _, stmt := range prog.Statements {
+		if st, ok := stmt.(*ast.StructStatement); ok {
+			structs = append(structs, st)
+		}
+	}
+	if data, err := object.NewJSONCodec(structs).Marshal(res, prog.ReturnType); err == nil {
+		return string(data)
+	}
+	return res.Inspect()
+}
+
+const pricingSource = `action "Tarif"(quantite: integer): integer
+	function remise(q: integer, prix: integer): integer {
+		if q >= 100 {
+			return prix * 90 / 100
+		} else if q >= 10 {
+			return prix * 95 / 100
+		}
+		return prix
+	}
+	function fib(n: integer): integer {
+		if n < 2 {
+			return n
+		}
+		return fib(n - 1) + fib(n - 2)
+	}
+	start
+		let total: integer = 0
+		let prix: array of integer = [120, 75, 300, 42]
+		for let i = 0; i < quantite; i = i + 1 {
+			if i % 7 == 3 {
+				continue
+			}
+			let p: integer = prix[i % length(prix)]
+			total = total + remise(i, p)
+			if total > 1000000 {
+				break
+			}
+		}
+		let j: integer = 0
+		for j < 10 {
+			j = j + 1
+			total = total + iif(j % 2 == 0, j, -j)
+		}
+		return total + fib(15)
+	stop
+	`
+
+func TestBytecode(t *testing.T) {
+	prog, errs := build(nil, pricingSource)
+	if prog == nil {
+		t.Fatal(errs)
+	}
+	params := map[string]object.Object{"quantite": &object.Integer{Value: 1000}}
+	want, got := execute(prog, nil, TreeWalker, params), execute(prog, nil, Bytecode, params)
+	if isError(want) || want.Inspect() != got.Inspect() {
+		t.Fatalf("expected %s with the virtual machine, got %s", want.Inspect(), got.Inspect())
+	}
+	code := Compile(prog)
+	if f := code.Failures(); len(f) != 0 {
+		t.Fatalf("expected no translation failure, got %v", f)
+	}
+	// les variables de l'action, les boucles et les deux fonctions sont traduites
+	if statements, functions := code.Compiled(); statements < 4 || functions != 2 || code.slots == 0 {
+		t.Fatalf("expected the variables, the loops and both functions to be translated, got %d statement(s), %d function(s) and %d slot(s)",
+			statements, functions, code.slots)
+	}
+}
+
+// Les variables et les paramètres de l'action occupent des cases communes à ses instructions; les
+// valeurs qui peuvent être des curseurs restent dans l'environnement, où Eval reçoit les cases qu'il lit
+func TestBytecodeActionVariables(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, salaire INTEGER)",
+		"INSERT INTO Emp (id, salaire) VALUES (1, 100), (2, 250), (3, 400)")
+	src := `action "Masse"(seuil: integer): integer
+		function prime(s: integer): integer {
+			return s * 10 / 100
+		}
+		start
+			let n: integer = 0
+			let lignes = select Emp.salaire from Emp where Emp.salaire > seuil + n;
+			for let r of lignes {
+				n = n + r.salaire + prime(r.salaire)
+			}
+			return n
+		stop
+		`
+	prog, errs := build(db, src)
+	if prog == nil {
+		t.Fatal(errs)
+	}
+	params := map[string]object.Object{"seuil": &object.Integer{Value: 150}}
+	want, got := execute(prog, db, TreeWalker, params), execute(prog, db, Bytecode, params)
+	if isError(want) || want.Inspect() != "715" || got.Inspect() != want.Inspect() {
+		t.Fatalf("expected 715 with both backends, got %s and %s", want.Inspect(), got.Inspect())
+	}
+	if code := Compile(prog); code.slots != 2 || len(code.Failures()) != 0 {
+		t.Fatalf("expected seuil and n in slots, got %d slot(s) and %v", code.slots, code.Failures())
+	}
+}
+
+// Un arbre incomplet n'interrompt pas la traduction: l'instruction reste à Eval et l'échec est signalé
+func TestBytecodeTranslationError(t *testing.T) {
+	stmt := &ast.IfStatement{Condition: &ast.BooleanLiteral{Value: true}}
+	code := Compile(&ast.Action{Statements: []ast.Statement{stmt, &ast.ReturnStatement{ReturnValue: &ast.IntegerLiteral{Value: 1}}}})
+	f := code.Failures()
+	if len(f) != 1 || f[0].Node != stmt || !strings.Contains(f[0].Error(), "block expected") {
+		t.Fatalf("expected a failure for the if without a block, got %v", f)
+	}
+	if code.statements[0] != nil || code.statements[1] == nil {
+		t.Fatal("expected only the if statement to be left to Eval")
+	}
+}
+
+// Un appel traduit vérifie le nombre d'arguments et la limite d'appels récursifs comme applyFunction
+func TestBytecodeCallLimits(t *testing.T) {
+	src := `action "Boucle"(): integer
+		function f(n: integer): integer {
+			return f(n + 1)
+		}
+		start
+			return f(0)
+		stop
+		`
+	prog, errs := build(nil, src)
+	if prog == nil {
+		t.Fatal(errs)
+	}
+	want, got := execute(prog, nil, TreeWalker, nil), execute(prog, nil, Bytecode, nil)
+	if !isError(want) || got.Inspect() != want.Inspect() {
+		t.Fatalf("expected %s with the virtual machine, got %s", want.Inspect(), got.Inspect())
+	}
+	fn := &object.Function{Parameters: []*ast.FunctionParameter{{Name: &ast.Identifier{Value: "n"}}}, Maxcall: 1}
+	if _, errObj := enterCall("f", fn, nil); errObj == nil || !strings.Contains(errObj.Inspect(), "expects 1 argument(s), got 0") {
+		t.Fatalf("expected an argument count error, got %v", errObj)
+	}
+	leave, _ := enterCall("f", fn, []object.Object{&object.Integer{Value: 1}})
+	if _, errObj := enterCall("f", fn, []object.Object{&object.Integer{Value: 1}}); errObj == nil {
+		t.Fatal("expected the recursive call limit to be reached")
+	}
+	if leave(); fn.Maxcall != 1 {
+		t.Fatalf("expected the call to be released, got Maxcall %d", fn.Maxcall)
+	}
+}
+
+// corpus renvoie les actions de testdata/corpus, reprises des tests du parser et de nsina, par nom
+// de fichier
+func corpus(t *testing.T) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.act"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := make(map[string]string)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[filepath.Base(f)] = string(data)
+	}
+	return res
+}
+
+// Le corpus donne le même résultat avec l'évaluateur et avec la machine virtuelle, et aucune de
+// ses traductions en bytecode n'échoue
+func TestCorpusBackends(t *testing.T) {
+	sources := corpus(t)
+	if len(sources) == 0 {
+		t.Fatal("expected the actions of the test corpus")
+	}
+	built := 0
+	for name, src := range sources {
+		// la traduction ne dépend pas de l'analyse: elle est aussi essayée sur les actions rejetées
+		p := parser.New(lexer.New(src))
+		if f := Compile(p.ParseAction()).Failures(); len(f) != 0 {
+			t.Errorf("%s: %v", name, f)
+		}
+		prog, _ := build(openSQLite(t), src)
+		if prog == nil {
+			continue
+		}
+		built++
+		if f := Compile(prog).Failures(); len(f) != 0 {
+			t.Errorf("%s: %v", name, f)
+		}
+		// chaque backend part d'une base vide
+		want := result(prog, execute(prog, openSQLite(t), TreeWalker, nil))
+		if got := result(prog, execute(prog, openSQLite(t), Bytecode, nil)); want != got {
+			t.Errorf("%s: expected %s with the virtual machine, got %s", name, want, got)
+		}
+	}
+	t.Logf("%d of %d actions analyzed and run", built, len(sources))
+}
+
+func BenchmarkPricing(b *testing.B) {
+	prog, errs := build(nil, pricingSource)
+	if prog == nil {
+		b.Fatal(errs)
+	}
+	code := Compile(prog)
+	params := map[string]object.Object{"quantite": &object.Integer{Value: 1000}}
+	for _, backend := range []Backend{TreeWalker, Bytecode} {
+		name := "TreeWalker"
+		if backend == Bytecode {
+			name = "Bytecode"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				env := object.NewEnvironment(context.Background(), nil, nil, nil, nil, params, false, false, nil, nil, nil, nil)
+				var res object.Object
+				if backend == Bytecode {
+					res = code.Run(env)
+				} else {
+					res = Eval(prog, env)
+				}
+				if isError(res) {
+					b.Fatal(res.Inspect())
+				}
+			}
+		})
+	}
+}
+
+// Un SELECT lu dans une variable array of ... est un tableau ordinaire
+func TestMaterializedRows(t *testing.T) {
+	src := `action "Lignes"(seuil: integer, debut: integer)
+		type Employe struct {
+			id: integer,
+			nom: string,
+			salaire: integer
+		}
+		start
+			let xs: array of Employe = select Emp.id, Emp.nom, Emp.salaire from Emp where Emp.salaire >= seuil order by Emp.id;
+			let ids: array of integer = select Emp.id from Emp order by Emp.id limit 3 offset debut;
+			let part = xs[1:3]
+			return {
+				n: length(xs),
+				second: xs[1].nom,
+				total: xs[0].salaire + xs[2].salaire + 1,
+				part: length(part),
+				first: part[0].id,
+				ids: length(ids),
+				has: contains(ids, 2),
+				hasnt: contains(ids, 1)
+			}
+		stop
+		`
+	// une variable lue seulement au travers d'une tranche n'est pas éliminée
+	slice := `action "Tranche"()
+		type Employe struct {
+			id: integer,
+			nom: string,
+			salaire: integer
+		}
+		start
+			let xs: array of Employe = select Emp.id, Emp.nom, Emp.salaire from Emp order by Emp.id;
+			return xs[1:3]
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, nom TEXT, salaire INTEGER)",
+			"INSERT INTO Emp (id, nom, salaire) VALUES (1, 'Ann', 1000), (2, 'Bob', 1500), (3, 'Cy', 2000), (4, 'Di', 2500)")
+		params := map[string]object.Object{"seuil": &object.Integer{Value: 1000}, "debut": &object.Integer{Value: 1}}
+		fields(t, interpret(t, db, backend, src, params), map[string]string{"n": "4", "second": "Bob", "total": "3001",
+			"part": "2", "first": "2", "ids": "3", "has": "true", "hasnt": "false"})
+		res := interpret(t, db, backend, slice, nil)
+		if arr, ok := res.(*object.Array); !ok || len(arr.Elements) != 2 {
+			t.Fatalf("expected the rows 2 and 3, got %s", res.Inspect())
+		}
+	})
+}
+
+// Avec une seule connexion, un curseur resté ouvert bloquerait la requête suivante jusqu'à l'expiration du contexte
+func TestCursorsClosedAtScopeEnd(t *testing.T) {
+	src := `action "Cursors"()
+		function premier(): string {
+			let c = select Emp.id, Emp.nom from Emp order by Emp.id;
+			let r = next(c)
+			return r.nom
+		}
+		start
+			let n: integer = 0
+			if true {
+				let inner = select Emp.id from Emp;
+				n = n + length(fetch(inner, 1))
+			}
+			for let i = 0; i < 3; i = i + 1 {
+				let c = select Emp.nom from Emp;
+				n = n + length(fetch(c, 2))
+			}
+			let cur = select Emp.id from Emp order by Emp.id;
+			let lot = fetch(cur, 2)
+			close(cur)
+			return {nom: premier(), n: n + length(lot)}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, nom TEXT)",
+			"INSERT INTO Emp (id, nom) VALUES (1, 'Ann'), (2, 'Bob'), (3, 'Cy')")
+		db.SetMaxOpenConns(1)
+		prog, errs := build(db, src)
+		if prog == nil {
+			t.Fatal(errs)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		dialect, _ := object.GetDialect("sqlite")
+		env := object.NewEnvironment(ctx, db, nil, nil, dialect, nil, false, false, nil, nil, nil, nil)
+		fields(t, evaluate(prog, env, backend), map[string]string{"nom": "Ann", "n": "9"})
+		if n := db.Stats().InUse; n != 0 {
+			t.Fatalf("%d connection(s) still in use after the action", n)
+		}
+	})
+}
+
+// Un curseur fermé n'est plus suivi: une boucle de SELECT ne garde pas un curseur par tour
+func TestCursorsReleased(t *testing.T) {
+	src := `action "Lot"(): integer
+		start
+			let n: integer = 0
+			for let i = 0; i < 200; i = i + 1 {
+				let c = select Emp.id from Emp order by Emp.id;
+				let r = next(c)
+				let ids: array of integer = select Emp.id from Emp;
+				for let e of select Emp.id from Emp where Emp.id == 2; {
+					n = n + e.id
+				}
+				n = n + r.id + length(ids)
+				emit("tour", i)
+			}
+			return n
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Emp (id INTEGER PRIMARY KEY, nom TEXT)",
+			"INSERT INTO Emp (id, nom) VALUES (1, 'Ann'), (2, 'Bob'), (3, 'Cy')")
+		prog, errs := build(db, src)
+		if prog == nil {
+			t.Fatal(errs)
+		}
+		var env *object.Environment
+		most, rounds := 0, 0
+		emit := func(ctx context.Context, subject string, message any) bool {
+			rounds++
+			most = max(most, env.OpenRows())
+			return true
+		}
+		dialect, _ := object.GetDialect("sqlite")
+		env = object.NewEnvironment(context.Background(), db, nil, nil, dialect, nil, false, false, nil, nil, emit, nil)
+		if res := evaluate(prog, env, backend); res.Inspect() != "1200" {
+			t.Fatalf("expected 1200, got %s", res.Inspect())
+		}
+		if rounds != 200 || most > 1 {
+			t.Fatalf("expected at most one open cursor per round, got %d after %d round(s)", most, rounds)
+		}
+	})
+}
+
+func TestDateTime(t *testing.T) {
+	src := `action "DateTime"()
+		start
+			let paris = #2024-03-30 22:30:00 Europe/Paris#
+			let utc: datetime = #2024-03-30T21:30:00Z#
+			let lendemain = paris + #1d#
+			insert into Rdv (id, debut) values (1, lendemain);
+			let lus: array of datetime = select Rdv.debut from Rdv;
+			return {
+				paris: paris,
+				same: paris == utc,
+				after: lendemain > paris,
+				ecart: lendemain - paris,
+				heure: hour(lendemain),
+				jour: #2024-03-31# < lendemain,
+				lu: lus[0] == lendemain
+			}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Rdv (id INTEGER PRIMARY KEY, debut DATETIME)")
+		// le passage à l'heure d'été tombe dans la nuit: un jour calendaire ne fait que 23 heures
+		fields(t, interpret(t, db, backend, src, nil), map[string]string{
+			"paris": "2024-03-30T22:30:00+01:00 Europe/Paris",
+			"same":  "true",
+			"after": "true",
+			"ecart": "#23h#",
+			"heure": "22",
+			"jour":  "true",
+			"lu":    "true",
+		})
+	})
+}
+
+func TestDateFunctions(t *testing.T) {
+	src := `action "Dates"()
+		start
+			let rdv = #2024-07-14 09:05:00 Europe/Paris#
+			let tokyo = convert_tz(#2024-07-14 09:05:00#, "Europe/Paris", "Asia/Tokyo")
+			return {
+				fr: format_date(rdv, "EEEE d MMMM yyyy 'à' HH'h'mm", "fr-FR"),
+				en: format_date(rdv, "EEE, MMM d yyyy h:mm a XXX", "en_US"),
+				tokyo: format_date(tokyo, "yyyy-MM-dd HH:mm VV"),
+				zone: format_date(now("America/New_York"), "VV"),
+				jour: parsedate("3 février 2024", "d MMMM yyyy", "fr"),
+				mois: month(parsedate("15/Aug/2023", "dd/MMM/yyyy")),
+				instant: parsedatetime("14/07/2024 09:05 +02:00", "dd/MM/yyyy HH:mm XXX") == rdv
+			}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		fields(t, interpret(t, nil, backend, src, nil), map[string]string{
+			"fr":      "dimanche 14 juillet 2024 à 09h05",
+			"en":      "Sun, Jul 14 2024 9:05 AM +02:00",
+			"tokyo":   "2024-07-14 16:05 Asia/Tokyo",
+			"zone":    "America/New_York",
+			"jour":    "2024-02-03",
+			"mois":    "8",
+			"instant": "true",
+		})
+		res := interpret(t, nil, backend, "action \"Locale\"()\nstart\n\treturn format_date(now(), \"MMMM\", \"de\")\nstop\n", nil)
+		if e, ok := res.(*object.Error); !ok || !strings.Contains(e.Message, "unsupported locale") {
+			t.Errorf("expected an unsupported locale error, got %v", res)
+		}
+	})
+}
+
+func TestDecimal(t *testing.T) {
+	src := `action "Decimal"()
+		start
+			let prix: decimal(10,2) = 19.99
+			let tiers: decimal(10,2) = 100m / 3
+			let total: decimal(12,2) = 0
+			for let i = 0; i < 10; i = i + 1 {
+				total = total + 0.10m
+			}
+			insert into Facture (id, montant) values (1, prix);
+			insert into Facture (id, montant) values (2, tiers);
+			let lus: array of decimal = select Facture.montant from Facture;
+			return {
+				exact: 0.1m + 0.2m == 0.3m,
+				binaire: 0.1 + 0.2 == 0.3,
+				prix: prix,
+				tiers: tiers,
+				total: total,
+				somme: sum(lus[0], lus[1], -prix),
+				lus: sum(lus),
+				plus_grand: max(1.50m, 2, prix),
+				banquier: round(2.345m, 2, "half_even"),
+				commercial: round(2.345m, 2),
+				plancher: round(-2.5m, 0, "floor"),
+				tva: round(prix * 0.196, 2)
+			}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Facture (id INTEGER PRIMARY KEY, montant NUMERIC(10,2))")
+		fields(t, interpret(t, db, backend, src, nil), map[string]string{
+			"exact":      "true",
+			"binaire":    "false",
+			"prix":       "19.99",
+			"tiers":      "33.33",
+			"total":      "1.00",
+			"somme":      "33.33",
+			"lus":        "53.32",
+			"plus_grand": "19.99",
+			"banquier":   "2.34",
+			"commercial": "2.35",
+			"plancher":   "-3",
+			"tva":        "3.92",
+		})
+		res := interpret(t, nil, backend, "action \"Overflow\"()\nstart\n\tlet m: decimal(4,2) = 123.45m\n\treturn m\nstop\n", nil)
+		if e, ok := res.(*object.Error); !ok || !strings.Contains(e.Message, "too much digits") {
+			t.Errorf("expected a precision error, got %v", res)
+		}
+	})
+}
+
+func TestMap(t *testing.T) {
+	src := `action "Map"()
+		start
+			let ventes: array of string = ["nord", "sud", "nord", "est", "nord"]
+			let compte: map of string to integer
+			for let r of ventes {
+				if has_key(compte, r) {
+					compte[r] = compte[r] + 1
+				} else {
+					compte[r] = 1
+				}
+			}
+			let prix: map of string to decimal = map{"a": 1.50m, "b": 2}
+			let supprime = delete(compte, "est")
+			delete(compte, "ouest")
+			let ordre: string = ""
+			let total: integer = 0
+			for let k, v of compte {
+				ordre = ordre + k
+				total = total + v
+			}
+			return {
+				nord: compte["nord"],
+				ordre: ordre,
+				total: total,
+				n: length(compte),
+				cles: keys(compte),
+				valeurs: values(compte),
+				supprime: supprime,
+				existe: "sud" in compte,
+				absent: compte["est"],
+				prix: sum(values(prix))
+			}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		fields(t, interpret(t, nil, backend, src, nil), map[string]string{
+			"nord":     "3",
+			"ordre":    "nordsud",
+			"total":    "4",
+			"n":        "2",
+			"cles":     "[nord, sud]",
+			"valeurs":  "[3, 1]",
+			"supprime": "true",
+			"existe":   "true",
+			"absent":   "null",
+			"prix":     "3.50",
+		})
+	})
+}
+
+func TestJSON(t *testing.T) {
+	src := `action "JSON"()
+		start
+			let j: json = parsejson("{\"client\": \"Ngo\", \"items\": [{\"sku\": \"a\", \"price\": 1.5}, {\"sku\": \"b\", \"price\": 2}], \"note\": null}")
+			let total: float = 0
+			for let item of j.$.items {
+				let p: float = item.$.price
+				total = total + p
+			}
+			let champs: string = ""
+			for let k, v of j {
+				champs = champs + k
+			}
+			let i: integer = 1
+			insert into Commande (id, doc) values (1, j.$.items[i]);
+			let lu: json = select Commande.doc from Commande;
+			return {
+				client: j.$.client,
+				prix: j.$.items[0].price,
+				dernier: j.$."items"[-1].sku,
+				absent: j.$.items[5].price,
+				n: length(j.$.items),
+				total: total,
+				champs: champs,
+				texte: tojson(j),
+				lu: tojson(lu),
+				simple: tojson({nom: "x<y", date: #2024-01-15#, montant: 2.50m, tags: ["a"]})
+			}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Commande (id INTEGER PRIMARY KEY, doc JSON)")
+		fields(t, interpret(t, db, backend, src, nil), map[string]string{
+			"client":  "Ngo",
+			"prix":    "1.500000",
+			"dernier": "b",
+			"absent":  "null",
+			"n":       "2",
+			"total":   "3.500000",
+			"champs":  "clientitemsnote",
+			"texte":   `{"client":"Ngo","items":[{"sku":"a","price":1.5},{"sku":"b","price":2}],"note":null}`,
+			"lu":      `[{"doc":{"sku":"b","price":2}}]`,
+			"simple":  `{"date":"2024-01-15","montant":2.50,"nom":"x<y","tags":["a"]}`,
+		})
+	})
+}
+
+func TestLambda(t *testing.T) {
+	src := `action "Lambda"()
+		function estPair(x: integer): boolean {
+			return x % 2 == 0
+		}
+		function ajouteur(n: integer): function(integer): integer {
+			return function(x: integer): integer { return x + n }
+		}
+		function appliquer(f: function(integer): integer, x: integer): integer {
+			return f(x)
+		}
+		start
+			let mes_nombres: array of integer = [5, 2, 8, 3, 6]
+			let seuil: integer = 4
+			let grands = filter(mes_nombres, function(x: integer): boolean { return x > seuil })
+			let plus10: function(integer): integer = ajouteur(10)
+			let noms: array of string = ["pomme", "kiwi", "banane"]
+			return {
+				grands: grands,
+				pairs: filter(mes_nombres, estPair),
+				doubles: map(mes_nombres, function(x: integer): integer { return x * 2 }),
+				total: reduce(mes_nombres, function(acc: integer, x: integer): integer { return acc + x }, 0),
+				tries: sort_by(noms, function(s: string): integer { return length(s) }),
+				un_pair: any(mes_nombres, estPair),
+				tous_pairs: all(mes_nombres, estPair),
+				premier: find(mes_nombres, function(x: integer): boolean { return x > 5 }),
+				absent: find(mes_nombres, function(x: integer): boolean { return x > 100 }),
+				plus10: plus10(5),
+				applique: appliquer(ajouteur(1), 41)
+			}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		fields(t, interpret(t, nil, backend, src, nil), map[string]string{
+			"grands":     "[5, 8, 6]",
+			"pairs":      "[2, 8, 6]",
+			"doubles":    "[10, 4, 16, 6, 12]",
+			"total":      "24",
+			"tries":      "[kiwi, pomme, banane]",
+			"un_pair":    "true",
+			"tous_pairs": "false",
+			"premier":    "8",
+			"absent":     "null",
+			"plus10":     "15",
+			"applique":   "42",
+		})
+	})
+}
+
+// modules fait charger à l'analyseur les modules de sources, désignés par leur chemin
+func modules(sources map[string]string) func(*semantic.SemanticAnalyzer) {
+	return func(sa *semantic.SemanticAnalyzer) {
+		sa.SetModuleLoader(func(ctx context.Context, path string) (string, error) {
+			if src, ok := sources[path]; ok {
+				return src, nil
+			}
+			return "", fmt.Errorf("unknown module '%s'", path)
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	lib := map[string]string{
+		"lib/taux": `module "taux"
+			let base: float = 0.05
+			function annuel(): float {
+				return base
+			}`,
+		"lib/finance": `module "finance"
+			import "lib/taux" as tx
+			type Pret struct {
+				montant: float,
+				taux: float,
+				duree: integer
+			}
+			function nouveau(montant: float, duree: integer): Pret {
+				return Pret{montant: montant, taux: tx.annuel(), duree: duree}
+			}
+			function cout(p: Pret): float {
+				return p.montant * p.taux * p.duree
+			}`,
+	}
+	src := `action "Credit"()
+		import "lib/finance" as fin
+		let base: integer = 1
+		start
+			let p: fin.Pret = fin.nouveau(1000.0, 2)
+			return {cout: fin.cout(p), duree: p.duree, base: base}
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		res := interpret(t, nil, backend, src, nil, modules(lib))
+		fields(t, res, map[string]string{"duree": "2", "base": "1"})
+		if c, ok := res.(*object.Struct).Fields["cout"].(*object.Float); !ok || c.Value != 100 {
+			t.Errorf("cout: expected 100, got %s", res.Inspect())
+		}
+	})
+}
+
+// actions fait charger à l'analyseur les actions de sources appelées par run, désignées par leur nom
+func actions(sources map[string]string) func(*semantic.SemanticAnalyzer) {
+	return func(sa *semantic.SemanticAnalyzer) {
+		sa.SetActionSource(func(ctx context.Context, name string) (string, error) {
+			if src, ok := sources[strings.ToLower(name)]; ok {
+				return src, nil
+			}
+			return "", fmt.Errorf("unknown action '%s'", name)
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	source := actions(map[string]string{
+		"journaliser": `action "Journaliser"(id: integer, msg: string): integer
+			start
+				insert into Journal (id, msg) values (id, msg);
+				return id * 10
+			stop`,
+	})
+	src := `action "Commande"()
+		start
+			let r: integer = 0
+			protected {
+				insert into Journal (id, msg) values (1, 'début');
+				r = run "Journaliser"(id: 2, msg: "suite")
+			}
+			return r
+		stop
+		`
+	// l'échec de l'action appelée annule aussi le travail de l'appelant
+	failing := `action "Doublon"()
+		start
+			protected {
+				insert into Journal (id, msg) values (3, 'annulé');
+				run "Journaliser"(id: 2, msg: "doublon")
+			}
+			return 0
+		stop
+		`
+	eachBackend(t, func(t *testing.T, backend Backend) {
+		db := openSQLite(t, "CREATE TABLE Journal (id INTEGER PRIMARY KEY, msg TEXT)")
+		// une seule connexion: l'action appelée doit utiliser la transaction de l'appelant
+		db.SetMaxOpenConns(1)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		dialect, _ := object.GetDialect("sqlite")
+		run := func(src string) object.Object {
+			prog, errs := build(db, src, source)
+			if prog == nil {
+				t.Fatal(errs)
+			}
+			return evaluate(prog, object.NewEnvironment(ctx, db, nil, nil, dialect, nil, false, false, nil, nil, nil, nil), backend)
+		}
+		if res := run(src); res.Inspect() != "20" {
+			t.Fatalf("expected 20, got %s", res.Inspect())
+		}
+		if res := run(failing); !isError(res) {
+			t.Fatalf("expected an error, got %s", res.Inspect())
+		}
+		var n, sum int
+		if err := db.QueryRow("SELECT count(*), sum(id) FROM Journal").Scan(&n, &sum); err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 || sum != 3 {
+			t.Fatalf("expected the rows 1 and 2, got %d row(s)", n)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package nsina
+
+import (
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Sous-actions: run "Calcul Paie"(emp_id: 12) exécute l'action chargée lors de l'analyse sémantique
+// dans une portée à part, qui partage la transaction et l'utilisateur de l'appelant
+
+func evalRunExpression(node *ast.RunExpression, env *object.Environment) object.Object {
+	if node.Action == nil {
+		return newError("Nsina: the action '%s' has not been loaded. line:%d, column:%d", node.Name,
+			node.Line(), node.Column())
+	}
+	params := make(map[string]object.Object, len(node.Arguments))
+	for _, arg := range node.Arguments {
+		val := Eval(arg.Value, env)
+		if isError(val) {
+			return val
+		}
+		params[strings.ToLower(arg.Name.Value)] = val
+	}
+	if !env.EnterRun() {
+		return newError("Nsina: too many nested actions to run '%s'. line:%d, column:%d", node.Name,
+			node.Line(), node.Column())
+	}
+	defer env.LeaveRun()
+
+	runEnv := object.NewRunEnvironment(env, params)
+	runEnv.Declare("error", &object.String{Value: ""})
+	runEnv.Declare("rows_affected", &object.Integer{Value: -1})
+	var result object.Object = object.NULL
+	for _, stmt := range node.Action.Statements {
+		select {
+		case <-env.Context().Done():
+			endScope(runEnv, nil)
+			return newError("%s: Canceled by the user", "Nsina")
+		default:
+		}
+		result = Eval(stmt, runEnv)
+		if isError(result) {
+			endScope(runEnv, nil)
+			return result
+		}
+		if rv, ok := result.(*object.ReturnValue); ok {
+			result = rv.Value
+			break
+		}
+	}
+	endScope(runEnv, result)
+	if result == nil {
+		return object.NULL
+	}
+	return actionResult(result)
+}
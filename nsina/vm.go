@@ -0,0 +1,309 @@
+package nsina
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/object"
+)
+
+// Machine virtuelle: exécute le bytecode produit par Compile. Les cases d'une unité occupent le bas
+// de sa portion de pile, les valeurs intermédiaires le haut. Les opérations reprennent les fonctions
+// d'Eval (evalInfixExpression, assignedValue, ...) pour donner exactement les mêmes résultats
+
+// Run exécute le programme dans env, comme Eval(program, env) pour l'action traduite
+func (p *Program) Run(env *object.Environment) object.Object {
+	m := &machine{prog: p, env: env}
+	// les cases des variables de l'action restent en bas de la pile d'une instruction à l'autre
+	m.reserve(p.slots)
+	return runAction(p.action, env, func(i int, statement ast.Statement) object.Object {
+		u := p.statements[i]
+		if u == nil {
+			return Eval(statement, env)
+		}
+		m.stack = m.stack[:p.slots]
+		return m.exec(u, 0)
+	})
+}
+
+type machine struct {
+	prog  *Program
+	env   *object.Environment
+	stack []object.Object
+}
+
+func (m *machine) push(o object.Object) {
+	m.stack = append(m.stack, o)
+}
+
+func (m *machine) pop() object.Object {
+	o := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return o
+}
+
+// reserve ajoute n cases vides au sommet de la pile
+func (m *machine) reserve(n int) {
+	for ; n > 0; n-- {
+		m.stack = append(m.stack, nil)
+	}
+}
+
+// exec exécute u, dont les cases commencent en bp. Le résultat est celui qu'Eval donnerait pour
+// l'instruction ou le corps de fonction traduit: la valeur de la dernière instruction, un
+// ReturnValue, une erreur, ou un break sorti d'une instruction confiée à Eval hors d'une boucle
+func (m *machine) exec(u *unit, bp int) object.Object {
+	var last object.Object
+	code := u.code
+	ip := 0
+	for ip < len(code) {
+		op := opcode(code[ip])
+		a := 0
+		if ip+3 <= len(code) {
+			a = int(binary.BigEndian.Uint16(code[ip+1:]))
+		}
+		var val object.Object
+		switch op {
+		case opConst:
+			m.push(u.consts[a])
+			ip += 3
+			continue
+		case opTrue:
+			m.push(&object.Boolean{Value: true})
+			ip++
+			continue
+		case opFalse:
+			m.push(&object.Boolean{Value: false})
+			ip++
+			continue
+		case opNull:
+			m.push(&object.Null{})
+			ip++
+			continue
+		case opNil:
+			m.push(nil)
+			ip++
+			continue
+		case opDefault:
+			// comme evalLetStatement: une variable sans valeur reçoit le paramètre de l'action du même nom
+			if name := u.names[int(binary.BigEndian.Uint16(code[ip+3:]))]; m.env.IsParams(name) {
+				m.push(m.env.Params(name))
+			} else {
+				m.push(getDefaultValue(u.names[a]))
+			}
+			ip += 5
+			continue
+		case opGetLocal:
+			m.push(m.stack[bp+a])
+			ip += 3
+			continue
+		case opGetEnv:
+			val = evalIdentifier(u.nodes[a].(*ast.Identifier), m.env)
+			ip += 3
+		case opGetStruct:
+			node := u.nodes[a].(*ast.TypeMember)
+			obj, ok := m.env.Get(node.Left.String())
+			if !ok {
+				return newError("Invalid structure name '%s'", node.Left.String())
+			}
+			val = obj
+			ip += 3
+		case opDeclare:
+			val = m.pop()
+			if typ := u.names[int(binary.BigEndian.Uint16(code[ip+3:]))]; typ != "" {
+				val = coerceNumber(typ, val)
+			}
+			m.stack[bp+a] = val
+			ip += 5
+		case opSetLocal:
+			target := u.nodes[int(binary.BigEndian.Uint16(code[ip+3:]))].(*ast.Identifier)
+			old := m.stack[bp+a]
+			val = coerceNumber(strings.ToLower(string(old.Type())), m.pop())
+			val = assignedValue(target, old, true, val)
+			if isError(val) {
+				return val
+			}
+			m.stack[bp+a] = val
+			if val == object.NULL {
+				return newError("Invalid name '%s'. line:%d, column:%d", target.Value, target.Line(), target.Column())
+			}
+			ip += 5
+		case opSetEnv:
+			val = assignIdentifier(u.nodes[a].(*ast.Identifier), m.pop(), m.env)
+			ip += 3
+		case opPrefix:
+			val = evalPrefixExpression(u.names[a], m.pop())
+			ip += 3
+		case opInfix:
+			right := m.pop()
+			val = evalInfixExpression(u.names[a], m.pop(), right, m.env)
+			ip += 3
+		case opIndex:
+			index := m.pop()
+			val = indexValue(m.pop(), index)
+			ip++
+		case opMember:
+			val = typeMember(u.nodes[a].(*ast.TypeMember), m.pop())
+			ip += 3
+		case opJump:
+			ip = a
+			continue
+		case opJumpIfFalse:
+			if isTruthy(m.pop()) {
+				ip += 3
+			} else {
+				ip = a
+			}
+			continue
+		case opIif:
+			condition := m.pop()
+			ifFalse := int(binary.BigEndian.Uint16(code[ip+3:]))
+			end := int(binary.BigEndian.Uint16(code[ip+5:]))
+			switch {
+			case condition.Type() == object.BOOLEAN_OBJ:
+				if condition.(*object.Boolean).Value {
+					ip += 7
+				} else {
+					ip = ifFalse
+				}
+				continue
+			case condition.Type() == object.DBFIELD_OBJ:
+				node := u.fallbacks[a].node.(*ast.IifExpression)
+				val = m.fallback(u.fallbacks[a], bp, func(env *object.Environment) object.Object {
+					return evalIifDBField(node, condition, env)
+				})
+				ip = end
+			default:
+				return newError("Invalid condition type: %s", condition.Type())
+			}
+		case opCallee:
+			site := u.calls[a]
+			if fn, ok := m.env.Get(site.node.Function.Value); ok && fn.Type() == object.FUNCTION_OBJ {
+				m.push(fn)
+				ip += 3
+				continue
+			}
+			val = m.eval(u.fallbacks[site.fallback], bp)
+			ip = site.end
+		case opCall:
+			site := u.calls[a]
+			base := len(m.stack) - site.argc
+			val = m.call(site.node.Function.Value, m.stack[base-1].(*object.Function), base)
+			m.stack = m.stack[:base-1]
+			ip += 3
+		case opEval:
+			f := u.fallbacks[a]
+			val = m.eval(f, bp)
+			ip += 3
+			if f.statement && !isError(val) {
+				if val != nil {
+					switch val.Type() {
+					case object.RETURN_VALUE_OBJ:
+						return val
+					case object.BREAK_OBJ:
+						if f.brk == noTarget {
+							return val
+						}
+						ip = f.brk
+						continue
+					case object.CONTINUE_OBJ:
+						if f.cont == noTarget {
+							return val
+						}
+						ip = f.cont
+						continue
+					}
+				}
+				last = val
+				continue
+			}
+		case opLast:
+			last = m.pop()
+			ip++
+			continue
+		case opLastNull:
+			last = object.NULL
+			ip++
+			continue
+		case opReturn:
+			return &object.ReturnValue{Value: m.pop()}
+		default:
+			return newError("Nsina: invalid bytecode %d", op)
+		}
+		if isError(val) {
+			return val
+		}
+		m.push(val)
+	}
+	return last
+}
+
+// eval confie à Eval le nœud du repli f
+func (m *machine) eval(f *fallback, bp int) object.Object {
+	return m.fallback(f, bp, func(env *object.Environment) object.Object {
+		return Eval(f.node, env)
+	})
+}
+
+// fallback appelle eval dans une portée où sont déclarées les variables locales du repli f, puis
+// reporte dans les cases les valeurs qu'Eval leur a affectées. Une instruction de l'action est
+// évaluée dans l'environnement de l'action, où elle déclare ses variables comme le ferait Eval
+func (m *machine) fallback(f *fallback, bp int, eval func(env *object.Environment) object.Object) object.Object {
+	if len(f.locals) == 0 && !f.statement {
+		return eval(m.env)
+	}
+	scope := m.env
+	if !f.global {
+		scope = object.NewEnclosedEnvironment(m.env)
+	}
+	for _, l := range f.locals {
+		scope.Declare(l.name, m.stack[bp+l.slot])
+	}
+	val := eval(scope)
+	for _, l := range f.locals {
+		if v, ok := scope.Get(l.name); ok {
+			m.stack[bp+l.slot] = v
+		}
+	}
+	return val
+}
+
+// call appelle fn avec les arguments rangés à partir de base, comme applyFunction. Une fonction
+// traduite s'exécute sur place: ses arguments deviennent ses premières cases, et ses replis
+// s'évaluent dans une portée d'appel dont les curseurs sont fermés au retour
+func (m *machine) call(name string, fn *object.Function, base int) object.Object {
+	u := m.prog.functions[fn.Body]
+	args := m.stack[base:]
+	if u == nil || fn.Env != nil || hasCursor(args) {
+		// un curseur passé en argument appartient à la portée de la fonction, qui le ferme
+		return applyFunction(name, fn, args, m.env)
+	}
+	leave, errObj := enterCall(name, fn, args)
+	if errObj != nil {
+		return errObj
+	}
+	defer leave()
+	caller := m.env
+	m.env = object.NewEnclosedEnvironment(caller)
+	m.reserve(u.slots - len(args))
+	val := m.exec(u, base)
+	endScope(m.env, val)
+	m.env = caller
+	if val == nil {
+		return nil
+	}
+	if val, ok := val.(*object.ReturnValue); ok {
+		return val.Value
+	}
+	return val
+}
+
+func hasCursor(args []object.Object) bool {
+	for _, arg := range args {
+		if res, ok := arg.(*object.SQLResult); ok && res.IsCursor() {
+			return true
+		}
+	}
+	return false
+}
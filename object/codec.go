@@ -0,0 +1,518 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/shopspring/decimal"
+)
+
+// JSONCodec écrit et lit des valeurs JSON selon leur type déclaré: le type de retour d'une action
+// ou ses paramètres. Sans type, ou pour json et any, il se comporte comme EncodeJSON et DecodeJSON.
+// Les dates s'écrivent 2006-01-02, les datetime en RFC 3339, les heures 15:04:05 et les durées
+// sans leurs '#' (1d2h); un decimal(p,s) garde ses s chiffres après la virgule
+type JSONCodec struct {
+	structs map[string]*ast.StructStatement
+}
+
+// NewJSONCodec prépare un codec pour les structures nommées de l'action (celles de Action.Signature)
+func NewJSONCodec(structs []*ast.StructStatement) *JSONCodec {
+	c := &JSONCodec{structs: make(map[string]*ast.StructStatement)}
+	for _, st := range structs {
+		if st != nil && st.Name != nil {
+			c.structs[strings.ToLower(st.Name.Value)] = st
+		}
+	}
+	return c
+}
+
+// Marshal écrit o en JSON selon le type ta
+func (c *JSONCodec) Marshal(o Object, ta *ast.TypeAnnotation) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.encode(&buf, o, ta, "$"); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *JSONCodec) encode(buf *bytes.Buffer, o Object, ta *ast.TypeAnnotation, path string) error {
+	if rv, ok := o.(*ReturnValue); ok {
+		o = rv.Value
+	}
+	if o == nil || o == NULL || ta == nil {
+		return encodeJSON(buf, o)
+	}
+	if _, ok := o.(*Null); ok {
+		return encodeJSON(buf, o)
+	}
+	switch {
+	case ta.ArrayType != nil:
+		arr, ok := o.(*Array)
+		if !ok {
+			return typeError(path, ta, o)
+		}
+		buf.WriteByte('[')
+		for i, e := range arr.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := c.encode(buf, e, ta.ArrayType.ElementType, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case ta.MapType != nil:
+		m, ok := o.(*Map)
+		if !ok {
+			return typeError(path, ta, o)
+		}
+		buf.WriteByte('{')
+		for i, pair := range m.Entries() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, jsonText(pair.Key))
+			buf.WriteByte(':')
+			if err := c.encode(buf, pair.Value, ta.MapType.Value, path+"."+pair.Key.Inspect()); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case ta.SetType != nil:
+		set, ok := o.(*Set)
+		if !ok {
+			return typeError(path, ta, o)
+		}
+		keys := make([]any, 0, len(set.Elements))
+		for k := range set.Elements {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, fmt.Sprint(k))
+			buf.WriteByte(':')
+			if err := c.encode(buf, set.Elements[k], ta.SetType.Value, fmt.Sprintf("%s.%v", path, k)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+	typ := strings.ToLower(ta.Type)
+	if st, ok := c.structs[typ]; ok {
+		s, ok := o.(*Struct)
+		if !ok {
+			return typeError(path, ta, o)
+		}
+		buf.WriteByte('{')
+		for i, f := range st.Fields {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, f.Name.Value)
+			buf.WriteByte(':')
+			if err := c.encode(buf, s.Fields[strings.ToLower(f.Name.Value)], f.Type, path+"."+f.Name.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+	switch typ {
+	case "integer":
+		d, ok := ToDecimal(o)
+		if !ok || !d.Value.IsInteger() {
+			return typeError(path, ta, o)
+		}
+		buf.WriteString(d.Value.String())
+	case "float":
+		d, ok := ToDecimal(o)
+		if !ok {
+			return typeError(path, ta, o)
+		}
+		return encodeJSON(buf, &Float{Value: d.Value.InexactFloat64()})
+	case "decimal", "numeric":
+		d, ok := ToDecimal(o)
+		if !ok {
+			return typeError(path, ta, o)
+		}
+		if ta.Constraints != nil && ta.Constraints.DecimalPlaces != nil {
+			buf.WriteString(d.Value.StringFixed(int32(ta.Constraints.DecimalPlaces.Value)))
+			return nil
+		}
+		buf.WriteString(d.Inspect())
+	case "boolean":
+		if _, ok := o.(*Boolean); !ok {
+			return typeError(path, ta, o)
+		}
+		return encodeJSON(buf, o)
+	case "string":
+		if _, ok := o.(*String); !ok {
+			return typeError(path, ta, o)
+		}
+		return encodeJSON(buf, o)
+	case "date", "datetime", "time", "duration":
+		switch o.(type) {
+		case *Date, *DateTime, *Time, *Duration:
+		default:
+			return typeError(path, ta, o)
+		}
+		writeJSONString(buf, jsonTextAs(typ, o))
+	default:
+		return encodeJSON(buf, o)
+	}
+	return nil
+}
+
+// jsonText renvoie la forme JSON d'une valeur simple, sans guillemets
+func jsonText(o Object) string {
+	switch o.(type) {
+	case *Date:
+		return jsonTextAs("date", o)
+	case *DateTime:
+		return jsonTextAs("datetime", o)
+	case *Time:
+		return jsonTextAs("time", o)
+	case *Duration:
+		return jsonTextAs("duration", o)
+	}
+	return o.Inspect()
+}
+
+func jsonTextAs(typ string, o Object) string {
+	var t time.Time
+	switch v := o.(type) {
+	case *Date:
+		t = v.Value
+	case *DateTime:
+		t = v.Value
+	case *Time:
+		t = v.Value
+	case *Duration:
+		return strings.Trim(v.Inspect(), "#")
+	}
+	switch typ {
+	case "date":
+		return t.Format("2006-01-02")
+	case "time":
+		return t.Format("15:04:05")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func typeError(path string, ta *ast.TypeAnnotation, o Object) error {
+	return fmt.Errorf("%s: expected %s, got %s", path, ta.String(), o.Type())
+}
+
+// Unmarshal lit data selon le type ta
+func (c *JSONCodec) Unmarshal(data []byte, ta *ast.TypeAnnotation) (Object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	o, err := c.decode(dec, ta, "$")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the json value")
+	}
+	return o, nil
+}
+
+// DecodeParams lit un objet JSON {"nom": valeur, ...} en paramètres typés de l'action.
+// Les noms sont mis en minuscules, comme ceux attendus par l'environnement
+func (c *JSONCodec) DecodeParams(data []byte, declared []*ast.StructField) (map[string]Object, error) {
+	types := make(map[string]*ast.TypeAnnotation)
+	for _, p := range declared {
+		types[strings.ToLower(p.Name.Value)] = p.Type
+	}
+	res := make(map[string]Object)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return res, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := expectDelim(dec, '{', "$"); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(tok.(string))
+		ta, ok := types[name]
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' is not declared by the action", tok)
+		}
+		val, err := c.decode(dec, ta, tok.(string))
+		if err != nil {
+			return nil, err
+		}
+		res[name] = val
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the json value")
+	}
+	return res, nil
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim, path string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if got, ok := tok.(json.Delim); !ok || got != d {
+		return fmt.Errorf("%s: expected '%s', got %v", path, d, tok)
+	}
+	return nil
+}
+
+func (c *JSONCodec) decode(dec *json.Decoder, ta *ast.TypeAnnotation, path string) (Object, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("unexpected end of json input")
+		}
+		return nil, err
+	}
+	if tok == nil {
+		return NULL, nil
+	}
+	if ta == nil {
+		return decodeJSONToken(dec, tok)
+	}
+	delim, isDelim := tok.(json.Delim)
+	switch {
+	case ta.ArrayType != nil:
+		if !isDelim || delim != '[' {
+			return nil, fmt.Errorf("%s: expected %s, got %v", path, ta.String(), tok)
+		}
+		arr := &Array{Elements: []Object{}, ElementType: strings.ToLower(ta.ArrayType.ElementType.Type)}
+		for i := 0; dec.More(); i++ {
+			e, err := c.decode(dec, ta.ArrayType.ElementType, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			arr.Elements = append(arr.Elements, e)
+		}
+		_, err := dec.Token() // ']'
+		return arr, err
+	case ta.MapType != nil, ta.SetType != nil:
+		if !isDelim || delim != '{' {
+			return nil, fmt.Errorf("%s: expected %s, got %v", path, ta.String(), tok)
+		}
+		keyType, valueType := ta.SetType.Key, ta.SetType.Value
+		if ta.MapType != nil {
+			keyType, valueType = ta.MapType.Key, ta.MapType.Value
+		}
+		m := NewMap(strings.ToLower(keyType.Type), strings.ToLower(valueType.Type))
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, err := c.scalar(keyType, k, path+"."+k.(string))
+			if err != nil {
+				return nil, err
+			}
+			val, err := c.decode(dec, valueType, path+"."+k.(string))
+			if err != nil {
+				return nil, err
+			}
+			if !m.Put(key, val) {
+				return nil, fmt.Errorf("%s: invalid key type %s", path, keyType.String())
+			}
+		}
+		if _, err := dec.Token(); err != nil { // '}'
+			return nil, err
+		}
+		if ta.MapType != nil {
+			return m, nil
+		}
+		set := &Set{Key: m.KeyType, Value: m.ValueType, Elements: make(map[any]Object)}
+		for _, pair := range m.Entries() {
+			set.Elements[GoValue(pair.Key)] = pair.Value
+		}
+		return set, nil
+	}
+	typ := strings.ToLower(ta.Type)
+	if st, ok := c.structs[typ]; ok {
+		if !isDelim || delim != '{' {
+			return nil, fmt.Errorf("%s: expected %s, got %v", path, st.Name.Value, tok)
+		}
+		fields := make(map[string]*ast.StructField)
+		res := &Struct{Name: typ, Fields: make(map[string]Object)}
+		for _, f := range st.Fields {
+			fields[strings.ToLower(f.Name.Value)] = f
+			res.Fields[strings.ToLower(f.Name.Value)] = NULL
+		}
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			f, ok := fields[strings.ToLower(k.(string))]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown field '%s' in %s", path, k, st.Name.Value)
+			}
+			val, err := c.decode(dec, f.Type, path+"."+f.Name.Value)
+			if err != nil {
+				return nil, err
+			}
+			res.Fields[strings.ToLower(f.Name.Value)] = val
+		}
+		_, err := dec.Token() // '}'
+		return res, err
+	}
+	switch typ {
+	case "", "any", "json":
+		return decodeJSONToken(dec, tok)
+	}
+	if isDelim {
+		return nil, fmt.Errorf("%s: expected %s, got %v", path, ta.String(), tok)
+	}
+	return c.scalar(ta, tok, path)
+}
+
+// scalar convertit un jeton JSON (nombre, chaîne ou booléen) dans le type simple ta
+func (c *JSONCodec) scalar(ta *ast.TypeAnnotation, tok json.Token, path string) (Object, error) {
+	fail := func() (Object, error) {
+		return nil, fmt.Errorf("%s: expected %s, got %v", path, ta.String(), tok)
+	}
+	num, isNum := tok.(json.Number)
+	str, isStr := tok.(string)
+	switch strings.ToLower(ta.Type) {
+	case "integer":
+		if !isNum && !isStr {
+			return fail()
+		}
+		if isStr {
+			num = json.Number(str)
+		}
+		i, err := num.Int64()
+		if err != nil {
+			return fail()
+		}
+		return &Integer{Value: i}, nil
+	case "float":
+		if !isNum && !isStr {
+			return fail()
+		}
+		if isStr {
+			num = json.Number(str)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return fail()
+		}
+		return &Float{Value: f}, nil
+	case "decimal", "numeric":
+		if !isNum && !isStr {
+			return fail()
+		}
+		if isNum {
+			str = string(num)
+		}
+		d, err := decimal.NewFromString(str)
+		if err != nil {
+			return fail()
+		}
+		return &Decimal{Value: d}, nil
+	case "boolean":
+		if b, ok := tok.(bool); ok {
+			return &Boolean{Value: b}, nil
+		}
+		return fail()
+	case "string":
+		if !isStr {
+			return fail()
+		}
+		return &String{Value: str}, nil
+	case "date":
+		if !isStr {
+			return fail()
+		}
+		for _, layout := range []string{"2006-01-02", time.RFC3339Nano} {
+			if t, err := time.Parse(layout, str); err == nil {
+				return &Date{Value: t}, nil
+			}
+		}
+		return fail()
+	case "datetime":
+		if !isStr {
+			return fail()
+		}
+		t, err := ParseDateTime(str)
+		if err != nil {
+			return fail()
+		}
+		return &DateTime{Value: t}, nil
+	case "time":
+		if !isStr {
+			return fail()
+		}
+		for _, layout := range []string{"15:04:05", "15:04"} {
+			if t, err := time.Parse(layout, str); err == nil {
+				return &Time{Value: t}, nil
+			}
+		}
+		return fail()
+	case "duration":
+		if !isStr {
+			return fail()
+		}
+		if !strings.HasPrefix(str, "#") {
+			str = "#" + str + "#"
+		}
+		d, err := ParseDuration(str)
+		if err != nil {
+			return fail()
+		}
+		return d, nil
+	}
+	if isStr {
+		return &String{Value: str}, nil
+	}
+	return decodeJSONToken(nil, tok)
+}
+
+// GoValue renvoie la valeur Go d'une valeur simple: clé d'un ensemble ou argument d'une requête
+func GoValue(o Object) any {
+	switch v := o.(type) {
+	case *Integer:
+		return v.Value
+	case *Float:
+		return v.Value
+	case *Decimal:
+		return v.Value
+	case *String:
+		return v.Value
+	case *Boolean:
+		return v.Value
+	case *Date:
+		return v.Value
+	case *DateTime:
+		return v.Value
+	case *Time:
+		return v.Value
+	case *Duration:
+		return v.Nanoseconds
+	}
+	return NULL.Inspect()
+}
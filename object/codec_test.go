@@ -0,0 +1,59 @@
+package object
+
+import (
+	"testing"
+
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/parser"
+)
+
+func TestJSONCodec(t *testing.T) {
+	src := `action "Commande"(client: string, lignes: array of Ligne, livraison: date) : Facture
+		type Ligne struct {
+			sku: string,
+			qte: integer,
+			prix: decimal(10,2)
+		}
+		type Facture struct {
+			client: string,
+			livraison: date,
+			total: decimal(10,2),
+			lignes: array of Ligne,
+			delai: duration,
+			taux: float
+		}
+		start
+			return null
+		stop
+		`
+	p := parser.New(lexer.New(src))
+	declared, retType, structs := p.ParseSignature()
+	if len(p.Errors()) != 0 {
+		t.Fatal(p.Errors())
+	}
+	codec := NewJSONCodec(structs)
+
+	// le décodeur relit ce que l'encodeur a écrit
+	want := `{"client":"Ngo","livraison":"2024-03-01","total":22.99,"lignes":[{"sku":"a","qte":2,"prix":1.50},{"sku":"b","qte":1,"prix":19.99}],"delai":"2d","taux":1}`
+	back, err := codec.Unmarshal([]byte(want), retType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := codec.Marshal(back, retType); err != nil || string(again) != want {
+		t.Fatalf("expected %s, got %s (%v)", want, again, err)
+	}
+	if _, err := codec.Marshal(&String{Value: "x"}, retType); err == nil {
+		t.Error("expected a type error for a string returned as Facture")
+	}
+
+	for _, bad := range []string{
+		`{"inconnu": 1}`,
+		`{"lignes": [{"sku": "a", "qte": "deux"}]}`,
+		`{"livraison": "mars"}`,
+		`[1]`,
+	} {
+		if _, err := codec.DecodeParams([]byte(bad), declared); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/akristianlopez/action/ast"
+)
+
+// Dialect regroupe tout ce qui varie d'un moteur SQL à l'autre dans le SQL généré par nsina.
+// Un dialecte est enregistré par nom avec RegisterDialect puis transmis à NewEnvironment.
+type Dialect interface {
+	// Name renvoie le nom sous lequel le dialecte est enregistré
+	Name() string
+	// Placeholder renvoie le paramètre lié numéro n (n commence à 1)
+	Placeholder(n int) string
+	// QuoteIdent protège un identifiant (alias, colonne, table)
+	QuoteIdent(name string) string
+	// ColumnType traduit le type d'une colonne (integer(5), float(6,2), string(50)...) en type SQL
+	ColumnType(dt *ast.SQLDataType) (string, error)
+	// DatePart extrait YEAR, MONTH, DAY, HOUR, MINUTE ou SECOND de l'expression SQL expr
+	DatePart(part, expr string) string
+	// Limit applique limit et offset (nil si absents) à une requête SELECT dont args sont les valeurs
+	// liées. limit et offset sont liés eux aussi: Limit renvoie la requête et ses valeurs dans l'ordre
+	// de ses '?'. ordered indique si la requête porte déjà une clause ORDER BY
+	Limit(query string, args []any, limit, offset any, ordered bool) (string, []any)
+	// Concat renvoie l'opérateur de concaténation de chaînes
+	Concat() string
+	// Coalesce renvoie l'expression SQL équivalente à left ?? right
+	Coalesce(left, right string) string
+	// CreateTable renvoie l'ordre de création d'une table à partir de la liste de ses colonnes et contraintes
+	CreateTable(name, body string, ifNotExists bool) string
+	// AlterTable renvoie l'ordre de modification d'une table pour une action ADD, MODIFY ou DROP
+	AlterTable(table string, action *ast.SQLAlterAction) (string, error)
+	// Truncate renvoie l'ordre qui vide une table
+	Truncate(table string) string
+	// Savepoint renvoie l'ordre qui pose le point de sauvegarde name dans la transaction courante
+	Savepoint(name string) string
+	// RollbackTo renvoie l'ordre qui annule le travail fait depuis le point de sauvegarde name
+	RollbackTo(name string) string
+	// Release renvoie l'ordre qui libère le point de sauvegarde name, ou "" si le moteur n'en a pas
+	Release(name string) string
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = make(map[string]Dialect)
+)
+
+// RegisterDialect enregistre un dialecte sous le nom donné (insensible à la casse).
+// Un dialecte déjà enregistré sous ce nom est remplacé.
+func RegisterDialect(name string, d Dialect) {
+	if d == nil {
+		panic("object: RegisterDialect dialect is nil")
+	}
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	dialects[strings.ToLower(name)] = d
+}
+
+// GetDialect renvoie le dialecte enregistré sous le nom donné
+func GetDialect(name string) (Dialect, bool) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+	d, ok := dialects[strings.ToLower(name)]
+	return d, ok
+}
+
+// LookupDialect renvoie le dialecte enregistré sous le nom donné, ou une erreur s'il n'y en a pas.
+// Un nom vide désigne le SQL commun (ANSI), sans dialecte
+func LookupDialect(name string) (Dialect, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if d, ok := GetDialect(name); ok {
+		return d, nil
+	}
+	dialectsMu.RLock()
+	names := make([]string, 0, len(dialects))
+	for n := range dialects {
+		names = append(names, n)
+	}
+	dialectsMu.RUnlock()
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown SQL dialect '%s' (registered: %s)", name, strings.Join(names, ", "))
+}
+
+func init() {
+	RegisterDialect("postgres", &postgresDialect{})
+	RegisterDialect("mysql", &mysqlDialect{name: "mysql"})
+	RegisterDialect("mariadb", &mysqlDialect{name: "mariadb"})
+	RegisterDialect("sqlite", &sqliteDialect{name: "sqlite"})
+	RegisterDialect("sqlite3", &sqliteDialect{name: "sqlite3"})
+	RegisterDialect("sqlserver", &sqlserverDialect{})
+}
+
+// ansiDialect porte le comportement commun, utilisé aussi lorsque l'environnement n'a pas de dialecte
+type ansiDialect struct{}
+
+func (d *ansiDialect) Name() string             { return "" }
+func (d *ansiDialect) Placeholder(n int) string { return "?" }
+func (d *ansiDialect) QuoteIdent(name string) string {
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(name, `"`, `""`))
+}
+func (d *ansiDialect) ColumnType(dt *ast.SQLDataType) (string, error) {
+	return dataTypeName(dt), nil
+}
+func (d *ansiDialect) DatePart(part, expr string) string {
+	return fmt.Sprintf("EXTRACT(%s FROM %s)", strings.ToUpper(part), expr)
+}
+func (d *ansiDialect) Limit(query string, args []any, limit, offset any, ordered bool) (string, []any) {
+	if limit != nil {
+		query = fmt.Sprintf("%s\nLIMIT ?", query)
+		args = append(args, limit)
+	}
+	if offset != nil {
+		query = fmt.Sprintf("%s\nOFFSET ?", query)
+		args = append(args, offset)
+	}
+	return query, args
+}
+func (d *ansiDialect) Concat() string { return "||" }
+func (d *ansiDialect) Coalesce(left, right string) string {
+	return fmt.Sprintf("coalesce(%s, %s)", left, right)
+}
+func (d *ansiDialect) CreateTable(name, body string, ifNotExists bool) string {
+	if ifNotExists {
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(%s)", name, body)
+	}
+	return fmt.Sprintf("CREATE TABLE %s(%s)", name, body)
+}
+func (d *ansiDialect) AlterTable(table string, action *ast.SQLAlterAction) (string, error) {
+	return alterTable(d, table, action, "ADD COLUMN", "MODIFY COLUMN")
+}
+func (d *ansiDialect) Truncate(table string) string {
+	return fmt.Sprintf("TRUNCATE %s", table)
+}
+func (d *ansiDialect) Savepoint(name string) string {
+	return fmt.Sprintf("SAVEPOINT %s", name)
+}
+func (d *ansiDialect) RollbackTo(name string) string {
+	return fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", name)
+}
+func (d *ansiDialect) Release(name string) string {
+	return fmt.Sprintf("RELEASE SAVEPOINT %s", name)
+}
+
+// dataTypeName renvoie le type tel qu'écrit dans la déclaration, longueur comprise
+func dataTypeName(dt *ast.SQLDataType) string {
+	out := dt.Name
+	if dt.Length != nil {
+		out = fmt.Sprintf("%s(%d)", out, dt.Length.Value)
+	} else if dt.Precision != nil && dt.Scale != nil {
+		out = fmt.Sprintf("%s(%d,%d)", out, dt.Precision.Value, dt.Scale.Value)
+	} else if dt.Precision != nil {
+		out = fmt.Sprintf("%s(%d)", out, dt.Precision.Value)
+	}
+	return out
+}
+
+// numericType rend le type exact d'un decimal: NAME(p,s), NAME(p) ou def quand la précision n'est pas donnée
+func numericType(name string, dt *ast.SQLDataType, def string) string {
+	switch {
+	case dataTypeLength(dt) > 0:
+		return fmt.Sprintf("%s(%d)", name, dt.Length.Value)
+	case dt.Precision != nil && dt.Scale != nil:
+		return fmt.Sprintf("%s(%d,%d)", name, dt.Precision.Value, dt.Scale.Value)
+	case dt.Precision != nil:
+		return fmt.Sprintf("%s(%d)", name, dt.Precision.Value)
+	}
+	return def
+}
+
+func dataTypeLength(dt *ast.SQLDataType) int64 {
+	if dt.Length == nil {
+		return 0
+	}
+	return dt.Length.Value
+}
+
+func columnDefinition(d Dialect, col *ast.SQLColumnDefinition) (string, error) {
+	typ, err := d.ColumnType(col.DataType)
+	if err != nil {
+		return "", err
+	}
+	out := fmt.Sprintf("%s %s", col.Name.Value, typ)
+	for _, constraint := range col.Constraints {
+		out += " " + constraint.String()
+	}
+	return out, nil
+}
+
+// alterTable construit l'ordre ALTER TABLE commun à la plupart des moteurs.
+// add et modify sont les mots-clés utilisés pour ajouter et modifier une colonne
+func alterTable(d Dialect, table string, action *ast.SQLAlterAction, add, modify string) (string, error) {
+	if action.Column == nil {
+		if action.ColumnName != nil {
+			return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, action.ColumnName.Value), nil
+		}
+		return fmt.Sprintf("ALTER TABLE %s %s", table, action.String()), nil
+	}
+	col, err := columnDefinition(d, action.Column)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToUpper(action.Type) {
+	case "ADD":
+		return fmt.Sprintf("ALTER TABLE %s %s %s", table, add, col), nil
+	case "MODIFY":
+		return fmt.Sprintf("ALTER TABLE %s %s %s", table, modify, col), nil
+	default:
+		return "", fmt.Errorf("%s: %s COLUMN not supported", d.Name(), action.Type)
+	}
+}
+
+type postgresDialect struct {
+	ansiDialect
+}
+
+func (d *postgresDialect) Name() string             { return "postgres" }
+func (d *postgresDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+func (d *postgresDialect) ColumnType(dt *ast.SQLDataType) (string, error) {
+	switch strings.ToLower(dt.Name) {
+	case "integer":
+		switch dataTypeLength(dt) {
+		case 1, 2, 3, 4, 5: //smallint -32768 to 32767
+			return "smallint", nil
+		case 6, 7, 8, 9, 10, 11: //integer -2147483648 to 2147483647
+			return "integer", nil
+		default: //bigint -9223372036854775808 to 9223372036854775807
+			return "bigint", nil
+		}
+	case "float":
+		switch {
+		case dataTypeLength(dt) > 0:
+			if dt.Length.Value > 131072 {
+				return "", fmt.Errorf("Precision value error: expected value between 0 and 131072, got %v", dt.Length.Value)
+			}
+			return fmt.Sprintf("NUMERIC(%d)", dt.Length.Value), nil
+		case dt.Precision != nil && dt.Precision.Value > 0:
+			if dt.Scale == nil {
+				return fmt.Sprintf("NUMERIC(%d)", dt.Precision.Value), nil
+			}
+			if dt.Scale.Value < -1000 || dt.Scale.Value > 1000 {
+				return "", fmt.Errorf("Scale value error: expected value between -1000 and 1000, got %v", dt.Scale.Value)
+			}
+			return fmt.Sprintf("NUMERIC(%d,%d)", dt.Precision.Value, dt.Scale.Value), nil
+		default:
+			return "FLOAT", nil
+		}
+	case "decimal":
+		return numericType("NUMERIC", dt, "NUMERIC"), nil
+	case "json", "jsonb":
+		return "JSONB", nil
+	case "string":
+		if dt.Length != nil && dt.Length.Value < 65535 {
+			return fmt.Sprintf("VARCHAR(%d)", dt.Length.Value), nil
+		}
+		return "TEXT", nil
+	case "datetime":
+		return "TIMESTAMPTZ", nil
+	case "duration":
+		return "interval", nil
+	default:
+		return dataTypeName(dt), nil
+	}
+}
+func (d *postgresDialect) AlterTable(table string, action *ast.SQLAlterAction) (string, error) {
+	if action.Column == nil || strings.ToUpper(action.Type) != "MODIFY" {
+		return alterTable(d, table, action, "ADD COLUMN", "ALTER COLUMN")
+	}
+	// PostgreSQL change le type puis chaque contrainte séparément
+	typ, err := d.ColumnType(action.Column.DataType)
+	if err != nil {
+		return "", err
+	}
+	name := action.Column.Name.Value
+	out := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", table, name, typ)
+	for _, constraint := range action.Column.Constraints {
+		out = fmt.Sprintf("%s, ALTER COLUMN %s SET %s", out, name, constraint.String())
+	}
+	return out, nil
+}
+
+type mysqlDialect struct {
+	ansiDialect
+	name string
+}
+
+func (d *mysqlDialect) Name() string { return d.name }
+func (d *mysqlDialect) QuoteIdent(name string) string {
+	return fmt.Sprintf("`%s`", strings.ReplaceAll(name, "`", "``"))
+}
+func (d *mysqlDialect) ColumnType(dt *ast.SQLDataType) (string, error) {
+	switch strings.ToLower(dt.Name) {
+	case "integer":
+		switch dataTypeLength(dt) {
+		case 1, 2, 3: //tinyint -128 to 127
+			return "tinyint", nil
+		case 4, 5: //smallint -32768 to 32767
+			return "smallint", nil
+		case 6, 7: //mediumint -8388608 to 8388607
+			return "mediumint", nil
+		case 8, 9, 10, 11: //integer -2147483648 to 2147483647
+			return "integer", nil
+		default: //bigint -9223372036854775808 to 9223372036854775807
+			return "bigint", nil
+		}
+	case "float":
+		switch {
+		case dataTypeLength(dt) > 0:
+			return fmt.Sprintf("DECIMAL(%d)", dt.Length.Value), nil
+		case dt.Precision != nil && dt.Precision.Value > 0:
+			if dt.Scale == nil {
+				return fmt.Sprintf("DECIMAL(%d)", dt.Precision.Value), nil
+			}
+			return fmt.Sprintf("DECIMAL(%d,%d)", dt.Precision.Value, dt.Scale.Value), nil
+		default:
+			return "DOUBLE", nil
+		}
+	case "decimal":
+		return numericType("DECIMAL", dt, "DECIMAL(65,30)"), nil
+	case "json", "jsonb":
+		return "JSON", nil
+	case "string":
+		switch {
+		case dt.Length == nil:
+			return "TEXT", nil
+		case dt.Length.Value <= 65535: //VARCHAR
+			return fmt.Sprintf("VARCHAR(%d)", dt.Length.Value), nil
+		default: //MEDIUMTEXT
+			return "MEDIUMTEXT", nil
+		}
+	case "datetime": // sans fuseau: l'instant est écrit dans le fuseau du pilote (UTC par défaut)
+		return "DATETIME(6)", nil
+	case "duration": // stockée en nanosecondes
+		return "bigint", nil
+	default:
+		return dataTypeName(dt), nil
+	}
+}
+func (d *mysqlDialect) DatePart(part, expr string) string {
+	return fmt.Sprintf("%s(%s)", strings.ToUpper(part), expr)
+}
+func (d *mysqlDialect) AlterTable(table string, action *ast.SQLAlterAction) (string, error) {
+	return alterTable(d, table, action, "ADD COLUMN", "MODIFY COLUMN")
+}
+
+type sqliteDialect struct {
+	ansiDialect
+	name string
+}
+
+func (d *sqliteDialect) Name() string { return d.name }
+
+// ColumnType conserve autant que possible le nom de type déclaré (VARCHAR(n), NUMERIC(p,s), DURATION)
+// afin que le type d'origine soit retrouvé à la lecture des colonnes
+func (d *sqliteDialect) ColumnType(dt *ast.SQLDataType) (string, error) {
+	switch strings.ToLower(dt.Name) {
+	case "integer":
+		return "INTEGER", nil
+	case "float":
+		switch {
+		case dataTypeLength(dt) > 0:
+			return fmt.Sprintf("NUMERIC(%d)", dt.Length.Value), nil
+		case dt.Precision != nil && dt.Precision.Value > 0:
+			if dt.Scale != nil {
+				return fmt.Sprintf("NUMERIC(%d,%d)", dt.Precision.Value, dt.Scale.Value), nil
+			}
+			return fmt.Sprintf("NUMERIC(%d)", dt.Precision.Value), nil
+		default:
+			return "REAL", nil
+		}
+	case "decimal":
+		return numericType("NUMERIC", dt, "NUMERIC"), nil
+	case "json", "jsonb":
+		return "JSON", nil
+	case "string":
+		if dataTypeLength(dt) > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", dt.Length.Value), nil
+		}
+		return "TEXT", nil
+	case "boolean":
+		return "BOOLEAN", nil
+	case "date":
+		return "DATE", nil
+	case "time":
+		return "TIMESTAMP", nil
+	case "datetime": // texte avec décalage, relu en time.Time par le pilote
+		return "DATETIME", nil
+	case "duration": // stockée en nanosecondes
+		return "DURATION", nil
+	default:
+		return dataTypeName(dt), nil
+	}
+}
+func (d *sqliteDialect) DatePart(part, expr string) string {
+	format := ""
+	switch strings.ToUpper(part) {
+	case "YEAR":
+		format = "%Y"
+	case "MONTH":
+		format = "%m"
+	case "DAY":
+		format = "%d"
+	case "HOUR":
+		format = "%H"
+	case "MINUTE":
+		format = "%M"
+	default:
+		format = "%S"
+	}
+	return fmt.Sprintf("CAST(strftime('%s', %s) AS INTEGER)", format, expr)
+}
+
+// AlterTable: SQLite ne sait qu'ajouter ou supprimer une colonne, ni MODIFY ni contraintes
+func (d *sqliteDialect) AlterTable(table string, action *ast.SQLAlterAction) (string, error) {
+	if action.Constraint != nil {
+		return "", fmt.Errorf("%s: %s CONSTRAINT not supported", d.name, action.Type)
+	}
+	if action.Column != nil && strings.ToUpper(action.Type) != "ADD" {
+		return "", fmt.Errorf("%s: %s COLUMN not supported", d.name, action.Type)
+	}
+	return alterTable(d, table, action, "ADD COLUMN", "")
+}
+func (d *sqliteDialect) Truncate(table string) string {
+	return fmt.Sprintf("DELETE FROM %s", table)
+}
+
+type sqlserverDialect struct {
+	ansiDialect
+}
+
+func (d *sqlserverDialect) Name() string             { return "sqlserver" }
+func (d *sqlserverDialect) Placeholder(n int) string { return fmt.Sprintf("@p%d", n) }
+func (d *sqlserverDialect) QuoteIdent(name string) string {
+	return fmt.Sprintf("[%s]", strings.ReplaceAll(name, "]", "]]"))
+}
+func (d *sqlserverDialect) ColumnType(dt *ast.SQLDataType) (string, error) {
+	switch strings.ToLower(dt.Name) {
+	case "integer":
+		switch dataTypeLength(dt) {
+		case 1, 2, 3, 4: //smallint -32768 to 32767
+			return "smallint", nil
+		case 5, 6, 7, 8, 9: //int -2147483648 to 2147483647
+			return "int", nil
+		default: //bigint -9223372036854775808 to 9223372036854775807
+			return "bigint", nil
+		}
+	case "float":
+		switch {
+		case dataTypeLength(dt) > 0:
+			if dt.Length.Value > 38 {
+				return "", fmt.Errorf("Precision value error: expected value between 1 and 38, got %v", dt.Length.Value)
+			}
+			return fmt.Sprintf("DECIMAL(%d)", dt.Length.Value), nil
+		case dt.Precision != nil && dt.Precision.Value > 0:
+			if dt.Precision.Value > 38 {
+				return "", fmt.Errorf("Precision value error: expected value between 1 and 38, got %v", dt.Precision.Value)
+			}
+			if dt.Scale == nil {
+				return fmt.Sprintf("DECIMAL(%d)", dt.Precision.Value), nil
+			}
+			if dt.Scale.Value < 0 || dt.Scale.Value > dt.Precision.Value {
+				return "", fmt.Errorf("Scale value error: expected value between 0 and %d, got %v", dt.Precision.Value, dt.Scale.Value)
+			}
+			return fmt.Sprintf("DECIMAL(%d,%d)", dt.Precision.Value, dt.Scale.Value), nil
+		default:
+			return "FLOAT", nil
+		}
+	case "decimal":
+		return numericType("DECIMAL", dt, "DECIMAL(38,10)"), nil
+	case "json", "jsonb": // pas de type json: le texte est gardé tel quel
+		return "NVARCHAR(MAX)", nil
+	case "string":
+		if length := dataTypeLength(dt); length > 0 && length <= 4000 {
+			return fmt.Sprintf("NVARCHAR(%d)", length), nil
+		}
+		return "NVARCHAR(MAX)", nil
+	case "boolean":
+		return "BIT", nil
+	case "date":
+		return "DATE", nil
+	case "time":
+		return "DATETIME2", nil
+	case "datetime":
+		return "DATETIMEOFFSET", nil
+	case "duration": // stockée en nanosecondes
+		return "BIGINT", nil
+	default:
+		return dataTypeName(dt), nil
+	}
+}
+func (d *sqlserverDialect) DatePart(part, expr string) string {
+	return fmt.Sprintf("DATEPART(%s, %s)", strings.ToUpper(part), expr)
+}
+
+// Limit: TOP sans OFFSET, sinon OFFSET ... FETCH qui exige un ORDER BY. La valeur de TOP précède
+// toutes les autres valeurs liées
+func (d *sqlserverDialect) Limit(query string, args []any, limit, offset any, ordered bool) (string, []any) {
+	if offset == nil {
+		if limit == nil || len(query) < 7 || !strings.EqualFold(query[:7], "SELECT ") {
+			return query, args
+		}
+		return fmt.Sprintf("SELECT TOP (?) %s", query[7:]), append([]any{limit}, args...)
+	}
+	if !ordered {
+		query = fmt.Sprintf("%s\nORDER BY (SELECT NULL)", query)
+	}
+	query = fmt.Sprintf("%s\nOFFSET ? ROWS", query)
+	args = append(args, offset)
+	if limit != nil {
+		query = fmt.Sprintf("%s FETCH NEXT ? ROWS ONLY", query)
+		args = append(args, limit)
+	}
+	return query, args
+}
+func (d *sqlserverDialect) Concat() string { return "+" }
+
+// CreateTable: T-SQL ne connait pas CREATE TABLE IF NOT EXISTS
+func (d *sqlserverDialect) CreateTable(name, body string, ifNotExists bool) string {
+	if ifNotExists {
+		return fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s(%s)", name, name, body)
+	}
+	return fmt.Sprintf("CREATE TABLE %s(%s)", name, body)
+}
+
+// AlterTable: T-SQL ajoute une colonne avec ADD (sans COLUMN) et la modifie avec ALTER COLUMN
+func (d *sqlserverDialect) AlterTable(table string, action *ast.SQLAlterAction) (string, error) {
+	return alterTable(d, table, action, "ADD", "ALTER COLUMN")
+}
+func (d *sqlserverDialect) Truncate(table string) string {
+	return fmt.Sprintf("TRUNCATE TABLE %s", table)
+}
+
+// Savepoint: T-SQL pose un point de sauvegarde avec SAVE TRANSACTION et ne le libère jamais
+func (d *sqlserverDialect) Savepoint(name string) string {
+	return fmt.Sprintf("SAVE TRANSACTION %s", name)
+}
+func (d *sqlserverDialect) RollbackTo(name string) string {
+	return fmt.Sprintf("ROLLBACK TRANSACTION %s", name)
+}
+func (d *sqlserverDialect) Release(name string) string { return "" }
+
+// Rebind remplace, dans l'ordre, les marqueurs '?' de query par les paramètres du dialecte.
+// Les marqueurs situés dans une chaîne ou un identifiant protégé sont laissés tels quels, de même
+// que les opérateurs jsonb ?| et ?& de PostgreSQL. L'opérateur jsonb ? s'écrit ?? pour ne pas être
+// pris pour un marqueur
+func Rebind(d Dialect, query string) string {
+	if d.Placeholder(1) == "?" || !strings.Contains(query, "?") {
+		return query
+	}
+	var out strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?' && jsonbOperator(query[i+1:]):
+			if query[i+1] == '?' {
+				i++
+			}
+		case c == '?':
+			n++
+			out.WriteString(d.Placeholder(n))
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String()
+}
+
+// jsonbOperator indique si le '?' qui précède rest est un opérateur jsonb (??, ?| ou ?&) et non un
+// marqueur. Un marqueur peut être suivi de || (concaténation) ou de && (recouvrement de tableaux)
+func jsonbOperator(rest string) bool {
+	if rest == "" {
+		return false
+	}
+	switch rest[0] {
+	case '?':
+		return true
+	case '|', '&':
+		return len(rest) == 1 || rest[1] != rest[0]
+	}
+	return false
+}
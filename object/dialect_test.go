@@ -0,0 +1,132 @@
+package object
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/akristianlopez/action/ast"
+)
+
+func TestSQLServerDialect(t *testing.T) {
+	d, ok := GetDialect("SQLServer")
+	if !ok {
+		t.Fatal("expected the sqlserver dialect to be registered")
+	}
+	query := "SELECT Emp.id, Emp.nom\nFROM Emp\nWHERE Emp.nom <> ?"
+	ordered := query + "\nORDER BY Emp.id"
+	limits := []struct {
+		name     string
+		query    string
+		limit    any
+		offset   any
+		ordered  bool
+		expected string
+		args     string
+	}{
+		{"top", query, 5, nil, false, "SELECT TOP (?) Emp.id, Emp.nom\nFROM Emp\nWHERE Emp.nom <> ?", "[5 Ann]"},
+		{"top ordered", ordered, 5, nil, true, "SELECT TOP (?) Emp.id, Emp.nom\nFROM Emp\nWHERE Emp.nom <> ?\nORDER BY Emp.id", "[5 Ann]"},
+		{"offset", ordered, nil, 20, true, ordered + "\nOFFSET ? ROWS", "[Ann 20]"},
+		{"offset fetch", ordered, 10, 20, true, ordered + "\nOFFSET ? ROWS FETCH NEXT ? ROWS ONLY", "[Ann 20 10]"},
+		{"offset unordered", query, 10, 20, false, query + "\nORDER BY (SELECT NULL)\nOFFSET ? ROWS FETCH NEXT ? ROWS ONLY", "[Ann 20 10]"},
+		{"no limit", query, nil, nil, false, query, "[Ann]"},
+	}
+	for _, tt := range limits {
+		got, args := d.Limit(tt.query, []any{"Ann"}, tt.limit, tt.offset, tt.ordered)
+		if got != tt.expected || fmt.Sprint(args) != tt.args {
+			t.Errorf("%s: expected %q %s, got %q %v", tt.name, tt.expected, tt.args, got, args)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"brackets", d.QuoteIdent("Nom complet"), "[Nom complet]"},
+		{"brackets escaped", d.QuoteIdent("a]b"), "[a]]b]"},
+		{"datepart", d.DatePart("year", "Emp.embauche"), "DATEPART(YEAR, Emp.embauche)"},
+		{"datepart second", d.DatePart("Second", "@p1"), "DATEPART(SECOND, @p1)"},
+		{"concat", d.Concat(), "+"},
+		{"placeholders", Rebind(d, "SELECT Emp.id FROM Emp WHERE Emp.nom = ? AND Emp.note <> '?' AND Emp.id > ?"),
+			"SELECT Emp.id FROM Emp WHERE Emp.nom = @p1 AND Emp.note <> '?' AND Emp.id > @p2"},
+		{"create table", d.CreateTable("Emp", "id INT", true), "IF OBJECT_ID(N'Emp', N'U') IS NULL CREATE TABLE Emp(id INT)"},
+		{"truncate", d.Truncate("Emp"), "TRUNCATE TABLE Emp"},
+		{"savepoint", d.Savepoint("sp1"), "SAVE TRANSACTION sp1"},
+		{"rollback to", d.RollbackTo("sp1"), "ROLLBACK TRANSACTION sp1"},
+		{"release", d.Release("sp1"), ""},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, tt.got)
+		}
+	}
+
+	types := []struct {
+		dt       *ast.SQLDataType
+		expected string
+	}{
+		{&ast.SQLDataType{Name: "integer", Length: &ast.IntegerLiteral{Value: 4}}, "smallint"},
+		{&ast.SQLDataType{Name: "integer", Length: &ast.IntegerLiteral{Value: 9}}, "int"},
+		{&ast.SQLDataType{Name: "integer"}, "bigint"},
+		{&ast.SQLDataType{Name: "string", Length: &ast.IntegerLiteral{Value: 50}}, "NVARCHAR(50)"},
+		{&ast.SQLDataType{Name: "string"}, "NVARCHAR(MAX)"},
+		{&ast.SQLDataType{Name: "boolean"}, "BIT"},
+		{&ast.SQLDataType{Name: "datetime"}, "DATETIMEOFFSET"},
+		{&ast.SQLDataType{Name: "float", Precision: &ast.IntegerLiteral{Value: 6}, Scale: &ast.IntegerLiteral{Value: 2}}, "DECIMAL(6,2)"},
+	}
+	for _, tt := range types {
+		got, err := d.ColumnType(tt.dt)
+		if err != nil || got != tt.expected {
+			t.Errorf("ColumnType(%s) = %q, %v, expected %q", tt.dt.Name, got, err, tt.expected)
+		}
+	}
+	if _, err := d.ColumnType(&ast.SQLDataType{Name: "float", Precision: &ast.IntegerLiteral{Value: 40}}); err == nil {
+		t.Error("expected an error for a precision above 38")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	d, _ := GetDialect("postgres")
+	query, args := d.Limit("SELECT Emp.id FROM Emp WHERE Emp.nom = ?", []any{"Ann"}, 10, 20, false)
+	if query != "SELECT Emp.id FROM Emp WHERE Emp.nom = ?\nLIMIT ?\nOFFSET ?" || fmt.Sprint(args) != "[Ann 10 20]" {
+		t.Errorf("expected LIMIT and OFFSET after the other values, got %q %v", query, args)
+	}
+	if query, args = d.Limit("SELECT Emp.id FROM Emp", nil, nil, nil, false); query != "SELECT Emp.id FROM Emp" || len(args) != 0 {
+		t.Errorf("expected the query unchanged, got %q %v", query, args)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	d, _ := GetDialect("postgres")
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT id FROM Emp WHERE nom = ? AND age > ?", "SELECT id FROM Emp WHERE nom = $1 AND age > $2"},
+		{"SELECT id FROM Emp WHERE note = '?' AND nom = ?", "SELECT id FROM Emp WHERE note = '?' AND nom = $1"},
+		{`SELECT "a?" FROM Emp WHERE nom = ?`, `SELECT "a?" FROM Emp WHERE nom = $1`},
+		{"SELECT id FROM Emp WHERE data ?? ? AND nom = ?", "SELECT id FROM Emp WHERE data ? $1 AND nom = $2"},
+		{"SELECT id FROM Emp WHERE data ?| ? AND data ?& ?", "SELECT id FROM Emp WHERE data ?| $1 AND data ?& $2"},
+		{"SELECT ?||nom, tags FROM Emp WHERE tags && ?", "SELECT $1||nom, tags FROM Emp WHERE tags && $2"},
+		{"SELECT id FROM Emp WHERE tags ?&& ?", "SELECT id FROM Emp WHERE tags $1&& $2"},
+		{"SELECT id FROM Emp WHERE nom = ?", "SELECT id FROM Emp WHERE nom = $1"},
+	}
+	for _, tt := range tests {
+		if got := Rebind(d, tt.query); got != tt.expected {
+			t.Errorf("Rebind(%q) = %q, expected %q", tt.query, got, tt.expected)
+		}
+	}
+	sqlite, _ := GetDialect("sqlite")
+	if got := Rebind(sqlite, "SELECT id FROM Emp WHERE nom = ?"); got != "SELECT id FROM Emp WHERE nom = ?" {
+		t.Errorf("expected the query unchanged for sqlite, got %q", got)
+	}
+}
+
+func TestJSONColumnType(t *testing.T) {
+	for name, want := range map[string]string{"postgres": "JSONB", "mysql": "JSON", "sqlite": "JSON"} {
+		d, _ := GetDialect(name)
+		if got, err := d.ColumnType(&ast.SQLDataType{Name: "json"}); err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", name, want, got, err)
+		}
+	}
+}
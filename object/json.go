@@ -0,0 +1,218 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Valeurs json: DecodeJSON produit des dictionnaires (clés string, dans l'ordre du texte),
+// des tableaux et des valeurs simples; EncodeJSON écrit n'importe quelle valeur du langage
+
+// EncodeJSON écrit o en JSON compact. Les dates, heures et durées sont écrites sous leur forme
+// textuelle, les decimal comme des nombres exacts et les champs d'une structure par ordre alphabétique
+func EncodeJSON(o Object) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeJSON(buf *bytes.Buffer, o Object) error {
+	switch v := o.(type) {
+	case nil, *Null:
+		buf.WriteString("null")
+	case *ReturnValue:
+		return encodeJSON(buf, v.Value)
+	case *Integer:
+		buf.WriteString(strconv.FormatInt(v.Value, 10))
+	case *Float:
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			return fmt.Errorf("%s cannot be written in json", v.Inspect())
+		}
+		b, _ := json.Marshal(v.Value)
+		buf.Write(b)
+	case *Decimal:
+		buf.WriteString(v.Inspect())
+	case *Boolean:
+		buf.WriteString(strconv.FormatBool(v.Value))
+	case *String:
+		writeJSONString(buf, v.Value)
+	case *Date, *DateTime, *Time, *Duration:
+		writeJSONString(buf, v.Inspect())
+	case *Array:
+		buf.WriteByte('[')
+		for i, e := range v.Elements {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case *Map:
+		buf.WriteByte('{')
+		for i, pair := range v.Entries() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, pair.Key.Inspect())
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, pair.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case *Struct:
+		names := make([]string, 0, len(v.Fields))
+		for name := range v.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, name)
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, v.Fields[name]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case *Set:
+		keys := make([]any, 0, len(v.Elements))
+		for k := range v.Elements {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, fmt.Sprint(k))
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, v.Elements[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case *SQLResult:
+		if v.IsCursor() {
+			return errors.New("the rows of a cursor must be read before being written in json")
+		}
+		buf.WriteString(`{"message":`)
+		writeJSONString(buf, v.Message)
+		fmt.Fprintf(buf, `,"rows_affected":%d}`, v.RowsAffected)
+	default:
+		return fmt.Errorf("a %s value cannot be written in json", o.Type())
+	}
+	return nil
+}
+
+// MarshalJSON rend les valeurs directement utilisables avec encoding/json, sous la forme de EncodeJSON
+func (i *Integer) MarshalJSON() ([]byte, error)      { return EncodeJSON(i) }
+func (f *Float) MarshalJSON() ([]byte, error)        { return EncodeJSON(f) }
+func (d *Decimal) MarshalJSON() ([]byte, error)      { return EncodeJSON(d) }
+func (b *Boolean) MarshalJSON() ([]byte, error)      { return EncodeJSON(b) }
+func (s *String) MarshalJSON() ([]byte, error)       { return EncodeJSON(s) }
+func (d *Date) MarshalJSON() ([]byte, error)         { return EncodeJSON(d) }
+func (d *DateTime) MarshalJSON() ([]byte, error)     { return EncodeJSON(d) }
+func (t *Time) MarshalJSON() ([]byte, error)         { return EncodeJSON(t) }
+func (d *Duration) MarshalJSON() ([]byte, error)     { return EncodeJSON(d) }
+func (a *Array) MarshalJSON() ([]byte, error)        { return EncodeJSON(a) }
+func (a *Set) MarshalJSON() ([]byte, error)          { return EncodeJSON(a) }
+func (m *Map) MarshalJSON() ([]byte, error)          { return EncodeJSON(m) }
+func (s *Struct) MarshalJSON() ([]byte, error)       { return EncodeJSON(s) }
+func (sr *SQLResult) MarshalJSON() ([]byte, error)   { return EncodeJSON(sr) }
+func (n *Null) MarshalJSON() ([]byte, error)         { return EncodeJSON(n) }
+func (rv *ReturnValue) MarshalJSON() ([]byte, error) { return EncodeJSON(rv) }
+
+// writeJSONString écrit s entre guillemets, sans échapper <, > et &
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // retour à la ligne ajouté par Encode
+}
+
+// DecodeJSON lit un texte json. Un nombre entier devient un integer, les autres nombres des float
+func DecodeJSON(data []byte) (Object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	o, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the json value")
+	}
+	return o, nil
+}
+
+func decodeJSON(dec *json.Decoder) (Object, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("unexpected end of json input")
+		}
+		return nil, err
+	}
+	return decodeJSONToken(dec, tok)
+}
+
+// decodeJSONToken lit la valeur qui commence par tok; dec n'est utile que pour un tableau ou un objet
+func decodeJSONToken(dec *json.Decoder, tok json.Token) (Object, error) {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '[' {
+			arr := &Array{Elements: []Object{}, ElementType: "json"}
+			for dec.More() {
+				e, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr.Elements = append(arr.Elements, e)
+			}
+			_, err := dec.Token() // ']'
+			return arr, err
+		}
+		m := NewMap("string", "json")
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.Put(&String{Value: k.(string)}, e)
+		}
+		_, err := dec.Token() // '}'
+		return m, err
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &Integer{Value: i}, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &Float{Value: f}, nil
+	case string:
+		return &String{Value: v}, nil
+	case bool:
+		return &Boolean{Value: v}, nil
+	}
+	return NULL, nil
+}
@@ -9,10 +9,11 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata" // fuseaux horaires des datetime, même sans base zoneinfo sur le serveur
 	"unicode"
 
 	"github.com/akristianlopez/action/ast"
-	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
 type ObjectType string
@@ -20,10 +21,12 @@ type ObjectType string
 const (
 	INTEGER_OBJ      = "INTEGER"
 	FLOAT_OBJ        = "FLOAT"
+	DECIMAL_OBJ      = "DECIMAL"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	TIME_OBJ         = "TIME"
 	DATE_OBJ         = "DATE"
+	DATETIME_OBJ     = "DATETIME"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR"
@@ -34,6 +37,8 @@ const (
 	SQL_RESULT_OBJ   = "SQL_RESULT"
 	ARRAY_OBJ        = "ARRAY"
 	SET_OBJ          = "SET"
+	MAP_OBJ          = "MAP"
+	MODULE_OBJ       = "MODULE"
 	// ROWS_OBJ         = "ROWS"
 	BREAK_OBJ       = "BREAK"
 	FALLTHROUGH_OBJ = "FALLTHROUGH"
@@ -56,12 +61,16 @@ func (l *Limits) Valid(value Object) (bool, string) {
 		return l.isValidInt(value.(*Integer))
 	case FLOAT_OBJ:
 		return l.isValidFloat(value.(*Float))
+	case DECIMAL_OBJ:
+		return l.isValidDecimal(value)
 	case STRING_OBJ:
 		return l.isValidString(value.(*String))
 	case TIME_OBJ:
 		return l.isValidTime(value.(*Time))
 	case DATE_OBJ:
 		return l.isValidDate(value.(*Date))
+	case DATETIME_OBJ:
+		return l.isValidDateTime(value)
 	case DURATION_OBJ:
 		return l.isValidDuration(value.(*Duration))
 	}
@@ -79,12 +88,16 @@ func (l *Limits) Set(name string, value Object) bool {
 		return l.setIntLimit(name, value)
 	case FLOAT_OBJ:
 		return l.setFloatLimit(name, value)
+	case DECIMAL_OBJ:
+		return l.setDecimalLimit(name, value)
 	case STRING_OBJ:
 		return l.setStringLimit(name, value)
 	case TIME_OBJ:
 		return l.setTimeLimit(name, value)
 	case DATE_OBJ:
 		return l.setDateLimit(name, value)
+	case DATETIME_OBJ:
+		return l.setDateTimeLimit(name, value)
 	case DURATION_OBJ:
 		return l.setDurationLimit(name, value)
 	}
@@ -178,6 +191,68 @@ func (l *Limits) isValidFloat(value *Float) (bool, string) {
 	}
 	return result, ""
 }
+func (l *Limits) setDecimalLimit(name string, value Object) bool {
+	if l.limit == nil {
+		o := make(map[string]Object)
+		l.limit = &o
+	}
+	switch strings.ToLower(name) {
+	case "precision", "scale":
+		if value.Type() != INTEGER_OBJ {
+			return false
+		}
+		(*l.limit)[strings.ToLower(name)] = value
+		return true
+	}
+	d, ok := ToDecimal(value)
+	if !ok {
+		return false
+	}
+	(*l.limit)[strings.ToLower(name)] = d
+	return true
+}
+func (l *Limits) isValidDecimal(value Object) (bool, string) {
+	if l.limit == nil {
+		return true, ""
+	}
+	d, ok := ToDecimal(value)
+	if !ok {
+		return false, "Value '" + value.Inspect() + "' is not a decimal"
+	}
+	if m, o := (*l.limit)["min"]; o && m.(*Decimal).Value.GreaterThan(d.Value) {
+		return false, "Value '" + d.Inspect() + "' is lower than '" + m.Inspect() + "'"
+	}
+	if m, o := (*l.limit)["max"]; o && m.(*Decimal).Value.LessThan(d.Value) {
+		return false, "Value '" + d.Inspect() + "' is greater than '" + m.Inspect() + "'"
+	}
+	// decimal(p,s): au plus p-s chiffres avant la virgule
+	if p, o := (*l.limit)["precision"]; o {
+		digits := p.(*Integer).Value
+		if s, o := (*l.limit)["scale"]; o {
+			digits -= s.(*Integer).Value
+		}
+		if ip := d.Value.Abs().Truncate(0); !ip.IsZero() && int64(len(ip.String())) > digits {
+			return false, "Value '" + d.Inspect() + "' too much digits than expected"
+		}
+	}
+	return true, ""
+}
+
+// Round arrondit value à l'échelle d'un decimal(p,s), au plus proche et à l'écart de zéro pour la moitié,
+// comme le fait le type NUMERIC des bases. Les autres valeurs sont rendues telles quelles
+func (l *Limits) Round(value Object) Object {
+	if l._type != DECIMAL_OBJ {
+		return value
+	}
+	d, ok := ToDecimal(value)
+	if !ok || l.limit == nil {
+		return value
+	}
+	if s, o := (*l.limit)["scale"]; o {
+		return &Decimal{Value: d.Value.Round(int32(s.(*Integer).Value))}
+	}
+	return d
+}
 func (l *Limits) setStringLimit(name string, value Object) bool {
 	if l.limit == nil {
 		o := make(map[string]Object)
@@ -271,6 +346,34 @@ func (l *Limits) isValidDate(value *Date) (bool, string) {
 	}
 	return result, ""
 }
+func (l *Limits) setDateTimeLimit(name string, value Object) bool {
+	dt, ok := ToDateTime(value)
+	if !ok {
+		return false
+	}
+	if l.limit == nil {
+		o := make(map[string]Object)
+		l.limit = &o
+	}
+	(*l.limit)[strings.ToLower(name)] = dt
+	return true
+}
+func (l *Limits) isValidDateTime(value Object) (bool, string) {
+	if l.limit == nil {
+		return true, ""
+	}
+	dt, ok := ToDateTime(value)
+	if !ok {
+		return false, "Value '" + value.Inspect() + "' is not a datetime"
+	}
+	if m, o := (*l.limit)["min"]; o && m.(*DateTime).Value.After(dt.Value) {
+		return false, "Value '" + dt.Inspect() + "' is lower than '" + m.Inspect() + "'"
+	}
+	if m, o := (*l.limit)["max"]; o && m.(*DateTime).Value.Before(dt.Value) {
+		return false, "Value '" + dt.Inspect() + "' is greater than '" + m.Inspect() + "'"
+	}
+	return true, ""
+}
 func (l *Limits) setDurationLimit(name string, value Object) bool {
 	if value.Type() != DURATION_OBJ {
 		return false
@@ -327,6 +430,61 @@ type Boolean struct {
 	Value bool
 }
 
+// Decimal est un nombre décimal exact (montants, prix...), sans l'arrondi binaire des float
+type Decimal struct {
+	Value decimal.Decimal
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+
+// Inspect garde l'échelle de la valeur: 19.90 et non 19.9
+func (d *Decimal) Inspect() string {
+	if exp := d.Value.Exponent(); exp < 0 {
+		return d.Value.StringFixed(-exp)
+	}
+	return d.Value.String()
+}
+
+// ToDecimal convertit un entier, un float (par sa plus courte écriture décimale) ou un decimal en decimal
+func ToDecimal(o Object) (*Decimal, bool) {
+	switch v := o.(type) {
+	case *Decimal:
+		return v, true
+	case *Integer:
+		return &Decimal{Value: decimal.NewFromInt(v.Value)}, true
+	case *Float:
+		return &Decimal{Value: decimal.NewFromFloat(v.Value)}, true
+	}
+	return nil, false
+}
+
+// RoundDecimal arrondit d à places chiffres après la virgule selon mode:
+// half_up (par défaut, la moitié s'éloigne de zéro), half_even (arrondi du banquier), half_down,
+// up (s'éloigne de zéro), down (tronque), ceiling (vers +infini) et floor (vers -infini)
+func RoundDecimal(d decimal.Decimal, places int32, mode string) (decimal.Decimal, error) {
+	switch strings.ToLower(mode) {
+	case "", "half_up":
+		return d.Round(places), nil
+	case "half_even":
+		return d.RoundBank(places), nil
+	case "half_down":
+		t := d.Truncate(places)
+		if d.Sub(t).Abs().GreaterThan(decimal.New(5, -places-1)) {
+			return d.Round(places), nil
+		}
+		return t, nil
+	case "up":
+		return d.RoundUp(places), nil
+	case "down":
+		return d.RoundDown(places), nil
+	case "ceiling":
+		return d.RoundCeil(places), nil
+	case "floor":
+		return d.RoundFloor(places), nil
+	}
+	return d, fmt.Errorf("unknown rounding mode '%s'", mode)
+}
+
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
@@ -340,6 +498,7 @@ func (s *String) Inspect() string  { return s.Value }
 type DBField struct {
 	Value string
 	OType string
+	Args  []any // valeurs liées aux marqueurs '?' de Value, dans l'ordre
 }
 
 func (s *DBField) Type() ObjectType { return DBFIELD_OBJ }
@@ -372,6 +531,64 @@ type Date struct {
 func (d *Date) Type() ObjectType { return DATE_OBJ }
 func (d *Date) Inspect() string  { return d.Value.Format("2006-01-02") }
 
+// DateTime est un instant avec son fuseau horaire. Un littéral sans décalage ni fuseau est en UTC
+type DateTime struct {
+	Value time.Time
+}
+
+func (d *DateTime) Type() ObjectType { return DATETIME_OBJ }
+
+// Inspect rend la forme RFC 3339 suivie du nom du fuseau s'il en a un: 2024-01-15T14:30:00+01:00 Europe/Paris
+func (d *DateTime) Inspect() string {
+	s := d.Value.Format(time.RFC3339Nano)
+	if name := d.Value.Location().String(); name != "" && name != "UTC" && name != "Local" {
+		s += " " + name
+	}
+	return s
+}
+
+// ToDateTime convertit un datetime ou une date (minuit, dans le fuseau de la date) en datetime
+func ToDateTime(o Object) (*DateTime, bool) {
+	switch v := o.(type) {
+	case *DateTime:
+		return v, true
+	case *Date:
+		return &DateTime{Value: v.Value}, true
+	}
+	return nil, false
+}
+
+// ParseDateTime lit une date suivie ou non d'une heure, séparées par un espace ou 'T', avec éventuellement
+// des fractions de seconde, un décalage (Z, +02:00) et un nom de fuseau IANA: "2024-01-15 14:30:00 Europe/Paris".
+// Sans décalage, l'heure est celle du fuseau nommé, UTC par défaut
+func ParseDateTime(literal string) (time.Time, error) {
+	value := strings.TrimSpace(literal)
+	loc, zone := time.UTC, ""
+	if k := strings.LastIndexByte(value, ' '); k > 0 && k+1 < len(value) && unicode.IsLetter(rune(value[k+1])) {
+		value, zone = value[:k], value[k+1:]
+		l, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone '%s'", zone)
+		}
+		loc = l
+	}
+	value = strings.Replace(value, " ", "T", 1)
+	for _, layout := range []string{"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if zone != "" {
+				t = t.In(loc)
+			}
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid datetime '%s'", literal)
+}
+
 type Null struct{}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
@@ -403,6 +620,17 @@ func (f *Function) Inspect() string {
 	return "function"
 }
 
+// Module est un module importé: ses fonctions et ses types sont déclarés dans Env
+type Module struct {
+	Name string
+	Env  *Environment
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("module %q", m.Name)
+}
+
 type Struct struct {
 	Name   string
 	Fields map[string]Object
@@ -439,23 +667,42 @@ var (
 	FALSE = &Boolean{Value: false}
 )
 
+// DEFAULT_MAX_CALL est la profondeur d'appel par défaut d'une fonction récursive
+const DEFAULT_MAX_CALL int64 = 100
+
+// MAX_RUN_DEPTH est le nombre maximal d'actions imbriquées par run "nom"(...)
+const MAX_RUN_DEPTH = 16
+
+// runState porte l'état propre à une exécution. Il est partagé par tous les environnements
+// qui en dérivent, si bien que deux exécutions simultanées ne se voient pas
+type runState struct {
+	lastValue Object
+	structID  int
+	maxCall   int64
+	rows      map[*sql.Rows]struct{} // curseurs ouverts par Query et pas encore fermés
+	runDepth  int                    // actions appelées par run en cours d'exécution
+}
+
 type Environment struct {
 	store         map[string]Object
 	outer         *Environment
 	limits        *map[string]Limits
 	db            *sql.DB
 	tx            *sql.Tx
-	ctx           *gin.Context
-	hasFilter     func(ctx *gin.Context, table string) bool
-	getFilter     func(ctx *gin.Context, table, newName string) (ast.Expression, bool)
-	dbname        string
+	txLevel       int  // transaction ouverte par cet environnement: 0 aucune, 1 transaction, n>1 point de sauvegarde
+	module        bool // portée d'un module importé: les noms des portées englobantes n'y sont pas visibles
+	run           *runState
+	ctx           context.Context
+	hasFilter     func(ctx context.Context, table string) bool
+	getFilter     func(ctx context.Context, table, newName string) (ast.Expression, bool)
+	dialect       Dialect
 	params        *map[string]Object
 	disableUpdate bool
 	disabledDDL   bool
-	external      func(ctx *gin.Context, srv, name string, args map[string]Object) (Object, bool)
-	signature     func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)
-	emit          func(ctx *gin.Context, subject string, message any) bool
-	idps          func(ctx *gin.Context, arg ...string) error
+	external      func(ctx context.Context, srv, name string, args map[string]Object) (Object, bool)
+	signature     func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)
+	emit          func(ctx context.Context, subject string, message any) bool
+	idps          func(ctx context.Context, arg ...string) error
 }
 
 func (env *Environment) propagate(out *Environment, t *sql.Tx) {
@@ -474,38 +721,94 @@ func (env *Environment) findtrans(out *Environment) *sql.Tx {
 	}
 	return env.findtrans(out.outer)
 }
+func (env *Environment) txDepth(out *Environment) int {
+	if out == nil {
+		return 0
+	}
+	if out.txLevel != 0 {
+		return out.txLevel
+	}
+	return env.txDepth(out.outer)
+}
+func savepointName(level int) string {
+	return fmt.Sprintf("nsina_sp%d", level)
+}
+
+// StartTrans ouvre une transaction, ou un point de sauvegarde si une transaction englobante est déjà ouverte
 func (env *Environment) StartTrans() error {
-	if env.tx != nil {
+	if env.txLevel != 0 {
 		return errors.New("A transaction already open")
 	}
-	tx := env.findtrans(env.outer)
+	tx := env.tx
+	if tx == nil {
+		tx = env.findtrans(env.outer)
+	}
 	if tx != nil {
+		level := env.txDepth(env.outer) + 1
+		if level < 2 {
+			level = 2
+		}
+		if _, e := tx.ExecContext(env.ctx, env.Dialect().Savepoint(savepointName(level))); e != nil {
+			return e
+		}
 		env.tx = tx
+		env.txLevel = level
 		return nil
 	}
-	t, e := env.db.Begin()
+	t, e := env.db.BeginTx(env.ctx, nil)
 	if e != nil {
 		return e
 	}
 	env.tx = t
+	env.txLevel = 1
 	env.propagate(env.outer, t)
 	return nil
 }
+
+// RollbackTrans annule la transaction ouverte par StartTrans, ou seulement le travail fait
+// depuis son point de sauvegarde. La transaction englobante reste alors ouverte
 func (env *Environment) RollbackTrans() error {
-	if env.tx == nil {
+	if env.tx == nil || env.txLevel == 0 {
 		return errors.New("No open transactions")
 	}
+	var err error
+	if env.txLevel > 1 {
+		name := savepointName(env.txLevel)
+		_, err = env.tx.ExecContext(env.ctx, env.Dialect().RollbackTo(name))
+		if release := env.Dialect().Release(name); err == nil && release != "" {
+			_, err = env.tx.ExecContext(env.ctx, release)
+		}
+		env.tx = nil
+		env.txLevel = 0
+		return err
+	}
+	err = env.tx.Rollback()
 	env.tx = nil
+	env.txLevel = 0
 	env.propagate(env.outer, nil)
-	return nil
+	return err
 }
+
+// EndTrans valide la transaction ouverte par StartTrans, ou libère son point de sauvegarde
 func (env *Environment) EndTrans() error {
-	if env.tx == nil {
+	if env.tx == nil || env.txLevel == 0 {
 		return errors.New("No open transactions")
 	}
+	if env.txLevel > 1 {
+		var err error
+		if release := env.Dialect().Release(savepointName(env.txLevel)); release != "" {
+			_, err = env.tx.ExecContext(env.ctx, release)
+		}
+		if err == nil {
+			env.tx = nil
+			env.txLevel = 0
+		}
+		return err
+	}
 	err := env.tx.Commit()
 	if err == nil {
 		env.tx = nil
+		env.txLevel = 0
 		env.propagate(env.outer, nil)
 	}
 	return err
@@ -516,6 +819,7 @@ func (env *Environment) ClearTrans() error {
 	}
 	err := env.tx.Rollback()
 	env.tx = nil
+	env.txLevel = 0
 	env.propagate(env.outer, nil)
 	return err
 }
@@ -523,17 +827,26 @@ func (env *Environment) Context() context.Context {
 	return env.ctx
 }
 func (env *Environment) DBName() string {
-	return env.dbname
+	return env.Dialect().Name()
+}
+
+// Dialect renvoie le dialecte SQL de l'environnement, ou un dialecte générique s'il n'est pas défini
+func (env *Environment) Dialect() Dialect {
+	if env.dialect == nil {
+		return &ansiDialect{}
+	}
+	return env.dialect
 }
-func NewEnvironment(ctx *gin.Context, db *sql.DB, hf func(ctx *gin.Context, table string) bool,
-	gf func(ctx *gin.Context, table, newName string) (ast.Expression, bool), dbname string, params map[string]Object,
-	disableUpdate, disabledDDL bool, sign func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error),
-	external func(ctx *gin.Context, srv, name string, args map[string]Object) (Object, bool),
-	emit func(ctx *gin.Context, subject string, message any) bool, idps func(ctx *gin.Context, arg ...string) error) *Environment {
+func NewEnvironment(ctx context.Context, db *sql.DB, hf func(ctx context.Context, table string) bool,
+	gf func(ctx context.Context, table, newName string) (ast.Expression, bool), dialect Dialect, params map[string]Object,
+	disableUpdate, disabledDDL bool, sign func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error),
+	external func(ctx context.Context, srv, name string, args map[string]Object) (Object, bool),
+	emit func(ctx context.Context, subject string, message any) bool, idps func(ctx context.Context, arg ...string) error) *Environment {
 	s := make(map[string]Object)
 
 	return &Environment{store: s, outer: nil, limits: nil, db: db, ctx: ctx, tx: nil,
-		hasFilter: hf, getFilter: gf, dbname: dbname, params: &params, emit: emit, idps: idps,
+		run:       &runState{lastValue: NULL, maxCall: DEFAULT_MAX_CALL},
+		hasFilter: hf, getFilter: gf, dialect: dialect, params: &params, emit: emit, idps: idps,
 		disableUpdate: disableUpdate, disabledDDL: disabledDDL, external: external, signature: sign}
 }
 func (env *Environment) IsParams(name string) bool {
@@ -592,6 +905,7 @@ func (env *Environment) Exec(strSQL string, args ...any) (sql.Result, error) {
 	if strSQL == "" {
 		return nil, errors.New("Nsina: no query to be executed")
 	}
+	strSQL = Rebind(env.Dialect(), strSQL)
 	if env.tx != nil {
 		return env.tx.ExecContext(env.ctx, strSQL, args...)
 	}
@@ -611,16 +925,21 @@ func (env *Environment) Query(strSQL string, args ...any) (*sql.Rows, error) {
 		if env.ctx == nil {
 			return nil, errors.New("Nsina: Context is not defined")
 		}
-		if len(args) == 0 {
-			if env.tx != nil {
-				return env.tx.QueryContext(env.ctx, strSQL)
-			}
-			return env.db.QueryContext(env.ctx, strSQL)
-		}
+		strSQL = Rebind(env.Dialect(), strSQL)
+		var rows *sql.Rows
+		var err error
 		if env.tx != nil {
-			return env.tx.QueryContext(env.ctx, strSQL, args...)
+			rows, err = env.tx.QueryContext(env.ctx, strSQL, args...)
+		} else {
+			rows, err = env.db.QueryContext(env.ctx, strSQL, args...)
 		}
-		return env.db.QueryContext(env.ctx, strSQL, args...)
+		if err == nil {
+			if env.run.rows == nil {
+				env.run.rows = make(map[*sql.Rows]struct{})
+			}
+			env.run.rows[rows] = struct{}{}
+		}
+		return rows, err
 	}
 	if env.db == nil {
 		return nil, errors.New("Nsina: no defined database")
@@ -629,13 +948,91 @@ func (env *Environment) Query(strSQL string, args ...any) (*sql.Rows, error) {
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment(outer.ctx, outer.db, outer.hasFilter, outer.getFilter, outer.dbname, nil,
+	env := NewEnvironment(outer.ctx, outer.db, outer.hasFilter, outer.getFilter, outer.dialect, nil,
 		outer.disableUpdate, outer.disabledDDL, outer.signature, outer.external, outer.emit, outer.idps)
 	env.tx = outer.tx
+	env.run = outer.run
 	env.outer = outer
 	env.limits = nil
 	return env
 }
+
+// NewModuleEnvironment crée la portée d'un module importé: elle partage la connexion, les transactions
+// et l'état d'exécution de outer, mais pas ses variables
+func NewModuleEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.module = true
+	return env
+}
+
+// NewRunEnvironment crée la portée d'une action appelée par run: comme un module, elle partage la
+// connexion, les transactions et l'état d'exécution de outer, et reçoit ses propres paramètres
+func NewRunEnvironment(outer *Environment, params map[string]Object) *Environment {
+	env := NewModuleEnvironment(outer)
+	env.params = &params
+	return env
+}
+
+// EnterRun compte une action appelée par run; false quand MAX_RUN_DEPTH est atteint
+func (e *Environment) EnterRun() bool {
+	if e.run.runDepth >= MAX_RUN_DEPTH {
+		return false
+	}
+	e.run.runDepth++
+	return true
+}
+
+// LeaveRun termine l'action comptée par EnterRun
+func (e *Environment) LeaveRun() {
+	e.run.runDepth--
+}
+
+// LastValue renvoie la valeur de la dernière instruction d'un bloc catch ou protected
+func (e *Environment) LastValue() Object {
+	return e.run.lastValue
+}
+func (e *Environment) SetLastValue(obj Object) {
+	e.run.lastValue = obj
+}
+
+// CloseRows ferme tous les curseurs ouverts par Query pendant l'action, y compris ceux qu'aucune portée ne possède
+func (e *Environment) CloseRows() {
+	for rows := range e.run.rows {
+		rows.Close()
+	}
+	e.run.rows = nil
+}
+
+// Release ferme rows, ouvert par Query, et cesse de le suivre
+func (e *Environment) Release(rows *sql.Rows) error {
+	delete(e.run.rows, rows)
+	return rows.Close()
+}
+
+// OpenRows renvoie le nombre de curseurs ouverts par Query et pas encore fermés
+func (e *Environment) OpenRows() int {
+	return len(e.run.rows)
+}
+
+// SetRows attache à res le curseur rows ouvert par Query: fermer res le fermera et cessera de le suivre
+func (e *Environment) SetRows(res *SQLResult, rows *sql.Rows) {
+	res.Rows = rows
+	res.run = e.run
+}
+
+// NextStructID renvoie un nouveau numéro pour nommer une structure anonyme
+func (e *Environment) NextStructID() int {
+	e.run.structID++
+	return e.run.structID
+}
+
+// MaxCall renvoie la profondeur d'appel autorisée pour une fonction récursive
+func (e *Environment) MaxCall() int64 {
+	return e.run.maxCall
+}
+func (e *Environment) SetMaxCall(n int64) {
+	e.run.maxCall = n
+}
 func (e *Environment) IsUpdateDisabled() bool {
 	return e.disableUpdate
 }
@@ -645,7 +1042,7 @@ func (e *Environment) IsDDLDisabled() bool {
 
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[strings.ToLower(name)]
-	if !ok && e.outer != nil {
+	if !ok && e.outer != nil && !e.module {
 		obj, ok = e.outer.Get(name)
 	}
 	return obj, ok
@@ -653,7 +1050,7 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 func (e *Environment) isExist(name string) (*Environment, bool) {
 	_, ok := e.store[strings.ToLower(name)]
-	if !ok && e.outer != nil {
+	if !ok && e.outer != nil && !e.module {
 		return e.outer.isExist(name)
 	}
 	if ok {
@@ -666,15 +1063,51 @@ func (e *Environment) Set(name string, val Object) Object {
 	n, ok := e.isExist(name)
 	if ok {
 		n.store[strings.ToLower(name)] = val
+		n.adopt(val)
 		return val
 	}
 	e.store[strings.ToLower(name)] = val
+	e.adopt(val)
 	return val
 }
 func (e *Environment) Declare(name string, val Object) Object {
 	e.store[strings.ToLower(name)] = val
+	e.adopt(val)
 	return val
 }
+
+// adopt confie un curseur à la portée la plus externe qui le référence
+func (e *Environment) adopt(val Object) {
+	cur, ok := val.(*SQLResult)
+	if !ok || !cur.IsCursor() {
+		return
+	}
+	for env := cur.owner; env != nil; env = env.outer {
+		if env == e {
+			cur.owner = e
+			return
+		}
+	}
+	if cur.owner == nil {
+		cur.owner = e
+	}
+}
+
+// Detach retire un curseur à la portée qui le possède, pour qu'il lui survive (valeur de retour)
+func (e *Environment) Detach(val Object) {
+	if cur, ok := val.(*SQLResult); ok && cur.owner == e {
+		cur.owner = nil
+	}
+}
+
+// CloseCursors ferme les curseurs possédés par cette portée
+func (e *Environment) CloseCursors() {
+	for _, val := range e.store {
+		if cur, ok := val.(*SQLResult); ok && cur.owner == e {
+			cur.Close()
+		}
+	}
+}
 func (e *Environment) Clear() {
 	e.store = make(map[string]Object)
 }
@@ -700,12 +1133,18 @@ func (e *Environment) HasLimits(name string) bool {
 func (e *Environment) GetLimitEnv(name string) *Environment {
 	env := e
 	if env.limits == nil {
+		if env.module {
+			return nil
+		}
 		env = env.outer
 	}
 	if env == nil {
 		return nil
 	}
 	for !env.HasLimits(name) {
+		if env.module {
+			return nil
+		}
 		env = env.outer
 		if env == nil {
 			break
@@ -713,6 +1152,17 @@ func (e *Environment) GetLimitEnv(name string) *Environment {
 	}
 	return env
 }
+
+// Round arrondit value selon les contraintes de la variable name (l'échelle d'un decimal(p,s))
+func (e *Environment) Round(name string, value Object) Object {
+	if e.limits == nil {
+		return value
+	}
+	if lim, ok := (*e.limits)[strings.ToLower(name)]; ok {
+		return lim.Round(value)
+	}
+	return value
+}
 func (e *Environment) Valid(name string, value Object) (bool, string) {
 	if e.limits == nil {
 		return true, ""
@@ -722,23 +1172,31 @@ func (e *Environment) Valid(name string, value Object) (bool, string) {
 	}
 	return true, ""
 }
+
+// SysUser déclare la variable sysuser à partir des attributs de l'utilisateur du contexte
 func (e *Environment) SysUser() Object {
 	usr := &Struct{Name: "sysuser", Fields: make(map[string]Object)}
-	for key, values := range e.ctx.Request.Header {
-		// Vérifie si la clé commence par "X-User-"
-		if strings.HasPrefix(key, "X-User-") {
-			if strings.EqualFold(key, "X-User-Roles") {
-				continue
-			}
+	if p := PrincipalFrom(e.ctx); p != nil {
+		for key, values := range p.Attributes {
 			if len(values) > 1 {
-				usr.Fields[strings.ToLower(strings.TrimPrefix(key, "X-User-"))] = &Array{ElementType: STRING_OBJ, Elements: make([]Object, len(values))}
+				arr := &Array{ElementType: STRING_OBJ, Elements: make([]Object, len(values))}
 				for i, v := range values {
-					usr.Fields[strings.ToLower(strings.TrimPrefix(key, "X-User-"))].(*Array).Elements[i] = &String{Value: v}
+					arr.Elements[i] = &String{Value: v}
 				}
+				usr.Fields[strings.ToLower(key)] = arr
 				continue
 			}
-			usr.Fields[strings.ToLower(strings.TrimPrefix(key, "X-User-"))] = &String{Value: values[0]}
+			value := ""
+			if len(values) == 1 {
+				value = values[0]
+			}
+			usr.Fields[strings.ToLower(key)] = &String{Value: value}
+		}
+		roles := &Array{ElementType: STRING_OBJ, Elements: make([]Object, len(p.Roles))}
+		for i, r := range p.Roles {
+			roles.Elements[i] = &String{Value: r}
 		}
+		usr.Fields["roles"] = roles
 	}
 	return e.Set("sysuser", usr)
 }
@@ -808,12 +1266,17 @@ type SQLIndex struct {
 	Unique  bool
 }
 
-// SQLResult - Résultat d'une opération SQL
+// SQLResult - Résultat d'une opération SQL.
+// Pour un SELECT, Rows est un curseur lu à la demande par next, fetch ou foreach
 type SQLResult struct {
 	Message      string
 	RowsAffected int64
 	Columns      []string
 	Rows         *sql.Rows //[]map[string]Object
+	types        []*sql.ColumnType
+	closed       bool
+	owner        *Environment // portée qui ferme le curseur à sa sortie
+	run          *runState    // exécution qui suit le curseur
 }
 
 func (sr *SQLResult) Type() ObjectType { return SQL_RESULT_OBJ }
@@ -824,6 +1287,36 @@ func (sr *SQLResult) Inspect() string {
 	return fmt.Sprintf("SQLResult(%d ligne(s) affectée(s))", sr.RowsAffected)
 }
 
+// IsCursor indique si le résultat est un curseur encore ouvert
+func (sr *SQLResult) IsCursor() bool {
+	return sr.Rows != nil && !sr.closed
+}
+
+// ColumnTypes renvoie les types des colonnes du curseur, lus une seule fois
+func (sr *SQLResult) ColumnTypes() ([]*sql.ColumnType, error) {
+	if sr.types == nil {
+		types, err := sr.Rows.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		sr.types = types
+	}
+	return sr.types, nil
+}
+
+// Close ferme le curseur et libère sa connexion; sans effet s'il est déjà fermé
+func (sr *SQLResult) Close() error {
+	if sr.Rows == nil || sr.closed {
+		return nil
+	}
+	sr.closed = true
+	sr.owner = nil
+	if sr.run != nil {
+		delete(sr.run.rows, sr.Rows)
+	}
+	return sr.Rows.Close()
+}
+
 // // HierarchicalTree - Arbre hiérarchique
 // type HierarchicalTree struct {
 // 	Roots []*HierarchicalNode
@@ -898,6 +1391,128 @@ func (a *Set) Inspect() string {
 	return out.String()
 }
 
+// MapKey - clé de hachage d'un élément de dictionnaire
+type MapKey struct {
+	Type  ObjectType
+	Value any
+}
+
+// HashKey renvoie la clé de hachage de o; seuls les types simples peuvent servir de clé
+func HashKey(o Object) (MapKey, bool) {
+	switch v := o.(type) {
+	case *Integer:
+		return MapKey{Type: INTEGER_OBJ, Value: v.Value}, true
+	case *Float:
+		return MapKey{Type: FLOAT_OBJ, Value: v.Value}, true
+	case *Decimal:
+		return MapKey{Type: DECIMAL_OBJ, Value: v.Value.String()}, true
+	case *String:
+		return MapKey{Type: STRING_OBJ, Value: v.Value}, true
+	case *Boolean:
+		return MapKey{Type: BOOLEAN_OBJ, Value: v.Value}, true
+	case *Date:
+		return MapKey{Type: DATE_OBJ, Value: v.Value.UnixNano()}, true
+	case *DateTime:
+		return MapKey{Type: DATETIME_OBJ, Value: v.Value.UnixNano()}, true
+	case *Time:
+		return MapKey{Type: TIME_OBJ, Value: v.Value.UnixNano()}, true
+	case *Duration:
+		return MapKey{Type: DURATION_OBJ, Value: v.Nanoseconds}, true
+	}
+	return MapKey{}, false
+}
+
+// MapPair - couple clé/valeur d'un dictionnaire
+type MapPair struct {
+	Key   Object
+	Value Object
+}
+
+// Map - Type dictionnaire; les clés gardent leur ordre d'insertion
+type Map struct {
+	KeyType   string // Type des clés (optionnel)
+	ValueType string // Type des valeurs (optionnel)
+	Order     []MapKey
+	Pairs     map[MapKey]*MapPair
+}
+
+func NewMap(keyType, valueType string) *Map {
+	return &Map{KeyType: keyType, ValueType: valueType, Order: []MapKey{}, Pairs: map[MapKey]*MapPair{}}
+}
+
+func (m *Map) Type() ObjectType { return MAP_OBJ }
+func (m *Map) Inspect() string {
+	var out strings.Builder
+	out.WriteString("{")
+	for i, pair := range m.Entries() {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		fmt.Fprintf(&out, "%s: %s", pair.Key.Inspect(), pair.Value.Inspect())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Len renvoie le nombre d'éléments du dictionnaire
+func (m *Map) Len() int { return len(m.Order) }
+
+// Get renvoie la valeur associée à key
+func (m *Map) Get(key Object) (Object, bool) {
+	hk, ok := HashKey(key)
+	if !ok {
+		return nil, false
+	}
+	pair, ok := m.Pairs[hk]
+	if !ok {
+		return nil, false
+	}
+	return pair.Value, true
+}
+
+// Put associe value à key; faux si key ne peut pas servir de clé
+func (m *Map) Put(key, value Object) bool {
+	hk, ok := HashKey(key)
+	if !ok {
+		return false
+	}
+	if pair, exists := m.Pairs[hk]; exists {
+		pair.Value = value
+		return true
+	}
+	m.Order = append(m.Order, hk)
+	m.Pairs[hk] = &MapPair{Key: key, Value: value}
+	return true
+}
+
+// Delete retire key du dictionnaire et indique si elle y était
+func (m *Map) Delete(key Object) bool {
+	hk, ok := HashKey(key)
+	if !ok {
+		return false
+	}
+	if _, exists := m.Pairs[hk]; !exists {
+		return false
+	}
+	delete(m.Pairs, hk)
+	for i, k := range m.Order {
+		if k == hk {
+			m.Order = append(m.Order[:i], m.Order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Entries renvoie les couples dans l'ordre d'insertion
+func (m *Map) Entries() []*MapPair {
+	res := make([]*MapPair, 0, len(m.Order))
+	for _, k := range m.Order {
+		res = append(res, m.Pairs[k])
+	}
+	return res
+}
+
 type Break struct{}
 
 func (b *Break) Type() ObjectType { return BREAK_OBJ }
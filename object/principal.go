@@ -0,0 +1,63 @@
+package object
+
+import (
+	"context"
+	"strings"
+)
+
+// Principal décrit l'utilisateur pour le compte duquel une action s'exécute.
+// Ses attributs et ses rôles (sysuser.roles) sont exposés au code de l'action par la variable sysuser
+type Principal struct {
+	Attributes map[string][]string // nom de l'attribut (minuscules) -> valeurs
+	Roles      []string
+}
+
+// NewPrincipal crée un utilisateur sans attribut ni rôle
+func NewPrincipal() *Principal {
+	return &Principal{Attributes: make(map[string][]string)}
+}
+
+// Set remplace les valeurs de l'attribut name
+func (p *Principal) Set(name string, values ...string) {
+	if p.Attributes == nil {
+		p.Attributes = make(map[string][]string)
+	}
+	p.Attributes[strings.ToLower(name)] = values
+}
+
+// Get renvoie la première valeur de l'attribut name
+func (p *Principal) Get(name string) string {
+	if p == nil || len(p.Attributes[strings.ToLower(name)]) == 0 {
+		return ""
+	}
+	return p.Attributes[strings.ToLower(name)][0]
+}
+
+// HasRole indique si l'utilisateur a le rôle role (insensible à la casse)
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal attache l'utilisateur au contexte transmis au moteur et aux callbacks
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom renvoie l'utilisateur attaché au contexte, ou nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
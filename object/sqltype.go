@@ -0,0 +1,35 @@
+package object
+
+import "strings"
+
+// ActionType renvoie le type du langage d'une colonne dont le moteur donne le type dbType
+// (sql.ColumnType.DatabaseTypeName, sans la taille). size est la taille en octets des entiers
+// qui en ont une (int2, int4, int8), 0 sinon. Un type inconnu est renvoyé en minuscules
+func ActionType(dbType string) (name string, size int) {
+	s := strings.ToLower(strings.TrimSpace(strings.Split(dbType, "(")[0]))
+	switch s {
+	case "string", "varchar", "varchar2", "nvarchar", "nvarchar2", "char", "nchar", "bpchar",
+		"character", "character varying", "text", "ntext", "tinytext", "mediumtext", "longtext",
+		"clob", "nclob", "blob", "name":
+		return "string", 0
+	case "int2", "smallint":
+		return "integer", 2
+	case "int4":
+		return "integer", 4
+	case "int8", "bigint":
+		return "integer", 8
+	case "integer", "int", "tinyint", "mediumint", "number":
+		return "integer", 0
+	case "float", "float4", "float8", "real", "double", "double precision":
+		return "float", 0
+	case "numeric", "decimal":
+		return "decimal", 0
+	case "bool", "boolean", "bit":
+		return "boolean", 0
+	case "timestamptz", "datetimeoffset":
+		return "datetime", 0
+	case "json", "jsonb":
+		return "json", 0
+	}
+	return s, 0
+}
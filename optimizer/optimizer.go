@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
 	// "github.com/akristianlopez/action/token"
 )
 
@@ -13,6 +14,7 @@ type Optimizer struct {
 	Optimizations []Optimization
 	Stats         OptimizationStats
 	Warnings      []string
+	Diagnostics   []diagnostic.Diagnostic
 }
 
 type OptimizationStats struct {
@@ -29,31 +31,28 @@ type Optimization interface {
 	CanApply(*ast.Action) bool
 }
 
-type ConstantFolding struct{}
-type DeadCodeElimination struct{}
-type FunctionInlining struct{}
-type LoopOptimization struct{}
-type UnrichabledCode struct{}
+// Chaque optimisation garde un lien vers son Optimizer pour y reporter avertissements et statistiques
+type ConstantFolding struct{ o *Optimizer }
+type DeadCodeElimination struct{ o *Optimizer }
+type FunctionInlining struct{ o *Optimizer }
+type LoopOptimization struct{ o *Optimizer }
+type UnrichabledCode struct{ o *Optimizer }
 
 func NewOptimizer() *Optimizer {
-	return &Optimizer{
-		Optimizations: []Optimization{
-			&ConstantFolding{},
-			&DeadCodeElimination{},
-			&LoopOptimization{},
-			&FunctionInlining{},
-			&UnrichabledCode{},
-		},
+	o := &Optimizer{
 		Stats:    OptimizationStats{},
 		Warnings: make([]string, 0),
 	}
+	o.Optimizations = []Optimization{
+		&ConstantFolding{o: o},
+		&DeadCodeElimination{o: o},
+		&LoopOptimization{o: o},
+		&FunctionInlining{o: o},
+		&UnrichabledCode{o: o},
+	}
+	return o
 }
 
-var Warnings func(format string, args ...interface{})
-var IncrementFolding func()
-var IncrementLoopOptimization func()
-var IncrementInlineExpansion func()
-
 // var IncrementUnreachibked func()
 
 func (o *Optimizer) IncrementConstantFolding() {
@@ -70,11 +69,6 @@ func (o *Optimizer) IncrementInlineExpansion() {
 
 func (o *Optimizer) Optimize(program *ast.Action) *ast.Action {
 	optimized := program
-	Warnings = o.addWarning
-	IncrementFolding = o.IncrementConstantFolding
-	IncrementLoopOptimization = o.IncrementLoopOptimization
-	IncrementInlineExpansion = o.IncrementInlineExpansion
-
 	// Appliquer les optimisations en plusieurs passes
 	for i := 0; i < 10; i++ { // Maximum 10 passes
 		changed := false
@@ -110,8 +104,15 @@ func (o *Optimizer) Optimize(program *ast.Action) *ast.Action {
 	return optimized
 }
 
-func (o *Optimizer) addWarning(format string, args ...interface{}) {
-	o.Warnings = append(o.Warnings, fmt.Sprintf(format, args...))
+// addWarning signale un avertissement à l'emplacement span; Warnings en garde la forme textuelle
+func (o *Optimizer) addWarning(code string, span diagnostic.Span, format string, args ...interface{}) {
+	d := diagnostic.Diagnostic{Code: code, Severity: diagnostic.Warning, Source: diagnostic.Optimizer,
+		Message: fmt.Sprintf(format, args...), Span: span}
+	if code == diagnostic.UnusedName && len(args) > 0 {
+		d.Fixes = []diagnostic.Fix{{Title: fmt.Sprintf("Remove the declaration of '%v'", args[0])}}
+	}
+	o.Warnings = append(o.Warnings, d.String())
+	o.Diagnostics = append(o.Diagnostics, d)
 }
 
 // CONSTANT FOLDING
@@ -136,7 +137,7 @@ func (cf *ConstantFolding) Apply(program *ast.Action) *ast.Action {
 		// default:
 		// 	optimized.Statements = append(optimized.Statements, foldConstantsInStatement(stmt))
 		// }
-		optimized.Statements = append(optimized.Statements, foldConstantsInStatement(stmt))
+		optimized.Statements = append(optimized.Statements, cf.o.foldConstantsInStatement(stmt))
 	}
 	return optimized
 }
@@ -247,6 +248,7 @@ func (uc *UnrichabledCode) check(stmts []ast.Statement) ([]ast.Statement, []ast.
 			st := &ast.ForEachStatement{
 				Token:    stm.Token,
 				Variable: stm.Variable,
+				Value:    stm.Value,
 				Iterator: stm.Iterator,
 				Body:     &ast.BlockStatement{Token: stm.Body.Token}}
 			op, un := uc.check(stm.Body.Statements)
@@ -320,89 +322,90 @@ func (uc *UnrichabledCode) Apply(program *ast.Action) *ast.Action {
 	optimized.Statements = append(optimized.Statements, op...)
 	if len(un) > 0 {
 		for _, st := range un {
-			Warnings("Unreachabled code. line:%d, column:%d", st.Line(), st.Column())
+			uc.o.addWarning(diagnostic.Unreachable, diagnostic.At(st.Line(), st.Column()), "Unreachabled code")
 		}
 	}
 	return optimized
 }
 
-func foldConstantsInStatement(stmt ast.Statement) ast.Statement {
+func (o *Optimizer) foldConstantsInStatement(stmt ast.Statement) ast.Statement {
 	switch s := stmt.(type) {
 	case *ast.LetStatement:
-		return foldLetStatement(s)
+		return o.foldLetStatement(s)
 	case *ast.ExpressionStatement:
-		return foldExpressionStatement(s)
+		return o.foldExpressionStatement(s)
 	case *ast.AssignmentStatement:
-		return foldAssignmentStatement(s)
+		return o.foldAssignmentStatement(s)
 	case *ast.ReturnStatement:
-		return foldReturnStatement(s)
+		return o.foldReturnStatement(s)
 	case *ast.BlockStatement:
-		return foldBlockStatement(s)
+		return o.foldBlockStatement(s)
 	case *ast.ForStatement:
-		return foldForStatement(s)
+		return o.foldForStatement(s)
 	case *ast.WhileStatement:
-		return foldWhileStatement(s)
+		return o.foldWhileStatement(s)
 	case *ast.ForEachStatement:
-		return foldForEachStatement(s)
+		return o.foldForEachStatement(s)
 	case *ast.FunctionStatement:
-		return foldFunctionStatement(s)
+		return o.foldFunctionStatement(s)
 	case *ast.IfStatement:
-		return foldIfStatement(s)
+		return o.foldIfStatement(s)
 	case *ast.CatchStatement:
-		return foldCatchStatement(s)
+		return o.foldCatchStatement(s)
 	case *ast.ProtectedStatement:
-		return foldProtectedStatement(s)
+		return o.foldProtectedStatement(s)
 	case *ast.SwitchStatement:
-		return foldSwitchStatement(s)
+		return o.foldSwitchStatement(s)
 	default:
 		return s
 	}
 }
 
-func foldFunctionStatement(stmt *ast.FunctionStatement) ast.Statement {
+func (o *Optimizer) foldFunctionStatement(stmt *ast.FunctionStatement) ast.Statement {
 	return &ast.FunctionStatement{
 		Token:      stmt.Token,
 		Name:       stmt.Name,
 		Parameters: stmt.Parameters,
 		ReturnType: stmt.ReturnType,
-		Body:       foldBlockStatement(stmt.Body),
+		Body:       o.foldBlockStatement(stmt.Body),
 	}
 }
 
-func foldIfStatement(stmt *ast.IfStatement) ast.Statement {
+func (o *Optimizer) foldIfStatement(stmt *ast.IfStatement) ast.Statement {
 	return &ast.IfStatement{
 		Token:     stmt.Token,
-		Condition: foldExpression(stmt.Condition),
-		Then:      foldBlockStatement(stmt.Then),
-		Else:      foldBlockStatement(stmt.Else),
+		Condition: o.foldExpression(stmt.Condition),
+		Then:      o.foldBlockStatement(stmt.Then),
+		Else:      o.foldBlockStatement(stmt.Else),
 	}
 }
 
-func foldCatchStatement(stmt *ast.CatchStatement) ast.Statement {
+func (o *Optimizer) foldCatchStatement(stmt *ast.CatchStatement) ast.Statement {
 	return &ast.CatchStatement{
 		Token:      stmt.Token,
-		Statements: foldBlockStatement(stmt.Statements),
+		Statements: o.foldBlockStatement(stmt.Statements),
 	}
 }
-func foldProtectedStatement(stmt *ast.ProtectedStatement) ast.Statement {
+func (o *Optimizer) foldProtectedStatement(stmt *ast.ProtectedStatement) ast.Statement {
 	return &ast.ProtectedStatement{
 		Token:      stmt.Token,
-		Statements: foldBlockStatement(stmt.Statements),
+		Statements: o.foldBlockStatement(stmt.Statements),
 	}
 }
 
-func foldForEachStatement(s *ast.ForEachStatement) ast.Statement {
+func (o *Optimizer) foldForEachStatement(s *ast.ForEachStatement) ast.Statement {
 	return &ast.ForEachStatement{
 		Token:    s.Token,
 		Variable: s.Variable,
-		Iterator: foldExpression(s.Iterator),
-		Body:     foldBlockStatement(s.Body),
+		Value:    s.Value,
+		Iterator: o.foldExpression(s.Iterator),
+		Body:     o.foldBlockStatement(s.Body),
 	}
 }
 
-func foldLetStatement(stmt *ast.LetStatement) *ast.LetStatement {
+func (o *Optimizer) foldLetStatement(stmt *ast.LetStatement) *ast.LetStatement {
 	if stmt.Value != nil {
-		folded := foldExpression(stmt.Value)
+		folded := o.foldExpression(stmt.Value)
 		if folded != stmt.Value {
 			// IncrementFolding()
 			return &ast.LetStatement{
@@ -416,26 +419,26 @@ func foldLetStatement(stmt *ast.LetStatement) *ast.LetStatement {
 	return stmt
 }
 
-func foldExpression(expr ast.Expression) ast.Expression {
+func (o *Optimizer) foldExpression(expr ast.Expression) ast.Expression {
 	switch e := expr.(type) {
 	case *ast.InfixExpression:
-		return foldInfixExpression(e)
+		return o.foldInfixExpression(e)
 	case *ast.IifExpression:
-		return foldIifExpression(e)
+		return o.foldIifExpression(e)
 	case *ast.BetweenExpression:
-		return foldBetweenExpression(e)
+		return o.foldBetweenExpression(e)
 	case *ast.LikeExpression:
-		return foldLikeExpression(e)
+		return o.foldLikeExpression(e)
 	case *ast.PrefixExpression:
-		return foldPrefixExpression(e)
+		return o.foldPrefixExpression(e)
 	default:
 		return e
 	}
 }
-func foldIifExpression(expr *ast.IifExpression) ast.Expression {
-	cond := foldExpression(expr.Condition)
-	then := foldExpression(expr.TrueExpr)
-	elseExpr := foldExpression(expr.FalseExpr)
+func (o *Optimizer) foldIifExpression(expr *ast.IifExpression) ast.Expression {
+	cond := o.foldExpression(expr.Condition)
+	then := o.foldExpression(expr.TrueExpr)
+	elseExpr := o.foldExpression(expr.FalseExpr)
 	if cond != expr.Condition || then != expr.TrueExpr || elseExpr != expr.FalseExpr {
 		return &ast.IifExpression{
 			Token:     expr.Token,
@@ -447,9 +450,9 @@ func foldIifExpression(expr *ast.IifExpression) ast.Expression {
 	return expr
 }
 
-func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
-	left := foldExpression(expr.Left)
-	right := foldExpression(expr.Right)
+func (o *Optimizer) foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
+	left := o.foldExpression(expr.Left)
+	right := o.foldExpression(expr.Right)
 
 	// Vérifier si les deux côtés sont des littéraux
 	if isConstant(left) && isConstant(right) {
@@ -458,7 +461,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "+":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.IntegerLiteral{
 						Token: expr.Token,
 						Value: l.Value + r.Value,
@@ -467,7 +470,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 			}
 			if l, ok := left.(*ast.FloatLiteral); ok {
 				if r, ok := right.(*ast.FloatLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.FloatLiteral{
 						Token: expr.Token,
 						Value: l.Value + r.Value,
@@ -478,7 +481,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "-":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.IntegerLiteral{
 						Token: expr.Token,
 						Value: l.Value - r.Value,
@@ -487,7 +490,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 			}
 			if l, ok := left.(*ast.FloatLiteral); ok {
 				if r, ok := right.(*ast.FloatLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.FloatLiteral{
 						Token: expr.Token,
 						Value: l.Value - r.Value,
@@ -498,7 +501,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "*":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.IntegerLiteral{
 						Token: expr.Token,
 						Value: l.Value * r.Value,
@@ -507,7 +510,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 			}
 			if l, ok := left.(*ast.FloatLiteral); ok {
 				if r, ok := right.(*ast.FloatLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.FloatLiteral{
 						Token: expr.Token,
 						Value: l.Value * r.Value,
@@ -518,7 +521,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
 					if r.Value != 0 {
-						IncrementFolding()
+						o.IncrementConstantFolding()
 						return &ast.IntegerLiteral{
 							Token: expr.Token,
 							Value: l.Value / r.Value,
@@ -529,7 +532,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 			if l, ok := left.(*ast.FloatLiteral); ok {
 				if r, ok := right.(*ast.FloatLiteral); ok {
 					if r.Value != 0 {
-						IncrementFolding()
+						o.IncrementConstantFolding()
 						return &ast.FloatLiteral{
 							Token: expr.Token,
 							Value: l.Value / r.Value,
@@ -540,7 +543,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "==":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.BooleanLiteral{
 						Token: expr.Token,
 						Value: l.Value == r.Value,
@@ -550,7 +553,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "!=":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.BooleanLiteral{
 						Token: expr.Token,
 						Value: l.Value != r.Value,
@@ -560,7 +563,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "<":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.BooleanLiteral{
 						Token: expr.Token,
 						Value: l.Value < r.Value,
@@ -570,7 +573,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case ">":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.BooleanLiteral{
 						Token: expr.Token,
 						Value: l.Value > r.Value,
@@ -580,7 +583,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case "<=":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.BooleanLiteral{
 						Token: expr.Token,
 						Value: l.Value <= r.Value,
@@ -590,7 +593,7 @@ func foldInfixExpression(expr *ast.InfixExpression) ast.Expression {
 		case ">=":
 			if l, ok := left.(*ast.IntegerLiteral); ok {
 				if r, ok := right.(*ast.IntegerLiteral); ok {
-					IncrementFolding()
+					o.IncrementConstantFolding()
 					return &ast.BooleanLiteral{
 						Token: expr.Token,
 						Value: l.Value >= r.Value,
@@ -635,101 +638,101 @@ func (dce *DeadCodeElimination) Apply(program *ast.Action) *ast.Action {
 	for _, stmt := range program.Statements {
 		switch s := stmt.(type) {
 		case *ast.LetStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: variable '%s' is not used. Line:%d, column:%d", s.Name.Value,
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.UnusedName, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: variable '%s' is not used", s.Name.Value)
 			continue
 		case *ast.FunctionStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: function '%s' is not used. Line:%d, column:%d", s.Name.Value,
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.UnusedName, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: function '%s' is not used", s.Name.Value)
 			continue
 		case *ast.StructStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: struct '%s' is not used. Line:%d, column:%d", s.Name.Value,
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.UnusedName, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: struct '%s' is not used", s.Name.Value)
 			continue
 		case *ast.IfStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
 			if isUnrichabled(s.Condition) && s.Else != nil {
-				Warnings("Dead code eliminated: Then statement at Line:%d, column:%d is not reachable.",
-					s.Token.Line, s.Token.Column)
+				dce.o.addWarning(diagnostic.Unreachable, diagnostic.At(s.Token.Line, s.Token.Column),
+					"Dead code eliminated: Then statement is not reachable")
 				optimized.Statements = append(optimized.Statements, s.Else)
 				continue
 			}
-			Warnings("Dead code eliminated: if statement at Line:%d, column:%d has empty body.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: if statement has empty body")
 		case *ast.CatchStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: Catch statement at Line:%d, column:%d has empty body.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: Catch statement has empty body")
 		case *ast.ProtectedStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: Protected statement at Line:%d, column:%d has empty body.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: Protected statement has empty body")
 		case *ast.WhileStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
 			if isUnrichabled(s.Condition) {
-				Warnings("Dead code eliminated: while statement at Line:%d, column:%d is not reachable.",
-					s.Token.Line, s.Token.Column)
+				dce.o.addWarning(diagnostic.Unreachable, diagnostic.At(s.Token.Line, s.Token.Column),
+					"Dead code eliminated: while statement is not reachable")
 				continue
 			}
-			Warnings("Dead code eliminated: while statement at Line:%d, column:%d has empty body.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: while statement has empty body")
 		case *ast.ForStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
 			if isUnrichabled(s.Condition) {
-				Warnings("Dead code eliminated: for statement at Line:%d, column:%d is not reachable.",
-					s.Token.Line, s.Token.Column)
+				dce.o.addWarning(diagnostic.Unreachable, diagnostic.At(s.Token.Line, s.Token.Column),
+					"Dead code eliminated: for statement is not reachable")
 				continue
 			}
-			Warnings("Dead code eliminated: for statement at Line:%d, column:%d has empty body.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: for statement has empty body")
 		case *ast.ForEachStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: foreach statement at Line:%d, column:%d has empty body.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: foreach statement has empty body")
 		case *ast.SwitchStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: switch statement at Line:%d, column:%d has all cases dead.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: switch statement has all cases dead")
 		case *ast.ReturnStatement:
-			if !isDeadCode(s, program.Statements) {
+			if !dce.isDeadCode(s, program.Statements) {
 				optimized.Statements = append(optimized.Statements, s)
 				continue
 			}
-			Warnings("Dead code eliminated: return statement at Line:%d, column:%d has no effect.",
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: return statement has no effect")
 		default:
 			optimized.Statements = append(optimized.Statements, stmt)
 		}
@@ -795,6 +798,15 @@ func isVariableUsedInExpression(expr ast.Expression, name string) bool {
 			isVariableUsedInExpression(e.FalseExpr, name)
 	case *ast.IndexExpression:
 		return isVariableUsedInExpression(e.Left, name) || isVariableUsedInExpression(e.Index, name)
+	case *ast.SliceExpression:
+		return isVariableUsedInExpression(e.Left, name) || isVariableUsedInExpression(e.Start, name) ||
+			isVariableUsedInExpression(e.End, name)
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			if isVariableUsedInExpression(el, name) {
+				return true
+			}
+		}
 	case *ast.PrefixExpression:
 		return isVariableUsedInExpression(e.Right, name)
 	case *ast.BetweenExpression:
@@ -810,6 +822,17 @@ func isVariableUsedInExpression(expr ast.Expression, name string) bool {
 		for _, ex := range e.Joins {
 			flag = flag || isVariableUsedInExpression(ex.On, name)
 		}
+		for _, ex := range e.GroupBy {
+			flag = flag || isVariableUsedInExpression(ex, name)
+		}
+		for _, ex := range e.OrderBy {
+			flag = flag || isVariableUsedInExpression(ex.Expression, name)
+		}
+		flag = flag || isVariableUsedInExpression(e.Having, name) || isVariableUsedInExpression(e.Limit, name) ||
+			isVariableUsedInExpression(e.Offset, name)
+		if e.Union != nil {
+			flag = flag || isVariableUsedInExpression(e.Union, name)
+		}
 		return flag
 	case *ast.SQLWithStatement:
 		for _, cte := range e.CTEs {
@@ -852,6 +875,30 @@ func isVariableUsedInExpression(expr ast.Expression, name string) bool {
 				return true
 			}
 		}
+	case *ast.JSONPathExpression:
+		if isVariableUsedInExpression(e.Left, name) {
+			return true
+		}
+		for _, step := range e.Steps {
+			if step.Index != nil && isVariableUsedInExpression(step.Index, name) {
+				return true
+			}
+		}
+	case *ast.MapLiteral:
+		for _, pair := range e.Pairs {
+			if isVariableUsedInExpression(pair.Key, name) || isVariableUsedInExpression(pair.Value, name) {
+				return true
+			}
+		}
+	case *ast.RunExpression:
+		for _, arg := range e.Arguments {
+			if isVariableUsedInExpression(arg.Value, name) {
+				return true
+			}
+		}
+	case *ast.FunctionLiteral:
+		// une fonction anonyme utilise les variables de la portée où elle est écrite
+		return e.Body != nil && isFunctionUsedInStatement(e.Body, name)
 	case *ast.StructLiteral:
 		if e.Name != nil && strings.EqualFold(e.Name.Value, name) {
 			return true
@@ -865,7 +912,7 @@ func isVariableUsedInExpression(expr ast.Expression, name string) bool {
 	return false
 }
 
-func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
+func (dce *DeadCodeElimination) isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 	// Identifier le code mort (variables non utilisées, etc.)
 	switch s := stmt.(type) {
 	case *ast.LetStatement:
@@ -876,8 +923,8 @@ func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 		return isFunctionDead(s, actions)
 	case *ast.StructStatement:
 		if len(s.Fields) == 0 {
-			Warnings("Dead code eliminated: struct '%s' is empty. Line:%d, column:%d", s.Name.Value,
-				s.Token.Line, s.Token.Column)
+			dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(s.Token.Line, s.Token.Column),
+				"Dead code eliminated: struct '%s' is empty", s.Name.Value)
 			return true
 		}
 		// Les structures ne sont pas considérées comme du code mort ici
@@ -901,24 +948,24 @@ func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 		if isAlwaysFalse(s.Condition) {
 			// Si le IF est toujours faux, on ne garde que le corps du ELSE s'il existe
 			if s.Else != nil {
-				return isDeadCode(s.Else, actions)
+				return dce.isDeadCode(s.Else, actions)
 			}
 			return true
 		}
 		if isAlwaysTrue(s.Condition) {
 			// Si le IF est toujours vrai, on ne garde que le corps du THEN
 			if s.Then != nil {
-				return isDeadCode(s.Then, actions)
+				return dce.isDeadCode(s.Then, actions)
 			}
 			return true
 		}
 
 		// 2. Sinon, on optimise les deux branches indépendamment
 		if s.Then != nil {
-			return isDeadCode(s.Then, actions)
+			return dce.isDeadCode(s.Then, actions)
 		}
 		if s.Else != nil {
-			return isDeadCode(s.Else, actions)
+			return dce.isDeadCode(s.Else, actions)
 		}
 
 		// Si les deux branches sont vides après optimisation, le IF ne sert plus à rien (sauf si la condition a un effet de bord)
@@ -928,10 +975,10 @@ func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 		return true
 	case *ast.CatchStatement:
 		// Si les deux branches sont mortes, le if est mort
-		return s.Statements == nil || isDeadCode(s.Statements, actions)
+		return s.Statements == nil || dce.isDeadCode(s.Statements, actions)
 	case *ast.ProtectedStatement:
 		// Si les deux branches sont mortes, le if est mort
-		return s.Statements == nil || isDeadCode(s.Statements, actions)
+		return s.Statements == nil || dce.isDeadCode(s.Statements, actions)
 	case *ast.WhileStatement:
 		// Si le corps de la boucle est vide ou mort, la boucle est morte
 		if s.Body == nil || len(s.Body.Statements) == 0 {
@@ -940,7 +987,7 @@ func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 		if isUnrichabled(s.Condition) {
 			return true
 		}
-		return isDeadCode(s.Body, actions)
+		return dce.isDeadCode(s.Body, actions)
 	case *ast.ForStatement:
 		// Si le corps de la boucle est vide ou mort, la boucle est morte
 		if s.Body == nil || len(s.Body.Statements) == 0 {
@@ -949,23 +996,23 @@ func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 		if isUnrichabled(s.Condition) {
 			return true
 		}
-		return isDeadCode(s.Body, actions)
+		return dce.isDeadCode(s.Body, actions)
 	case *ast.ForEachStatement:
 		// Si le corps de la boucle est vide ou mort, la boucle est morte
 		if s.Body == nil || len(s.Body.Statements) == 0 {
 			return true
 		}
-		return isDeadCode(s.Body, actions)
+		return dce.isDeadCode(s.Body, actions)
 	case *ast.SwitchStatement:
 		// Si tous les cas sont morts, le switch est mort
 		allDead := true
 		for _, c := range s.Cases {
-			if c.Body != nil && !isDeadCode(c.Body, actions) {
+			if c.Body != nil && !dce.isDeadCode(c.Body, actions) {
 				allDead = false
 				break
 			}
 		}
-		if s.DefaultCase != nil && !isDeadCode(s.DefaultCase, actions) {
+		if s.DefaultCase != nil && !dce.isDeadCode(s.DefaultCase, actions) {
 			allDead = false
 		}
 		return allDead
@@ -982,11 +1029,11 @@ func isDeadCode(stmt ast.Statement, actions []ast.Statement) bool {
 	case *ast.BlockStatement:
 		var cleanStatements []ast.Statement
 		for _, st := range s.Statements {
-			if !isDeadCode(st, actions) {
+			if !dce.isDeadCode(st, actions) {
 				cleanStatements = append(cleanStatements, st)
 			} else {
-				Warnings("Dead code eliminated: statement at Line:%d, column:%d has no effect.",
-					st.Line(), st.Column())
+				dce.o.addWarning(diagnostic.DeadCode, diagnostic.At(st.Line(), st.Column()),
+					"Dead code eliminated: statement has no effect")
 			}
 			// Si on croise un Return, tout ce qui suit dans ce bloc est du code mort !
 			if _, ok := st.(*ast.ReturnStatement); ok {
@@ -1287,7 +1334,7 @@ func isFunctionUsedInStatement(stmt ast.Statement, name string) bool {
 func isPureExpression(expr ast.Expression) bool {
 	// Vérifier si l'expression n'a pas d'effet de bord
 	switch expr.(type) {
-	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral,
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.DecimalLiteral, *ast.StringLiteral,
 		*ast.BooleanLiteral, *ast.DurationLiteral, *ast.DateTimeLiteral:
 		return true
 	case *ast.InfixExpression:
@@ -1312,26 +1359,26 @@ func (lo *LoopOptimization) Apply(program *ast.Action) *ast.Action {
 	}
 
 	for _, stmt := range program.Statements {
-		optimized.Statements = append(optimized.Statements, optimizeLoopInStatement(stmt))
+		optimized.Statements = append(optimized.Statements, lo.optimizeLoopInStatement(stmt))
 	}
 
 	return optimized
 }
 
-func optimizeLoopInStatement(stmt ast.Statement) ast.Statement {
+func (lo *LoopOptimization) optimizeLoopInStatement(stmt ast.Statement) ast.Statement {
 	switch s := stmt.(type) {
 	case *ast.ForStatement:
-		return optimizeForLoop(s)
+		return lo.optimizeForLoop(s)
 	case *ast.WhileStatement:
-		return optimizeWhileLoop(s)
+		return lo.optimizeWhileLoop(s)
 	case *ast.ForEachStatement:
-		return optimizeForEachLoop(s)
+		return lo.optimizeForEachLoop(s)
 	default:
 		return s
 	}
 }
 
-func optimizeForLoop(stmt *ast.ForStatement) ast.Statement {
+func (lo *LoopOptimization) optimizeForLoop(stmt *ast.ForStatement) ast.Statement {
 	// Loop-invariant code motion (conservative heuristic):
 	// - Collect variables declared inside the loop body (let ...).
 	// - Move out only pure statements (pure expressions or let with pure value)
@@ -1381,7 +1428,7 @@ func optimizeForLoop(stmt *ast.ForStatement) ast.Statement {
 	if len(moved) == 0 {
 		return stmt
 	}
-	IncrementLoopOptimization()
+	lo.o.IncrementLoopOptimization()
 	// Construct the optimized loop with remaining body statements.
 	optimizedLoop := &ast.ForStatement{
 		Token:     stmt.Token,
@@ -1401,7 +1448,7 @@ func optimizeForLoop(stmt *ast.ForStatement) ast.Statement {
 	}
 }
 
-func optimizeWhileLoop(stmt *ast.WhileStatement) ast.Statement {
+func (lo *LoopOptimization) optimizeWhileLoop(stmt *ast.WhileStatement) ast.Statement {
 	// Loop-invariant code motion (conservative heuristic):
 	// - Collect variables declared inside the loop body (let ...).
 	// - Move out only pure statements (pure expressions or let with pure value)
@@ -1463,7 +1510,7 @@ func optimizeWhileLoop(stmt *ast.WhileStatement) ast.Statement {
 	if len(moved) == 0 {
 		return stmt
 	}
-	IncrementLoopOptimization()
+	lo.o.IncrementLoopOptimization()
 	// Construct the optimized loop with remaining body statements.
 	optimizedLoop := &ast.WhileStatement{
 		Token:     stmt.Token,
@@ -1481,7 +1528,7 @@ func optimizeWhileLoop(stmt *ast.WhileStatement) ast.Statement {
 	}
 }
 
-func optimizeForEachLoop(stmt *ast.ForEachStatement) ast.Statement {
+func (lo *LoopOptimization) optimizeForEachLoop(stmt *ast.ForEachStatement) ast.Statement {
 	// Loop-invariant code motion (conservative heuristic):
 	// - Collect variables declared inside the loop body (let ...).
 	// - Move out only pure statements (pure expressions or let with pure value)
@@ -1543,11 +1590,12 @@ func optimizeForEachLoop(stmt *ast.ForEachStatement) ast.Statement {
 	if len(moved) == 0 {
 		return stmt
 	}
-	IncrementLoopOptimization()
+	lo.o.IncrementLoopOptimization()
 	// Construct the optimized loop with remaining body statements.
 	optimizedLoop := &ast.ForEachStatement{
 		Token:    stmt.Token,
 		Variable: stmt.Variable,
+		Value:    stmt.Value,
 		Iterator: stmt.Iterator,
 		Body: &ast.BlockStatement{
 			Token:      stmt.Body.Token,
@@ -1621,7 +1669,7 @@ func (fi *FunctionInlining) Apply(program *ast.Action) *ast.Action {
 	}
 
 	for _, stmt := range otherStatements {
-		optimized.Statements = append(optimized.Statements, inlineFunctionsInStatement(stmt, functions))
+		optimized.Statements = append(optimized.Statements, fi.o.inlineFunctionsInStatement(stmt, functions))
 	}
 
 	// Garder seulement les fonctions non inlineables
@@ -1731,8 +1779,8 @@ func hasSmallFunctions(program *ast.Action) bool {
 }
 
 // Implémentations des autres méthodes de folding
-func foldExpressionStatement(stmt *ast.ExpressionStatement) *ast.ExpressionStatement {
-	folded := foldExpression(stmt.Expression)
+func (o *Optimizer) foldExpressionStatement(stmt *ast.ExpressionStatement) *ast.ExpressionStatement {
+	folded := o.foldExpression(stmt.Expression)
 	if folded != stmt.Expression {
 		return &ast.ExpressionStatement{
 			Token:      stmt.Token,
@@ -1743,8 +1791,8 @@ func foldExpressionStatement(stmt *ast.ExpressionStatement) *ast.ExpressionState
 }
 
 // Implémentations des autres méthodes de folding
-func foldAssignmentStatement(stmt *ast.AssignmentStatement) *ast.AssignmentStatement {
-	folded := foldExpression(stmt.Value)
+func (o *Optimizer) foldAssignmentStatement(stmt *ast.AssignmentStatement) *ast.AssignmentStatement {
+	folded := o.foldExpression(stmt.Value)
 	if folded != stmt.Value {
 		return &ast.AssignmentStatement{
 			Token:    stmt.Token,
@@ -1754,9 +1802,9 @@ func foldAssignmentStatement(stmt *ast.AssignmentStatement) *ast.AssignmentState
 	}
 	return stmt
 }
-func foldReturnStatement(stmt *ast.ReturnStatement) *ast.ReturnStatement {
+func (o *Optimizer) foldReturnStatement(stmt *ast.ReturnStatement) *ast.ReturnStatement {
 	if stmt.ReturnValue != nil {
-		folded := foldExpression(stmt.ReturnValue)
+		folded := o.foldExpression(stmt.ReturnValue)
 		if folded != stmt.ReturnValue {
 			return &ast.ReturnStatement{
 				Token:       stmt.Token,
@@ -1767,7 +1815,7 @@ func foldReturnStatement(stmt *ast.ReturnStatement) *ast.ReturnStatement {
 	return stmt
 }
 
-func foldBlockStatement(stmt *ast.BlockStatement) *ast.BlockStatement {
+func (o *Optimizer) foldBlockStatement(stmt *ast.BlockStatement) *ast.BlockStatement {
 	if stmt == nil {
 		return nil
 	}
@@ -1777,26 +1825,26 @@ func foldBlockStatement(stmt *ast.BlockStatement) *ast.BlockStatement {
 	}
 
 	for _, s := range stmt.Statements {
-		folded.Statements = append(folded.Statements, foldConstantsInStatement(s))
+		folded.Statements = append(folded.Statements, o.foldConstantsInStatement(s))
 	}
 
 	return folded
 }
 
-func foldForStatement(stmt *ast.ForStatement) *ast.ForStatement {
+func (o *Optimizer) foldForStatement(stmt *ast.ForStatement) *ast.ForStatement {
 	return &ast.ForStatement{
 		Token:     stmt.Token,
-		Init:      foldConstantsInStatement(stmt.Init),
-		Condition: foldExpression(stmt.Condition),
-		Update:    foldConstantsInStatement(stmt.Update),
-		Body:      foldBlockStatement(stmt.Body),
+		Init:      o.foldConstantsInStatement(stmt.Init),
+		Condition: o.foldExpression(stmt.Condition),
+		Update:    o.foldConstantsInStatement(stmt.Update),
+		Body:      o.foldBlockStatement(stmt.Body),
 	}
 }
 
-func foldSwitchStatement(stmt *ast.SwitchStatement) *ast.SwitchStatement {
+func (o *Optimizer) foldSwitchStatement(stmt *ast.SwitchStatement) *ast.SwitchStatement {
 	folded := &ast.SwitchStatement{
 		Token:       stmt.Token,
-		Expression:  foldExpression(stmt.Expression),
+		Expression:  o.foldExpression(stmt.Expression),
 		Cases:       []*ast.SwitchCase{},
 		DefaultCase: nil,
 	}
@@ -1805,38 +1853,38 @@ func foldSwitchStatement(stmt *ast.SwitchStatement) *ast.SwitchStatement {
 		foldedCase := &ast.SwitchCase{
 			Token:       c.Token,
 			Expressions: []ast.Expression{},
-			Body:        foldBlockStatement(c.Body),
+			Body:        o.foldBlockStatement(c.Body),
 		}
 
 		for _, expr := range c.Expressions {
-			foldedCase.Expressions = append(foldedCase.Expressions, foldExpression(expr))
+			foldedCase.Expressions = append(foldedCase.Expressions, o.foldExpression(expr))
 		}
 
 		folded.Cases = append(folded.Cases, foldedCase)
 	}
 
 	if stmt.DefaultCase != nil {
-		folded.DefaultCase = foldBlockStatement(stmt.DefaultCase)
+		folded.DefaultCase = o.foldBlockStatement(stmt.DefaultCase)
 	}
 
 	return folded
 }
 
-func foldPrefixExpression(expr *ast.PrefixExpression) ast.Expression {
-	operand := foldExpression(expr.Right)
+func (o *Optimizer) foldPrefixExpression(expr *ast.PrefixExpression) ast.Expression {
+	operand := o.foldExpression(expr.Right)
 
 	if isConstant(operand) {
 		switch expr.Operator {
 		case "-":
 			if intLit, ok := operand.(*ast.IntegerLiteral); ok {
-				IncrementFolding()
+				o.IncrementConstantFolding()
 				return &ast.IntegerLiteral{
 					Token: expr.Token,
 					Value: -intLit.Value,
 				}
 			}
 			if floatLit, ok := operand.(*ast.FloatLiteral); ok {
-				IncrementFolding()
+				o.IncrementConstantFolding()
 				return &ast.FloatLiteral{
 					Token: expr.Token,
 					Value: -floatLit.Value,
@@ -1844,7 +1892,7 @@ func foldPrefixExpression(expr *ast.PrefixExpression) ast.Expression {
 			}
 		case "!":
 			if boolLit, ok := operand.(*ast.BooleanLiteral); ok {
-				IncrementFolding()
+				o.IncrementConstantFolding()
 				return &ast.BooleanLiteral{
 					Token: expr.Token,
 					Value: !boolLit.Value,
@@ -1877,7 +1925,7 @@ func floatVal(e ast.Expression) float64 {
 // These are conservative no-ops for now and can be expanded to fold inner
 // expressions when the exact AST field names/structure are known.
 
-func foldBetweenExpression(expr *ast.BetweenExpression) ast.Expression {
+func (o *Optimizer) foldBetweenExpression(expr *ast.BetweenExpression) ast.Expression {
 	if expr == nil {
 		return nil
 	}
@@ -1894,7 +1942,7 @@ func foldBetweenExpression(expr *ast.BetweenExpression) ast.Expression {
 			if expr.Not {
 				value = !value
 			}
-			IncrementFolding()
+			o.IncrementConstantFolding()
 			return &ast.BooleanLiteral{
 				Token: expr.Token,
 				Value: value,
@@ -1906,7 +1954,7 @@ func foldBetweenExpression(expr *ast.BetweenExpression) ast.Expression {
 	return expr
 }
 
-func foldLikeExpression(expr *ast.LikeExpression) ast.Expression {
+func (o *Optimizer) foldLikeExpression(expr *ast.LikeExpression) ast.Expression {
 	if expr == nil {
 		return nil
 	}
@@ -1926,7 +1974,7 @@ func foldLikeExpression(expr *ast.LikeExpression) ast.Expression {
 			if expr.Not {
 				res = !res
 			}
-			IncrementFolding()
+			o.IncrementConstantFolding()
 			return &ast.BooleanLiteral{
 				Token: expr.Token,
 				Value: res,
@@ -1939,20 +1987,20 @@ func foldLikeExpression(expr *ast.LikeExpression) ast.Expression {
 	return expr
 }
 
-func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.FunctionStatement) ast.Statement {
+func (o *Optimizer) inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.FunctionStatement) ast.Statement {
 	if stmt == nil {
 		return stmt
 	}
 	switch s := stmt.(type) {
 	case *ast.ExpressionStatement:
-		newExpr := inlineFunctionsInExpression(s.Expression, functions)
+		newExpr := o.inlineFunctionsInExpression(s.Expression, functions)
 		if newExpr != s.Expression {
 			return &ast.ExpressionStatement{Token: s.Token, Expression: newExpr}
 		}
 		return s
 	case *ast.LetStatement:
 		if s.Value != nil {
-			newVal := inlineFunctionsInExpression(s.Value, functions)
+			newVal := o.inlineFunctionsInExpression(s.Value, functions)
 			if newVal != s.Value {
 				return &ast.LetStatement{
 					Token: s.Token,
@@ -1969,7 +2017,7 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 	// 	for _, v := range *s {
 	// 		ls := v
 	// 		if ls.Value != nil {
-	// 			newVal := inlineFunctionsInExpression(ls.Value, functions)
+	// 			newVal := o.inlineFunctionsInExpression(ls.Value, functions)
 	// 			if newVal != ls.Value {
 	// 				ls = ast.LetStatement{
 	// 					Token: ls.Token,
@@ -1992,15 +2040,15 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 	// 	}
 	// 	return s
 	case *ast.AssignmentStatement:
-		target := inlineFunctionsInExpression(s.Variable, functions)
-		value := inlineFunctionsInExpression(s.Value, functions)
+		target := o.inlineFunctionsInExpression(s.Variable, functions)
+		value := o.inlineFunctionsInExpression(s.Value, functions)
 		if s.Variable != target || value != s.Value {
 			return &ast.AssignmentStatement{Token: s.Token, Variable: target, Value: value}
 		}
 		return s
 	case *ast.ReturnStatement:
 		if s.ReturnValue != nil {
-			newVal := inlineFunctionsInExpression(s.ReturnValue, functions)
+			newVal := o.inlineFunctionsInExpression(s.ReturnValue, functions)
 			if newVal != s.ReturnValue {
 				return &ast.ReturnStatement{Token: s.Token, ReturnValue: newVal}
 			}
@@ -2010,7 +2058,7 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		newBlock := &ast.BlockStatement{Token: s.Token, Statements: []ast.Statement{}}
 		changed := false
 		for _, st := range s.Statements {
-			ns := inlineFunctionsInStatement(st, functions)
+			ns := o.inlineFunctionsInStatement(st, functions)
 			newBlock.Statements = append(newBlock.Statements, ns)
 			if ns != st {
 				changed = true
@@ -2021,12 +2069,12 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		return s
 	case *ast.IfStatement:
-		cond := inlineFunctionsInExpression(s.Condition, functions)
-		then := foldBlockStatement(s.Then)
-		elseBlk := foldBlockStatement(s.Else)
+		cond := o.inlineFunctionsInExpression(s.Condition, functions)
+		then := o.foldBlockStatement(s.Then)
+		elseBlk := o.foldBlockStatement(s.Else)
 		// inline inside then/else
-		then = inlineBlockStatements(then, functions)
-		elseBlk = inlineBlockStatements(elseBlk, functions)
+		then = o.inlineBlockStatements(then, functions)
+		elseBlk = o.inlineBlockStatements(elseBlk, functions)
 		if cond != s.Condition || then != s.Then || elseBlk != s.Else {
 			return &ast.IfStatement{
 				Token:     s.Token,
@@ -2037,9 +2085,9 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		return s
 	case *ast.CatchStatement:
-		then := foldBlockStatement(s.Statements)
+		then := o.foldBlockStatement(s.Statements)
 		// inline inside then/else
-		then = inlineBlockStatements(then, functions)
+		then = o.inlineBlockStatements(then, functions)
 		if then != s.Statements {
 			return &ast.CatchStatement{
 				Token:      s.Token,
@@ -2048,9 +2096,9 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		return s
 	case *ast.ProtectedStatement:
-		then := foldBlockStatement(s.Statements)
+		then := o.foldBlockStatement(s.Statements)
 		// inline inside then/else
-		then = inlineBlockStatements(then, functions)
+		then = o.inlineBlockStatements(then, functions)
 		if then != s.Statements {
 			return &ast.ProtectedStatement{
 				Token:      s.Token,
@@ -2059,10 +2107,10 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		return s
 	case *ast.ForStatement:
-		init := inlineFunctionsInStatement(s.Init, functions)
-		cond := inlineFunctionsInExpression(s.Condition, functions)
-		update := inlineFunctionsInStatement(s.Update, functions)
-		body := inlineBlockStatements(s.Body, functions)
+		init := o.inlineFunctionsInStatement(s.Init, functions)
+		cond := o.inlineFunctionsInExpression(s.Condition, functions)
+		update := o.inlineFunctionsInStatement(s.Update, functions)
+		body := o.inlineBlockStatements(s.Body, functions)
 		if init != s.Init || cond != s.Condition || update != s.Update || body != s.Body {
 			return &ast.ForStatement{
 				Token:     s.Token,
@@ -2074,8 +2122,8 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		return s
 	case *ast.WhileStatement:
-		cond := inlineFunctionsInExpression(s.Condition, functions)
-		body := inlineBlockStatements(s.Body, functions)
+		cond := o.inlineFunctionsInExpression(s.Condition, functions)
+		body := o.inlineBlockStatements(s.Body, functions)
 		if cond != s.Condition || body != s.Body {
 			return &ast.WhileStatement{
 				Token:     s.Token,
@@ -2085,26 +2133,27 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		return s
 	case *ast.ForEachStatement:
-		iter := inlineFunctionsInExpression(s.Iterator, functions)
-		body := inlineBlockStatements(s.Body, functions)
+		iter := o.inlineFunctionsInExpression(s.Iterator, functions)
+		body := o.inlineBlockStatements(s.Body, functions)
 		if iter != s.Iterator || body != s.Body {
 			return &ast.ForEachStatement{
 				Token:    s.Token,
 				Variable: s.Variable,
+				Value:    s.Value,
 				Iterator: iter,
 				Body:     body,
 			}
 		}
 		return s
 	case *ast.SwitchStatement:
-		expr := inlineFunctionsInExpression(s.Expression, functions)
+		expr := o.inlineFunctionsInExpression(s.Expression, functions)
 		changed := expr != s.Expression
 		newCases := []*ast.SwitchCase{}
 		for _, c := range s.Cases {
-			newBody := inlineBlockStatements(c.Body, functions)
+			newBody := o.inlineBlockStatements(c.Body, functions)
 			newExprs := []ast.Expression{}
 			for _, e := range c.Expressions {
-				ne := inlineFunctionsInExpression(e, functions)
+				ne := o.inlineFunctionsInExpression(e, functions)
 				newExprs = append(newExprs, ne)
 				if ne != e {
 					changed = true
@@ -2121,7 +2170,7 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 		}
 		def := s.DefaultCase
 		if def != nil {
-			newDef := inlineBlockStatements(def, functions)
+			newDef := o.inlineBlockStatements(def, functions)
 			if newDef != def {
 				changed = true
 			}
@@ -2141,14 +2190,14 @@ func inlineFunctionsInStatement(stmt ast.Statement, functions map[string]*ast.Fu
 	}
 }
 
-func inlineBlockStatements(b *ast.BlockStatement, functions map[string]*ast.FunctionStatement) *ast.BlockStatement {
+func (o *Optimizer) inlineBlockStatements(b *ast.BlockStatement, functions map[string]*ast.FunctionStatement) *ast.BlockStatement {
 	if b == nil {
 		return nil
 	}
 	changed := false
 	newBlk := &ast.BlockStatement{Token: b.Token, Statements: []ast.Statement{}}
 	for _, st := range b.Statements {
-		ns := inlineFunctionsInStatement(st, functions)
+		ns := o.inlineFunctionsInStatement(st, functions)
 		newBlk.Statements = append(newBlk.Statements, ns)
 		if ns != st {
 			changed = true
@@ -2160,7 +2209,7 @@ func inlineBlockStatements(b *ast.BlockStatement, functions map[string]*ast.Func
 	return b
 }
 
-func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.FunctionStatement) ast.Expression {
+func (o *Optimizer) inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.FunctionStatement) ast.Expression {
 	if expr == nil {
 		return nil
 	}
@@ -2168,9 +2217,9 @@ func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.
 	case *ast.Identifier:
 		return e
 	case *ast.IifExpression:
-		cond := inlineFunctionsInExpression(e.Condition, functions)
-		then := inlineFunctionsInExpression(e.TrueExpr, functions)
-		elseExpr := inlineFunctionsInExpression(e.FalseExpr, functions)
+		cond := o.inlineFunctionsInExpression(e.Condition, functions)
+		then := o.inlineFunctionsInExpression(e.TrueExpr, functions)
+		elseExpr := o.inlineFunctionsInExpression(e.FalseExpr, functions)
 		if cond != e.Condition || then != e.TrueExpr || elseExpr != e.FalseExpr {
 			return &ast.IifExpression{
 				Token:     e.Token,
@@ -2181,22 +2230,22 @@ func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.
 		}
 		return e
 	case *ast.InfixExpression:
-		l := inlineFunctionsInExpression(e.Left, functions)
-		r := inlineFunctionsInExpression(e.Right, functions)
+		l := o.inlineFunctionsInExpression(e.Left, functions)
+		r := o.inlineFunctionsInExpression(e.Right, functions)
 		if l != e.Left || r != e.Right {
 			return &ast.InfixExpression{Token: e.Token, Left: l, Operator: e.Operator, Right: r}
 		}
 		return e
 	case *ast.PrefixExpression:
-		r := inlineFunctionsInExpression(e.Right, functions)
+		r := o.inlineFunctionsInExpression(e.Right, functions)
 		if r != e.Right {
 			return &ast.PrefixExpression{Token: e.Token, Operator: e.Operator, Right: r}
 		}
 		return e
 	case *ast.BetweenExpression:
-		base := inlineFunctionsInExpression(e.Base, functions)
-		l := inlineFunctionsInExpression(e.Left, functions)
-		r := inlineFunctionsInExpression(e.Right, functions)
+		base := o.inlineFunctionsInExpression(e.Base, functions)
+		l := o.inlineFunctionsInExpression(e.Left, functions)
+		r := o.inlineFunctionsInExpression(e.Right, functions)
 		if base != e.Base || l != e.Left || r != e.Right {
 			return &ast.BetweenExpression{
 				Token: e.Token, Base: base, Left: l, Right: r, Not: e.Not,
@@ -2204,15 +2253,15 @@ func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.
 		}
 		return e
 	case *ast.LikeExpression:
-		l := inlineFunctionsInExpression(e.Left, functions)
-		r := inlineFunctionsInExpression(e.Right, functions)
+		l := o.inlineFunctionsInExpression(e.Left, functions)
+		r := o.inlineFunctionsInExpression(e.Right, functions)
 		if l != e.Left || r != e.Right {
 			return &ast.LikeExpression{Token: e.Token, Left: l, Right: r, Not: e.Not}
 		}
 		return e
 	case *ast.AssignmentStatement:
-		target := inlineFunctionsInExpression(e.Variable, functions)
-		value := inlineFunctionsInExpression(e.Value, functions)
+		target := o.inlineFunctionsInExpression(e.Variable, functions)
+		value := o.inlineFunctionsInExpression(e.Value, functions)
 		if e.Variable != target || value != e.Value {
 			return &ast.AssignmentStatement{Token: e.Token, Variable: target, Value: value}
 		}
@@ -2220,11 +2269,11 @@ func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.
 	case *ast.ArrayFunctionCall:
 		// recurse into function expression first
 
-		fnExpr := inlineFunctionsInExpression(e.Function, functions)
+		fnExpr := o.inlineFunctionsInExpression(e.Function, functions)
 		argsChanged := false
 		newArgs := make([]ast.Expression, 0, len(e.Arguments))
 		for _, a := range e.Arguments {
-			na := inlineFunctionsInExpression(a, functions)
+			na := o.inlineFunctionsInExpression(a, functions)
 			newArgs = append(newArgs, na)
 			if na != a {
 				argsChanged = true
@@ -2242,20 +2291,20 @@ func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.
 				if paramCount == 0 && fn.Body != nil && len(fn.Body.Statements) == 1 {
 					if ret, ok := fn.Body.Statements[0].(*ast.ReturnStatement); ok && ret.ReturnValue != nil {
 						// inline by returning a copy of the return expression (and recursively inline inside it)
-						IncrementInlineExpansion()
-						inlined := inlineFunctionsInExpression(ret.ReturnValue, functions)
+						o.IncrementInlineExpansion()
+						inlined := o.inlineFunctionsInExpression(ret.ReturnValue, functions)
 						return inlined
 					}
 				}
 			}
 		}
 		// otherwise rebuild node if any child changed
-		if fnExpr != e.Function || argsChanged || (e.Array != nil && inlineFunctionsInExpression(e.Array, functions) != e.Array) {
-			IncrementInlineExpansion()
+		if fnExpr != e.Function || argsChanged || (e.Array != nil && o.inlineFunctionsInExpression(e.Array, functions) != e.Array) {
+			o.IncrementInlineExpansion()
 			return &ast.ArrayFunctionCall{
 				Token:     e.Token,
 				Function:  fnExpr.(*ast.Identifier),
-				Array:     inlineFunctionsInExpression(e.Array, functions),
+				Array:     o.inlineFunctionsInExpression(e.Array, functions),
 				Arguments: newArgs,
 			}
 		}
@@ -2266,10 +2315,10 @@ func inlineFunctionsInExpression(expr ast.Expression, functions map[string]*ast.
 	}
 }
 
-func foldWhileStatement(stmt *ast.WhileStatement) *ast.WhileStatement {
+func (o *Optimizer) foldWhileStatement(stmt *ast.WhileStatement) *ast.WhileStatement {
 	return &ast.WhileStatement{
 		Token:     stmt.Token,
-		Condition: foldExpression(stmt.Condition),
-		Body:      foldBlockStatement(stmt.Body),
+		Condition: o.foldExpression(stmt.Condition),
+		Body:      o.foldBlockStatement(stmt.Body),
 	}
 }
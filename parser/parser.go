@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
 	"github.com/akristianlopez/action/lexer"
 	"github.com/akristianlopez/action/token"
 )
@@ -20,19 +22,19 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
-}
 
-var _position, _currentPosition int
-var _scr, _spk *token.Token = nil, nil
+	// jetons sauvegardés par Save et rétablis par Restore
+	scr, spk *token.Token
+}
 
 func (p *Parser) Save() {
 	if p.l == nil {
 		return
 	}
 	p.l.SaveCnt()
-	_scr = &token.Token{Type: p.curToken.Type, Literal: p.curToken.Literal,
+	p.scr = &token.Token{Type: p.curToken.Type, Literal: p.curToken.Literal,
 		Line: p.curToken.Line, Column: p.curToken.Column}
-	_spk = &token.Token{Type: p.peekToken.Type, Literal: p.peekToken.Literal,
+	p.spk = &token.Token{Type: p.peekToken.Type, Literal: p.peekToken.Literal,
 		Line: p.peekToken.Line, Column: p.peekToken.Column}
 }
 func (p *Parser) Restore() {
@@ -40,16 +42,16 @@ func (p *Parser) Restore() {
 		return
 	}
 	p.l.RestoreCnt()
-	if _scr != nil && _spk != nil {
-		p.curToken = *_scr
-		_scr = nil
-		p.peekToken = *_spk
-		_spk = nil
+	if p.scr != nil && p.spk != nil {
+		p.curToken = *p.scr
+		p.scr = nil
+		p.peekToken = *p.spk
+		p.spk = nil
 	}
 }
 func (p *Parser) Clear() {
-	_scr = nil
-	_spk = nil
+	p.scr = nil
+	p.spk = nil
 }
 
 type (
@@ -61,6 +63,8 @@ type ParserError struct {
 	msg    string
 	line   int
 	column int
+	code   string
+	fixes  []diagnostic.Fix
 }
 
 func (pe *ParserError) Message() string {
@@ -74,8 +78,22 @@ func (pe *ParserError) String() string {
 	}
 	return ""
 }
-func Create(message string, line, column int) *ParserError {
-	return &ParserError{msg: message, line: line, column: column}
+
+// Create construit une erreur de syntaxe; code est l'un des codes P00x du package diagnostic
+func Create(code, message string, line, column int) *ParserError {
+	return &ParserError{msg: message, line: line, column: column, code: code}
+}
+
+// Diagnostic renvoie l'erreur sous forme de diagnostic
+func (pe *ParserError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Code:     pe.code,
+		Severity: diagnostic.Error,
+		Source:   diagnostic.Parser,
+		Message:  pe.msg,
+		Span:     diagnostic.At(pe.line, pe.column),
+		Fixes:    pe.fixes,
+	}
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -89,10 +107,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.ACTION, p.parseIdentifier)
 	p.registerPrefix(token.INT_LIT, p.parseIntegerLiteral)
 	p.registerPrefix(token.FLOAT_LIT, p.parseFloatLiteral)
+	p.registerPrefix(token.DECIMAL_LIT, p.parseDecimalLiteral)
 	p.registerPrefix(token.STRING_LIT, p.parseStringLiteral)
 	p.registerPrefix(token.BOOL_LIT, p.parseBooleanLiteral)
 	p.registerPrefix(token.TIME_LIT, p.parseDateTimeLiteral)
 	p.registerPrefix(token.DATE_LIT, p.parseDateTimeLiteral)
+	p.registerPrefix(token.DATETIME_LIT, p.parseDateTimeLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	// p.registerPrefix(token.PLUS, p.parsePrefixExpression)
@@ -110,6 +130,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LAST_VALUE, p.parseWindowFunction)
 	p.registerPrefix(token.NTILE, p.parseWindowFunction)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.MAP, p.parseMapLiteral)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.ALL, p.parseIdentifier)    // all(tableau, fonction)
+	p.registerPrefix(token.DELETE, p.parseIdentifier) // delete(m, k) et values(m) hors d'une requête
+	p.registerPrefix(token.VALUES, p.parseIdentifier)
 	// p.registerPrefix(token.LENGTH, p.parseArrayFunctionCall)
 	// p.registerPrefix(token.APPEND, p.parseArrayFunctionCall)
 	// p.registerPrefix(token.PREPEND, p.parseArrayFunctionCall)
@@ -185,18 +210,18 @@ func (p *Parser) ParseAction() *ast.Action {
 	program := &ast.Action{}
 
 	if p.curTokenIs(token.EOF) {
-		p.errors = append(p.errors, *Create("Unexpected end of action. 'action' keyword is missing.", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.UnexpectedToken, "Unexpected end of action. 'action' keyword is missing.", p.curToken.Line, p.curToken.Column))
 	}
 	// Vérifier que le programme commence par 'action'
 	if !p.curTokenIs(token.ACTION) {
-		p.errors = append(p.errors, *Create("The action must start with the word 'action'", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, "The action must start with the word 'action'", p.curToken.Line, p.curToken.Column))
 		return program
 	}
 	p.nextToken() //move to name
 
 	// Lire le nom de l'action
 	if !p.curTokenIs(token.STRING_LIT) {
-		p.errors = append(p.errors, *Create("Attendu un nom d'action après 'action'", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, "Attendu un nom d'action après 'action'", p.curToken.Line, p.curToken.Column))
 		return program
 	}
 	program.ActionName = p.curToken.Literal
@@ -205,7 +230,7 @@ func (p *Parser) ParseAction() *ast.Action {
 	}
 	p.nextToken() //move to name
 	if p.curTokenIs(token.EOF) {
-		p.errors = append(p.errors, *Create("Unexpected end of action. 'action name' is missing.", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.UnexpectedToken, "Unexpected end of action. 'action name' is missing.", p.curToken.Line, p.curToken.Column))
 	}
 
 	//Parser les arguments de l'action
@@ -284,11 +309,44 @@ func (p *Parser) ParseAction() *ast.Action {
 		}
 	}
 	if !p.curTokenIs(token.STOP) {
-		p.errors = append(p.errors, *Create("'stop' is missing", p.curToken.Line, p.curToken.Column))
+		pe := Create(diagnostic.ExpectedToken, "'stop' is missing", p.curToken.Line, p.curToken.Column)
+		pe.fixes = []diagnostic.Fix{{Title: "Insert 'stop'", Span: diagnostic.At(p.curToken.Line, p.curToken.Column), NewText: "stop\n"}}
+		p.errors = append(p.errors, *pe)
 	}
 	if !p.expectPeek(token.EOF) {
 		p.nextToken()
-		p.errors = append(p.errors, *Create("Unrichable statement", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.UnexpectedToken, "Unrichable statement", p.curToken.Line, p.curToken.Column))
+	}
+	return program
+}
+
+// ParseModule analyse un module: module "nom" suivi de déclarations import, type, function et let
+func (p *Parser) ParseModule() *ast.Action {
+	program := &ast.Action{}
+	if !p.curTokenIs(token.IDENT) || !strings.EqualFold(p.curToken.Literal, "module") {
+		p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, "The module must start with the word 'module'", p.curToken.Line, p.curToken.Column))
+		return program
+	}
+	if !p.expectPeek(token.STRING_LIT) {
+		return program
+	}
+	program.ActionName = p.curToken.Literal
+	p.nextToken()
+	for !p.curTokenIs(token.EOF) {
+		stmt, pe := p.parseStatement(false)
+		if pe != nil {
+			p.errors = append(p.errors, *pe)
+		}
+		if stmt != nil {
+			if arr, ok := stmt.(*ast.LetStatements); ok {
+				for _, val := range *arr {
+					program.Statements = append(program.Statements, &val)
+				}
+			} else {
+				program.Statements = append(program.Statements, stmt)
+			}
+		}
+		p.nextToken()
 	}
 	return program
 }
@@ -298,14 +356,14 @@ func (p *Parser) ParseSignature() ([]*ast.StructField, *ast.TypeAnnotation, []*a
 
 	// Vérifier que le programme commence par 'action'
 	if !p.curTokenIs(token.ACTION) {
-		p.errors = append(p.errors, *Create("The action must start with the word 'action'", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, "The action must start with the word 'action'", p.curToken.Line, p.curToken.Column))
 		return nil, nil, nil
 	}
 	p.nextToken() //move to name
 
 	// Lire le nom de l'action
 	if !p.curTokenIs(token.STRING_LIT) {
-		p.errors = append(p.errors, *Create("Attendu un nom d'action après 'action'", p.curToken.Line, p.curToken.Column))
+		p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, "Attendu un nom d'action après 'action'", p.curToken.Line, p.curToken.Column))
 		return nil, nil, nil
 	}
 	// program.ActionName = p.curToken.Literal
@@ -396,7 +454,9 @@ func (p *Parser) AllStructureForSignature(args *ast.StructStatement, st []ast.St
 }
 func (p *Parser) getDefinitionStatement(ss *ast.TypeAnnotation, st []ast.Statement) *ast.StructStatement {
 	var res *ast.StructStatement
-	res = nil
+	if ss == nil {
+		return nil
+	}
 	for _, ts := range st {
 		if ss.ArrayType != nil {
 			return p.getDefinitionStatement(ss.ArrayType.ElementType, st)
@@ -435,30 +495,33 @@ func (p *Parser) parseStmStartSection() (ast.Statement, *ParserError) {
 		} else if p.peekTokenIs(token.INDEX, token.UNIQUE) {
 			return p.parseSQLCreateIndex()
 		}
-		return nil, Create("token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
+		return nil, Create(diagnostic.ExpectedToken, "token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
 	case token.DROP:
 		if p.peekTokenIs(token.OBJECT) {
 			return p.parseSQLDropObject()
 		} else if p.peekTokenIs(token.INDEX, token.UNIQUE) {
 			return p.parseSQLDropIndex()
 		}
-		return nil, Create("token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
+		return nil, Create(diagnostic.ExpectedToken, "token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
 	case token.ALTER:
 		if p.peekTokenIs(token.OBJECT) {
 			return p.parseSQLAlterObject()
 		}
-		return nil, Create("token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
+		return nil, Create(diagnostic.ExpectedToken, "token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
 	case token.INSERT:
 		return p.parseSQLInsert()
 	case token.UPDATE:
 		return p.parseSQLUpdate()
 	case token.DELETE:
+		if p.peekTokenIs(token.LPAREN) {
+			return p.parseExpressionStatement()
+		}
 		return p.parseSQLDelete()
 	case token.TRUNCATE:
 		if p.peekTokenIs(token.OBJECT) {
 			return p.parseSQLTruncate()
 		}
-		return nil, Create("token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
+		return nil, Create(diagnostic.ExpectedToken, "token 'object' is missing", p.peekToken.Line, p.peekToken.Column)
 	case token.SELECT:
 		return p.parseSQLSelectStatement()
 	// case token.WITH:
@@ -478,7 +541,6 @@ func (p *Parser) parseStmStartSection() (ast.Statement, *ParserError) {
 	default:
 		return p.parseExpressionStatement()
 	}
-	return nil, Create(fmt.Sprintf("'%s' is not expected", p.curToken.Type), p.curToken.Line, p.curToken.Column)
 }
 
 func (p *Parser) parseStmDeclarationSection() (ast.Statement, *ParserError) {
@@ -489,9 +551,32 @@ func (p *Parser) parseStmDeclarationSection() (ast.Statement, *ParserError) {
 		return p.parseFunctionStatement()
 	case token.TYPE:
 		return p.parseStructStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	}
+	return nil, Create(diagnostic.UnexpectedToken, fmt.Sprintf("'%s' is not expected", p.curToken.Type), p.curToken.Line, p.curToken.Column)
+}
+
+// parseImportStatement analyse import "lib/finance" as fin
+func (p *Parser) parseImportStatement() (*ast.ImportStatement, *ParserError) {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	if !p.expectPeek(token.STRING_LIT) {
+		return nil, nil
+	}
+	stmt.Path = p.curToken.Literal
+	if !p.expectPeek(token.AS) {
+		return nil, nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil, nil
 	}
-	return nil, Create(fmt.Sprintf("'%s' is not expected", p.curToken.Type), p.curToken.Line, p.curToken.Column)
+	stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt, nil
 }
+
 func (p *Parser) parseStatement(startSts bool) (ast.Statement, *ParserError) {
 	if startSts {
 		return p.parseStmStartSection()
@@ -515,7 +600,7 @@ func (p *Parser) parseLetStatements() (*ast.LetStatements, *ParserError) {
 		stmt := ast.LetStatement{Token: tok}
 		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.ASSIGN) {
-			return nil, Create("type expected", p.peekToken.Line, p.peekToken.Column)
+			return nil, Create(diagnostic.ExpectedToken, "type expected", p.peekToken.Line, p.peekToken.Column)
 		}
 		// Vérifier s'il y a une annotation de type
 		if p.peekTokenIs(token.COLON) {
@@ -569,7 +654,7 @@ func (p *Parser) parseLetStatement() (*ast.LetStatement, *ParserError) {
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.ASSIGN) {
-		return nil, Create("type expected", p.peekToken.Line, p.peekToken.Column)
+		return nil, Create(diagnostic.ExpectedToken, "type expected", p.peekToken.Line, p.peekToken.Column)
 	}
 
 	// Vérifier s'il y a une annotation de type
@@ -655,9 +740,9 @@ func (p *Parser) parseRangeConstraint() (*ast.RangeConstraint, *ParserError) {
 	}
 	p.nextToken()
 
-	if !p.peekTokenIs(token.INT_LIT) && !p.peekTokenIs(token.FLOAT_LIT) &&
+	if !p.peekTokenIs(token.INT_LIT) && !p.peekTokenIs(token.FLOAT_LIT) && !p.peekTokenIs(token.DECIMAL_LIT) &&
 		!p.peekTokenIs(token.DURATION_LIT) && !p.peekTokenIs(token.DATE_LIT) &&
-		!p.peekTokenIs(token.TIME_LIT) { //!p.expectPeek(token.DOT) ||
+		!p.peekTokenIs(token.DATETIME_LIT) && !p.peekTokenIs(token.TIME_LIT) { //!p.expectPeek(token.DOT) ||
 		return nil, nil //Create("'number' is missing", p.peekToken.Line, p.peekToken.Column)
 	}
 	p.nextToken()
@@ -666,6 +751,11 @@ func (p *Parser) parseRangeConstraint() (*ast.RangeConstraint, *ParserError) {
 	return rc, nil
 }
 
+// returnTypes sont les jetons qui peuvent commencer le type de retour d'une fonction
+var returnTypes = []token.TokenType{token.IDENT, token.INTEGER, token.FLOAT,
+	token.STRING, token.BOOLEAN, token.DATE, token.DATETIME,
+	token.TIME, token.DURATION, token.ARRAY, token.MAP, token.JSON, token.FUNCTION}
+
 func (p *Parser) parseFunctionStatement() (*ast.FunctionStatement, *ParserError) {
 	stmt := &ast.FunctionStatement{Token: p.curToken}
 	var pe *ParserError
@@ -688,9 +778,7 @@ func (p *Parser) parseFunctionStatement() (*ast.FunctionStatement, *ParserError)
 	// Type de retour optionnel
 	if p.peekTokenIs(token.COLON) {
 		p.nextToken() // :
-		if !p.expectPeekEx(token.IDENT, token.INTEGER, token.FLOAT,
-			token.STRING, token.BOOLEAN, token.DATE, token.DATETIME,
-			token.TIME, token.DURATION, token.ARRAY) {
+		if !p.expectPeekEx(returnTypes...) {
 			return nil, nil
 		}
 		stmt.ReturnType = p.parseTypeAnnotation()
@@ -705,6 +793,68 @@ func (p *Parser) parseFunctionStatement() (*ast.FunctionStatement, *ParserError)
 	return stmt, pe
 }
 
+// parseFunctionLiteral analyse une fonction anonyme: function(x: integer): boolean { ... }
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+	var pe *ParserError
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	lit.Parameters, pe = p.parseFunctionParameters()
+	if pe != nil {
+		p.errors = append(p.errors, *pe)
+	}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken() // :
+		if !p.expectPeekEx(returnTypes...) {
+			return nil
+		}
+		lit.ReturnType = p.parseTypeAnnotation()
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	lit.Body, pe = p.parseBlockStatement()
+	if pe != nil {
+		p.errors = append(p.errors, *pe)
+	}
+	if lit.Body == nil {
+		return nil
+	}
+	return lit
+}
+
+// parseFunctionType analyse le type d'une fonction: function(integer, string): boolean
+func (p *Parser) parseFunctionType() *ast.FunctionType {
+	ft := &ast.FunctionType{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+	} else {
+		p.nextToken()
+		ft.Parameters = append(ft.Parameters, p.parseTypeAnnotation())
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			ft.Parameters = append(ft.Parameters, p.parseTypeAnnotation())
+		}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken() // :
+		if !p.expectPeekEx(returnTypes...) {
+			return nil
+		}
+		ft.ReturnType = p.parseTypeAnnotation()
+	}
+	return ft
+}
+
 func (p *Parser) parseFunctionParameters() ([]*ast.FunctionParameter, *ParserError) {
 	var params []*ast.FunctionParameter
 
@@ -929,12 +1079,12 @@ func (p *Parser) parseForStatement() (ast.Statement, *ParserError) {
 		p.nextToken()
 		reParen = true
 	}
-	if p.peekTokenIs(token.LET) { //Chef if it's a for each statement: for let x of y
+	if p.peekTokenIs(token.LET) { //Chef if it's a for each statement: for let x of y, for let k, v of m
 		p.nextToken() // let
 		if !p.expectPeek(token.IDENT) {
 			return nil, nil
 		}
-		if p.peekTokenIs(token.OF) {
+		if p.peekTokenIs(token.OF, token.COMMA) {
 			p.Restore()
 			return p.parseForEachStatement()
 		}
@@ -1041,6 +1191,13 @@ func (p *Parser) parseForEachStatement() (*ast.ForEachStatement, *ParserError) {
 		return nil, nil
 	}
 	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil, nil
+		}
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
 
 	if !p.expectPeek(token.OF) {
 		return nil, nil
@@ -1208,12 +1365,12 @@ func (p *Parser) parseSwitchStatement() (*ast.SwitchStatement, *ParserError) {
 		case token.DEFAULT:
 			if stmt.DefaultCase != nil {
 				// p.errors = append(p.errors, "Multiple default cases in switch")
-				return nil, Create("Multiple default cases in switch", p.peekToken.Line, p.peekToken.Column)
+				return nil, Create(diagnostic.UnexpectedToken, "Multiple default cases in switch", p.peekToken.Line, p.peekToken.Column)
 			}
 			stmt.DefaultCase = p.parseDefaultCase()
 		default:
 			// p.errors = append(p.errors, fmt.Sprintf("Unexpected token in switch: %s", p.curToken.Type))
-			return nil, Create(fmt.Sprintf("Unexpected token in switch: %s", p.curToken.Type), p.peekToken.Line, p.peekToken.Column)
+			return nil, Create(diagnostic.UnexpectedToken, fmt.Sprintf("Unexpected token in switch: %s", p.curToken.Type), p.peekToken.Line, p.peekToken.Column)
 		}
 		p.nextToken()
 	}
@@ -1392,6 +1549,9 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	// return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	tok := p.curToken
 	// pok := p.peekToken
+	if strings.EqualFold(tok.Literal, "run") && p.peekTokenIs(token.STRING_LIT) {
+		return p.parseRunExpression()
+	}
 	if p.peekToken.Type == token.LPAREN {
 		return p.parseArrayFunctionCall()
 	}
@@ -1408,12 +1568,44 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: tok, Value: tok.Literal}
 }
 
+// parseRunExpression analyse l'appel d'une autre action: run "Calcul Paie"(emp_id: 12, mois: 3)
+func (p *Parser) parseRunExpression() ast.Expression {
+	exp := &ast.RunExpression{Token: p.curToken}
+	p.nextToken()
+	exp.Name = p.curToken.Literal
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return exp
+	}
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		arg := ast.StructFieldLit{Token: p.curToken, Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		arg.Value = p.parseExpression(LOWEST)
+		exp.Arguments = append(exp.Arguments, arg)
+		if !p.expectPeekEx(token.COMMA, token.RPAREN) {
+			return nil
+		}
+		if p.curTokenIs(token.RPAREN) {
+			return exp
+		}
+	}
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
 	if err != nil {
-		p.errors = append(p.errors, *Create(fmt.Sprintf("Impossible de parser %q comme entier", p.curToken.Literal),
+		p.errors = append(p.errors, *Create(diagnostic.InvalidLiteral, fmt.Sprintf("Impossible de parser %q comme entier", p.curToken.Literal),
 			p.curToken.Line, p.curToken.Column))
 		return nil
 	}
@@ -1429,7 +1621,7 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		p.errors = append(p.errors, *Create(fmt.Sprintf("Impossible de parser %q comme flottant", p.curToken.Literal),
+		p.errors = append(p.errors, *Create(diagnostic.InvalidLiteral, fmt.Sprintf("Impossible de parser %q comme flottant", p.curToken.Literal),
 			p.curToken.Line, p.curToken.Column))
 		return nil
 	}
@@ -1438,6 +1630,10 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseDecimalLiteral() ast.Expression {
+	return &ast.DecimalLiteral{Token: p.curToken, Value: p.curToken.Literal[:len(p.curToken.Literal)-1]}
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -1447,11 +1643,11 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 }
 
 func (p *Parser) parseDateTimeLiteral() ast.Expression {
-	isTime := p.curToken.Type == token.TIME_LIT
 	return &ast.DateTimeLiteral{
-		Token:  p.curToken,
-		Value:  p.curToken.Literal,
-		IsTime: isTime,
+		Token:      p.curToken,
+		Value:      p.curToken.Literal,
+		IsTime:     p.curToken.Type == token.TIME_LIT,
+		IsDateTime: p.curToken.Type == token.DATETIME_LIT,
 	}
 }
 
@@ -1495,6 +1691,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parsePropertyAccess(left ast.Expression) ast.Expression {
+	if p.peekTokenIs(token.DOLLAR) {
+		p.nextToken()
+		return p.parseJSONPath(left)
+	}
 	pa := &ast.TypeMember{Token: p.curToken, Left: left}
 	t := p.toIdent(p.peekToken.Type)
 	prefix := p.prefixParseFns[t]
@@ -1508,6 +1708,12 @@ func (p *Parser) parsePropertyAccess(left ast.Expression) ast.Expression {
 		p.nextToken()
 		pa.Right = p.parsePropertyAccess(pa.Right) // p.parseExpression(LOWEST)
 	}
+	// a.b.$.x: le chemin s'applique à a.b tout entier
+	if jp, ok := pa.Right.(*ast.JSONPathExpression); ok {
+		pa.Right = jp.Left
+		jp.Left = pa
+		return jp
+	}
 	if n, ok := pa.Left.(*ast.Identifier); ok {
 		if f, ko := pa.Right.(*ast.ArrayFunctionCall); ko {
 			return &ast.TypeExternalCall{Token: pa.Token, Name: n, Action: f}
@@ -1515,9 +1721,35 @@ func (p *Parser) parsePropertyAccess(left ast.Expression) ast.Expression {
 	}
 	return pa
 }
+
+// parseJSONPath lit les étapes d'un chemin json après le '$': .champ, ."champ" ou [expression]
+func (p *Parser) parseJSONPath(left ast.Expression) ast.Expression {
+	jp := &ast.JSONPathExpression{Token: p.curToken, Left: left}
+	for p.peekTokenIs(token.DOT, token.LBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.LBRACKET) {
+			p.nextToken()
+			step := ast.JSONPathStep{Index: p.parseExpression(LOWEST)}
+			if !p.expectPeek(token.RBRACKET) {
+				return nil
+			}
+			jp.Steps = append(jp.Steps, step)
+			continue
+		}
+		p.nextToken()
+		lit := p.curToken.Literal
+		if !p.curTokenIs(token.STRING_LIT) && strings.IndexFunc(lit, unicode.IsLetter) != 0 && !strings.HasPrefix(lit, "_") {
+			p.addError(Create(diagnostic.ExpectedToken, fmt.Sprintf("Invalid json path: field name expected, got '%s'", lit), p.curToken.Line, p.curToken.Column))
+			return nil
+		}
+		jp.Steps = append(jp.Steps, ast.JSONPathStep{Key: lit})
+	}
+	return jp
+}
+
 func (p *Parser) toIdent(t token.TokenType) token.TokenType {
 	switch t {
-	case token.TYPE, token.DATE, token.DURATION, token.INTEGER, token.FLOAT, token.STRING, token.BOOLEAN:
+	case token.TYPE, token.DATE, token.DURATION, token.INTEGER, token.FLOAT, token.STRING, token.BOOLEAN, token.JSON:
 		return token.IDENT
 	case token.RANK, token.ROW_NUMBER, token.DENSE_RANK, token.LAG, token.LEAD, token.GROUP, token.BY:
 		return token.IDENT
@@ -1650,7 +1882,7 @@ func (p *Parser) parseSQLColumnDefinition() (*ast.SQLColumnDefinition, *ParserEr
 
 	// Type de données
 	if !p.expectPeekEx(token.IDENT, token.DATE, token.DATETIME, token.INTEGER, token.FLOAT,
-		token.DURATION, token.STRING, token.BOOLEAN, token.TIME) {
+		token.DURATION, token.STRING, token.BOOLEAN, token.TIME, token.JSON) {
 		return nil, nil
 	}
 	var pi *ParserError
@@ -2199,7 +2431,7 @@ func (p *Parser) parseSelectList(readParan bool) []ast.Expression {
 	var expressions []ast.Expression
 	extread := readParan
 	if p.curTokenIs(token.ASTERISK) {
-		p.addError(Create(fmt.Sprintf("'%s' is not expected here.", p.curToken.Literal), p.curToken.Line, p.curToken.Column))
+		p.addError(Create(diagnostic.UnexpectedToken, fmt.Sprintf("'%s' is not expected here.", p.curToken.Literal), p.curToken.Line, p.curToken.Column))
 		return nil
 		// expressions = append(expressions, &ast.SelectArgs{
 		// 	Expr:    &ast.Identifier{Token: p.curToken, Value: "*"},
@@ -2212,7 +2444,7 @@ func (p *Parser) parseSelectList(readParan bool) []ast.Expression {
 	arg.Expr = p.parseExpression(LOWEST)
 	if extread {
 		if !p.peekTokenIs(token.RPAREN) {
-			p.addError(Create(fmt.Sprintf("Expected ')' got %s", p.peekToken.Type), p.peekToken.Line, p.peekToken.Column))
+			p.addError(Create(diagnostic.ExpectedToken, fmt.Sprintf("Expected ')' got %s", p.peekToken.Type), p.peekToken.Line, p.peekToken.Column))
 			return nil
 		}
 		p.nextToken()
@@ -2277,26 +2509,70 @@ func (p *Parser) expectPeekEx(t ...token.TokenType) bool {
 		}
 	}
 	msg := fmt.Sprintf("Expected %s, got %s", t, p.peekToken.Type)
-	p.errors = append(p.errors, *Create(msg, p.peekToken.Line, p.peekToken.Column))
+	p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, msg, p.peekToken.Line, p.peekToken.Column))
 	return false
 }
 
+// Errors renvoie les erreurs lexicales suivies des erreurs de syntaxe
 func (p *Parser) Errors() []ParserError {
-	return p.errors
+	lexical := p.l.Errors()
+	if len(lexical) == 0 {
+		return p.errors
+	}
+	res := make([]ParserError, 0, len(lexical)+len(p.errors))
+	for _, e := range lexical {
+		res = append(res, *Create(e.Code, e.Message, e.Line, e.Column))
+	}
+	return append(res, p.errors...)
+}
+
+// Diagnostics renvoie les erreurs de syntaxe sous forme de diagnostics
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	errs := p.Errors()
+	res := make([]diagnostic.Diagnostic, 0, len(errs))
+	for _, pe := range errs {
+		res = append(res, pe.Diagnostic())
+	}
+	return res
+}
+
+// Warnings renvoie les avertissements lexicaux (séquences d'échappement inconnues) sous forme de diagnostics
+func (p *Parser) Warnings() []diagnostic.Diagnostic {
+	warnings := p.l.Warnings()
+	res := make([]diagnostic.Diagnostic, 0, len(warnings))
+	for _, w := range warnings {
+		d := Create(w.Code, w.Message, w.Line, w.Column).Diagnostic()
+		d.Severity = diagnostic.Warning
+		res = append(res, d)
+	}
+	return res
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("Expected %s, got %s", t, p.peekToken.Type)
-	p.errors = append(p.errors, *Create(msg, p.peekToken.Line, p.peekToken.Column))
+	p.expectedError(t, p.peekToken)
 }
 
 func (p *Parser) curError(t token.TokenType) {
-	msg := fmt.Sprintf("Expected %s, got %s", t, p.curToken.Type)
-	p.errors = append(p.errors, *Create(msg, p.curToken.Line, p.curToken.Column))
+	p.expectedError(t, p.curToken)
+}
+
+// expectedError signale le jeton t attendu à la place de got; un délimiteur manquant peut être inséré
+func (p *Parser) expectedError(t token.TokenType, got token.Token) {
+	pe := Create(diagnostic.ExpectedToken, fmt.Sprintf("Expected %s, got %s", t, got.Type), got.Line, got.Column)
+	switch t {
+	case token.COMMA, token.SEMICOLON, token.COLON, token.LPAREN, token.RPAREN,
+		token.LBRACE, token.RBRACE, token.LBRACKET, token.RBRACKET:
+		pe.fixes = []diagnostic.Fix{{
+			Title:   fmt.Sprintf("Insert '%s'", t),
+			Span:    diagnostic.At(got.Line, got.Column),
+			NewText: string(t),
+		}}
+	}
+	p.errors = append(p.errors, *pe)
 }
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("Unexpected here %s", t)
-	p.errors = append(p.errors, *Create(msg, p.peekToken.Line, p.peekToken.Column))
+	p.errors = append(p.errors, *Create(diagnostic.UnexpectedToken, fmt.Sprintf("Unexpected here %s", t),
+		p.peekToken.Line, p.peekToken.Column))
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -2951,6 +3227,59 @@ func (p *Parser) parseArrayType() *ast.ArrayType {
 	return arrayType
 }
 
+// parseMapType analyse map of K to V
+func (p *Parser) parseMapType() *ast.MapType {
+	mapType := &ast.MapType{Token: p.curToken}
+	if !p.expectPeek(token.OF) {
+		return nil
+	}
+	p.nextToken()
+	mapType.Key = p.parseTypeAnnotation()
+	if !p.peekTokenIs(token.IDENT) || !strings.EqualFold(p.peekToken.Literal, "to") {
+		p.errors = append(p.errors, *Create(diagnostic.ExpectedToken, fmt.Sprintf("Expected to, got %s", p.peekToken.Literal),
+			p.peekToken.Line, p.peekToken.Column))
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	mapType.Value = p.parseTypeAnnotation()
+	if mapType.Key == nil || mapType.Value == nil {
+		return nil
+	}
+	return mapType
+}
+
+// parseMapLiteral analyse map{k: v, ...}
+func (p *Parser) parseMapLiteral() ast.Expression {
+	if p.peekTokenIs(token.LPAREN) {
+		return p.parseIdentifier() // map(tableau, fonction)
+	}
+	lit := &ast.MapLiteral{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken()
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		pair := ast.MapPair{Key: p.parseExpression(LOWEST)}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		pair.Value = p.parseExpression(LOWEST)
+		lit.Pairs = append(lit.Pairs, pair)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+		p.nextToken()
+	}
+	if !p.curTokenIs(token.RBRACE) {
+		p.curError(token.RBRACE)
+		return nil
+	}
+	return lit
+}
+
 func (p *Parser) parseInExpression(left ast.Expression) ast.Expression {
 	exp := &ast.InExpression{Token: p.curToken, Left: left, Not: false}
 
@@ -3063,6 +3392,17 @@ func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
 		ta.ArrayType = p.parseArrayType()
 		return ta
 	}
+	if p.curTokenIs(token.MAP) {
+		ta.MapType = p.parseMapType()
+		return ta
+	}
+	if p.curTokenIs(token.FUNCTION) {
+		ta.FuncType = p.parseFunctionType()
+		if ta.FuncType == nil {
+			return nil
+		}
+		return ta
+	}
 	if p.curTokenIs(token.SET) {
 		ta.SetType = p.parseSetType()
 	}
@@ -3077,6 +3417,15 @@ func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
 	ta.Type = p.curToken.Literal
 	var pe *ParserError
 
+	// type exporté par un module importé: fin.Pret
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.DOT) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ta.Type += "." + p.curToken.Literal
+	}
+
 	// Vérifier les contraintes
 	if p.peekTokenIs(token.LPAREN) || p.peekTokenIs(token.LBRACKET) {
 		ta.Constraints, pe = p.parseTypeConstraints()
@@ -0,0 +1,169 @@
+package semantic
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/parser"
+)
+
+// Modules: import "lib/finance" as fin charge, par le ModuleLoader fourni par l'hôte, un module
+// de déclarations (types, fonctions, let). Ses fonctions sont appelées par fin.f(...) et ses types
+// désignés par fin.Type
+
+// ModuleLoader renvoie le source du module désigné par path
+type ModuleLoader func(ctx context.Context, path string) (string, error)
+
+// DirLoader charge les modules depuis le répertoire root; l'extension .act est ajoutée
+// quand path n'en a pas. Un chemin qui sort de root est refusé
+func DirLoader(root string) ModuleLoader {
+	return func(ctx context.Context, name string) (string, error) {
+		name = filepath.FromSlash(name)
+		if !filepath.IsLocal(name) {
+			return "", errors.New("the module path must be relative and stay inside the module directory")
+		}
+		if filepath.Ext(name) == "" {
+			name += ".act"
+		}
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+// SetModuleLoader définit la fonction qui fournit le source des modules importés
+func (sa *SemanticAnalyzer) SetModuleLoader(loader ModuleLoader) {
+	sa.loader = loader
+}
+
+// AnalyzeModule analyse les déclarations d'un module chargé par import
+func (sa *SemanticAnalyzer) AnalyzeModule(module *ast.Action) []string {
+	select {
+	case <-sa.ctx.Done():
+		sa.addError(diagnostic.Canceled, diagnostic.Span{}, "Cancled by the user")
+		return sa.Errors
+	default:
+		sa.visitImports(module)
+		for _, stmt := range module.Statements {
+			if _, o := stmt.(*ast.StructStatement); o {
+				sa.visitStatement(stmt, nil)
+			}
+		}
+		for _, stmt := range module.Statements {
+			switch stmt.(type) {
+			case *ast.StructStatement, *ast.ImportStatement:
+			default:
+				sa.visitStatement(stmt, nil)
+			}
+		}
+		return sa.Errors
+	}
+}
+
+// visitImports charge et analyse les modules importés, avant toute autre déclaration
+func (sa *SemanticAnalyzer) visitImports(program *ast.Action) {
+	for _, stmt := range program.Statements {
+		if node, ok := stmt.(*ast.ImportStatement); ok {
+			sa.visitImportStatement(node)
+		}
+	}
+}
+
+func (sa *SemanticAnalyzer) visitImportStatement(node *ast.ImportStatement) {
+	alias := node.Alias.Value
+	if sym, exists := sa.CurrentScope.Symbols[lower(alias)]; exists {
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(node.Alias.Line(), node.Alias.Column()), "'%s' is already declared", alias)
+		sa.relate(sym, "'%s' is declared here", sym.Name)
+		return
+	}
+	// l'alias est déclaré même si le module ne peut être chargé, pour ne signaler l'erreur qu'une fois
+	sa.registerSymbol(alias, ModuleSymbol, &TypeInfo{Name: "module"}, node)
+	symbol := sa.CurrentScope.Symbols[lower(alias)]
+	if sa.loader == nil {
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "No module loader is defined to import '%s'",
+			node.Path)
+		return
+	}
+	key := path.Clean(node.Path)
+	for k, p := range sa.loading {
+		if p == key {
+			cycle := append(append([]string{}, sa.loading[k:]...), key)
+			sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "Import cycle: %s",
+				strings.Join(cycle, " -> "))
+			return
+		}
+	}
+	src, err := sa.loader(sa.ctx, node.Path)
+	if err != nil {
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "Cannot load the module '%s': %s",
+			node.Path, err.Error())
+		return
+	}
+	p := parser.New(lexer.New(src))
+	module := p.ParseModule()
+	if diags := p.Diagnostics(); len(diags) > 0 {
+		for _, d := range diags {
+			sa.addNested("module '"+node.Path+"'", d, node.Line(), node.Column())
+		}
+		return
+	}
+
+	child := NewSemanticAnalyzer(sa.ctx, sa.db, sa.canHandle, sa.serviceExists, sa.signature, sa.mode)
+	child.loader, child.source, child.running = sa.loader, sa.source, sa.running
+	child.loading = append(append([]string{}, sa.loading...), key)
+	child.AnalyzeModule(module)
+	for _, d := range diagnostic.Errors(child.Diagnostics) {
+		sa.addNested("module '"+node.Path+"'", d, node.Line(), node.Column())
+	}
+	node.Module = module
+
+	symbol.Exports = child.GlobalScope
+	for _, stmt := range module.Statements {
+		if st, ok := stmt.(*ast.StructStatement); ok {
+			if ti, exists := child.TypeTable[lower(st.Name.Value)]; exists {
+				sa.TypeTable[lower(alias+"."+st.Name.Value)] = ti
+			}
+		}
+	}
+}
+
+// addNested signale à la position de l'import ou du run l'erreur d trouvée dans le source chargé
+func (sa *SemanticAnalyzer) addNested(what string, d diagnostic.Diagnostic, line, column int) {
+	if d.Span.Start.Line == 0 {
+		sa.addError(diagnostic.SemanticError, diagnostic.At(line, column), "Error in %s: %s", what, d.Message)
+		return
+	}
+	sa.addError(diagnostic.SemanticError, diagnostic.At(line, column), "Error in %s (%d:%d): %s",
+		what, d.Span.Start.Line, d.Span.Start.Column, d.Message)
+}
+
+// visitModuleCall vérifie l'appel fin.f(...) d'une fonction déclarée par un module importé
+func (sa *SemanticAnalyzer) visitModuleCall(node *ast.TypeExternalCall, module *Symbol) *TypeInfo {
+	call := node.Action
+	sa.reference(node.Name, module, nil, module.DataType)
+	if module.Exports == nil {
+		// module non chargé: l'erreur a été signalée par import
+		return &TypeInfo{Name: "any"}
+	}
+	fn := module.Exports.Symbols[lower(call.Function.Value)]
+	if fn == nil || fn.Type != FunctionSymbol || !isFunctionStatement(fn.Node) {
+		sa.addError(diagnostic.UnknownName, diagnostic.At(call.Function.Token.Line, call.Function.Token.Column), "The module '%s' does not export a function '%s'",
+			node.Name.Value, call.Function.Value)
+		return &TypeInfo{Name: "void"}
+	}
+	return sa.visitCall(call, fn)
+}
+
+func isFunctionStatement(node ast.Node) bool {
+	_, ok := node.(*ast.FunctionStatement)
+	return ok
+}
@@ -0,0 +1,102 @@
+package semantic
+
+import (
+	"context"
+	"strings"
+
+	"github.com/akristianlopez/action/ast"
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/object"
+	"github.com/akristianlopez/action/parser"
+)
+
+// Sous-actions: run "Calcul Paie"(emp_id: 12) exécute une autre action, dont le source est fourni
+// par l'hôte. Les arguments sont nommés et vérifiés contre les paramètres de l'action appelée
+
+// ActionSource renvoie le source de l'action nommée name
+type ActionSource func(ctx context.Context, name string) (string, error)
+
+// SetActionSource définit la fonction qui fournit le source des actions appelées par run
+func (sa *SemanticAnalyzer) SetActionSource(source ActionSource) {
+	sa.source = source
+}
+
+func (sa *SemanticAnalyzer) visitRunExpression(node *ast.RunExpression) *TypeInfo {
+	if sa.source == nil {
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "No action source is defined to run '%s'",
+			node.Name)
+		return &TypeInfo{Name: "any"}
+	}
+	for k, name := range sa.running {
+		if strings.EqualFold(name, node.Name) {
+			cycle := append(append([]string{}, sa.running[k:]...), node.Name)
+			sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "Action cycle: %s",
+				strings.Join(cycle, " -> "))
+			return &TypeInfo{Name: "any"}
+		}
+	}
+	if len(sa.running) > object.MAX_RUN_DEPTH {
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "Too many nested actions to run '%s': the limit is %d",
+			node.Name, object.MAX_RUN_DEPTH)
+		return &TypeInfo{Name: "any"}
+	}
+	src, err := sa.source(sa.ctx, node.Name)
+	if err != nil {
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Line(), node.Column()), "Cannot load the action '%s': %s",
+			node.Name, err.Error())
+		return &TypeInfo{Name: "any"}
+	}
+	p := parser.New(lexer.New(src))
+	callee := p.ParseAction()
+	if diags := p.Diagnostics(); len(diags) > 0 {
+		for _, d := range diags {
+			sa.addNested("action '"+node.Name+"'", d, node.Line(), node.Column())
+		}
+		return &TypeInfo{Name: "any"}
+	}
+
+	child := NewSemanticAnalyzer(sa.ctx, sa.db, sa.canHandle, sa.serviceExists, sa.signature, sa.mode)
+	child.loader, child.source = sa.loader, sa.source
+	child.running = append(append([]string{}, sa.running...), node.Name)
+	child.Analyze(callee)
+	if errs := diagnostic.Errors(child.Diagnostics); len(errs) > 0 {
+		for _, d := range errs {
+			sa.addNested("action '"+node.Name+"'", d, node.Line(), node.Column())
+		}
+		return &TypeInfo{Name: "any"}
+	}
+	node.Action = callee
+
+	// Les paramètres non fournis prennent leur valeur par défaut, comme pour un appel HTTP
+	declared := make(map[string]*ast.StructField)
+	for _, param := range callee.Paramters {
+		declared[lower(param.Name.Value)] = param
+	}
+	seen := make(map[string]bool)
+	for _, arg := range node.Arguments {
+		argType := sa.visitExpression(arg.Value)
+		name := lower(arg.Name.Value)
+		param, exists := declared[name]
+		if !exists {
+			sa.addError(diagnostic.InvalidArguments, diagnostic.At(arg.Name.Line(), arg.Name.Column()), "The action '%s' does not have a parameter '%s'",
+				node.Name, arg.Name.Value)
+			continue
+		}
+		if seen[name] {
+			sa.addError(diagnostic.InvalidArguments, diagnostic.At(arg.Name.Line(), arg.Name.Column()), "The parameter '%s' is given more than once",
+				arg.Name.Value)
+			continue
+		}
+		seen[name] = true
+		expected := child.resolveTypeAnnotation(param.Type)
+		if !sa.areTypesCompatible(expected, argType) {
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(arg.Name.Line(), arg.Name.Column()), "Type mismatch for parameter '%s' of action '%s': expected %s, got %s",
+				arg.Name.Value, node.Name, expected.String(), argType.String())
+		}
+	}
+	if callee.ReturnType == nil {
+		return &TypeInfo{Name: "any"}
+	}
+	return child.resolveTypeAnnotation(callee.ReturnType)
+}
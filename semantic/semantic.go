@@ -1,6 +1,7 @@
 package semantic
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -9,7 +10,8 @@ import (
 	// "go/ast"
 
 	"github.com/akristianlopez/action/ast"
-	"github.com/gin-gonic/gin"
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/object"
 )
 
 type SymbolType string
@@ -23,6 +25,7 @@ const (
 	ArraySymbol     SymbolType = "ARRAY"
 	SetSymbol       SymbolType = "SET"
 	ParameterSymbol SymbolType = "PARAMETER"
+	ModuleSymbol    SymbolType = "MODULE"
 )
 
 type Symbol struct {
@@ -33,6 +36,42 @@ type Symbol struct {
 	Node     ast.Node
 	NoOrder  int
 	Index    int
+	Optional bool   // paramètre facultatif d'une fonction standard
+	Exports  *Scope // déclarations d'un module importé
+}
+
+// Reference est une occurrence d'un nom dans le source: la déclaration d'un symbole, son utilisation
+// ou le champ d'une structure ou d'une table (Owner désigne alors le symbole qui porte le champ)
+type Reference struct {
+	Name   string
+	Line   int
+	Column int
+	Symbol *Symbol
+	Owner  *Symbol
+	Type   *TypeInfo
+}
+
+// Declaration renvoie l'identifiant qui déclare le symbole, nil pour les symboles prédéfinis
+func (s *Symbol) Declaration() *ast.Identifier {
+	var id *ast.Identifier
+	switch n := s.Node.(type) {
+	case *ast.LetStatement:
+		id = n.Name
+	case *ast.FunctionStatement:
+		id = n.Name
+	case *ast.StructStatement:
+		id = n.Name
+	case *ast.FunctionParameter:
+		id = n.Name
+	case *ast.ForEachStatement:
+		id = n.Variable
+	case *ast.Identifier:
+		id = n
+	}
+	if id == nil || id.Token.Line == 0 {
+		return nil
+	}
+	return id
 }
 
 type Scope struct {
@@ -47,8 +86,23 @@ type TypeInfo struct {
 	ArraySize   int64
 	ElementType *TypeInfo
 	Constraints *Constraint
-	SetInfo     *SetInfo
+	SetInfo     *SetInfo             // Clés et valeurs des sets et des dictionnaires (map)
 	Fields      map[string]*TypeInfo // Pour les structures
+	Function    *FuncInfo            // Paramètres et type de retour d'une fonction
+}
+
+// FuncInfo décrit la signature d'une valeur fonction: function(integer): boolean
+type FuncInfo struct {
+	Params []*TypeInfo
+	Return *TypeInfo
+}
+
+func (fi *FuncInfo) clone() *FuncInfo {
+	retValue := &FuncInfo{Return: fi.Return.clone()}
+	for _, p := range fi.Params {
+		retValue.Params = append(retValue.Params, p.clone())
+	}
+	return retValue
 }
 
 func (ti *TypeInfo) oString() string {
@@ -74,6 +128,16 @@ func (ti *TypeInfo) String() string {
 	if ti.IsArray {
 		return fmt.Sprintf("Array of %s", ti.ElementType.String())
 	}
+	if ti.Name == "map" && ti.SetInfo != nil {
+		return fmt.Sprintf("Map of %s to %s", ti.SetInfo.Key.String(), ti.SetInfo.Value.String())
+	}
+	if ti.Function != nil {
+		params := make([]string, 0, len(ti.Function.Params))
+		for _, p := range ti.Function.Params {
+			params = append(params, p.String())
+		}
+		return fmt.Sprintf("function(%s): %s", strings.Join(params, ", "), ti.Function.Return.String())
+	}
 	return ti.oString()
 }
 func (ti *TypeInfo) clone() *TypeInfo {
@@ -97,6 +161,9 @@ func (ti *TypeInfo) clone() *TypeInfo {
 	if ti.SetInfo != nil {
 		retVal.SetInfo = ti.SetInfo.clone()
 	}
+	if ti.Function != nil {
+		retVal.Function = ti.Function.clone()
+	}
 	return retVal
 }
 
@@ -130,7 +197,7 @@ func (st *SetInfo) clone() *SetInfo {
 		retValue.Key = st.Key.clone()
 	}
 	if st.Value != nil {
-		retValue.Key = st.Value.clone()
+		retValue.Value = st.Value.clone()
 	}
 	return retValue
 }
@@ -140,24 +207,33 @@ type SemanticAnalyzer struct {
 	GlobalScope   *Scope
 	Errors        []string
 	Warnings      []string
+	Diagnostics   []diagnostic.Diagnostic // erreurs et avertissements, dans l'ordre où ils sont produits
+	References    []Reference             // noms résolus, pour les outils d'édition
 	TypeTable     map[string]*TypeInfo
 	TypFunct      map[string]string
 	TypCast       map[string]string
+	TypCursor     map[string]string // fonctions de curseur: "row" renvoie une ligne, "rows" un tableau de lignes
+	TypMap        map[string]string // fonctions de dictionnaire: "keys" et "values" renvoient un tableau, "key" reçoit une clé
+	TypLambda     map[string]string // fonctions qui appliquent une fonction aux éléments d'un tableau
 	TypeSql       map[string]*TypeInfo
 	inType        int
 	db            *sql.DB
-	ctx           *gin.Context
+	ctx           context.Context
 	mode          bool
-	canHandle     func(ctx *gin.Context, table, field, operation string, mode bool) (bool, string)
+	canHandle     func(ctx context.Context, table, field, operation string, mode bool) (bool, string)
 	serviceExists func(serviceName string) bool
-	signature     func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)
+	signature     func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error)
+	loader        ModuleLoader
+	loading       []string // modules en cours d'analyse, pour détecter les imports circulaires
+	source        ActionSource
+	running       []string // actions en cours d'analyse par run, de l'action principale à l'appelée
 }
 
 // var tokenList []string
 
-func NewSemanticAnalyzer(ctx *gin.Context, db *sql.DB, ch func(ctx *gin.Context, table, field, operation string, mode bool) (bool, string),
+func NewSemanticAnalyzer(ctx context.Context, db *sql.DB, ch func(ctx context.Context, table, field, operation string, mode bool) (bool, string),
 	srvExists func(serviceName string) bool,
-	srvSignature func(ctx *gin.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error), mode bool) *SemanticAnalyzer {
+	srvSignature func(ctx context.Context, serviceName, methodName string) ([]*ast.StructField, *ast.TypeAnnotation, error), mode bool) *SemanticAnalyzer {
 
 	globalScope := &Scope{
 		Symbols: make(map[string]*Symbol),
@@ -171,6 +247,9 @@ func NewSemanticAnalyzer(ctx *gin.Context, db *sql.DB, ch func(ctx *gin.Context,
 		TypeTable:    make(map[string]*TypeInfo),
 		TypFunct:     map[string]string{},
 		TypCast:      map[string]string{},
+		TypCursor:    map[string]string{},
+		TypMap:       map[string]string{},
+		TypLambda:    map[string]string{},
 
 		// TypeSql:       make(map[string]*TypeInfo),
 		inType:        1,
@@ -471,6 +550,8 @@ func (sa *SemanticAnalyzer) registerBuiltinFunctions() {
 	oldScope.Children = append(oldScope.Children, funScope)
 	sa.CurrentScope = funScope
 	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "string"}, -1, 0)
+	sa.optionalParameter("pattern", "string", 1)
+	sa.optionalParameter("locale", "string", 2)
 	sa.CurrentScope = oldScope
 	sa.registerSymbol("parsedate", FunctionSymbol, &TypeInfo{Name: "date"}, &ast.Identifier{Value: "parsedate"}, 25)
 
@@ -481,6 +562,8 @@ func (sa *SemanticAnalyzer) registerBuiltinFunctions() {
 	oldScope.Children = append(oldScope.Children, funScope)
 	sa.CurrentScope = funScope
 	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "string"}, -1, 0)
+	sa.optionalParameter("pattern", "string", 1)
+	sa.optionalParameter("locale", "string", 2)
 	sa.CurrentScope = oldScope
 	sa.registerSymbol("parsetime", FunctionSymbol, &TypeInfo{Name: "time"}, &ast.Identifier{Value: "parsetime"}, 26)
 
@@ -491,6 +574,8 @@ func (sa *SemanticAnalyzer) registerBuiltinFunctions() {
 	oldScope.Children = append(oldScope.Children, funScope)
 	sa.CurrentScope = funScope
 	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "string"}, -1, 0)
+	sa.optionalParameter("pattern", "string", 1)
+	sa.optionalParameter("locale", "string", 2)
 	sa.CurrentScope = oldScope
 	sa.registerSymbol("parsedatetime", FunctionSymbol, &TypeInfo{Name: "datetime"}, &ast.Identifier{Value: "parsedatetime"}, 27)
 
@@ -539,14 +624,18 @@ func (sa *SemanticAnalyzer) registerBuiltinFunctions() {
 		Symbols: make(map[string]*Symbol),
 	}
 	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.optionalParameter("tz", "string", 0)
 	sa.CurrentScope = oldScope
-	sa.registerSymbol("now", FunctionSymbol, &TypeInfo{Name: "time"}, &ast.Identifier{Value: "now"}, 32)
+	sa.registerSymbol("now", FunctionSymbol, &TypeInfo{Name: "datetime"}, &ast.Identifier{Value: "now"}, 32)
 
 	funScope = &Scope{
 		Parent:  oldScope,
 		Symbols: make(map[string]*Symbol),
 	}
 	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.optionalParameter("tz", "string", 0)
 	sa.CurrentScope = oldScope
 	sa.registerSymbol("today", FunctionSymbol, &TypeInfo{Name: "date"}, &ast.Identifier{Value: "today"}, 33)
 
@@ -580,12 +669,186 @@ func (sa *SemanticAnalyzer) registerBuiltinFunctions() {
 	sa.CurrentScope = oldScope
 	sa.registerSymbol("day", FunctionSymbol, &TypeInfo{Name: "integer"}, &ast.Identifier{Value: "day"}, 36)
 
+	// Curseurs: le résultat d'un select est lu ligne par ligne (next), par paquets (fetch) ou abandonné (close)
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("cursor", ParameterSymbol, &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}}, &ast.Identifier{Value: "cursor"}, -1, 0)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("next", FunctionSymbol, &TypeInfo{Name: "any"}, &ast.Identifier{Value: "next"}, 37)
+
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("cursor", ParameterSymbol, &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}}, &ast.Identifier{Value: "cursor"}, -1, 0)
+	sa.registerSymbol("n", ParameterSymbol, &TypeInfo{Name: "integer"}, &ast.Identifier{Value: "n"}, -1, 1)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("fetch", FunctionSymbol, &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}}, &ast.Identifier{Value: "fetch"}, 38)
+
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("cursor", ParameterSymbol, &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}}, &ast.Identifier{Value: "cursor"}, -1, 0)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("close", FunctionSymbol, &TypeInfo{Name: "boolean"}, &ast.Identifier{Value: "close"}, 39)
+
+	// Heure, minute et seconde d'un datetime, dans son fuseau
+	for k, name := range []string{"hour", "minute", "seconde"} {
+		funScope = &Scope{
+			Parent:  oldScope,
+			Symbols: make(map[string]*Symbol),
+		}
+		oldScope.Children = append(oldScope.Children, funScope)
+		sa.CurrentScope = funScope
+		sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "datetime"}, &ast.Identifier{Value: "datetime"}, -1, 0)
+		sa.CurrentScope = oldScope
+		sa.registerSymbol(name, FunctionSymbol, &TypeInfo{Name: "integer"}, &ast.Identifier{Value: name}, 40+k)
+	}
+
+	// convert_tz(d, from, to): l'heure affichée par d lue dans le fuseau from, convertie dans to
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "datetime"}, &ast.Identifier{Value: "datetime"}, -1, 0)
+	sa.registerSymbol("from", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "from"}, -1, 1)
+	sa.registerSymbol("to", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "to"}, -1, 2)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("convert_tz", FunctionSymbol, &TypeInfo{Name: "datetime"}, &ast.Identifier{Value: "convert_tz"}, 43)
+
+	// format_date(d, pattern, locale?)
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "datetime"}, &ast.Identifier{Value: "datetime"}, -1, 0)
+	sa.registerSymbol("pattern", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "pattern"}, -1, 1)
+	sa.optionalParameter("locale", "string", 2)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("format_date", FunctionSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "format_date"}, 44)
+
+	// round(x, places?, mode?): arrondi exact d'un nombre en decimal (half_up, half_even, half_down, up, down, ceiling, floor)
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "decimal"}, &ast.Identifier{Value: "decimal"}, -1, 0)
+	sa.optionalParameter("places", "integer", 1)
+	sa.optionalParameter("mode", "string", 2)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("round", FunctionSymbol, &TypeInfo{Name: "decimal"}, &ast.Identifier{Value: "round"}, 45)
+
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "string"}, -1, 0)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("parsedecimal", FunctionSymbol, &TypeInfo{Name: "decimal"}, &ast.Identifier{Value: "parsedecimal"}, 46)
+
+	// keys(m), values(m), has_key(m, k), delete(m, k): le type réel des clés et des valeurs est celui du dictionnaire
+	for k, name := range []string{"keys", "values", "has_key", "delete"} {
+		funScope = &Scope{
+			Parent:  oldScope,
+			Symbols: make(map[string]*Symbol),
+		}
+		oldScope.Children = append(oldScope.Children, funScope)
+		sa.CurrentScope = funScope
+		sa.registerSymbol("m", ParameterSymbol, anyMap(), &ast.Identifier{Value: "m"}, -1, 0)
+		result := &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}}
+		if k > 1 {
+			sa.registerSymbol("key", ParameterSymbol, &TypeInfo{Name: "any"}, &ast.Identifier{Value: "key"}, -1, 1)
+			result = &TypeInfo{Name: "boolean"}
+		}
+		sa.CurrentScope = oldScope
+		sa.registerSymbol(name, FunctionSymbol, result, &ast.Identifier{Value: name}, 47+k)
+	}
+
+	// parsejson(s) lit un texte json; tojson(x) écrit n'importe quelle valeur en json
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "string"}, -1, 0)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("parsejson", FunctionSymbol, &TypeInfo{Name: "json"}, &ast.Identifier{Value: "parsejson"}, 51)
+
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("val", ParameterSymbol, &TypeInfo{Name: "any"}, &ast.Identifier{Value: "val"}, -1, 0)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("tojson", FunctionSymbol, &TypeInfo{Name: "string"}, &ast.Identifier{Value: "tojson"}, 52)
+
+	// map, filter, reduce, sort_by, any, all, find(tableau, fonction): la signature de la fonction
+	// est contrôlée à chaque appel, d'après le type des éléments du tableau
+	for k, name := range []string{"map", "filter", "reduce", "sort_by", "any", "all", "find"} {
+		funScope = &Scope{
+			Parent:  oldScope,
+			Symbols: make(map[string]*Symbol),
+		}
+		oldScope.Children = append(oldScope.Children, funScope)
+		sa.CurrentScope = funScope
+		sa.registerSymbol("arr", ParameterSymbol, &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}},
+			&ast.Identifier{Value: "arr"}, -1, 0)
+		sa.registerSymbol("fn", ParameterSymbol, &TypeInfo{Name: "function"}, &ast.Identifier{Value: "fn"}, -1, 1)
+		if name == "reduce" {
+			sa.registerSymbol("init", ParameterSymbol, &TypeInfo{Name: "any"}, &ast.Identifier{Value: "init"}, -1, 2)
+		}
+		sa.CurrentScope = oldScope
+		sa.registerSymbol(name, FunctionSymbol, &TypeInfo{Name: "any"}, &ast.Identifier{Value: name}, 53+k)
+	}
+
+	funScope = &Scope{
+		Parent:  oldScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	oldScope.Children = append(oldScope.Children, funScope)
+	sa.CurrentScope = funScope
+	sa.registerSymbol("arr", ParameterSymbol, &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "any"}}, &ast.Identifier{Value: "arr"}, -1, 0)
+	sa.registerSymbol("element", ParameterSymbol, &TypeInfo{Name: "any"}, &ast.Identifier{Value: "element"}, -1, 1)
+	sa.CurrentScope = oldScope
+	sa.registerSymbol("contains", FunctionSymbol, &TypeInfo{Name: "boolean"}, &ast.Identifier{Value: "contains"}, len(oldScope.Children)-1)
+}
+
+// anyMap est le type d'un dictionnaire quelconque
+func anyMap() *TypeInfo {
+	return &TypeInfo{Name: "map", SetInfo: &SetInfo{Key: &TypeInfo{Name: "any"}, Value: &TypeInfo{Name: "any"}}}
+}
+
+// optionalParameter déclare un paramètre facultatif de la fonction standard en cours d'enregistrement
+func (sa *SemanticAnalyzer) optionalParameter(name, typ string, noOrder int) {
+	sa.registerSymbol(name, ParameterSymbol, &TypeInfo{Name: typ}, &ast.Identifier{Value: name}, -1, noOrder)
+	sa.CurrentScope.Symbols[lower(name)].Optional = true
 }
 
 func (sa *SemanticAnalyzer) registerBuiltinTypes() {
 	// Types primitifs
 	sa.TypeTable["integer"] = &TypeInfo{Name: "integer"}
 	sa.TypeTable["float"] = &TypeInfo{Name: "float"}
+	sa.TypeTable["decimal"] = &TypeInfo{Name: "decimal"}
 	sa.TypeTable["string"] = &TypeInfo{Name: "string"}
 	sa.TypeTable["boolean"] = &TypeInfo{Name: "boolean"}
 	sa.TypeTable["time"] = &TypeInfo{Name: "time"}
@@ -593,6 +856,7 @@ func (sa *SemanticAnalyzer) registerBuiltinTypes() {
 	sa.TypeTable["any"] = &TypeInfo{Name: "any"} // Type générique
 	sa.TypeTable["duration"] = &TypeInfo{Name: "duration"}
 	sa.TypeTable["datetime"] = &TypeInfo{Name: "datetime"}
+	sa.TypeTable["json"] = &TypeInfo{Name: "json"} // valeur dynamique: dictionnaire, tableau ou valeur simple
 
 	sa.TypFunct["max"] = ""
 	sa.TypFunct["min"] = ""
@@ -602,6 +866,18 @@ func (sa *SemanticAnalyzer) registerBuiltinTypes() {
 	sa.TypFunct["trim"] = ""
 
 	sa.TypCast["parseinteger"] = ""
+
+	sa.TypCursor["next"] = "row"
+	sa.TypCursor["fetch"] = "rows"
+
+	sa.TypMap["keys"] = "keys"
+	sa.TypMap["values"] = "values"
+	sa.TypMap["has_key"] = "key"
+	sa.TypMap["delete"] = "key"
+
+	for _, name := range []string{"map", "filter", "reduce", "sort_by", "any", "all", "find"} {
+		sa.TypLambda[name] = name
+	}
 	// sa.TypFunct["coalesce"] = ""
 
 	// penser a supprimer ces types pour n'utiliser que les types du haut
@@ -630,9 +906,13 @@ func (sa *SemanticAnalyzer) registerBuiltinTypes() {
 func (sa *SemanticAnalyzer) Analyze(program *ast.Action) []string {
 	select {
 	case <-sa.ctx.Done():
-		sa.addError("Cancled by the user")
+		sa.addError(diagnostic.Canceled, diagnostic.Span{}, "Cancled by the user")
 		return sa.Errors
 	default:
+		if len(sa.running) == 0 {
+			sa.running = []string{program.ActionName}
+		}
+		sa.visitImports(program)
 		for _, stmt := range program.Statements {
 			if _, o := stmt.(*ast.StructStatement); o {
 				sa.visitStatement(stmt, nil)
@@ -646,7 +926,7 @@ func (sa *SemanticAnalyzer) Analyze(program *ast.Action) []string {
 func (sa *SemanticAnalyzer) AnalyzeExpression(table, newName string, expr ast.Expression) {
 	select {
 	case <-sa.ctx.Done():
-		sa.addError("Cancled by the user")
+		sa.addError(diagnostic.Canceled, diagnostic.Span{}, "Cancled by the user")
 		return
 	default:
 		sa.resolveTypeFromTableName(table)
@@ -655,27 +935,20 @@ func (sa *SemanticAnalyzer) AnalyzeExpression(table, newName string, expr ast.Ex
 			sa.registerSymbol(newName, symb.Type, symb.DataType, symb.Node)
 		}
 		if sa.ctx == nil {
-			sa.addError("Context is nil")
-			return
-		}
-		if sa.ctx.Request == nil {
-			sa.addError("Request is nil")
+			sa.addError(diagnostic.SemanticError, diagnostic.Span{}, "Context is nil")
 			return
 		}
 		//Register the User object in the symbol table to be used in the expression analysis
 		fields := map[string]*TypeInfo{}
-		for key, value := range sa.ctx.Request.Header {
-			// Vérifie si la clé commence par "X-User-"
-			if strings.HasPrefix(key, "X-User-") {
-				if strings.EqualFold(key, "X-User-Roles") {
-					continue
-				}
-				if len(value) > 1 {
-					fields[strings.ToLower(strings.TrimPrefix(key, "X-User-"))] = &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "string"}}
+		if p := object.PrincipalFrom(sa.ctx); p != nil {
+			for key, values := range p.Attributes {
+				if len(values) > 1 {
+					fields[strings.ToLower(key)] = &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "string"}}
 					continue
 				}
-				fields[strings.ToLower(strings.TrimPrefix(key, "X-User-"))] = &TypeInfo{Name: "string"}
+				fields[strings.ToLower(key)] = &TypeInfo{Name: "string"}
 			}
+			fields["roles"] = &TypeInfo{Name: "array", IsArray: true, ElementType: &TypeInfo{Name: "string"}}
 		}
 
 		sa.registerSymbol("sysuser", VariableSymbol, &TypeInfo{Name: "sysuser", Fields: fields}, &ast.Identifier{Value: "sysuser"})
@@ -686,7 +959,7 @@ func (sa *SemanticAnalyzer) AnalyzeExpression(table, newName string, expr ast.Ex
 func (sa *SemanticAnalyzer) visitProgram(node *ast.Action) {
 	// Vérifier la structure du programme
 	if node.ActionName == "" {
-		sa.addError("Then action must start by 'action <nom>'")
+		sa.addError(diagnostic.SemanticError, diagnostic.Span{}, "Then action must start by 'action <nom>'")
 	}
 	returnType := &TypeInfo{Name: "any"}
 	isVoid := false
@@ -700,10 +973,12 @@ func (sa *SemanticAnalyzer) visitProgram(node *ast.Action) {
 	for _, stmt := range node.Statements {
 		select {
 		case <-sa.ctx.Done():
-			sa.addError("Cancled by the user")
+			sa.addError(diagnostic.Canceled, diagnostic.Span{}, "Cancled by the user")
 			return
 		default:
-			if _, o := stmt.(*ast.StructStatement); !o {
+			switch stmt.(type) {
+			case *ast.StructStatement, *ast.ImportStatement:
+			default:
 				sa.visitStatement(stmt, returnType)
 			}
 		}
@@ -712,7 +987,7 @@ func (sa *SemanticAnalyzer) visitProgram(node *ast.Action) {
 		// On vérifie si le flux de contrôle est terminé par un return
 		// dans la liste des statements de l'Action.
 		if !sa.isControlFlowTerminated(node.Statements) {
-			sa.addError("Action '%s' must return a value of type %s", node.ActionName, returnType.Name)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Action '%s' must return a value of type %s", node.ActionName, returnType.Name)
 		}
 	}
 }
@@ -772,7 +1047,7 @@ func (sa *SemanticAnalyzer) visitStatement(stmt ast.Statement, t *TypeInfo) {
 
 func (sa *SemanticAnalyzer) visitSQLTruncateStatement(s *ast.SQLTruncateStatement) {
 	if ok, msg := sa.canHandle(sa.ctx, s.ObjectName.Value, "", "delete", sa.mode); !ok {
-		sa.addError("%s", msg)
+		sa.addDenied(diagnostic.At(s.Token.Line, s.Token.Column), msg)
 		return
 	}
 }
@@ -782,7 +1057,7 @@ func (sa *SemanticAnalyzer) visitSQLDropObjectStatement(s *ast.SQLDropObjectStat
 		return
 	}
 	if ok, msg := sa.canHandle(sa.ctx, "system", "", "ddl_delete", sa.mode); !ok {
-		sa.addError("%s", msg)
+		sa.addDenied(diagnostic.At(s.Token.Line, s.Token.Column), msg)
 		return
 	}
 }
@@ -791,7 +1066,7 @@ func (sa *SemanticAnalyzer) visitSQLDropIndexStatement(s *ast.SQLDropIndexStatem
 		return
 	}
 	if ok, msg := sa.canHandle(sa.ctx, "system", "", "ddl_delete", sa.mode); !ok {
-		sa.addError("%s", msg)
+		sa.addDenied(diagnostic.At(s.Token.Line, s.Token.Column), msg)
 		return
 	}
 }
@@ -800,11 +1075,11 @@ func (sa *SemanticAnalyzer) visitSQLAlterObjectStatement(s *ast.SQLAlterObjectSt
 		return
 	}
 	if s.ObjectName == nil {
-		sa.addError("The name of the object is missing. line:%d, column:%d", s.Token.Line, s.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "The name of the object is missing")
 		return
 	}
 	if len(s.Actions) == 0 {
-		sa.addError("Define at least one column or one constraint to add. line:%d, column:%d", s.Token.Line, s.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "Define at least one column or one constraint to add")
 		return
 	}
 	// tokenList := make([]string, 0)
@@ -813,11 +1088,11 @@ func (sa *SemanticAnalyzer) visitSQLAlterObjectStatement(s *ast.SQLAlterObjectSt
 		if !strings.EqualFold(action.Type, "ADD") &&
 			!strings.EqualFold(action.Type, "MODIFY") &&
 			!strings.EqualFold(action.Type, "DROP") {
-			sa.addError("Unknown action '%s' in ALTER OBJECT statement. line:%d, column:%d", action.Type, s.Token.Line, s.Token.Column)
+			sa.addError(diagnostic.UnknownName, diagnostic.At(s.Token.Line, s.Token.Column), "Unknown action '%s' in ALTER OBJECT statement", action.Type)
 			continue
 		}
 		if ok, msg := sa.canHandle(sa.ctx, "system", action.Type, "ddl_update", sa.mode); !ok {
-			sa.addError("%s", msg)
+			sa.addDenied(diagnostic.At(s.Token.Line, s.Token.Column), msg)
 			return
 		}
 
@@ -834,40 +1109,40 @@ func (sa *SemanticAnalyzer) visitSQLAlterObjectStatement(s *ast.SQLAlterObjectSt
 		}
 		if action.Constraint != nil {
 			if action.Constraint.Name == nil {
-				sa.addError("Define the name of the primary key constraint. line:%d, column:%d", s.Token.Line, s.Token.Column)
+				sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "Define the name of the primary key constraint")
 				continue
 			}
 			switch lower(action.Constraint.Type) {
 			case "primary key":
 				if len(action.Constraint.Columns) == 0 {
-					sa.addError("Define the columns for the primary key constraint. line:%d, column:%d", s.Token.Line, s.Token.Column)
+					sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "Define the columns for the primary key constraint")
 				}
 			case "foreign key":
 				if len(action.Constraint.Columns) != len(action.Constraint.References.Columns) {
-					sa.addError("The number of columns in FOREIGN KEY constraint does not match the number of referenced columns. line:%d, column:%d", s.Token.Line, s.Token.Column)
+					sa.addError(diagnostic.TypeMismatch, diagnostic.At(s.Token.Line, s.Token.Column), "The number of columns in FOREIGN KEY constraint does not match the number of referenced columns")
 				}
 				if action.Constraint.References.TableName == nil {
-					sa.addError("Define the referenced object and table for the foreign key constraint. line:%d, column:%d", s.Token.Line, s.Token.Column)
+					sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "Define the referenced object and table for the foreign key constraint")
 				}
 				if strings.EqualFold(action.Constraint.References.TableName.Value, s.ObjectName.Value) {
-					sa.addError("An object cannot reference itself in a FOREIGN KEY constraint. line:%d, column:%d", s.Token.Line, s.Token.Column)
+					sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "An object cannot reference itself in a FOREIGN KEY constraint")
 				}
 			case "unique":
 				if len(action.Constraint.Columns) == 0 {
-					sa.addError("Define the columns for the unique constraint. line:%d, column:%d", s.Token.Line, s.Token.Column)
+					sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "Define the columns for the unique constraint")
 				}
 			case "check":
 				if action.Constraint.Check == nil {
-					sa.addError("Define the check expression for the CHECK constraint. line:%d, column:%d", action.Constraint.Token.Line, action.Constraint.Token.Column)
+					sa.addError(diagnostic.SemanticError, diagnostic.At(action.Constraint.Token.Line, action.Constraint.Token.Column), "Define the check expression for the CHECK constraint")
 					continue
 				}
 				t := sa.visitExpression(action.Constraint.Check)
 				if _, exists := sa.TypeTable[strings.ToLower(t.Name)]; !exists {
-					sa.addError("'%s' invalid expression. line:%d, column:%d", action.Constraint.Check.String(),
-						action.Constraint.Check.Line(), action.Constraint.Check.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(action.Constraint.Check.Line(), action.Constraint.Check.Column()), "'%s' invalid expression",
+						action.Constraint.Check.String())
 				}
 			default:
-				sa.addError("Unknown constraint type '%s' in ALTER OBJECT statement. line:%d, column:%d", action.Constraint.Type, s.Token.Line, s.Token.Column)
+				sa.addError(diagnostic.UnknownName, diagnostic.At(s.Token.Line, s.Token.Column), "Unknown constraint type '%s' in ALTER OBJECT statement", action.Constraint.Type)
 			}
 		}
 	}
@@ -875,17 +1150,15 @@ func (sa *SemanticAnalyzer) visitSQLAlterObjectStatement(s *ast.SQLAlterObjectSt
 
 func (sa *SemanticAnalyzer) visitSQLDeleteStatement(s *ast.SQLDeleteStatement) {
 	if s.From == nil {
-		sa.addError("Define the right object where datas should be deleted eventually. line:%d, column:%d",
-			s.Line(), s.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "Define the right object where datas should be deleted eventually")
 		return
 	}
 	if s.Where == nil {
-		sa.addError("The condition in the clause <where> is needed. line:%d, column:%d",
-			s.Line(), s.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "The condition in the clause <where> is needed")
 		return
 	}
 	if ok, msg := sa.canHandle(sa.ctx, s.From.Value, "", "delete", sa.mode); !ok {
-		sa.addError("%s", msg)
+		sa.addDenied(diagnostic.At(s.Token.Line, s.Token.Column), msg)
 		return
 	}
 	tokenList := make([]string, 0)
@@ -900,8 +1173,7 @@ func (sa *SemanticAnalyzer) visitSQLDeleteStatement(s *ast.SQLDeleteStatement) {
 
 	condType := sa.visitExpression(s.Where)
 	if condType.Name != "boolean" {
-		sa.addError("The condition of a for loop must be boolean. line:%d, column:%d",
-			s.Line(), s.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(s.Line(), s.Column()), "The condition of a for loop must be boolean")
 		sa.CurrentScope = oldScope
 		return
 	}
@@ -915,23 +1187,21 @@ func (sa *SemanticAnalyzer) visitSQLDeleteStatement(s *ast.SQLDeleteStatement) {
 
 func (sa *SemanticAnalyzer) visitSQLUpdateStatement(s *ast.SQLUpdateStatement) {
 	if s.ObjectName == nil {
-		sa.addError("Define the right name of the object. line:%d, column:%d",
-			s.Line(), s.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "Define the right name of the object")
 		return
 	}
 	sa.resolveTypeFromTableName(s.ObjectName.Value)
 	if s.Set == nil {
-		sa.addError("The condition in the clause <where> is needed. line:%d, column:%d",
-			s.Line(), s.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "The condition in the clause <where> is needed")
 		return
 	}
 	for _, stm := range s.Set {
 		if ok, _ := sa.hasField(s.ObjectName.Value, stm.Column.Value); !ok {
-			sa.addError("The column '%s' is not defined in the object '%s'. line:%d, column:%d", stm.Column.Value, s.ObjectName.Value, s.Line(), s.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(s.Line(), s.Column()), "The column '%s' is not defined in the object '%s'", stm.Column.Value, s.ObjectName.Value)
 			return
 		}
 		if ok, msg := sa.canHandle(sa.ctx, s.ObjectName.Value, stm.Column.Value, "update", sa.mode); !ok {
-			sa.addError("%s", msg)
+			sa.addDenied(diagnostic.At(s.Line(), s.Column()), msg)
 			return
 		}
 	}
@@ -946,20 +1216,18 @@ func (sa *SemanticAnalyzer) visitSQLUpdateStatement(s *ast.SQLUpdateStatement) {
 	sa.registerTempoSymbols(tokenList)
 	for _, v := range s.Set {
 		if v.Column == nil {
-			sa.addError("Define the right name of the column. line:%d, column:%d",
-				s.Line(), s.Column())
+			sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "Define the right name of the column")
 		}
 		info := sa.visitExpression(v.Value)
 		if _, exists := sa.TypeTable[lower(info.Name)]; !exists {
-			sa.addError("This column '%s[%s]' is not defined. Maybe, it's a field of %s. line:%d, column:%d",
-				v.Column, info.Name, s.ObjectName.Value, s.Line(), s.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(s.Line(), s.Column()), "This column '%s[%s]' is not defined. Maybe, it's a field of %s",
+				v.Column, info.Name, s.ObjectName.Value)
 		}
 	}
 	if s.Where != nil {
 		condType := sa.visitExpression(s.Where)
 		if condType.Name != "boolean" {
-			sa.addError("The condition of a for loop must be boolean. line:%d, column:%d",
-				s.Line(), s.Column())
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(s.Line(), s.Column()), "The condition of a for loop must be boolean")
 			sa.CurrentScope = oldScope
 			return
 		}
@@ -974,28 +1242,28 @@ func (sa *SemanticAnalyzer) visitSQLUpdateStatement(s *ast.SQLUpdateStatement) {
 
 func (sa *SemanticAnalyzer) visitSQLInsertStatement(s *ast.SQLInsertStatement) {
 	if s.ObjectName == nil {
-		sa.addError("The name of the object is missing. line:%d, column:%d", s.Line(), s.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "The name of the object is missing")
 		return
 	}
 	sa.resolveTypeFromTableName(s.ObjectName.Value)
 	for _, name := range s.Columns {
 		if ok, _ := sa.hasField(s.ObjectName.Value, name.Value); !ok {
-			sa.addError("The column '%s' is not defined in the object '%s'. line:%d, column:%d", name.Value, s.ObjectName.Value, s.Line(), s.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(s.Line(), s.Column()), "The column '%s' is not defined in the object '%s'", name.Value, s.ObjectName.Value)
 			return
 		}
 		if ok, msg := sa.canHandle(sa.ctx, s.ObjectName.Value, name.Value, "insert", sa.mode); !ok {
-			sa.addError("%s", msg)
+			sa.addDenied(diagnostic.At(s.Line(), s.Column()), msg)
 			return
 		}
 	}
 	if s.Select == nil {
 		for _, v := range s.Values {
 			if len(s.Columns) > len(v.Values) {
-				sa.addError("Too few values. line:%d, column:%d", v.Token.Line, v.Token.Column)
+				sa.addError(diagnostic.SemanticError, diagnostic.At(v.Token.Line, v.Token.Column), "Too few values")
 				return
 			}
 			if len(s.Columns) < len(v.Values) {
-				sa.addError("Too much values. line:%d, column:%d", v.Token.Line, v.Token.Column)
+				sa.addError(diagnostic.SemanticError, diagnostic.At(v.Token.Line, v.Token.Column), "Too much values")
 				return
 			}
 			for _, e := range v.Values {
@@ -1007,24 +1275,24 @@ func (sa *SemanticAnalyzer) visitSQLInsertStatement(s *ast.SQLInsertStatement) {
 					if lower(t.Name) == "string" {
 						continue
 					}
-					sa.addError("'%s' invalid expression. line:%d, column:%d", e.String(),
-						e.Line(), e.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(e.Line(), e.Column()), "'%s' invalid expression",
+						e.String())
 				}
 			}
 		}
 		return
 	}
 	if len(s.Values) > 0 {
-		sa.addError("Bad insert statement. line:%d, column:%d", s.Line(), s.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "Bad insert statement")
 		return
 	}
 	if len(s.Columns) > 0 {
 		if len(s.Select.Select) > len(s.Columns) {
-			sa.addError("Too much values. line:%d, column:%d", s.Line(), s.Column())
+			sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "Too much values")
 			return
 		}
 		if len(s.Select.Select) < len(s.Columns) {
-			sa.addError("Too few values. line:%d, column:%d", s.Line(), s.Column())
+			sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "Too few values")
 			return
 		}
 	}
@@ -1038,37 +1306,37 @@ func (sa *SemanticAnalyzer) visitSQLTypeConstraint(v *ast.SQLDataType) {
 	// 	return
 	// }
 	if _, exists := sa.TypeTable[strings.ToLower(v.Name)]; !exists {
-		sa.addError("'%s' invalid expression. line:%d, column:%d", v.Name,
-			v.Token.Line, v.Token.Column)
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.Token.Line, v.Token.Column), "'%s' invalid expression",
+			v.Name)
 		return
 	}
 	if v.Length != nil && v.Length.Value > 0 {
 		switch strings.ToLower(v.Name) {
 		case "string":
 			break
-		case "integer", "float":
+		case "integer", "float", "decimal":
 			break
 		default:
-			sa.addError("'%d' invalid type '%s' constraint. line:%d, column:%d",
-				v.Length.Value, v.Name, v.Token.Line, v.Token.Column)
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.Token.Line, v.Token.Column), "'%d' invalid type '%s' constraint",
+				v.Length.Value, v.Name)
 		}
 	}
 	if v.Precision != nil && v.Precision.Value > 0 {
 		switch strings.ToLower(v.Name) {
-		case "float":
+		case "float", "decimal":
 			break
 		default:
-			sa.addError("'%d' invalid type '%s' constraint. line:%d, column:%d",
-				v.Length.Value, v.Name, v.Token.Line, v.Token.Column)
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.Token.Line, v.Token.Column), "'%d' invalid type '%s' constraint",
+				v.Length.Value, v.Name)
 		}
 	}
 	if v.Scale != nil && v.Scale.Value > 0 {
 		switch strings.ToLower(v.Name) {
-		case "float":
+		case "float", "decimal":
 			break
 		default:
-			sa.addError("'%d' invalid type '%s' constraint. line:%d, column:%d",
-				v.Length.Value, v.Name, v.Token.Line, v.Token.Column)
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.Token.Line, v.Token.Column), "'%d' invalid type '%s' constraint",
+				v.Length.Value, v.Name)
 		}
 	}
 }
@@ -1083,21 +1351,21 @@ func (sa *SemanticAnalyzer) visitSQLColumnConstraints(names []string, v *ast.SQL
 		return
 	}
 	if v.Name == nil {
-		sa.addError("Define the name of the column. line:%d, column:%d", v.Token.Line, v.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(v.Token.Line, v.Token.Column), "Define the name of the column")
 		return
 	}
 	for _, n := range v.Columns {
 		if !contains(names, strings.ToLower(n.Value)) {
-			sa.addError("This '%s' does not exist. line:%d, column:%d", n.Value, n.Line(), n.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(n.Line(), n.Column()), "This '%s' does not exist", n.Value)
 			continue
 		}
 	}
 	if v.References != nil && len(v.References.Columns) > 0 {
 		if len(v.References.Columns) > len(v.Columns) {
-			sa.addError("Too much columns. line:%d, column:%d", v.References.Token.Line, v.References.Token.Column)
+			sa.addError(diagnostic.SemanticError, diagnostic.At(v.References.Token.Line, v.References.Token.Column), "Too much columns")
 		}
 		if len(v.References.Columns) < len(v.Columns) {
-			sa.addError("Too few columns. line:%d, column:%d", v.References.Token.Line, v.References.Token.Column)
+			sa.addError(diagnostic.SemanticError, diagnostic.At(v.References.Token.Line, v.References.Token.Column), "Too few columns")
 		}
 		t := sa.resolveTypeFromTableName(v.References.TableName.Value)
 		if t == nil {
@@ -1108,26 +1376,26 @@ func (sa *SemanticAnalyzer) visitSQLColumnConstraints(names []string, v *ast.SQL
 				}
 			}
 			if t == nil {
-				sa.addError("'%s' Invalid reference name. line:%d, column:%d", v.References.TableName.Value, v.References.Token.Line, v.References.Token.Column)
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.References.Token.Line, v.References.Token.Column), "'%s' Invalid reference name", v.References.TableName.Value)
 				return
 			}
 		}
 
 		if t.Fields == nil {
-			sa.addError("'%s' no fields detected. line:%d, column:%d", v.References.TableName.Value, v.References.Token.Line, v.References.Token.Column)
+			sa.addError(diagnostic.SemanticError, diagnostic.At(v.References.Token.Line, v.References.Token.Column), "'%s' no fields detected", v.References.TableName.Value)
 			return
 		}
 		for _, name := range v.References.Columns {
 			if _, ok := t.Fields[strings.ToLower(name.Value)]; !ok {
-				sa.addError("'%s' Invalid reference name. line:%d, column:%d", v.References.TableName.Value, v.References.Token.Line, v.References.Token.Column)
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.References.Token.Line, v.References.Token.Column), "'%s' Invalid reference name", v.References.TableName.Value)
 			}
 		}
 	}
 	if v.Check != nil {
 		t := sa.visitExpression(v.Check)
 		if _, exists := sa.TypeTable[strings.ToLower(t.Name)]; !exists {
-			sa.addError("'%s' invalid expression. line:%d, column:%d",
-				v.Check.String(), v.Check.Line(), v.Check.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.Check.Line(), v.Check.Column()), "'%s' invalid expression",
+				v.Check.String())
 		}
 	}
 }
@@ -1170,15 +1438,15 @@ func (sa *SemanticAnalyzer) makeSQLCreateAsStructure(s *ast.SQLCreateObjectState
 func (sa *SemanticAnalyzer) visitSQLCreateObjectStatement(s *ast.SQLCreateObjectStatement) {
 	//After creating an object register it as a type structure
 	if s.ObjectName == nil {
-		sa.addError("The name of the object is missing. line:%d, column:%d", s.Token.Line, s.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "The name of the object is missing")
 		return
 	}
 	if len(s.Columns) == 0 {
-		sa.addError("Define at least one column. line:%d, column:%d", s.Token.Line, s.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.Token.Line, s.Token.Column), "Define at least one column")
 		return
 	}
 	if ok, msg := sa.canHandle(sa.ctx, "system", "", "ddl_insert", sa.mode); !ok {
-		sa.addError("%s", msg)
+		sa.addDenied(diagnostic.At(s.Token.Line, s.Token.Column), msg)
 		return
 	}
 	//Browsing columns
@@ -1187,8 +1455,8 @@ func (sa *SemanticAnalyzer) visitSQLCreateObjectStatement(s *ast.SQLCreateObject
 
 	for _, v := range s.Columns {
 		if contains(names, lower(v.Name.Value)) {
-			sa.addError("This column '%s' is already existed. line:%d, column:%d",
-				v.Name.Value, v.Token.Line, v.Token.Column)
+			sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(v.Token.Line, v.Token.Column), "This column '%s' is already existed",
+				v.Name.Value)
 			continue
 		}
 		names = append(names, lower(v.Name.Value))
@@ -1202,19 +1470,19 @@ func (sa *SemanticAnalyzer) visitSQLCreateObjectStatement(s *ast.SQLCreateObject
 	constNames := make([]string, 0)
 	constType := make([]string, 0)
 	if len(s.Constraints) == 0 && !hasConst {
-		sa.addError("Object '%s' does not have at least the primary. line:%d, column:%d", s.ObjectName.Value, s.ObjectName.Line(), s.ObjectName.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(s.ObjectName.Line(), s.ObjectName.Column()), "Object '%s' does not have at least the primary", s.ObjectName.Value)
 		return
 	}
 	for _, e := range s.Constraints {
 		sa.visitSQLColumnConstraints(names, e)
 		if contains(constNames, strings.ToLower(e.Name.Value)) {
-			sa.addError("This constraint '%s' already exist. line:%d, column:%d", e.Name.Value, e.Name.Line(), e.Name.Column())
+			sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(e.Name.Line(), e.Name.Column()), "This constraint '%s' already exist", e.Name.Value)
 			continue
 		}
 		constNames = append(constNames, strings.ToLower(e.Name.Value))
 		flag := contains(constType, strings.ToLower(e.Type))
 		if flag && strings.ToLower(e.Type) == "primary key" {
-			sa.addError("Primary key already exist. line:%d, column:%d", e.Name.Line(), e.Name.Column())
+			sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(e.Name.Line(), e.Name.Column()), "Primary key already exist")
 			continue
 		}
 		if !flag {
@@ -1254,24 +1522,28 @@ func (sa *SemanticAnalyzer) visitExpressionStatement(s *ast.ExpressionStatement)
 			l := sa.canReceivedValue(expr.Left)
 			ti := sa.visitExpression(expr.Right)
 			if !sa.areSameType(l, ti) {
-				sa.addError("Type of '%s' does not match the type of '%s'. Line:%d, column:%d",
-					expr.Left.String(), expr.Right.String(), expr.Line(), expr.Column())
+				sa.addError(diagnostic.TypeMismatch, diagnostic.At(expr.Line(), expr.Column()), "Type of '%s' does not match the type of '%s'",
+					expr.Left.String(), expr.Right.String())
 			}
 			/*
 				case "[": //Array's element
-					sa.addError("Invalid expression. Line:%d, column:%d", expr.Line(), expr.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(expr.Line(), expr.Column()), "Invalid expression")
 				case ".": //Object's member
-					sa.addError("Invalid expression. Line:%d, column:%d", expr.Line(), expr.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(expr.Line(), expr.Column()), "Invalid expression")
 			*/
 		default: //Unkown
-			sa.addError("Invalid expression. Line:%d, column:%d", expr.Line(), expr.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(expr.Line(), expr.Column()), "Invalid expression")
 		}
 	case *ast.ArrayFunctionCall:
 		sa.visitArrayFunctionCall(expr)
+	case *ast.TypeExternalCall:
+		sa.visitTypeExternalCall(expr)
+	case *ast.RunExpression:
+		sa.visitRunExpression(expr)
 	case *ast.SQLSelectStatement:
 		sa.visitSQLSelectStatement(expr, "")
 	default:
-		sa.addError("Invalid expression '%s'. Line:%d, column:%d", expr.String(), expr.Line(), expr.Column())
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(expr.Line(), expr.Column()), "Invalid expression '%s'", expr.String())
 	}
 }
 
@@ -1314,7 +1586,7 @@ func contains(slice []string, element string) bool {
 
 func (sa *SemanticAnalyzer) visitObjectInFromClause(se ast.Expression) (*string, *string) {
 	if se == nil {
-		sa.addError("From clause must have at least one object. line:%d, column:%d", 0, 0)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(0, 0), "From clause must have at least one object")
 		return nil, nil
 	}
 	res := ""
@@ -1332,13 +1604,13 @@ func (sa *SemanticAnalyzer) visitObjectInFromClause(se ast.Expression) (*string,
 				res = strings.ToLower(n.Value)
 				return &oldname, &res
 			default:
-				sa.addError("'%s' invalid statement here. line:%d, column:%d", s.NewName.String(), s.NewName.Line(), s.NewName.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.NewName.Line(), s.NewName.Column()), "'%s' invalid statement here", s.NewName.String())
 				return &oldname, nil
 			}
 		case *ast.SQLSelectStatement:
 			//pare the statement here
 			if s.NewName == nil {
-				sa.addError("New name expected. line:%d, column:%d", s.Value.Line(), s.Value.Column())
+				sa.addError(diagnostic.SemanticError, diagnostic.At(s.Value.Line(), s.Value.Column()), "New name expected")
 				break
 			}
 			selectType, _ := sa.visitSQLSelectStatement(v, "")
@@ -1349,11 +1621,11 @@ func (sa *SemanticAnalyzer) visitObjectInFromClause(se ast.Expression) (*string,
 			res := s.NewName.String()
 			return nil, &res
 		default:
-			sa.addError("'%s' invalid statement here. line:%d, column:%d", s.Value.String(), s.Value.Line(), s.Value.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Value.Line(), s.Value.Column()), "'%s' invalid statement here", s.Value.String())
 			return nil, nil
 		}
 	default:
-		sa.addError("Unknown expression '%s' here. line:%d, column:%d", s.String(), s.Line(), s.Column())
+		sa.addError(diagnostic.UnknownName, diagnostic.At(s.Line(), s.Column()), "Unknown expression '%s' here", s.String())
 		return nil, nil
 	}
 	return nil, &res
@@ -1366,13 +1638,13 @@ func (sa *SemanticAnalyzer) visitSQLExpressionWithDotToken(tab []string, expr as
 		switch left := tm.Left.(type) {
 		case *ast.Identifier:
 			if !contains(tab, strings.ToLower(left.Value)) {
-				sa.addError("'%s' is not an object. line:%d, column:%d",
-					left.Value, left.Token.Line, left.Token.Column)
+				sa.addError(diagnostic.UnknownName, diagnostic.At(left.Token.Line, left.Token.Column), "'%s' is not an object",
+					left.Value)
 
 			}
 		default:
-			sa.addError("'%s' is not an object. line:%d, column:%d",
-				left.String(), left.Line(), left.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(left.Line(), left.Column()), "'%s' is not an object",
+				left.String())
 		}
 	case *ast.InfixExpression:
 		ie := expr.(*ast.InfixExpression)
@@ -1401,7 +1673,7 @@ func (sa *SemanticAnalyzer) hasField(o, f string) (bool, string) {
 	if ti.DataType == nil || ti.DataType.Fields == nil {
 		return false, fmt.Sprintf("'%s' is not defined into '%s'", f, o)
 	}
-	if _, o := ti.DataType.Fields[lower(f)]; !o {
+	if _, ok := ti.DataType.Fields[lower(f)]; !ok {
 		return false, fmt.Sprintf("'%s' is not defined into '%s'", f, o)
 	}
 	return true, ""
@@ -1410,11 +1682,11 @@ func (sa *SemanticAnalyzer) hasField(o, f string) (bool, string) {
 func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement, stepName string) (*TypeInfo, *Scope) {
 	//check for select argumens
 	if ss.Select == nil {
-		sa.addError("select must have at least one field. line:%d, column:%d", ss.Line(), ss.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(ss.Line(), ss.Column()), "select must have at least one field")
 		return &TypeInfo{Name: "void"}, nil
 	}
 	if ss.From == nil {
-		sa.addError("select must have at least one object in the clause from. line:%d, column:%d", ss.Line(), ss.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(ss.Line(), ss.Column()), "select must have at least one object in the clause from")
 		return &TypeInfo{Name: "void"}, nil
 	}
 	ctes := make([]string, 0)
@@ -1431,7 +1703,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 	oldName, newName := sa.visitObjectInFromClause(ss.From)
 	if newName != nil {
 		if !contains(ctes, *newName) && len(ctes) > 0 {
-			sa.addError("'%s' is not defined as CTE. line:%d, column:%d", *newName, ss.From.Line(), ss.From.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(ss.From.Line(), ss.From.Column()), "'%s' is not defined as CTE", *newName)
 			sa.CurrentScope = oldscope
 			return &TypeInfo{Name: "void"}, &scope
 		}
@@ -1444,7 +1716,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 		td := sa.lookupSymbol(*oldName)
 		tn := sa.lookupSymbol(*newName)
 		if tn != nil {
-			sa.addError("'%s' already exists. Line:%d, column:%d", *newName, ss.From.Line(), ss.From.Column())
+			sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(ss.From.Line(), ss.From.Column()), "'%s' already exists", *newName)
 			return &TypeInfo{Name: "void"}, &scope
 		}
 		if td != nil && (td.Type == DbObjectSymbol || td.Type == StructSymbol) {
@@ -1456,6 +1728,13 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 	if ss.Joins != nil {
 		for _, fm := range ss.Joins {
 			oldName, newName = sa.visitObjectInFromClause(fm.Table)
+			if oldName == nil {
+				// sous-requête: visitObjectInFromClause a enregistré son nouveau nom ou signalé l'erreur
+				if newName == nil {
+					continue
+				}
+				oldName, newName = newName, nil
+			}
 			if !contains(tokenList, *oldName) {
 				tokenList = append(tokenList, *oldName)
 				tab := make([]string, 0)
@@ -1464,7 +1743,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 					td := sa.lookupSymbol(*oldName)
 					tn := sa.lookupSymbol(*newName)
 					if tn != nil {
-						sa.addError("'%s' already exists. Line:%d, column:%d", *newName, ss.From.Line(), ss.From.Column())
+						sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(ss.From.Line(), ss.From.Column()), "'%s' already exists", *newName)
 						return &TypeInfo{Name: "void"}, &scope
 					}
 					if td != nil && (td.Type == DbObjectSymbol || td.Type == StructSymbol) {
@@ -1473,12 +1752,11 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 				}
 				continue
 			}
-			sa.addError("'%s' already exists. Line:%d, column:%d", *newName, fm.Table.Line(), fm.Table.Column())
+			sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(fm.Table.Line(), fm.Table.Column()), "'%s' already exists", *oldName)
 			//check the clause ON globally
 			condType := sa.visitExpression(fm.On)
-			if condType.Name != "boolean" {
-				sa.addError("The condition of a for loop must be boolean. line:%d, column:%d",
-					ss.Line(), ss.Column())
+			if condType != nil && condType.Name != "boolean" {
+				sa.addError(diagnostic.TypeMismatch, diagnostic.At(ss.Line(), ss.Column()), "The condition of a for loop must be boolean")
 				sa.CurrentScope = oldscope
 				return &TypeInfo{Name: "void"}, &scope
 			}
@@ -1503,8 +1781,8 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 			continue
 		case *ast.IifExpression, *ast.PrefixExpression:
 			if field.NewName == nil {
-				sa.addError("IIF '%s' must have a new name. line:%d, column:%d",
-					s.String(), s.Line(), s.Column())
+				sa.addError(diagnostic.SemanticError, diagnostic.At(s.Line(), s.Column()), "IIF '%s' must have a new name",
+					s.String())
 				continue
 			}
 			if !contains(argList, lower(field.NewName.Value)) {
@@ -1535,39 +1813,39 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 				if !val && fm.NewName != nil {
 					vl, k := fm.NewName.(*ast.Identifier)
 					if !k {
-						sa.addError("Invalid new name '%s' . line:%d, column:%d",
-							fm.Value, fm.Token.Line, fm.Token.Column)
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(fm.Token.Line, fm.Token.Column), "Invalid new name '%s'",
+							fm.Value)
 						continue
 					}
 					val = strings.EqualFold(n.Value, vl.Value)
 				}
 				if !val && len(ss.Joins) > 0 && !lIsInFrom(n.Value, ss.Joins) {
-					sa.addError("'%s' is not an object. line:%d, column:%d",
-						n.Value, n.Token.Line, n.Token.Column)
+					sa.addError(diagnostic.UnknownName, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' is not an object",
+						n.Value)
 				}
 				switch r := s.Right.(type) {
 				case *ast.Identifier, *ast.StringLiteral:
 					t := sa.lookupSymbol(n.Value)
-					if t != nil && t.Type == DbObjectSymbol {
+					if t != nil && t.Type == DbObjectSymbol && t.DataType != nil {
 						if ok, msg := sa.canHandle(sa.ctx, t.DataType.Name, r.String(), "read", sa.mode); !ok {
-							sa.addError("%s", msg)
+							sa.addDenied(diagnostic.At(n.Token.Line, n.Token.Column), msg)
 						}
 					}
 					continue
 				default:
-					sa.addError("'%s' can not be a new name. line:%d, column:%d",
-						n.Value, n.Token.Line, n.Token.Column)
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' can not be a new name",
+						n.Value)
 				}
 			case *ast.ArrayFunctionCall:
 				n := s.Left.(*ast.ArrayFunctionCall)
 				if sa.lookupSymbol(n.Function.Value) != nil {
-					sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-						s.Right.String(), s.Right.Line(), s.Right.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Right.Line(), s.Right.Column()), "'%s' can not be used in the select clause",
+						s.Right.String())
 				}
 				//Check the function argument format but this will be done after
 				if n.Array == nil && len(n.Arguments) == 0 {
-					sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-						n.Function.String(), s.Line(), s.Column())
+					sa.addError(diagnostic.InvalidArguments, diagnostic.At(s.Line(), s.Column()), "Function '%s' must have at least one argument",
+						n.Function.String())
 				}
 				switch e := s.Right.(type) {
 				case *ast.Identifier, *ast.StringLiteral:
@@ -1581,8 +1859,8 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 						argList = append(argList, strings.ToLower(e.String()))
 					}
 				default:
-					sa.addError("'%s' can not be a new name. line:%d, column:%d",
-						s.Right.String(), s.Right.Line(), s.Right.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Right.Line(), s.Right.Column()), "'%s' can not be a new name",
+						s.Right.String())
 				}
 			}
 		case *ast.InfixExpression:
@@ -1590,27 +1868,27 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 			case *ast.Identifier:
 				n := s.Left.(*ast.Identifier)
 				if !lIsInFrom(n.Value, ss.Joins) {
-					sa.addError("'%s' is not an object. line:%d, column:%d",
-						n.Value, n.Token.Line, n.Token.Column)
+					sa.addError(diagnostic.UnknownName, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' is not an object",
+						n.Value)
 
 				}
 				switch s.Right.(type) {
 				case *ast.Identifier, *ast.StringLiteral:
 					continue
 				default:
-					sa.addError("'%s' can not be a new name. line:%d, column:%d",
-						n.Value, n.Token.Line, n.Token.Column)
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' can not be a new name",
+						n.Value)
 				}
 			case *ast.ArrayFunctionCall:
 				n := s.Left.(*ast.ArrayFunctionCall)
 				if sa.lookupSymbol(n.Function.Value) != nil {
-					sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-						s.Right.String(), s.Right.Line(), s.Right.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Right.Line(), s.Right.Column()), "'%s' can not be used in the select clause",
+						s.Right.String())
 				}
 				//Check the function argument format but this will be done after
 				if n.Array == nil && len(n.Arguments) == 0 {
-					sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-						n.Function.String(), s.Line(), s.Column())
+					sa.addError(diagnostic.InvalidArguments, diagnostic.At(s.Line(), s.Column()), "Function '%s' must have at least one argument",
+						n.Function.String())
 				}
 				switch e := s.Right.(type) {
 				case *ast.Identifier, *ast.StringLiteral:
@@ -1624,23 +1902,23 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 						argList = append(argList, strings.ToLower(e.String()))
 					}
 				default:
-					sa.addError("'%s' can not be a new name. line:%d, column:%d",
-						s.Right.String(), s.Right.Line(), s.Right.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Right.Line(), s.Right.Column()), "'%s' can not be a new name",
+						s.Right.String())
 				}
 			}
 		case *ast.ArrayFunctionCall:
 			if sa.lookupSymbol(s.Function.Value) != nil {
-				sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-					s.Function.String(), s.Line(), s.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Line(), s.Column()), "'%s' can not be used in the select clause",
+					s.Function.String())
 			}
 			//Check the function argument format but this will be done after
 			if s.Array == nil && len(s.Arguments) == 0 {
-				sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-					s.Function.String(), s.Line(), s.Column())
+				sa.addError(diagnostic.InvalidArguments, diagnostic.At(s.Line(), s.Column()), "Function '%s' must have at least one argument",
+					s.Function.String())
 			}
 		default:
-			sa.addError("'%s' invalid . line:%d, column:%d",
-				s.String(), s.Line(), s.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Line(), s.Column()), "'%s' invalid",
+				s.String())
 		}
 
 	}
@@ -1650,8 +1928,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 		condType := sa.visitExpression(ss.Where)
 		sa.CurrentScope = oldscope
 		if condType.Name != "boolean" {
-			sa.addError("The condition of a for loop must be boolean. line:%d, column:%d",
-				ss.Line(), ss.Column())
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(ss.Line(), ss.Column()), "The condition of a for loop must be boolean")
 		}
 		//Verify that each time, we have a.b, a exists in the list
 		sa.visitSQLExpressionWithDotToken(tokenList, ss.Where)
@@ -1661,8 +1938,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 	if ss.Having != nil {
 		condType := sa.visitExpression(ss.Having)
 		if condType.Name != "boolean" {
-			sa.addError("The condition of a for loop must be boolean. line:%d, column:%d",
-				ss.Line(), ss.Column())
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(ss.Line(), ss.Column()), "The condition of a for loop must be boolean")
 		}
 	}
 	//Verify that each time, we have a.b, a exists in the list
@@ -1685,39 +1961,39 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 					if !val && fm.NewName != nil {
 						vl, k := fm.NewName.(*ast.Identifier)
 						if !k {
-							sa.addError("Invalid new name '%s' . line:%d, column:%d",
-								fm.Value, fm.Token.Line, fm.Token.Column)
+							sa.addError(diagnostic.InvalidExpression, diagnostic.At(fm.Token.Line, fm.Token.Column), "Invalid new name '%s'",
+								fm.Value)
 							continue
 						}
 						val = strings.EqualFold(n.Value, vl.Value)
 					}
 					if !val && len(ss.Joins) > 0 && !lIsInFrom(n.Value, ss.Joins) {
-						sa.addError("'%s' is not an object. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.UnknownName, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' is not an object",
+							n.Value)
 					}
 					switch r := t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
 						t := sa.lookupSymbol(n.Value)
-						if t != nil && t.Type == DbObjectSymbol {
+						if t != nil && t.Type == DbObjectSymbol && t.DataType != nil {
 							if ok, msg := sa.canHandle(sa.ctx, t.DataType.Name, r.String(), "read", sa.mode); !ok {
-								sa.addError("%s", msg)
+								sa.addDenied(diagnostic.At(n.Token.Line, n.Token.Column), msg)
 							}
 						}
 						continue
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' can not be a new name",
+							n.Value)
 					}
 				case *ast.ArrayFunctionCall:
 					n := t.Left.(*ast.ArrayFunctionCall)
 					if sa.lookupSymbol(n.Function.Value) != nil {
-						sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be used in the select clause",
+							t.Right.String())
 					}
 					//Check the function argument format but this will be done after
 					if n.Array == nil && len(n.Arguments) == 0 {
-						sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-							n.Function.String(), t.Line(), t.Column())
+						sa.addError(diagnostic.InvalidArguments, diagnostic.At(t.Line(), t.Column()), "Function '%s' must have at least one argument",
+							n.Function.String())
 					}
 					switch e := t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
@@ -1725,8 +2001,8 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 							argList = append(argList, strings.ToLower(e.String()))
 						}
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be a new name",
+							t.Right.String())
 					}
 				}
 			case *ast.InfixExpression:
@@ -1734,27 +2010,27 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 				case *ast.Identifier:
 					n := t.Left.(*ast.Identifier)
 					if !lIsInFrom(n.Value, ss.Joins) {
-						sa.addError("'%s' is not an object. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.UnknownName, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' is not an object",
+							n.Value)
 
 					}
 					switch t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
 						continue
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' can not be a new name",
+							n.Value)
 					}
 				case *ast.ArrayFunctionCall:
 					n := t.Left.(*ast.ArrayFunctionCall)
 					if sa.lookupSymbol(n.Function.Value) != nil {
-						sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be used in the select clause",
+							t.Right.String())
 					}
 					//Check the function argument format but this will be done after
 					if n.Array == nil && len(n.Arguments) == 0 {
-						sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-							n.Function.String(), t.Line(), t.Column())
+						sa.addError(diagnostic.InvalidArguments, diagnostic.At(t.Line(), t.Column()), "Function '%s' must have at least one argument",
+							n.Function.String())
 					}
 					switch e := t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
@@ -1762,32 +2038,32 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 							argList = append(argList, strings.ToLower(e.String()))
 						}
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be a new name",
+							t.Right.String())
 					}
 				}
 			case *ast.ArrayFunctionCall:
 				if sa.lookupSymbol(t.Function.Value) != nil {
-					sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-						t.Function.String(), t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "'%s' can not be used in the select clause",
+						t.Function.String())
 				}
 				//Check the function argument format but this will be done after
 				if t.Array == nil && len(t.Arguments) == 0 {
-					sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-						t.Function.String(), t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidArguments, diagnostic.At(t.Line(), t.Column()), "Function '%s' must have at least one argument",
+						t.Function.String())
 				}
 
 			case *ast.IntegerLiteral:
 				//verify if the value of the literal is between 0 and length of the select arguments list
 				if t.Value <= 0 || t.Value >= int64(len(argList)) {
-					sa.addError("Index '%d' out of box. line:%d, column:%d", t.Value,
-						t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "Index '%d' out of box",
+						t.Value)
 				}
 			case *ast.StringLiteral:
 				//Verify that this literal exists into the select rguments list
 				if !contains(argList, strings.ToLower(t.Value)) {
-					sa.addError("Invalid express '%s'. line:%d, column:%d", t.String(),
-						t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "Invalid express '%s'",
+						t.String())
 				}
 			// case *ast.ArrayFunctionCall:
 			// 	//very that this function was call in the select clause
@@ -1796,7 +2072,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 			// 			t.Line(), t.Column())
 			// 	}
 			default:
-				sa.addError("Invalid expression '%s'. line:%d, column:%d", t.String(), t.Line(), t.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "Invalid expression '%s'", t.String())
 			}
 		}
 	}
@@ -1805,7 +2081,7 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 		for _, v := range ss.OrderBy {
 			sa.visitExpression(v.Expression)
 			if strings.ToLower(v.Direction) != "asc" && strings.ToLower(v.Direction) != "desc" {
-				sa.addError("Invalid direction '%s'. line:%d, column:%d", v.Direction, v.Expression.Line(), v.Expression.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(v.Expression.Line(), v.Expression.Column()), "Invalid direction '%s'", v.Direction)
 			}
 			switch t := v.Expression.(type) {
 			case *ast.TypeMember:
@@ -1820,39 +2096,39 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 					if !val && fm.NewName != nil {
 						vl, k := fm.NewName.(*ast.Identifier)
 						if !k {
-							sa.addError("Invalid new name '%s' . line:%d, column:%d",
-								fm.Value, fm.Token.Line, fm.Token.Column)
+							sa.addError(diagnostic.InvalidExpression, diagnostic.At(fm.Token.Line, fm.Token.Column), "Invalid new name '%s'",
+								fm.Value)
 							continue
 						}
 						val = strings.EqualFold(n.Value, vl.Value)
 					}
 					if !val && len(ss.Joins) > 0 && !lIsInFrom(n.Value, ss.Joins) {
-						sa.addError("'%s' is not an object. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.UnknownName, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' is not an object",
+							n.Value)
 					}
 					switch r := t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
 						t := sa.lookupSymbol(n.Value)
-						if t != nil && t.Type == DbObjectSymbol {
+						if t != nil && t.Type == DbObjectSymbol && t.DataType != nil {
 							if ok, msg := sa.canHandle(sa.ctx, t.DataType.Name, r.String(), "read", sa.mode); !ok {
-								sa.addError("%s", msg)
+								sa.addDenied(diagnostic.At(n.Token.Line, n.Token.Column), msg)
 							}
 						}
 						continue
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' can not be a new name",
+							n.Value)
 					}
 				case *ast.ArrayFunctionCall:
 					n := t.Left.(*ast.ArrayFunctionCall)
 					if sa.lookupSymbol(n.Function.Value) != nil {
-						sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be used in the select clause",
+							t.Right.String())
 					}
 					//Check the function argument format but this will be done after
 					if n.Array == nil && len(n.Arguments) == 0 {
-						sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-							n.Function.String(), t.Line(), t.Column())
+						sa.addError(diagnostic.InvalidArguments, diagnostic.At(t.Line(), t.Column()), "Function '%s' must have at least one argument",
+							n.Function.String())
 					}
 					switch e := t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
@@ -1860,8 +2136,8 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 							argList = append(argList, strings.ToLower(e.String()))
 						}
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be a new name",
+							t.Right.String())
 					}
 				}
 			case *ast.InfixExpression:
@@ -1869,27 +2145,27 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 				case *ast.Identifier:
 					n := t.Left.(*ast.Identifier)
 					if !lIsInFrom(n.Value, ss.Joins) {
-						sa.addError("'%s' is not an object. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.UnknownName, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' is not an object",
+							n.Value)
 
 					}
 					switch t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
 						continue
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							n.Value, n.Token.Line, n.Token.Column)
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(n.Token.Line, n.Token.Column), "'%s' can not be a new name",
+							n.Value)
 					}
 				case *ast.ArrayFunctionCall:
 					n := t.Left.(*ast.ArrayFunctionCall)
 					if sa.lookupSymbol(n.Function.Value) != nil {
-						sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be used in the select clause",
+							t.Right.String())
 					}
 					//Check the function argument format but this will be done after
 					if n.Array == nil && len(n.Arguments) == 0 {
-						sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-							n.Function.String(), t.Line(), t.Column())
+						sa.addError(diagnostic.InvalidArguments, diagnostic.At(t.Line(), t.Column()), "Function '%s' must have at least one argument",
+							n.Function.String())
 					}
 					switch e := t.Right.(type) {
 					case *ast.Identifier, *ast.StringLiteral:
@@ -1897,28 +2173,28 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 							argList = append(argList, strings.ToLower(e.String()))
 						}
 					default:
-						sa.addError("'%s' can not be a new name. line:%d, column:%d",
-							t.Right.String(), t.Right.Line(), t.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Right.Line(), t.Right.Column()), "'%s' can not be a new name",
+							t.Right.String())
 					}
 				}
 			case *ast.ArrayFunctionCall:
 				if sa.lookupSymbol(t.Function.Value) != nil {
-					sa.addError("'%s' can not be used in the select clause. line:%d, column:%d",
-						t.Function.String(), t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "'%s' can not be used in the select clause",
+						t.Function.String())
 				}
 				//Check the function argument format but this will be done after
 				if t.Array == nil && len(t.Arguments) == 0 {
-					sa.addError("Function '%s' must have at least one argument. line:%d, column:%d",
-						t.Function.String(), t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidArguments, diagnostic.At(t.Line(), t.Column()), "Function '%s' must have at least one argument",
+						t.Function.String())
 				}
 
 			case *ast.Identifier, *ast.StringLiteral:
 				if !contains(argList, strings.ToLower(t.String())) {
-					sa.addError("Field '%s'does not exist. line:%d, column:%d", t.String(), t.Line(), t.Column())
+					sa.addError(diagnostic.UnknownName, diagnostic.At(t.Line(), t.Column()), "Field '%s'does not exist", t.String())
 				}
 				// sa.addError("Invalid operation '%s'. line:%d, column:%d", t.String(), t.Line(), t.Column())
 			default:
-				sa.addError("Invalid expression '%s'. line:%d, column:%d", t.String(), t.Line(), t.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "Invalid expression '%s'", t.String())
 			}
 		}
 	}
@@ -1937,19 +2213,19 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 				case *ast.TypeMember:
 					s, ok := e.Right.(*ast.Identifier)
 					if !ok {
-						sa.addError("'%s' invalid . line:%d, column:%d",
-							e.Right.String(), e.Right.Line(), e.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(e.Right.Line(), e.Right.Column()), "'%s' invalid",
+							e.Right.String())
 						continue
 					}
 					t.Fields[lower(s.Value)] = sa.visitExpression(e)
 				default:
-					sa.addError("'%s' invalid . line:%d, column:%d",
-						s.Expr.String(), s.Expr.Line(), s.Expr.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Expr.Line(), s.Expr.Column()), "'%s' invalid",
+						s.Expr.String())
 				}
 
 			default:
-				sa.addError("'%s' invalid . line:%d, column	:%d",
-					s.String(), s.Line(), s.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Line(), s.Column()), "'%s' invalid",
+					s.String())
 			}
 		}
 		sa.registerSymbol(stepName, StructSymbol, t, nil)
@@ -1963,12 +2239,11 @@ func (sa *SemanticAnalyzer) visitSQLSelectStatement(ss *ast.SQLSelectStatement,
 func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes []string) *TypeInfo {
 	//check for select argumens
 	if sw.Select == nil {
-		sa.addError("select must have at least one field. line:%d, column:%d", sw.Line(), sw.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(sw.Line(), sw.Column()), "select must have at least one field")
 		return &TypeInfo{Name: "void"}
 	}
 	if sw.CTEs == nil {
-		sa.addError("select must have at least one object in the clause from. line:%d, column:%d",
-			sw.Line(), sw.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(sw.Line(), sw.Column()), "select must have at least one object in the clause from")
 		return &TypeInfo{Name: "void"}
 	}
 	oldScope := sa.CurrentScope
@@ -1983,7 +2258,7 @@ func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes
 		}
 		sa.CurrentScope = scope
 		if t == nil || t.Name == "void" {
-			sa.addError("Invalid CTE '%s'. line:%d, column:%d", cte.Name.Value, cte.Name.Line(), cte.Name.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(cte.Name.Line(), cte.Name.Column()), "Invalid CTE '%s'", cte.Name.Value)
 			continue
 		}
 		// if  t.Name == "void" {
@@ -2000,7 +2275,7 @@ func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes
 						continue
 					}
 					if !cte.Contains(lower(s.NewName.Value)) {
-						sa.addError("'%s' does not exist. line:%d, column:%d", s.NewName.Value, s.NewName.Line(), s.NewName.Column())
+						sa.addError(diagnostic.UnknownName, diagnostic.At(s.NewName.Line(), s.NewName.Column()), "'%s' does not exist", s.NewName.Value)
 						continue
 					}
 					t.Fields[lower(s.NewName.Value)] = sa.visitExpression(s.Expr)
@@ -2013,15 +2288,15 @@ func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes
 						continue
 					}
 					if !cte.Contains(lower(e.Value)) {
-						sa.addError("'%s' does not exist. line:%d, column:%d", e.Value, e.Line(), e.Column())
+						sa.addError(diagnostic.UnknownName, diagnostic.At(e.Line(), e.Column()), "'%s' does not exist", e.Value)
 						continue
 					}
 					t.Fields[lower(e.Value)] = sa.visitExpression(s.Expr)
 				case *ast.TypeMember:
 					s, ok := e.Right.(*ast.Identifier)
 					if !ok {
-						sa.addError("'%s' invalid . line:%d, column:%d",
-							e.Right.String(), e.Right.Line(), e.Right.Column())
+						sa.addError(diagnostic.InvalidExpression, diagnostic.At(e.Right.Line(), e.Right.Column()), "'%s' invalid",
+							e.Right.String())
 						continue
 					}
 					if len(cte.Columns) == 0 {
@@ -2029,18 +2304,18 @@ func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes
 						continue
 					}
 					if !cte.Contains(lower(s.Value)) {
-						sa.addError("'%s' does not exist. line:%d, column:%d", s.Value, s.Line(), s.Column())
+						sa.addError(diagnostic.UnknownName, diagnostic.At(s.Line(), s.Column()), "'%s' does not exist", s.Value)
 						continue
 					}
 					t.Fields[lower(s.Value)] = sa.visitExpression(e)
 				default:
-					sa.addError("'%s' invalid . line:%d, column:%d",
-						s.Expr.String(), s.Expr.Line(), s.Expr.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Expr.Line(), s.Expr.Column()), "'%s' invalid",
+						s.Expr.String())
 				}
 
 			default:
-				sa.addError("'%s' invalid . line:%d, column	:%d",
-					s.String(), s.Line(), s.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(s.Line(), s.Column()), "'%s' invalid",
+					s.String())
 			}
 		}
 		sa.CurrentScope = oldScope
@@ -2049,13 +2324,13 @@ func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes
 			ctes = append(ctes, lower(cte.Name.Value))
 			continue
 		}
-		sa.addError("'%s' already exists. line:%d, column:%d", cte.Name.Value, cte.Name.Line(), cte.Name.Column())
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(cte.Name.Line(), cte.Name.Column()), "'%s' already exists", cte.Name.Value)
 	}
 	// sw.Select.With.Recursive = false
 	ti, _ := sa.visitSQLSelectStatement(sw.Select, "")
 	sa.CurrentScope = oldScope
 	if ti == nil || ti.Name == "void" {
-		sa.addError("Invalid Select. line:%d, column:%d", sw.Select.Line(), sw.Select.Column())
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(sw.Select.Line(), sw.Select.Column()), "Invalid Select")
 	}
 	return ti
 }
@@ -2063,9 +2338,10 @@ func (sa *SemanticAnalyzer) visitSQLWithStatement(sw *ast.SQLWithStatement, ctes
 func (sa *SemanticAnalyzer) visitLetStatement(node *ast.LetStatement) {
 	// Vérifier si la variable est déjà déclarée
 	var varType *TypeInfo
-	if sa.lookupSymbol(node.Name.Value) != nil {
-		sa.addError("Variable '%s' already declared. line:%d, column:%d",
-			node.Name.Value, node.Name.Token.Line, node.Name.Token.Column)
+	if sym := sa.lookupSymbol(node.Name.Value); sym != nil {
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(node.Name.Token.Line, node.Name.Token.Column), "Variable '%s' already declared",
+			node.Name.Value)
+		sa.relate(sym, "'%s' is declared here", node.Name.Value)
 		return
 	}
 	if node.Type != nil {
@@ -2075,9 +2351,9 @@ func (sa *SemanticAnalyzer) visitLetStatement(node *ast.LetStatement) {
 	if node.Value != nil {
 		valueType := sa.visitExpression(node.Value)
 
-		if varType != nil && !sa.areTypesCompatible(varType, valueType) {
-			sa.addError("Type mismatch for the variable '%s': expected %s, got %s. line:%d, column:%d",
-				node.Name.Value, varType.Name, valueType.Name, node.Token.Line, node.Token.Column)
+		if varType != nil && !sa.areTypesCompatible(varType, valueType) && !sa.isSelectCompatible(node.Value, varType, valueType) {
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "Type mismatch for the variable '%s': expected %s, got %s",
+				node.Name.Value, varType.Name, valueType.Name)
 		}
 		// Si le type n'est pas spécifié, l'inférer
 		if varType == nil {
@@ -2100,7 +2376,7 @@ func (sa *SemanticAnalyzer) visitAssignmentStatement(node *ast.AssignmentStateme
 	case *ast.Identifier:
 		sym := sa.lookupSymbol(left.Value)
 		if sym == nil {
-			sa.addError("Non declared identifier: %s line:%d, column:%d", left.Value, left.Token.Line, left.Token.Column)
+			sa.addError(diagnostic.UndeclaredName, diagnostic.At(left.Token.Line, left.Token.Column), "Non declared identifier: %s", left.Value)
 			return &TypeInfo{Name: "void"}
 		}
 		leftType = sym.DataType
@@ -2110,7 +2386,7 @@ func (sa *SemanticAnalyzer) visitAssignmentStatement(node *ast.AssignmentStateme
 		leftType = sa.visitIndexExpression(left)
 		if leftType == nil {
 			// visitIndexExpression reports its own errors
-			sa.addError("Invalid left side in assignment: %s. line:%d, column:%d", left.String(), left.Line(), left.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(left.Line(), left.Column()), "Invalid left side in assignment: %s", left.String())
 			return &TypeInfo{Name: "void"}
 		}
 
@@ -2119,12 +2395,12 @@ func (sa *SemanticAnalyzer) visitAssignmentStatement(node *ast.AssignmentStateme
 		leftType = sa.visitTypeMember(left, "")
 		if leftType == nil {
 			// visitTypeMember reports its own errors
-			sa.addError("Invalid left side in assignment: %s. line:%d, column:%d", left.String(), left.Line(), left.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(left.Line(), left.Column()), "Invalid left side in assignment: %s", left.String())
 			return &TypeInfo{Name: "void"}
 		}
 
 	default:
-		sa.addError("Invalid Left side in assignment: %s. line:%d, column:%d", node.Variable.String(), node.Variable.Line(), node.Variable.Column())
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Variable.Line(), node.Variable.Column()), "Invalid Left side in assignment: %s", node.Variable.String())
 		return &TypeInfo{Name: "void"}
 	}
 
@@ -2132,14 +2408,13 @@ func (sa *SemanticAnalyzer) visitAssignmentStatement(node *ast.AssignmentStateme
 	rightType := sa.visitExpression(node.Value)
 	if rightType == nil {
 		// visitExpression may have reported errors
-		sa.addError("Invalid Right side expression has no type. line:%d, column:%d",
-			node.Value.Line(), node.Value.Column())
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Value.Line(), node.Value.Column()), "Invalid Right side expression has no type")
 		return &TypeInfo{Name: "void"}
 	}
 
 	if !sa.areTypesCompatible(leftType, rightType) {
-		sa.addError("Type mismatch in assignment: expected %s, got %s. line:%d, column:%d",
-			leftType.String(), rightType.String(), node.Token.Line, node.Token.Column)
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "Type mismatch in assignment: expected %s, got %s",
+			leftType.String(), rightType.String())
 		return &TypeInfo{Name: "void"}
 	}
 	return leftType.clone()
@@ -2147,8 +2422,10 @@ func (sa *SemanticAnalyzer) visitAssignmentStatement(node *ast.AssignmentStateme
 
 func (sa *SemanticAnalyzer) visitFunctionStatement(node *ast.FunctionStatement) {
 	// Vérifier si la fonction est déjà déclarée
-	if sa.lookupSymbol(node.Name.Value) != nil {
-		sa.addError("Function '%s' already declared", node.Name.Value)
+	if sym := sa.lookupSymbol(node.Name.Value); sym != nil {
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(node.Name.Token.Line, node.Name.Token.Column), "Function '%s' already declared",
+			node.Name.Value)
+		sa.relate(sym, "'%s' is declared here", node.Name.Value)
 		return
 	}
 
@@ -2187,7 +2464,7 @@ func (sa *SemanticAnalyzer) visitFunctionStatement(node *ast.FunctionStatement)
 		// On utilise la logique de ton UnreachableCode/isLastStatementTerminating
 		// pour s'assurer que le flux ne peut pas "sortir" de la fonction sans return
 		if !sa.isControlFlowTerminated(node.Body.Statements) {
-			sa.addError("Function '%s' must return a value of type %s", node.Name.Value, returnType.Name)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Function '%s' must return a value of type %s", node.Name.Value, returnType.Name)
 		}
 	}
 	// Restaurer le scope
@@ -2235,9 +2512,10 @@ func (sa *SemanticAnalyzer) checkTerminating(stmt ast.Statement) bool {
 }
 func (sa *SemanticAnalyzer) visitStructStatement(node *ast.StructStatement) {
 	// Vérifier si la structure est déjà déclarée
-	if sa.lookupSymbol(node.Name.Value) != nil {
-		sa.addError("Type '%s' already declared. line:%d, column:%d", node.Name.Value,
-			node.Token.Line, node.Token.Column)
+	if sym := sa.lookupSymbol(node.Name.Value); sym != nil {
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(node.Token.Line, node.Token.Column), "Type '%s' already declared",
+			node.Name.Value)
+		sa.relate(sym, "'%s' is declared here", node.Name.Value)
 		return
 	}
 
@@ -2282,8 +2560,7 @@ func (sa *SemanticAnalyzer) visitForStatement(node *ast.ForStatement, t *TypeInf
 	if node.Condition != nil {
 		condType := sa.visitExpression(node.Condition)
 		if condType.Name != "boolean" && condType.Name != "any" {
-			sa.addError("The condition of a for loop must be boolean. line:%d, column:%d",
-				node.Token.Line, node.Token.Column)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "The condition of a for loop must be boolean")
 		}
 	}
 
@@ -2314,8 +2591,7 @@ func (sa *SemanticAnalyzer) visitIfStatement(node *ast.IfStatement, t *TypeInfo)
 	if node.Condition != nil {
 		condType := sa.visitExpression(node.Condition)
 		if condType.Name != "boolean" && condType.Name != "any" {
-			sa.addError("The condition of a If statement must be boolean. line:%d, column:%d",
-				node.Token.Line, node.Token.Column)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "The condition of a If statement must be boolean")
 			return
 		}
 	}
@@ -2385,8 +2661,7 @@ func (sa *SemanticAnalyzer) visitWhileStatement(node *ast.WhileStatement, t *Typ
 	if node.Condition != nil {
 		condType := sa.visitExpression(node.Condition)
 		if condType.Name != "boolean" && condType.Name != "any" {
-			sa.addError("The condition of a If statement must be boolean. line:%d, column:%d",
-				node.Token.Line, node.Token.Column)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "The condition of a If statement must be boolean")
 			return
 		}
 	}
@@ -2407,30 +2682,55 @@ func (sa *SemanticAnalyzer) visitForEachStatement(node *ast.ForEachStatement, t
 		Symbols: make(map[string]*Symbol),
 	}
 	if node.Variable == nil {
-		sa.addError("Variable must be defined. Line:%d, column:%d", node.Token.Line, node.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Token.Line, node.Token.Column), "Variable must be defined")
 		return
 	}
 	symbol := sa.lookupSymbol(node.Variable.Value)
 	if symbol != nil {
-		sa.addError("This variable '%s' already exists. Line:%d, column:%d", node.Variable.Value,
-			node.Variable.Line(), node.Variable.Column())
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(node.Variable.Line(), node.Variable.Column()), "This variable '%s' already exists",
+			node.Variable.Value)
 		return
 	}
 	sa.CurrentScope.Children = append(sa.CurrentScope.Children, loopScope)
 	varType := sa.visitExpression(node.Iterator)
 	if varType == nil || node.Iterator == nil {
-		sa.addError("Iterator '%s' must have a type. Line:%d, column:%d", node.Iterator.String(),
-			node.Iterator.Line(), node.Iterator.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Iterator.Line(), node.Iterator.Column()), "Iterator '%s' must have a type",
+			node.Iterator.String())
+		return
+	}
+	if varType.Name == "json" {
+		// éléments d'un tableau json ou clés d'un objet json; avec deux variables, clés et valeurs d'un objet
+		key := &TypeInfo{Name: "json"}
+		if node.Value != nil {
+			key = &TypeInfo{Name: "string"}
+		}
+		varType = &TypeInfo{Name: "map", SetInfo: &SetInfo{Key: key, Value: &TypeInfo{Name: "json"}}}
+	}
+	isMap := varType.Name == "map" && varType.SetInfo != nil
+	if !varType.IsArray && !isMap {
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Iterator.Line(), node.Iterator.Column()), "'%s' must be an iterator",
+			node.Iterator.String())
 		return
 	}
-	if !varType.IsArray {
-		sa.addError("'%s' must be an iterator. Line:%d, column:%d", node.Iterator.String(),
-			node.Iterator.Line(), node.Iterator.Column())
+	if node.Value != nil && !isMap {
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Value.Line(), node.Value.Column()), "Only a map can be iterated with a key and a value")
+		return
+	}
+	if node.Value != nil && (sa.lookupSymbol(node.Value.Value) != nil || strings.EqualFold(node.Value.Value, node.Variable.Value)) {
+		sa.addError(diagnostic.AlreadyDeclared, diagnostic.At(node.Value.Line(), node.Value.Column()), "This variable '%s' already exists",
+			node.Value.Value)
 		return
 	}
 	oldScope := sa.CurrentScope
 	sa.CurrentScope = loopScope
-	sa.registerSymbol(node.Variable.Value, VariableSymbol, varType.ElementType, node)
+	if isMap {
+		sa.registerSymbol(node.Variable.Value, VariableSymbol, varType.SetInfo.Key, node)
+		if node.Value != nil {
+			sa.registerSymbol(node.Value.Value, VariableSymbol, varType.SetInfo.Value, node)
+		}
+	} else {
+		sa.registerSymbol(node.Variable.Value, VariableSymbol, varType.ElementType, node)
+	}
 
 	// Analyser l'update
 	if node.Body != nil {
@@ -2450,7 +2750,7 @@ func (sa *SemanticAnalyzer) visitSwitchStatement(node *ast.SwitchStatement, t *T
 		for _, expr := range caseStmt.Expressions {
 			caseType := sa.visitExpression(expr)
 			if !sa.areTypesCompatible(switchType, caseType) {
-				sa.addError("Type incompatible dans case: attendu %s, got %s",
+				sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Type incompatible dans case: attendu %s, got %s",
 					switchType.Name, caseType.Name)
 			}
 		}
@@ -2501,6 +2801,10 @@ func (sa *SemanticAnalyzer) visitExpression(expr ast.Expression) *TypeInfo {
 		tab := strings.Split(e.String(), ".")
 		return &TypeInfo{Name: "float", Constraints: &Constraint{Length: -1,
 			Precision: int64(len(tab[0])), Scale: int64(len(tab[1])), Range: nil}}
+	case *ast.DecimalLiteral:
+		tab := append(strings.Split(e.Value, "."), "")
+		return &TypeInfo{Name: "decimal", Constraints: &Constraint{Length: -1,
+			Precision: int64(len(tab[0])), Scale: int64(len(tab[1])), Range: nil}}
 	case *ast.StringLiteral:
 		return &TypeInfo{Name: "string", Constraints: &Constraint{Length: int64(len(e.String())),
 			Precision: -1, Scale: -1, Range: nil}}
@@ -2510,11 +2814,23 @@ func (sa *SemanticAnalyzer) visitExpression(expr ast.Expression) *TypeInfo {
 		if e.IsTime {
 			return &TypeInfo{Name: "time"}
 		}
+		if e.IsDateTime {
+			if _, err := object.ParseDateTime(e.Value[1 : len(e.Value)-1]); err != nil {
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(e.Line(), e.Column()), "Invalid datetime %s: %s", e.Value, err.Error())
+			}
+			return &TypeInfo{Name: "datetime"}
+		}
 		return &TypeInfo{Name: "date"}
 	case *ast.DurationLiteral:
 		return &TypeInfo{Name: "duration"}
 	case *ast.ArrayLiteral:
 		return sa.visitArrayLiteral(e)
+	case *ast.MapLiteral:
+		return sa.visitMapLiteral(e)
+	case *ast.FunctionLiteral:
+		return sa.visitFunctionLiteral(e)
+	case *ast.JSONPathExpression:
+		return sa.visitJSONPath(e)
 	case *ast.StructLiteral:
 		return sa.visitStructLiteral(e)
 	case *ast.NullLiteral:
@@ -2535,6 +2851,10 @@ func (sa *SemanticAnalyzer) visitExpression(expr ast.Expression) *TypeInfo {
 		return sa.visitIsExpression(e)
 	case *ast.ArrayFunctionCall:
 		return sa.visitArrayFunctionCall(e)
+	case *ast.TypeExternalCall:
+		return sa.visitTypeExternalCall(e)
+	case *ast.RunExpression:
+		return sa.visitRunExpression(e)
 	case *ast.SQLSelectStatement:
 		// Create and register the type of sql_result from select statement field
 		return sa.visitSelectExpression(e)
@@ -2565,28 +2885,30 @@ func (sa *SemanticAnalyzer) visitSelectArgs(node *ast.SelectArgs) *TypeInfo {
 	if fl, ok := node.Expr.(*ast.TypeMember); ok {
 		f, ov := fl.Left.(*ast.Identifier)
 		if !ov {
-			sa.addError("Object '%s' does not exist. Line:%d, column:%d.", fl.Left.String(), fl.Left.Line(), fl.Left.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(fl.Left.Line(), fl.Left.Column()), "Object '%s' does not exist", fl.Left.String())
 			return nil
 		}
 		symp := sa.lookupSymbol(f.Value)
 		if symp == nil {
-			sa.addError("Object '%s' does not exist.", f.Value)
+			sa.addError(diagnostic.UnknownName, diagnostic.Span{}, "Object '%s' does not exist.", f.Value)
 			return nil
 		}
 		fi, o := fl.Right.(*ast.Identifier)
 		if !o {
-			sa.addError("Object '%s' does not exist. Line:%d, column:%d.", fl.Right.String(), fl.Right.Line(), fl.Right.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(fl.Right.Line(), fl.Right.Column()), "Object '%s' does not exist", fl.Right.String())
 			return nil
 		}
 		if ok, msg := sa.canHandle(sa.ctx, symp.DataType.Name, fi.Value, "read", sa.mode); !ok {
-			sa.addError("%s", msg)
+			sa.addDenied(diagnostic.At(fi.Token.Line, fi.Token.Column), msg)
 			return nil
 		}
 		res, o := symp.DataType.Fields[lower(fi.Value)]
 		if !o {
-			sa.addError("Object '%s' does not exist. Line:%d, column:%d.", fi.Value, fi.Line(), fi.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(fi.Line(), fi.Column()), "Object '%s' does not exist", fi.Value)
 			return nil
 		}
+		sa.reference(f, symp, nil, symp.DataType)
+		sa.reference(fi, nil, symp, res)
 		return res
 	}
 	if fl, ok := node.Expr.(*ast.ArrayFunctionCall); ok {
@@ -2637,12 +2959,12 @@ func (sa *SemanticAnalyzer) visitSingleFromClauseExpression(node *ast.FromIdenti
 		symp = sa.lookupSymbol(node.Value.String())
 		id, ok := node.NewName.(*ast.Identifier)
 		if !ok {
-			sa.addError("Invalid expression '%s' does not exist. Line:%d, column:%d.", id.String(), id.Line(), id.Column())
+			sa.addError(diagnostic.UnknownName, diagnostic.At(id.Line(), id.Column()), "Invalid expression '%s' does not exist", id.String())
 			return
 		}
 		if symp == nil {
 			if resultType == nil {
-				sa.addError("Object '%s' does not exist. Line:%d, column:%d.", node.Value.String(), node.Value.Line(), node.Value.Column())
+				sa.addError(diagnostic.UnknownName, diagnostic.At(node.Value.Line(), node.Value.Column()), "Object '%s' does not exist", node.Value.String())
 				return
 			}
 			return
@@ -2656,7 +2978,7 @@ func (sa *SemanticAnalyzer) visitFromClauseExpression(node *ast.SQLSelectStateme
 	}
 	fi, o := node.From.(*ast.FromIdentifier)
 	if !o {
-		sa.addError("Invalid expression '%s' does not exist. Line:%d, column:%d.", node.From.String(), node.From.Line(), node.From.Column())
+		sa.addError(diagnostic.UnknownName, diagnostic.At(node.From.Line(), node.From.Column()), "Invalid expression '%s' does not exist", node.From.String())
 		return
 	}
 	sa.visitSingleFromClauseExpression(fi)
@@ -2665,7 +2987,7 @@ func (sa *SemanticAnalyzer) visitFromClauseExpression(node *ast.SQLSelectStateme
 		for _, join := range node.Joins {
 			fi, o := join.Table.(*ast.FromIdentifier)
 			if !o {
-				sa.addError("Invalid expression '%s' does not exist. Line:%d, column:%d.", join.Table.String(), join.Table.Line(), join.Table.Column())
+				sa.addError(diagnostic.UnknownName, diagnostic.At(join.Table.Line(), join.Table.Column()), "Invalid expression '%s' does not exist", join.Table.String())
 				return
 			}
 			if sq, ok := fi.Value.(*ast.SQLSelectStatement); ok {
@@ -2708,8 +3030,8 @@ func (sa *SemanticAnalyzer) visitSelectExpression(node *ast.SQLSelectStatement)
 	for _, f := range node.Select {
 		if fld, ok := f.(*ast.SelectArgs); ok {
 			if fi, o := fld.Expr.(*ast.Identifier); o {
-				sa.addError("'%s' needs to be prefixed by the name of an object. line:%d, column:%d", fi.Value,
-					fi.Line(), fi.Column())
+				sa.addError(diagnostic.SemanticError, diagnostic.At(fi.Line(), fi.Column()), "'%s' needs to be prefixed by the name of an object",
+					fi.Value)
 				continue
 			}
 			fieldType := sa.visitSelectArgs(fld)
@@ -2725,7 +3047,7 @@ func (sa *SemanticAnalyzer) visitSelectExpression(node *ast.SQLSelectStatement)
 					structType.ElementType.Fields[lower(fld.NewName.Value)] = sa.visitExpression(fld.Expr)
 					continue
 				}
-				sa.addError("'%s' is not a field name. Line:%d, column:%d", fld.Expr.String(), fld.Expr.Line(), fld.Expr.Column())
+				sa.addError(diagnostic.SemanticError, diagnostic.At(fld.Expr.Line(), fld.Expr.Column()), "'%s' is not a field name", fld.Expr.String())
 				break
 			}
 			if fl, ok := fld.Expr.(*ast.TypeMember); ok {
@@ -2734,13 +3056,13 @@ func (sa *SemanticAnalyzer) visitSelectExpression(node *ast.SQLSelectStatement)
 					structType.ElementType.Fields[lower(fi.Value)] = fieldType
 					continue
 				}
-				sa.addError("Invalid column expression '%s'. line:%d, column:%d", fld.Expr.String(),
-					fld.Expr.Line(), fld.Expr.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(fld.Expr.Line(), fld.Expr.Column()), "Invalid column expression '%s'",
+					fld.Expr.String())
 				sa.CurrentScope = oldScope
 				return &TypeInfo{Name: "void"}
 			}
-			sa.addError("'%s' needs to be renamed. line:%d, column:%d", fld.Expr.String(),
-				fld.Expr.Line(), fld.Expr.Column())
+			sa.addError(diagnostic.SemanticError, diagnostic.At(fld.Expr.Line(), fld.Expr.Column()), "'%s' needs to be renamed",
+				fld.Expr.String())
 			sa.CurrentScope = oldScope
 			return &TypeInfo{Name: "void"}
 		}
@@ -2748,16 +3070,16 @@ func (sa *SemanticAnalyzer) visitSelectExpression(node *ast.SQLSelectStatement)
 	if node.Where != nil {
 		t := sa.visitExpression(node.Where)
 		if t.Name != "boolean" {
-			sa.addError("Invalid expression '%s'. Line:%d, column:%d", node.Where.String(),
-				node.Where.Line(), node.Where.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Where.Line(), node.Where.Column()), "Invalid expression '%s'",
+				node.Where.String())
 			return &TypeInfo{Name: "void"}
 		}
 	}
 	if node.Having != nil {
 		t := sa.visitExpression(node.Having)
 		if t.Name != "boolean" {
-			sa.addError("Invalid expression '%s'. Line:%d, column:%d", node.Having.String(),
-				node.Having.Line(), node.Having.Column())
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Having.Line(), node.Having.Column()), "Invalid expression '%s'",
+				node.Having.String())
 			return &TypeInfo{Name: "void"}
 		}
 	}
@@ -2783,7 +3105,7 @@ func (sa *SemanticAnalyzer) visitLikeExpression(e *ast.LikeExpression) *TypeInfo
 
 	// Accept only string operands for LIKE
 	if left.Name != "string" || right.Name != "string" {
-		sa.addError("invalid operation. Both operands of 'like' must be strings. got %s and %s",
+		sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "invalid operation. Both operands of 'like' must be strings. got %s and %s",
 			left.Name, right.Name)
 		return &TypeInfo{Name: "void"}
 	}
@@ -2796,13 +3118,13 @@ func (sa *SemanticAnalyzer) visitBetweenExpression(e *ast.BetweenExpression) *Ty
 	tc := sa.visitExpression(e.Left)
 	te := sa.visitExpression(e.Right)
 	if !sa.areTypesCompatible(tb, tc) {
-		sa.addError("Type mismatch in BETWEEN expression: base '%s' and correct '%s' are not compatible. line:%d, column:%d",
-			tb.Name, tc.Name, e.Line(), e.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.Line(), e.Column()), "Type mismatch in BETWEEN expression: base '%s' and correct '%s' are not compatible",
+			tb.Name, tc.Name)
 		return &TypeInfo{Name: "void"}
 	}
 	if !sa.areTypesCompatible(tb, te) {
-		sa.addError("Type mismatch in BETWEEN expression: base '%s' and error '%s' are not compatible. line:%d, column:%d",
-			tb.Name, te.Name, e.Line(), e.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.Line(), e.Column()), "Type mismatch in BETWEEN expression: base '%s' and error '%s' are not compatible",
+			tb.Name, te.Name)
 		return &TypeInfo{Name: "void"}
 	}
 	return &TypeInfo{Name: "boolean"}
@@ -2812,17 +3134,17 @@ func (sa *SemanticAnalyzer) visitSliceExpression(e *ast.SliceExpression) *TypeIn
 	ts := sa.visitExpression(e.Start)
 	te := sa.visitExpression(e.End)
 	if ts != nil && ts.Name != "integer" {
-		sa.addError("This expression '%s' must be integer. line:%d, column:%d",
-			e.String(), e.Start.Line(), e.Start.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.Start.Line(), e.Start.Column()), "This expression '%s' must be integer",
+			e.String())
 	}
 	if te != nil && te.Name != "integer" {
-		sa.addError("This expression '%s' must be integer. line:%d, column:%d",
-			e.String(), e.End.Line(), e.End.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.End.Line(), e.End.Column()), "This expression '%s' must be integer",
+			e.String())
 	}
 	symbol := sa.lookupSymbol(e.Left.String())
 	if symbol == nil {
-		sa.addError("Non declared identifier: %s line:%d, column:%d", e.Left.String(),
-			e.Left.Line(), e.Left.Column())
+		sa.addError(diagnostic.UndeclaredName, diagnostic.At(e.Left.Line(), e.Left.Column()), "Non declared identifier: %s",
+			e.Left.String())
 		return &TypeInfo{Name: "void"}
 	}
 	return symbol.DataType.clone()
@@ -2833,38 +3155,59 @@ func (sa *SemanticAnalyzer) visitArrayFunctionCall(e *ast.ArrayFunctionCall) *Ty
 	oldScope := sa.CurrentScope
 	symbol := sa.lookupSymbol(e.Function.String())
 	if symbol == nil {
-		sa.addError("Non declared function: %s. line:%d, column:%d", e.Function.Value,
-			e.Function.Token.Line, e.Function.Token.Column)
+		sa.addError(diagnostic.UndeclaredName, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "Non declared function: %s",
+			e.Function.Value)
 		sa.CurrentScope = oldScope
 		return &TypeInfo{Name: "void"}
 	}
+	sa.reference(e.Function, symbol, nil, symbol.DataType)
+	return sa.visitCall(e, symbol)
+}
+
+// visitCall contrôle les arguments de l'appel e à la fonction symbol et renvoie le type du résultat
+func (sa *SemanticAnalyzer) visitCall(e *ast.ArrayFunctionCall, symbol *Symbol) *TypeInfo {
+	oldScope := sa.CurrentScope
+	if symbol.Type != FunctionSymbol && symbol.DataType != nil && symbol.DataType.Function != nil {
+		return sa.visitFunctionValueCall(e, symbol.DataType)
+	}
 	Scope := symbol.Scope.Children[symbol.Index]
-	if len(Scope.Symbols) == 0 && e.Array == nil {
+	required, variadic := 0, false
+	for _, param := range Scope.Symbols {
+		if !param.Optional {
+			required++
+		}
+		variadic = variadic || param.DataType.Name == "$_arguments" || param.DataType.Name == "$n_arguments"
+	}
+	if required == 0 && e.Array == nil {
 		sa.CurrentScope = oldScope
 		return symbol.DataType.clone()
 	}
 	if Scope == nil && e.Array != nil {
-		sa.addError("The function '%s' does not have argument(s). line:%d, column:%d", e.Function.Value,
-			e.Function.Token.Line, e.Function.Token.Column)
+		sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "The function '%s' does not have argument(s)",
+			e.Function.Value)
 		sa.CurrentScope = oldScope
 		return &TypeInfo{Name: "void"}
 	}
-	if e.Array == nil && len(Scope.Symbols) > 0 {
-		sa.addError("The function '%s' must have argument(s). line:%d, column:%d", e.Function.Value,
-			e.Function.Token.Line, e.Function.Token.Column)
+	if e.Array == nil && required > 0 {
+		sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "The function '%s' must have argument(s)",
+			e.Function.Value)
 		sa.CurrentScope = oldScope
 		return &TypeInfo{Name: "void"}
 	}
 
-	if len(e.Arguments) > 0 && len(Scope.Symbols)-1 == 0 {
-		sa.addError("The function '%s' does not have argument(s). line:%d, column:%d", e.Function.Value,
-			e.Function.Token.Line, e.Function.Token.Column)
+	if len(e.Arguments) > 0 && len(Scope.Symbols)-1 == 0 && !variadic {
+		sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "The function '%s' does not have argument(s)",
+			e.Function.Value)
 		sa.CurrentScope = oldScope
 		return &TypeInfo{Name: "void"}
 	}
-	if len(Scope.Symbols) != (len(e.Arguments) + 1) {
-		sa.addError("The function '%s' expects %d argument(s), but got %d. line:%d, column:%d", e.Function.Value,
-			len(Scope.Symbols), len(e.Arguments), e.Function.Token.Line, e.Function.Token.Column)
+	if given := len(e.Arguments) + 1; !variadic && (given < required || given > len(Scope.Symbols)) {
+		expected := fmt.Sprint(len(Scope.Symbols))
+		if required != len(Scope.Symbols) {
+			expected = fmt.Sprintf("%d to %d", required, len(Scope.Symbols))
+		}
+		sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "The function '%s' expects %s argument(s), but got %d",
+			e.Function.Value, expected, given)
 		sa.CurrentScope = oldScope
 		return &TypeInfo{Name: "void"}
 	}
@@ -2874,56 +3217,71 @@ func (sa *SemanticAnalyzer) visitArrayFunctionCall(e *ast.ArrayFunctionCall) *Ty
 		args[v.NoOrder] = k
 	}
 	currentType := sa.visitExpression(e.Array)
+	firstType := currentType
 	expectedType := Scope.Symbols[args[0]]
 	isArgList := false
 	if expectedType.DataType.Name == "$_arguments" {
 		isArgList = true
 		expectedType = &Symbol{Name: "", Type: ParameterSymbol, DataType: currentType}
 		if currentType.Name != "string" {
-			sa.addError("Type mismatch for argument '%s' in function '%s': expected %s, got %s. line:%d, column:%d",
-				e.Array.String(), e.Function.Value, "string", currentType.Name,
-				e.Array.Line(), e.Array.Column())
+			sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Array.Line(), e.Array.Column()), "Type mismatch for argument '%s' in function '%s': expected %s, got %s",
+				e.Array.String(), e.Function.Value, "string", currentType.Name)
 			return &TypeInfo{Name: "void"}
 		}
 	}
 	if expectedType.DataType.Name == "$n_arguments" {
 		isArgList = true
+		// un tableau seul: l'agrégat porte sur ses éléments
+		if currentType.IsArray && currentType.ElementType != nil && len(e.Arguments) == 0 {
+			currentType = currentType.ElementType
+		}
 		expectedType = &Symbol{Name: "", Type: ParameterSymbol, DataType: currentType}
-		if currentType.Name != "integer" && currentType.Name != "float" && currentType.Name != "string" {
-			sa.addError("Type mismatch for argument '%s' in function '%s': expected %s, got %s. line:%d, column:%d",
-				e.Array.String(), e.Function.Value, "integer or float", currentType.Name,
-				e.Array.Line(), e.Array.Column())
+		if currentType.Name != "integer" && currentType.Name != "float" && currentType.Name != "decimal" && currentType.Name != "string" {
+			sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Array.Line(), e.Array.Column()), "Type mismatch for argument '%s' in function '%s': expected %s, got %s",
+				e.Array.String(), e.Function.Value, "integer or float", currentType.Name)
 			return &TypeInfo{Name: "void"}
 		}
 	}
 	if !sa.areSameType(expectedType.DataType, currentType) {
-		sa.addError("Type mismatch for argument '%s' in function '%s': expected %s, got %s. line:%d, column:%d",
-			e.Array.String(), e.Function.Value, expectedType.DataType.Name, currentType.Name,
-			e.Function.Token.Line, e.Function.Token.Column)
+		sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "Type mismatch for argument '%s' in function '%s': expected %s, got %s",
+			e.Array.String(), e.Function.Value, expectedType.DataType.Name, currentType.Name)
 		return &TypeInfo{Name: "void"}
 	}
 	var exists bool
+	argTypes := make([]*TypeInfo, 0, len(e.Arguments))
 
 	for k, arg := range e.Arguments {
 		currentType = sa.visitExpression(arg)
+		argTypes = append(argTypes, currentType)
 		if !isArgList {
 			expectedType, exists = Scope.Symbols[args[k+1]]
 			if !exists {
-				sa.addError("The function '%s' does not have argument '%s'. line:%d, column:%d", e.Function.Value,
-					arg.String(), e.Function.Token.Line, e.Function.Token.Column)
+				sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "The function '%s' does not have argument '%s'",
+					e.Function.Value, arg.String())
 				continue
 			}
 		}
 		if !sa.areSameType(expectedType.DataType, currentType) {
-			sa.addError("Type mismatch for argument '%s' in function '%s': expected %s, got %s. line:%d, column:%d",
-				arg.String(), e.Function.Value, expectedType.DataType.Name, currentType.Name,
-				e.Function.Token.Line, e.Function.Token.Column)
+			sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "Type mismatch for argument '%s' in function '%s': expected %s, got %s",
+				arg.String(), e.Function.Value, expectedType.DataType.Name, currentType.Name)
 		}
 	}
 	sa.CurrentScope = oldScope
 	if _, ok := sa.TypFunct[lower(symbol.Name)]; ok {
 		return currentType
 	}
+	if kind, ok := sa.TypMap[lower(symbol.Name)]; ok {
+		return sa.visitMapFunction(e, kind, firstType, argTypes, symbol.DataType.clone())
+	}
+	if kind, ok := sa.TypLambda[lower(symbol.Name)]; ok {
+		return sa.visitLambdaFunction(e, kind, firstType, argTypes)
+	}
+	if kind, ok := sa.TypCursor[lower(symbol.Name)]; ok && firstType.IsArray {
+		if kind == "row" && firstType.ElementType != nil {
+			return firstType.ElementType.clone()
+		}
+		return firstType.clone()
+	}
 	if _, ok := sa.TypCast[lower(symbol.Name)]; ok {
 		if len(e.Arguments) > 0 && strings.EqualFold(symbol.Name, "parseinteger") {
 			dt := symbol.DataType.clone()
@@ -2939,13 +3297,159 @@ func (sa *SemanticAnalyzer) visitArrayFunctionCall(e *ast.ArrayFunctionCall) *Ty
 func (sa *SemanticAnalyzer) visitIdentifier(node *ast.Identifier) *TypeInfo {
 	symbol := sa.lookupSymbol(node.Value)
 	if symbol == nil {
-		sa.addError("Non declared identifier: %s line:%d, column:%d", node.Value, node.Token.Line,
-			node.Token.Column)
+		sa.addError(diagnostic.UndeclaredName, diagnostic.At(node.Token.Line, node.Token.Column), "Non declared identifier: %s",
+			node.Value)
 		return &TypeInfo{Name: "any"}
 	}
+	sa.reference(node, symbol, nil, symbol.DataType)
+	if fn, ok := symbol.Node.(*ast.FunctionStatement); ok && symbol.Type == FunctionSymbol {
+		return sa.signatureOf(symbol, fn)
+	}
 	return symbol.DataType.clone()
 }
 
+// signatureOf donne le type function(...) d'une fonction déclarée, passée comme valeur
+func (sa *SemanticAnalyzer) signatureOf(symbol *Symbol, fn *ast.FunctionStatement) *TypeInfo {
+	fi := &FuncInfo{Return: symbol.DataType.clone()}
+	scope := symbol.Scope.Children[symbol.Index]
+	for _, param := range fn.Parameters {
+		paramType := &TypeInfo{Name: "any"}
+		if p, ok := scope.Symbols[lower(param.Name.Value)]; ok && p.DataType != nil {
+			paramType = p.DataType.clone()
+		}
+		fi.Params = append(fi.Params, paramType)
+	}
+	return &TypeInfo{Name: "function", Function: fi}
+}
+
+// visitFunctionLiteral analyse une fonction anonyme: son corps voit les variables de la portée où elle est écrite
+func (sa *SemanticAnalyzer) visitFunctionLiteral(node *ast.FunctionLiteral) *TypeInfo {
+	returnType := &TypeInfo{Name: "void"}
+	if node.ReturnType != nil {
+		if rt := sa.resolveTypeAnnotation(node.ReturnType); rt != nil {
+			returnType = rt
+		}
+	}
+	funcScope := &Scope{
+		Parent:  sa.CurrentScope,
+		Symbols: make(map[string]*Symbol),
+	}
+	sa.CurrentScope.Children = append(sa.CurrentScope.Children, funcScope)
+	oldScope := sa.CurrentScope
+	sa.CurrentScope = funcScope
+
+	fi := &FuncInfo{Return: returnType.clone()}
+	for k, param := range node.Parameters {
+		paramType := sa.resolveTypeAnnotation(param.Type)
+		if paramType == nil {
+			paramType = &TypeInfo{Name: "any"}
+		}
+		sa.registerSymbol(param.Name.Value, ParameterSymbol, paramType, param, -1, k)
+		fi.Params = append(fi.Params, paramType.clone())
+	}
+	sa.visitBlockStatement(node.Body, returnType)
+	if returnType.Name != "void" && !sa.isControlFlowTerminated(node.Body.Statements) {
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Line(), node.Column()), "Anonymous function must return a value of type %s",
+			returnType.Name)
+	}
+	sa.CurrentScope = oldScope
+	return &TypeInfo{Name: "function", Function: fi}
+}
+
+// visitFunctionValueCall contrôle l'appel d'une variable ou d'un paramètre de type function(...)
+func (sa *SemanticAnalyzer) visitFunctionValueCall(e *ast.ArrayFunctionCall, fnType *TypeInfo) *TypeInfo {
+	args := e.Arguments
+	if e.Array != nil {
+		args = append([]ast.Expression{e.Array}, e.Arguments...)
+	}
+	if len(args) != len(fnType.Function.Params) {
+		sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "The function '%s' expects %d argument(s), but got %d",
+			e.Function.Value, len(fnType.Function.Params), len(args))
+		return fnType.Function.Return.clone()
+	}
+	for k, arg := range args {
+		argType := sa.visitExpression(arg)
+		if !sa.areSameType(fnType.Function.Params[k], argType) {
+			sa.addError(diagnostic.InvalidArguments, diagnostic.At(e.Function.Token.Line, e.Function.Token.Column), "Type mismatch for argument '%s' in function '%s': expected %s, got %s",
+				arg.String(), e.Function.Value, fnType.Function.Params[k].String(), argType.String())
+		}
+	}
+	return fnType.Function.Return.clone()
+}
+
+// visitLambdaFunction contrôle la signature de la fonction passée à map, filter, reduce, sort_by, any,
+// all et find d'après le type des éléments du tableau, et donne le type du résultat
+func (sa *SemanticAnalyzer) visitLambdaFunction(e *ast.ArrayFunctionCall, kind string, arrType *TypeInfo, argTypes []*TypeInfo) *TypeInfo {
+	elem := &TypeInfo{Name: "any"}
+	if arrType != nil && arrType.IsArray && arrType.ElementType != nil {
+		elem = arrType.ElementType.clone()
+	} else if arrType != nil && arrType.Name == "json" {
+		elem = &TypeInfo{Name: "json"}
+	}
+	var fn *FuncInfo
+	if len(argTypes) > 0 && argTypes[0] != nil {
+		fn = argTypes[0].Function
+	}
+	expected := &FuncInfo{Params: []*TypeInfo{elem}, Return: &TypeInfo{Name: "boolean"}}
+	switch kind {
+	case "map", "sort_by":
+		expected.Return = &TypeInfo{Name: "any"}
+	case "reduce":
+		acc := &TypeInfo{Name: "any"}
+		if len(argTypes) > 1 && argTypes[1] != nil && argTypes[1].Name != "null" {
+			acc = argTypes[1].clone()
+			acc.Constraints = nil
+		}
+		expected = &FuncInfo{Params: []*TypeInfo{acc, elem}, Return: acc}
+	}
+	if fn != nil && !sa.isSignatureCompatible(expected, fn) {
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.Arguments[0].Line(), e.Arguments[0].Column()), "Type mismatch for the function passed to '%s': expected %s, got %s",
+			e.Function.Value, (&TypeInfo{Name: "function", Function: expected}).String(), argTypes[0].String())
+	}
+	if fn != nil && kind == "sort_by" {
+		switch fn.Return.Name {
+		case "integer", "float", "decimal", "string", "date", "datetime", "time", "duration", "any", "json":
+		default:
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.Arguments[0].Line(), e.Arguments[0].Column()), "The function passed to 'sort_by' must return a comparable value, got %s",
+				fn.Return.String())
+		}
+	}
+	switch kind {
+	case "map":
+		result := &TypeInfo{Name: "any"}
+		if fn != nil {
+			result = fn.Return.clone()
+		}
+		return &TypeInfo{Name: "array", IsArray: true, ElementType: result}
+	case "filter", "sort_by":
+		return &TypeInfo{Name: "array", IsArray: true, ElementType: elem}
+	case "find":
+		return elem
+	case "reduce":
+		if fn != nil {
+			return fn.Return.clone()
+		}
+		return expected.Return.clone()
+	}
+	return &TypeInfo{Name: "boolean"}
+}
+
+// isSignatureCompatible vérifie qu'une fonction de signature fn peut être utilisée là où expected est attendue
+func (sa *SemanticAnalyzer) isSignatureCompatible(expected, fn *FuncInfo) bool {
+	if len(expected.Params) != len(fn.Params) {
+		return false
+	}
+	for k, param := range fn.Params {
+		if !sa.areTypesCompatibleEx(param, expected.Params[k]) {
+			return false
+		}
+	}
+	if expected.Return.Name == "void" {
+		return fn.Return.Name == "void"
+	}
+	return fn.Return.Name != "void" && sa.areTypesCompatibleEx(expected.Return, fn.Return)
+}
+
 func (sa *SemanticAnalyzer) visitTypeMember(node *ast.TypeMember, path string) *TypeInfo {
 	switch t := node.Left.(type) {
 	case *ast.Identifier:
@@ -2956,24 +3460,27 @@ func (sa *SemanticAnalyzer) visitTypeMember(node *ast.TypeMember, path string) *
 			for k := 0; k < len(tb); k++ {
 				l = sa.lookupSymbol(tb[k])
 				if l == nil {
-					sa.addError("Invalid field type name '%s'. Line:%d, column:%d", name, t.Line(), t.Column())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.At(t.Line(), t.Column()), "Invalid field type name '%s'", name)
 					return &TypeInfo{Name: "void"}
 				}
 			}
 			ta, exists := l.DataType.Fields[strings.ToLower(name)]
 			if !exists {
-				sa.addError("Field '%s' does not exist. line:%d, column:%d", t.String(),
-					t.Line(), t.Column())
+				sa.addError(diagnostic.UnknownName, diagnostic.At(t.Line(), t.Column()), "Field '%s' does not exist",
+					t.String())
 				return &TypeInfo{Name: "void"}
 			}
 			l = sa.lookupSymbol(strings.ToLower(ta.Name))
 		} else {
 			l = sa.lookupSymbol(name)
+			if l != nil {
+				sa.reference(t, l, nil, l.DataType)
+			}
 		}
 
 		if l == nil {
-			sa.addError("Non declared variable '%s'. line:%d, column:%d", t.String(),
-				node.Line(), node.Column())
+			sa.addError(diagnostic.UndeclaredName, diagnostic.At(node.Line(), node.Column()), "Non declared variable '%s'",
+				t.String())
 			return &TypeInfo{Name: "void"}
 		}
 		// if l.Type == DbObjectSymbol {
@@ -2985,10 +3492,11 @@ func (sa *SemanticAnalyzer) visitTypeMember(node *ast.TypeMember, path string) *
 			case *ast.Identifier:
 				ta, exists := l.DataType.Fields[strings.ToLower(node.Right.(*ast.Identifier).Value)]
 				if !exists {
-					sa.addError("Field '%s' does not exist. line:%d, column:%d", node.Right.String(),
-						node.Right.Line(), node.Right.Column())
+					sa.addError(diagnostic.UnknownName, diagnostic.At(node.Right.Line(), node.Right.Column()), "Field '%s' does not exist",
+						node.Right.String())
 					return &TypeInfo{Name: "void"}
 				}
+				sa.reference(node.Right.(*ast.Identifier), nil, l, ta)
 				return ta.clone()
 			case *ast.TypeMember:
 				if path == "" {
@@ -2998,20 +3506,20 @@ func (sa *SemanticAnalyzer) visitTypeMember(node *ast.TypeMember, path string) *
 				}
 				return sa.visitTypeMember(node.Right.(*ast.TypeMember), path)
 			case *ast.ArrayFunctionCall:
-				sa.addError("Invalid expression '%s'. line:%d, column:%d", node.Right.String(),
-					node.Right.Line(), node.Right.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Right.Line(), node.Right.Column()), "Invalid expression '%s'",
+					node.Right.String())
 				return &TypeInfo{Name: "void"}
 			default:
-				sa.addError("Invalid expression '%s'. line:%d, column:%d", node.Right.String(),
-					node.Right.Line(), node.Right.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Right.Line(), node.Right.Column()), "Invalid expression '%s'",
+					node.Right.String())
 				return &TypeInfo{Name: "void"}
 			}
 		}
 	case *ast.TypeMember:
 		return sa.visitTypeMember(t, path)
 	case *ast.ArrayFunctionCall:
-		sa.addError("Invalid expression '%s'. line:%d, column:%d", node.Left.String(),
-			node.Left.Line(), node.Left.Column())
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Left.Line(), node.Left.Column()), "Invalid expression '%s'",
+			node.Left.String())
 	case *ast.IndexExpression:
 		left := sa.visitIndexExpression(t)
 		if left.Fields != nil {
@@ -3019,15 +3527,15 @@ func (sa *SemanticAnalyzer) visitTypeMember(node *ast.TypeMember, path string) *
 			case *ast.Identifier:
 				return left.Fields[lower(r.Value)].clone()
 			default:
-				sa.addError("Invalid expression '%s'. line:%d, column:%d", node.Left.String(),
-					node.Left.Line(), node.Left.Column())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Left.Line(), node.Left.Column()), "Invalid expression '%s'",
+					node.Left.String())
 				return &TypeInfo{Name: "void"}
 			}
 		}
 		return left.clone()
 	default:
-		sa.addError("Invalid expression '%s'. line:%d, column:%d", node.Left.String(),
-			node.Left.Line(), node.Left.Column())
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Left.Line(), node.Left.Column()), "Invalid expression '%s'",
+			node.Left.String())
 	}
 	return &TypeInfo{Name: "void"}
 }
@@ -3035,48 +3543,56 @@ func (sa *SemanticAnalyzer) visitTypeExternalCall(node *ast.TypeExternalCall) *T
 	if node == nil {
 		return &TypeInfo{Name: "void"}
 	}
+	if node.Name != nil && node.Action != nil && node.Action.Function != nil {
+		if sym := sa.lookupSymbol(node.Name.Value); sym != nil && sym.Type == ModuleSymbol {
+			return sa.visitModuleCall(node, sym)
+		}
+	}
 	// check if the name is valid
 	if node.Name == nil {
-		sa.addError("Invlid microservice name.")
+		sa.addError(diagnostic.InvalidExpression, diagnostic.Span{}, "Invlid microservice name.")
 		return &TypeInfo{Name: "void"}
 	}
 	// check if the action is valid
 	if node.Action == nil || node.Action.Function == nil {
-		sa.addError("Invlid action name.")
+		sa.addError(diagnostic.InvalidExpression, diagnostic.Span{}, "Invlid action name.")
 		return &TypeInfo{Name: "void"}
 	}
 	// check if the microservice exists
-	if !sa.serviceExists(node.Name.Value) {
-		sa.addError("Microservice '%s' does not exist.", node.Name.Value)
+	if sa.serviceExists == nil || !sa.serviceExists(node.Name.Value) {
+		sa.addError(diagnostic.UnknownName, diagnostic.Span{}, "Microservice '%s' does not exist.", node.Name.Value)
 		return &TypeInfo{Name: "void"}
 	}
 	// call the Microservice to get the signature of the action
+	if sa.signature == nil {
+		sa.addError(diagnostic.SemanticError, diagnostic.Span{}, "Cannot get signature of action '%s' from microservice '%s'",
+			node.Action.Function.Value, node.Name.Value)
+		return &TypeInfo{Name: "void"}
+	}
 	ts, rt, err := sa.signature(sa.ctx, node.Name.Value, node.Action.Function.Value)
 	if err != nil {
-		sa.addError("Cannot get signature of action '%s' from microservice '%s': %s",
+		sa.addError(diagnostic.SemanticError, diagnostic.Span{}, "Cannot get signature of action '%s' from microservice '%s': %s",
 			node.Action.Function.Value, node.Name.Value, err.Error())
 		return &TypeInfo{Name: "void"}
 	}
 	if len(ts) != len(node.Action.Arguments)+1 {
-		sa.addError("The action '%s' from microservice '%s' expects %d argument(s), but got %d.",
+		sa.addError(diagnostic.InvalidArguments, diagnostic.Span{}, "The action '%s' from microservice '%s' expects %d argument(s), but got %d.",
 			node.Action.Function.Value, node.Name.Value, len(ts), len(node.Action.Arguments))
 		return &TypeInfo{Name: "void"}
 	}
 	currentType := sa.visitExpression(node.Action.Array)
 	expectedType := sa.visitStructField(ts[0])
 	if !sa.areSameType(expectedType, currentType) {
-		sa.addError("Type mismatch for array argument in action '%s' from microservice '%s': expected %s, got %s.",
-			node.Action.Function.Value, node.Name.Value,
-			expectedType.Name, currentType.Name)
+		sa.addError(diagnostic.InvalidArguments, diagnostic.Span{}, "Type mismatch for array argument in action '%s' from microservice '%s': expected %s, got %s.",
+			node.Action.Function.Value, node.Name.Value, expectedType.Name, currentType.Name)
 		return &TypeInfo{Name: "void"}
 	}
 	for k, arg := range node.Action.Arguments {
 		currentType := sa.visitExpression(arg)
 		expectedType := sa.visitStructField(ts[k+1])
 		if !sa.areSameType(expectedType, currentType) {
-			sa.addError("Type mismatch for argument '%s' in action '%s' from microservice '%s': expected %s, got %s.",
-				arg.String(), node.Action.Function.Value, node.Name.Value,
-				expectedType.Name, currentType.Name)
+			sa.addError(diagnostic.InvalidArguments, diagnostic.Span{}, "Type mismatch for argument '%s' in action '%s' from microservice '%s': expected %s, got %s.",
+				arg.String(), node.Action.Function.Value, node.Name.Value, expectedType.Name, currentType.Name)
 		}
 	}
 	// return the type of the action
@@ -3100,7 +3616,7 @@ func (sa *SemanticAnalyzer) visitArrayLiteral(node *ast.ArrayLiteral) *TypeInfo
 	for i, elem := range node.Elements {
 		elemType := sa.visitExpression(elem)
 		if !sa.areTypesCompatibleEx(firstType, elemType) {
-			sa.addError("Type incompatible dans le tableau à la position %d", i)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Type incompatible dans le tableau à la position %d", i)
 		}
 	}
 
@@ -3111,6 +3627,60 @@ func (sa *SemanticAnalyzer) visitArrayLiteral(node *ast.ArrayLiteral) *TypeInfo
 	}
 }
 
+func (sa *SemanticAnalyzer) visitMapLiteral(node *ast.MapLiteral) *TypeInfo {
+	if len(node.Pairs) == 0 {
+		return anyMap()
+	}
+	var keyType, valueType *TypeInfo
+	for i, pair := range node.Pairs {
+		kt := sa.visitExpression(pair.Key)
+		vt := sa.visitExpression(pair.Value)
+		if kt == nil || vt == nil {
+			return &TypeInfo{Name: "void"}
+		}
+		if _, ok := sa.TypeTable[lower(kt.Name)]; !ok || kt.Name == "any" {
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(pair.Key.Line(), pair.Key.Column()), "Invalid Key type %s", kt.String())
+			continue
+		}
+		if i == 0 {
+			// les contraintes des littéraux ne doivent pas limiter les éléments ajoutés ensuite
+			keyType, valueType = kt.clone(), vt.clone()
+			keyType.Constraints, valueType.Constraints = nil, nil
+			continue
+		}
+		if keyType != nil && !sa.areTypesCompatibleEx(keyType, kt) {
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(pair.Key.Line(), pair.Key.Column()), "Type mismatch for the key '%s': expected %s, got %s",
+				pair.Key.String(), keyType.Name, kt.Name)
+		}
+		if valueType != nil && !sa.areTypesCompatibleEx(valueType, vt) {
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(pair.Value.Line(), pair.Value.Column()), "Type mismatch for the value '%s': expected %s, got %s",
+				pair.Value.String(), valueType.Name, vt.Name)
+		}
+	}
+	if keyType == nil {
+		return &TypeInfo{Name: "void"}
+	}
+	return &TypeInfo{Name: "map", SetInfo: &SetInfo{Key: keyType, Value: valueType}}
+}
+
+// visitMapFunction contrôle la clé passée à has_key et delete et donne le type renvoyé par keys et values
+func (sa *SemanticAnalyzer) visitMapFunction(e *ast.ArrayFunctionCall, kind string, mapType *TypeInfo, argTypes []*TypeInfo, result *TypeInfo) *TypeInfo {
+	if mapType == nil || mapType.SetInfo == nil {
+		return result
+	}
+	switch kind {
+	case "keys":
+		return &TypeInfo{Name: "array", IsArray: true, ElementType: mapType.SetInfo.Key.clone()}
+	case "values":
+		return &TypeInfo{Name: "array", IsArray: true, ElementType: mapType.SetInfo.Value.clone()}
+	}
+	if len(argTypes) > 0 && argTypes[0] != nil && !sa.areTypesCompatible(mapType.SetInfo.Key, argTypes[0]) {
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(e.Arguments[0].Line(), e.Arguments[0].Column()), "Type mismatch for the key '%s' in function '%s': expected %s, got %s",
+			e.Arguments[0].String(), e.Function.Value, mapType.SetInfo.Key.Name, argTypes[0].Name)
+	}
+	return result
+}
+
 func (sa *SemanticAnalyzer) ifExists(node *ast.StructLiteral) *TypeInfo {
 	// keys := make([]string, 0)
 	oldScope := sa.CurrentScope
@@ -3147,6 +3717,9 @@ func (sa *SemanticAnalyzer) ifExists(node *ast.StructLiteral) *TypeInfo {
 	}
 
 	sa.CurrentScope = oldScope
+	if returnType == nil {
+		return nil
+	}
 	return returnType.clone()
 }
 
@@ -3160,8 +3733,8 @@ func (sa *SemanticAnalyzer) visitStructLiteral(node *ast.StructLiteral) *TypeInf
 	if node.Name != nil {
 		structType := sa.lookupSymbol(lower(node.Name.Value))
 		if structType == nil {
-			sa.addError("Type '%s' not declared. line:%d, column:%d", node.Name.Value,
-				node.Token.Line, node.Token.Column)
+			sa.addError(diagnostic.UndeclaredName, diagnostic.At(node.Token.Line, node.Token.Column), "Type '%s' not declared",
+				node.Name.Value)
 			return &TypeInfo{Name: "void"}
 		}
 		resultType = structType.DataType.clone()
@@ -3191,13 +3764,13 @@ func (sa *SemanticAnalyzer) visitStructLiteral(node *ast.StructLiteral) *TypeInf
 		}
 		expectedType, exists := resultType.Fields[lower(elem.Name.Value)]
 		if !exists {
-			sa.addError("Field '%s' does not exist in type '%s'. line:%d, column:%d",
-				elem.Name.Value, resultType.Name, elem.Name.Token.Line, elem.Name.Token.Column)
+			sa.addError(diagnostic.UnknownName, diagnostic.At(elem.Name.Token.Line, elem.Name.Token.Column), "Field '%s' does not exist in type '%s'",
+				elem.Name.Value, resultType.Name)
 			continue
 		}
 		if !sa.areTypesCompatible(expectedType, elemType) {
-			sa.addError("Type '%s' mismatch. line:%d, column:%d", elem.Name.Value,
-				elem.Name.Token.Line, elem.Name.Token.Column)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(elem.Name.Token.Line, elem.Name.Token.Column), "Type '%s' mismatch",
+				elem.Name.Value)
 		}
 	}
 	return resultType.clone()
@@ -3206,8 +3779,7 @@ func (sa *SemanticAnalyzer) visitStructLiteral(node *ast.StructLiteral) *TypeInf
 func (sa *SemanticAnalyzer) visitIifExpression(node *ast.IifExpression) *TypeInfo {
 	condType := sa.visitExpression(node.Condition)
 	if condType.Name != "boolean" {
-		sa.addError("Condition in IIF expression must be boolean. line:%d, column:%d",
-			node.Condition.Line(), node.Condition.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Condition.Line(), node.Condition.Column()), "Condition in IIF expression must be boolean")
 		return &TypeInfo{Name: "void"}
 	}
 	trueType := sa.visitExpression(node.TrueExpr)
@@ -3216,8 +3788,7 @@ func (sa *SemanticAnalyzer) visitIifExpression(node *ast.IifExpression) *TypeInf
 		return &TypeInfo{Name: "void"}
 	}
 	if !sa.areTypesCompatible(trueType, falseType) {
-		sa.addError("The true and false expressions in IIF must be of compatible types. line:%d, column:%d",
-			node.Line(), node.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Line(), node.Column()), "The true and false expressions in IIF must be of compatible types")
 		return &TypeInfo{Name: "void"}
 	}
 	return trueType
@@ -3226,14 +3797,14 @@ func (sa *SemanticAnalyzer) visitPrefixExpression(node *ast.PrefixExpression) *T
 	rightType := sa.visitExpression(node.Right)
 	switch node.Operator {
 	case "-", "+":
-		if rightType.Name == "integer" {
+		if rightType.Name == "integer" || rightType.Name == "decimal" {
 			return rightType
 		}
 		if rightType.Name == "float" ||
 			rightType.Name == "numeric" || rightType.Name == "decimal" {
 			return &TypeInfo{Name: "float", Constraints: rightType.Constraints}
 		}
-		sa.addError("'%s' non supported operation on %s",
+		sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "'%s' non supported operation on %s",
 			node.Operator, rightType.Name)
 	case "not":
 		if rightType.Name == "boolean" {
@@ -3246,7 +3817,7 @@ func (sa *SemanticAnalyzer) visitPrefixExpression(node *ast.PrefixExpression) *T
 	case "object":
 		return &TypeInfo{Name: "table"}
 	default:
-		sa.addError("'%s' non supported operation on %s",
+		sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "'%s' non supported operation on %s",
 			node.Operator, rightType.Name)
 	}
 
@@ -3260,6 +3831,9 @@ func (sa *SemanticAnalyzer) rightTypeForPlus(leftType *TypeInfo, rightType *Type
 	if rightType == nil {
 		return leftType
 	}
+	if res := decimalResult(leftType, rightType); res != nil {
+		return res
+	}
 
 	if (leftType.Name == "date" || leftType.Name == "datetime" || leftType.Name == "time") && rightType.Name == "duration" {
 		return leftType
@@ -3296,7 +3870,21 @@ func (sa *SemanticAnalyzer) rightTypeForPlus(leftType *TypeInfo, rightType *Type
 	}
 	return nil
 }
+
+// decimalResult type une opération entre un decimal et un nombre: le résultat est un decimal
+func decimalResult(leftType, rightType *TypeInfo) *TypeInfo {
+	isNumber := func(t *TypeInfo) bool {
+		return !t.IsArray && (t.Name == "integer" || t.Name == "float" || t.Name == "decimal")
+	}
+	if (leftType.Name == "decimal" || rightType.Name == "decimal") && isNumber(leftType) && isNumber(rightType) {
+		return &TypeInfo{Name: "decimal"}
+	}
+	return nil
+}
 func (sa *SemanticAnalyzer) rightTypeForTimesDivide(leftType *TypeInfo, rightType *TypeInfo, op string) *TypeInfo {
+	if res := decimalResult(leftType, rightType); res != nil {
+		return res
+	}
 	if leftType.Name == "duration" && (rightType.Name == "integer" || rightType.Name == "float") {
 		return leftType
 	}
@@ -3399,7 +3987,7 @@ func (sa *SemanticAnalyzer) getConstraint(leftType *TypeInfo, rightType *TypeInf
 			}
 			ok = true
 		}
-		if lc.Range != nil && rc.Range == nil {
+		if rc.Range == nil {
 			if ok {
 				return rightType
 			}
@@ -3459,7 +4047,7 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 		if leftType.Name == "integer" && rightType.Name == "integer" {
 			return sa.getConstraint(leftType, rightType)
 		}
-		sa.addError("Non supported operation '%s' between %s and %s",
+		sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Non supported operation '%s' between %s and %s",
 			node.Operator, leftType.Name, rightType.Name)
 	case "+":
 		res := sa.rightTypeForPlus(leftType, rightType, node.Operator)
@@ -3469,14 +4057,14 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 				node.Operator == "+" {
 				return leftType
 			}
-			sa.addError("Non supported operation '%s' between %s and %s",
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Non supported operation '%s' between %s and %s",
 				node.Operator, leftType.Name, rightType.Name)
 		}
 		return res
 	case "-":
 		res := sa.rightTypeForMinus(leftType, rightType)
 		if res == nil {
-			sa.addError("Non supported operation '%s' between %s and %s",
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Non supported operation '%s' between %s and %s",
 				node.Operator, leftType.Name, rightType.Name)
 		}
 		return res
@@ -3484,7 +4072,7 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 		// Duration * Number = Duration
 		res := sa.rightTypeForTimesDivide(leftType, rightType, node.Operator)
 		if res == nil {
-			sa.addError("Non supported '%s' operation between %s and %s",
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Non supported '%s' operation between %s and %s",
 				node.Operator, leftType.Name, rightType.Name)
 		}
 		return res
@@ -3495,13 +4083,13 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 		}
 		// Comparaisons Date/Time + Duration
 		if (leftType.Name == "date" || leftType.Name == "time") && rightType.Name == "duration" {
-			sa.addWarning("Comparison Date/Time with Duration - implicite conversion")
+			sa.addWarning(diagnostic.SemanticError, diagnostic.Span{}, "Comparison Date/Time with Duration - implicite conversion")
 			return &TypeInfo{Name: "boolean"}
 		}
 
 		// Opérations de comparaison
 		if !sa.areTypesCompatibleEx(leftType, rightType) {
-			sa.addError("Non authorize comparision between %s and %s",
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Non authorize comparision between %s and %s",
 				leftType.String(), rightType.String())
 			return &TypeInfo{Name: "void"}
 		}
@@ -3509,7 +4097,7 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 	case "and", "or":
 		// Opérations booléennes
 		if leftType.Name != "boolean" || rightType.Name != "boolean" {
-			sa.addError("Operation '%s' requires booleans", node.Operator)
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Operation '%s' requires booleans", node.Operator)
 		}
 		return &TypeInfo{Name: "boolean"}
 	case "??":
@@ -3517,7 +4105,7 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 			if strings.EqualFold(leftType.Name, rightType.Name) {
 				return rightType
 			}
-			sa.addError("Type mismatch: %s and %s", leftType.String(), rightType.String())
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Type mismatch: %s and %s", leftType.String(), rightType.String())
 			return &TypeInfo{Name: "void"}
 		}
 		return leftType
@@ -3532,7 +4120,7 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 	case "||":
 		if leftType.IsArray && rightType.IsArray {
 			if !sa.areTypesCompatible(leftType.ElementType, rightType.ElementType) {
-				sa.addError("Impossible to concat arrays because of type mismatch: %s and %s",
+				sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Impossible to concat arrays because of type mismatch: %s and %s",
 					leftType.ElementType.Name, rightType.ElementType.Name)
 				return &TypeInfo{Name: "void"}
 			}
@@ -3540,47 +4128,71 @@ func (sa *SemanticAnalyzer) visitInfixExpression(node *ast.InfixExpression) *Typ
 		}
 		// Opérations de concaténation de chaînes
 		if leftType.Name != "string" || rightType.Name != "string" {
-			sa.addError("invalid operation. Both operands of '||' must have the same type (string, array). got %s and %s",
+			sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "invalid operation. Both operands of '||' must have the same type (string, array). got %s and %s",
 				leftType.Name, rightType.Name)
 			return &TypeInfo{Name: "void"}
 		}
 		return &TypeInfo{Name: "string"}
 	default:
-		sa.addError("Opérateur inconnu: %s. Line:%d, column:%d", node.Operator,
-			node.Token.Line, node.Token.Column)
+		sa.addError(diagnostic.UnknownName, diagnostic.At(node.Token.Line, node.Token.Column), "Opérateur inconnu: %s",
+			node.Operator)
 	}
 	return &TypeInfo{Name: "any"}
 }
 
+// visitJSONPath type un chemin j.$.a[0]: seule une valeur json se parcourt ainsi, avec des index entiers ou chaînes
+func (sa *SemanticAnalyzer) visitJSONPath(node *ast.JSONPathExpression) *TypeInfo {
+	leftType := sa.visitExpression(node.Left)
+	if leftType == nil {
+		return nil
+	}
+	if leftType.Name != "json" && leftType.Name != "any" {
+		sa.addError(diagnostic.InvalidExpression, diagnostic.At(node.Token.Line, node.Token.Column), "Invalid json path: '%s' is %s, not json",
+			node.Left.String(), leftType.String())
+		return &TypeInfo{Name: "void"}
+	}
+	for _, step := range node.Steps {
+		if step.Index == nil {
+			continue
+		}
+		indexType := sa.visitExpression(step.Index)
+		if indexType != nil && indexType.Name != "integer" && indexType.Name != "string" &&
+			indexType.Name != "json" && indexType.Name != "any" {
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(step.Index.Line(), step.Index.Column()), "Type mismatch: a json path index must be an integer or a string, got %s",
+				indexType.Name)
+		}
+	}
+	return &TypeInfo{Name: "json"}
+}
+
 func (sa *SemanticAnalyzer) visitIndexExpression(node *ast.IndexExpression) *TypeInfo {
 	leftType := sa.visitExpression(node.Left)
 	indexType := sa.visitExpression(node.Index)
 	if leftType == nil {
-		sa.addError("Non declared variable '%s'. line:%d, column:%d", node.Left.String(),
-			node.Left.Line(), node.Left.Column())
+		sa.addError(diagnostic.UndeclaredName, diagnostic.At(node.Left.Line(), node.Left.Column()), "Non declared variable '%s'",
+			node.Left.String())
 		return &TypeInfo{Name: "void"}
 	}
 	if leftType.SetInfo != nil {
 		if !sa.areTypesCompatible(leftType.SetInfo.Key, indexType) {
-			sa.addError("Type mismatch: expected %s, got %s. line:%d, column:%d",
-				leftType.SetInfo.Key.Name, indexType.Name, node.Token.Line, node.Token.Column)
-			return &TypeInfo{Name: "void"}
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "Type mismatch: expected %s, got %s",
+				leftType.SetInfo.Key.Name, indexType.Name)
 		}
 		return leftType.SetInfo.Value
 	}
 
 	if indexType.Name != "integer" {
-		sa.addError("Index must be an integer. line:%d, column:%d", node.Index.Line(), node.Index.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Index.Line(), node.Index.Column()), "Index must be an integer")
 		return &TypeInfo{Name: "void"}
 	}
 	if !leftType.IsArray {
-		sa.addError("The variable '%s' is not an array. line:%d, column:%d", node.Left.String(),
-			node.Left.Line(), node.Left.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Left.Line(), node.Left.Column()), "The variable '%s' is not an array",
+			node.Left.String())
 		return &TypeInfo{Name: "void"}
 	}
 	if leftType.ElementType == nil {
-		sa.addError("The variable '%s' has no element type. line:%d, column:%d", node.Left.String(),
-			node.Left.Line(), node.Left.Column())
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Left.Line(), node.Left.Column()), "The variable '%s' has no element type",
+			node.Left.String())
 		return &TypeInfo{Name: "void"}
 	}
 	return leftType.ElementType
@@ -3600,10 +4212,18 @@ func (sa *SemanticAnalyzer) visitInExpression(node *ast.InExpression) *TypeInfo
 	if rightType.Name == "string" && sa.areTypesCompatibleEx(leftType, rightType) {
 		return &TypeInfo{Name: "boolean"}
 	}
+	if rightType.Name == "map" && rightType.SetInfo != nil {
+		if !sa.areTypesCompatibleEx(rightType.SetInfo.Key, leftType) {
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Left.Line(), node.Left.Column()), "Type '%s' mismatch for IN",
+				leftType.Name)
+			return &TypeInfo{Name: "void"}
+		}
+		return &TypeInfo{Name: "boolean"}
+	}
 
 	if !rightType.IsArray {
-		sa.addError("'%s' must be an array type in IN operation. line:%d, column:%d",
-			node.Right.String(), node.Right.Line(), node.Right.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Right.Line(), node.Right.Column()), "'%s' must be an array type in IN operation",
+			node.Right.String())
 		return &TypeInfo{Name: "void"}
 	}
 	if isSelect && len(rightType.ElementType.Fields) == 1 {
@@ -3612,16 +4232,16 @@ func (sa *SemanticAnalyzer) visitInExpression(node *ast.InExpression) *TypeInfo
 			ok = sa.areTypesCompatible(leftType, v)
 		}
 		if !ok {
-			sa.addError("Type '%s' mismatch for IN. line:%d, column:%d",
-				leftType.Name, node.Left.Line(), node.Left.Column())
+			sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Left.Line(), node.Left.Column()), "Type '%s' mismatch for IN",
+				leftType.Name)
 			return &TypeInfo{Name: "void"}
 
 		}
 		return &TypeInfo{Name: "boolean"}
 	}
 	if !sa.areTypesCompatibleEx(leftType, rightType.ElementType) {
-		sa.addError("Type '%s' mismatch for IN. line:%d, column:%d",
-			leftType.Name, node.Left.Line(), node.Left.Column())
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Left.Line(), node.Left.Column()), "Type '%s' mismatch for IN",
+			leftType.Name)
 		return &TypeInfo{Name: "void"}
 	}
 	return &TypeInfo{Name: "boolean"}
@@ -3639,7 +4259,7 @@ func (sa *SemanticAnalyzer) visitIsExpression(node *ast.IsExpression) *TypeInfo
 	}
 	// Comparaisons Date/Time + Duration
 	if (leftType.Name == "date" || leftType.Name == "time") && rightType.Name == "duration" {
-		sa.addWarning("Comparison Date/Time with Duration - implicite conversion")
+		sa.addWarning(diagnostic.SemanticError, diagnostic.Span{}, "Comparison Date/Time with Duration - implicite conversion")
 		return &TypeInfo{Name: "boolean"}
 	}
 	if leftType.Name == "null" && rightType.Name != "null" {
@@ -3647,7 +4267,7 @@ func (sa *SemanticAnalyzer) visitIsExpression(node *ast.IsExpression) *TypeInfo
 	}
 	// Opérations de comparaison
 	if !sa.areTypesCompatibleEx(leftType, rightType) {
-		sa.addError("Non authorize comparision between %s and %s",
+		sa.addError(diagnostic.TypeMismatch, diagnostic.Span{}, "Non authorize comparision between %s and %s",
 			leftType.String(), rightType.String())
 		return &TypeInfo{Name: "void"}
 	}
@@ -3660,41 +4280,24 @@ func (sa *SemanticAnalyzer) formType(col *sql.ColumnType) *TypeInfo {
 	}
 
 	tab := strings.Split(col.DatabaseTypeName(), "(")
-	s := tab[0]
-	s = strings.ReplaceAll(lower(s), "nvarchar2", "string")
-	s = strings.ReplaceAll(s, "nvarchar", "string")
-	s = strings.ReplaceAll(s, "varchar2", "string")
-	s = strings.ReplaceAll(s, "varchar", "string")
-	s = strings.ReplaceAll(s, "ntext", "string")
-	s = strings.ReplaceAll(s, "text", "string")
-	s = strings.ReplaceAll(s, "longtext", "string")
-	s = strings.ReplaceAll(s, "mediumtext", "string")
-	s = strings.ReplaceAll(s, "number", "integer")
-	s = strings.ReplaceAll(s, "int", "integer")
-	s = strings.ReplaceAll(s, "tinyint", "integer")
-	s = strings.ReplaceAll(s, "mediumint", "integer")
-	s = strings.ReplaceAll(s, "bigint", "integer")
-	s = strings.ReplaceAll(s, "decimal", "float")
-	s = strings.ReplaceAll(s, "numeric", "float")
-	s = strings.ReplaceAll(s, "double", "float")
-	s = strings.ReplaceAll(s, "blob", "string")
-	switch s {
-	case "int2", "integer2":
+	s, size := object.ActionType(tab[0])
+	switch size {
+	case 2:
 		return &TypeInfo{Name: "integer", Constraints: &Constraint{Length: 5, Scale: -1, Precision: -1,
 			Range: &RangeValue{Min: -32768, Max: +32767}}}
-	case "int4", "integer4":
+	case 4:
 		return &TypeInfo{Name: "integer", Constraints: &Constraint{Length: 10, Scale: -1, Precision: -1,
 			Range: &RangeValue{Min: -2147483648, Max: +2147483647}}}
-	case "int8", "integer8":
+	case 8:
 		return &TypeInfo{Name: "integer", Constraints: &Constraint{Length: 19, Scale: -1, Precision: -1,
 			Range: &RangeValue{Min: -9223372036854775808, Max: +9223372036854775807}}}
+	}
+	switch s {
 	case "string":
 		if length, ok := col.Length(); ok {
 			return &TypeInfo{Name: "string", Constraints: &Constraint{Length: length, Scale: -1, Precision: -1, Range: nil}}
 			// fmt.Sprintf("%s(%d)", s, length)
 		}
-	case "name":
-		return &TypeInfo{Name: "string"}
 	}
 
 	result := &TypeInfo{Name: s}
@@ -3706,13 +4309,13 @@ func (sa *SemanticAnalyzer) formType(col *sql.ColumnType) *TypeInfo {
 			i, er := strconv.ParseInt(tb[0], 10, 64)
 			if er == nil {
 				switch s {
-				case "integer", "float":
+				case "integer", "float", "decimal":
 					result.Constraints.Precision = i
 				case "string":
 					result.Constraints.Length = i
 				default:
 					result.Constraints = nil
-					sa.addError("Invalid constrants '%s'", col.DatabaseTypeName())
+					sa.addError(diagnostic.InvalidExpression, diagnostic.Span{}, "Invalid constrants '%s'", col.DatabaseTypeName())
 				}
 			}
 			return result
@@ -3721,12 +4324,12 @@ func (sa *SemanticAnalyzer) formType(col *sql.ColumnType) *TypeInfo {
 		sc, er2 := strconv.ParseInt(tb[1], 10, 64)
 		if er1 == nil && er2 == nil {
 			switch s {
-			case "float", "float2", "float4", "float8":
+			case "float", "decimal":
 				result.Constraints.Precision = pr
 				result.Constraints.Scale = sc
 			default:
 				result.Constraints = nil
-				sa.addError("Invalid constrants '%s'", col.DatabaseTypeName())
+				sa.addError(diagnostic.InvalidExpression, diagnostic.Span{}, "Invalid constrants '%s'", col.DatabaseTypeName())
 			}
 		}
 	}
@@ -3739,7 +4342,11 @@ func (sa *SemanticAnalyzer) resolveTypeFromTableName(name string) *TypeInfo {
 		return sym.DataType.clone()
 	}
 	if f, m := sa.canHandle(sa.ctx, name, "", "read", sa.mode); !f {
-		sa.addError("%s", m)
+		sa.addDenied(diagnostic.Span{}, m)
+		return nil
+	}
+	if sa.db == nil {
+		sa.addError(diagnostic.UnknownName, diagnostic.Span{}, "Object '%s' does not exist: no database is available", name)
 		return nil
 	}
 	strSQL := fmt.Sprintf("SELECT * FROM %s LIMIT 1", name)
@@ -3754,7 +4361,7 @@ func (sa *SemanticAnalyzer) resolveTypeFromTableName(name string) *TypeInfo {
 		// rows, err = sa.db.Query(strSQL)
 	}
 	if err != nil || rows == nil {
-		sa.addError("Object '%s' does not exist", name)
+		sa.addError(diagnostic.UnknownName, diagnostic.Span{}, "Object '%s' does not exist", name)
 		return nil
 	}
 	defer rows.Close()
@@ -3816,6 +4423,10 @@ func getValue(e ast.Expression) any {
 	if v, o := e.(*ast.FloatLiteral); o {
 		return v.Value
 	}
+	if v, o := e.(*ast.DecimalLiteral); o {
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	}
 	if v, o := e.(*ast.DateTimeLiteral); o {
 		return v.Value
 	}
@@ -3849,6 +4460,7 @@ func (sa *SemanticAnalyzer) resolveTypeAnnotation(ta *ast.TypeAnnotation) *TypeI
 			Token:       ta.ArrayType.ElementType.Token,
 			Type:        ta.ArrayType.ElementType.Type,
 			Constraints: ta.ArrayType.ElementType.Constraints,
+			MapType:     ta.ArrayType.ElementType.MapType,
 		})
 		return &TypeInfo{
 			Name:        "array",
@@ -3857,27 +4469,59 @@ func (sa *SemanticAnalyzer) resolveTypeAnnotation(ta *ast.TypeAnnotation) *TypeI
 			ElementType: elementType,
 		}
 	}
+	if ta.MapType != nil {
+		key := sa.resolveTypeAnnotation(ta.MapType.Key)
+		if key == nil {
+			return nil
+		}
+		if _, ok := sa.TypeTable[lower(key.Name)]; !ok || key.Name == "any" || key.Name == "json" {
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(ta.MapType.Key.Token.Line, ta.MapType.Key.Token.Column), "Invalid Key type %s",
+				ta.MapType.Key.String())
+			return nil
+		}
+		value := sa.resolveTypeAnnotation(ta.MapType.Value)
+		if value == nil {
+			return nil
+		}
+		return &TypeInfo{Name: "map", SetInfo: &SetInfo{Key: key, Value: value}}
+	}
+	if ta.FuncType != nil {
+		fi := &FuncInfo{Return: &TypeInfo{Name: "void"}}
+		for _, param := range ta.FuncType.Parameters {
+			paramType := sa.resolveTypeAnnotation(param)
+			if paramType == nil {
+				return nil
+			}
+			fi.Params = append(fi.Params, paramType)
+		}
+		if ta.FuncType.ReturnType != nil {
+			if fi.Return = sa.resolveTypeAnnotation(ta.FuncType.ReturnType); fi.Return == nil {
+				return nil
+			}
+		}
+		return &TypeInfo{Name: "function", Function: fi}
+	}
 	if ta.SetType != nil {
 		if ta.SetType.Key == nil || ta.SetType.Value == nil {
-			sa.addError("Invalid Set declaration %s. line:%d, column:%d", ta.SetType.Token,
-				ta.SetType.Token.Line, ta.SetType.Token.Column)
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(ta.SetType.Token.Line, ta.SetType.Token.Column), "Invalid Set declaration %s",
+				ta.SetType.Token.Literal)
 			return nil
 		}
 		set := &SetInfo{}
 		set.Key = sa.resolveTypeAnnotation(ta.SetType.Key)
 		if set.Key == nil {
-			sa.addError("Invalid Key type %s. line:%d, column:%d", ta.SetType.Key.String(),
-				ta.SetType.Key.Token.Line, ta.SetType.Key.Token.Column)
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(ta.SetType.Key.Token.Line, ta.SetType.Key.Token.Column), "Invalid Key type %s",
+				ta.SetType.Key.String())
 			return nil
 		}
-		if _, ok := sa.TypeTable[lower(set.Key.Name)]; !ok || strings.EqualFold(set.Key.Name, "any") {
-			sa.addError("Invalid Key type %s. line:%d, column:%d", set.Key.Name, ta.SetType.Key.Token.Line, ta.SetType.Key.Token.Column)
+		if _, ok := sa.TypeTable[lower(set.Key.Name)]; !ok || strings.EqualFold(set.Key.Name, "any") || strings.EqualFold(set.Key.Name, "json") {
+			sa.addError(diagnostic.InvalidExpression, diagnostic.At(ta.SetType.Key.Token.Line, ta.SetType.Key.Token.Column), "Invalid Key type %s", set.Key.Name)
 			return nil
 		}
 
 		set.Value = sa.resolveTypeAnnotation(ta.SetType.Value)
 		if set.Value == nil {
-			sa.addError("Invalid Value type %s", ta.Type)
+			sa.addError(diagnostic.InvalidExpression, diagnostic.Span{}, "Invalid Value type %s", ta.Type)
 			return nil
 		}
 
@@ -3904,7 +4548,7 @@ func (sa *SemanticAnalyzer) resolveTypeAnnotation(ta *ast.TypeAnnotation) *TypeI
 	}
 
 	// Type inconnu
-	sa.addError("Unknown type %s", ta.Type)
+	sa.addError(diagnostic.UnknownName, diagnostic.Span{}, "Unknown type %s", ta.Type)
 	return nil
 }
 func lower(s string) string {
@@ -3918,13 +4562,13 @@ func (sa *SemanticAnalyzer) getArraySize(size *ast.IntegerLiteral) int64 {
 }
 func (sa *SemanticAnalyzer) areTypesConstraintsCompatible(t1, t2 *TypeInfo) bool {
 	var c1, c2 *Constraint
-	if t1==nil && t2==nil {
+	if t1 == nil && t2 == nil {
 		return true
-	}	
-	if t1==nil && t2!=nil {
+	}
+	if t1 == nil && t2 != nil {
 		return false
 	}
-	if t1!=nil && t2==nil {
+	if t1 != nil && t2 == nil {
 		return false
 	}
 	if t1.Name != t2.Name {
@@ -3970,9 +4614,16 @@ func (sa *SemanticAnalyzer) areTypesConstraintsCompatible(t1, t2 *TypeInfo) bool
 	return res
 }
 func (sa *SemanticAnalyzer) areTypesCompatible(t1, t2 *TypeInfo) bool {
-	if t1.Name == "any" || t2.Name == "any" {
+	// un type inconnu a déjà été signalé là où il devait être déterminé
+	if t1 == nil || t2 == nil {
 		return true
 	}
+	if t1.Name == "any" || t2.Name == "any" || t1.Name == "json" || t2.Name == "json" {
+		return true
+	}
+	if t1.Function != nil && t2.Function != nil {
+		return sa.isSignatureCompatible(t1.Function, t2.Function)
+	}
 	if t1.Name == "base" {
 		_, ok := sa.TypeTable[lower(t2.Name)]
 		return ok && !strings.EqualFold(t2.Name, "any")
@@ -3986,6 +4637,9 @@ func (sa *SemanticAnalyzer) areTypesCompatible(t1, t2 *TypeInfo) bool {
 		return true
 	}
 
+	if t1.Name == "map" && t2.Name == "map" && t1.SetInfo != nil && t2.SetInfo != nil {
+		return sa.areTypesCompatible(t1.SetInfo.Key, t2.SetInfo.Key) && sa.areTypesCompatible(t1.SetInfo.Value, t2.SetInfo.Value)
+	}
 	if t1.IsArray && t2.IsArray {
 		return sa.areTypesCompatible(t1.ElementType, t2.ElementType)
 	}
@@ -4000,6 +4654,9 @@ func (sa *SemanticAnalyzer) areTypesCompatible(t1, t2 *TypeInfo) bool {
 	if t1.Name == "string" && t2.Name == "string" {
 		return sa.areTypesConstraintsCompatible(t1, t2)
 	}
+	if decimalResult(t1, t2) != nil {
+		return true
+	}
 	if t1.Name == "integer" && t2.Name == "float" {
 		return true
 	}
@@ -4017,10 +4674,43 @@ func (sa *SemanticAnalyzer) areTypesCompatible(t1, t2 *TypeInfo) bool {
 	}
 	return t1.Name == t2.Name
 }
+
+// isSelectCompatible vérifie qu'un SELECT peut être lu dans une variable de type target (array of ...):
+// chaque colonne doit correspondre à un champ de la structure, ou l'unique colonne au type simple
+func (sa *SemanticAnalyzer) isSelectCompatible(value ast.Expression, target, rows *TypeInfo) bool {
+	switch value.(type) {
+	case *ast.SQLSelectStatement, *ast.SQLWithStatement:
+	default:
+		return false
+	}
+	if target == nil || !target.IsArray || target.ElementType == nil ||
+		rows == nil || !rows.IsArray || rows.ElementType == nil {
+		return false
+	}
+	elem := target.ElementType
+	if len(elem.Fields) == 0 {
+		if len(rows.ElementType.Fields) != 1 {
+			return false
+		}
+		for _, col := range rows.ElementType.Fields {
+			return sa.areTypesCompatibleEx(elem, col)
+		}
+	}
+	for name, col := range rows.ElementType.Fields {
+		field, ok := elem.Fields[name]
+		if !ok || !sa.areTypesCompatibleEx(field, col) {
+			return false
+		}
+	}
+	return true
+}
 func (sa *SemanticAnalyzer) areTypesCompatibleEx(t1, t2 *TypeInfo) bool {
-	if t1.Name == "any" || t2.Name == "any" {
+	if t1.Name == "any" || t2.Name == "any" || t1.Name == "json" || t2.Name == "json" {
 		return true
 	}
+	if t1.Function != nil && t2.Function != nil {
+		return sa.isSignatureCompatible(t1.Function, t2.Function)
+	}
 	if t1.Name == "base" {
 		_, ok := sa.TypeTable[lower(t2.Name)]
 		return ok && !strings.EqualFold(t2.Name, "any")
@@ -4034,6 +4724,9 @@ func (sa *SemanticAnalyzer) areTypesCompatibleEx(t1, t2 *TypeInfo) bool {
 		return true
 	}
 
+	if t1.Name == "map" && t2.Name == "map" && t1.SetInfo != nil && t2.SetInfo != nil {
+		return sa.areTypesCompatibleEx(t1.SetInfo.Key, t2.SetInfo.Key) && sa.areTypesCompatibleEx(t1.SetInfo.Value, t2.SetInfo.Value)
+	}
 	if t1.IsArray && t2.IsArray {
 		return sa.areTypesCompatibleEx(t1.ElementType, t2.ElementType)
 	}
@@ -4051,6 +4744,9 @@ func (sa *SemanticAnalyzer) areTypesCompatibleEx(t1, t2 *TypeInfo) bool {
 		// return sa.areTypesConstraintsCompatible(t1, t2)
 		return true
 	}
+	if decimalResult(t1, t2) != nil {
+		return true
+	}
 	if t1.Name == "integer" && t2.Name == "float" {
 		return true
 	}
@@ -4070,9 +4766,12 @@ func (sa *SemanticAnalyzer) areTypesCompatibleEx(t1, t2 *TypeInfo) bool {
 }
 
 func (sa *SemanticAnalyzer) areSameType(t1, t2 *TypeInfo) bool {
-	if t1.Name == "any" || t2.Name == "any" {
+	if t1.Name == "any" || t2.Name == "any" || t1.Name == "json" || t2.Name == "json" {
 		return true
 	}
+	if t1.Function != nil && t2.Function != nil {
+		return sa.isSignatureCompatible(t1.Function, t2.Function)
+	}
 
 	if t1.IsArray && t2.IsArray {
 		return sa.areSameType(t1.ElementType, t2.ElementType)
@@ -4081,6 +4780,13 @@ func (sa *SemanticAnalyzer) areSameType(t1, t2 *TypeInfo) bool {
 	if t1.Name == "float" && t2.Name == "integer" {
 		return true
 	}
+	// la précision et l'échelle d'un decimal sont vérifiées à l'exécution, après arrondi
+	if t1.Name == "decimal" && (t2.Name == "integer" || t2.Name == "float" || t2.Name == "decimal") {
+		return true
+	}
+	if t1.Name == "datetime" && t2.Name == "date" {
+		return true
+	}
 	return t1.Name == t2.Name && sa.areTypesConstraintsCompatible(t1, t2)
 }
 
@@ -4116,6 +4822,18 @@ func (sa *SemanticAnalyzer) registerSymbol(name string, symType SymbolType, data
 		NoOrder:  noOrder,
 	}
 	sa.CurrentScope.Symbols[lower(name)] = symbol
+	if id := symbol.Declaration(); id != nil {
+		sa.reference(id, symbol, nil, dataType)
+	}
+}
+
+// reference mémorise l'occurrence de id; symbol ou owner peut être nil
+func (sa *SemanticAnalyzer) reference(id *ast.Identifier, symbol, owner *Symbol, dataType *TypeInfo) {
+	if id == nil || id.Token.Line == 0 {
+		return
+	}
+	sa.References = append(sa.References, Reference{Name: id.Value, Line: id.Token.Line, Column: id.Token.Column,
+		Symbol: symbol, Owner: owner, Type: dataType})
 }
 
 func (sa *SemanticAnalyzer) registerTempoSymbols(names []string) {
@@ -4139,25 +4857,56 @@ func (sa *SemanticAnalyzer) registerTempoSymbols(names []string) {
 	}
 }
 
-func (sa *SemanticAnalyzer) addError(format string, args ...interface{}) {
-	sa.Errors = append(sa.Errors, fmt.Sprintf(format, args...))
+// addError signale une erreur à l'emplacement span; Errors en garde la forme textuelle
+func (sa *SemanticAnalyzer) addError(code string, span diagnostic.Span, format string, args ...interface{}) {
+	sa.add(diagnostic.Error, code, span, fmt.Sprintf(format, args...))
 }
 
-func (sa *SemanticAnalyzer) addWarning(format string, args ...interface{}) {
-	sa.Warnings = append(sa.Warnings, fmt.Sprintf(format, args...))
+func (sa *SemanticAnalyzer) addWarning(code string, span diagnostic.Span, format string, args ...interface{}) {
+	sa.add(diagnostic.Warning, code, span, fmt.Sprintf(format, args...))
+}
+
+// addDenied signale une opération refusée par canHandle
+func (sa *SemanticAnalyzer) addDenied(span diagnostic.Span, msg string) {
+	sa.add(diagnostic.Error, diagnostic.NotAllowed, span, msg)
+}
+
+func (sa *SemanticAnalyzer) add(severity diagnostic.Severity, code string, span diagnostic.Span, msg string) {
+	d := diagnostic.Diagnostic{Code: code, Severity: severity, Source: diagnostic.Semantic, Message: msg, Span: span}
+	if severity == diagnostic.Error {
+		sa.Errors = append(sa.Errors, d.String())
+	} else {
+		sa.Warnings = append(sa.Warnings, d.String())
+	}
+	sa.Diagnostics = append(sa.Diagnostics, d)
+}
+
+// relate rattache au dernier diagnostic l'emplacement de la déclaration existante du symbole
+func (sa *SemanticAnalyzer) relate(sym *Symbol, format string, args ...interface{}) {
+	node, ok := sym.Node.(interface {
+		Line() int
+		Column() int
+	})
+	if len(sa.Diagnostics) == 0 || !ok || node.Line() == 0 {
+		return
+	}
+	d := &sa.Diagnostics[len(sa.Diagnostics)-1]
+	d.Related = append(d.Related, diagnostic.Related{
+		Span:    diagnostic.At(node.Line(), node.Column()),
+		Message: fmt.Sprintf(format, args...),
+	})
 }
 
 // Méthodes restantes pour visiter les autres types d'expressions et instructions
 func (sa *SemanticAnalyzer) visitReturnStatement(node *ast.ReturnStatement, t *TypeInfo) {
 	if (t == nil || t.Name == "void") && node.ReturnValue != nil {
-		sa.addError("Fonction does not return a value. line:%d, column:%d",
-			node.Token.Line, node.Token.Column)
+		sa.addError(diagnostic.SemanticError, diagnostic.At(node.Token.Line, node.Token.Column), "Fonction does not return a value")
 		return
 	}
 	ti := sa.visitExpression(node.ReturnValue)
 	if !sa.areTypesCompatible(t, ti) {
-		sa.addError("Type of the Return value mismatch: expected %s, got %s. line:%d, column:%d",
-			t.Name, ti.Name, node.Token.Line, node.Token.Column)
+		sa.addError(diagnostic.TypeMismatch, diagnostic.At(node.Token.Line, node.Token.Column), "Type of the Return value mismatch: expected %s, got %s",
+			t.Name, ti.Name)
 	}
 }
 
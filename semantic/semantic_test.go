@@ -1,5 +1,19 @@
 package semantic
 
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akristianlopez/action/diagnostic"
+	"github.com/akristianlopez/action/lexer"
+	"github.com/akristianlopez/action/parser"
+	_ "github.com/mattn/go-sqlite3"
+)
+
 // import (
 // 	"context"
 // 	"fmt"
@@ -804,3 +818,212 @@ package semantic
 // 		})
 // 	}
 // }
+
+func allowAll(ctx context.Context, table, field, operation string, mode bool) (bool, string) {
+	return true, ""
+}
+
+// openSQLite ouvre une base sqlite temporaire et y exécute stmts
+func openSQLite(t testing.TB, stmts ...string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// analyze analyse src sur db comme Action.Check, après avoir préparé l'analyseur avec setup, et
+// renvoie ses erreurs de syntaxe ou d'analyse
+func analyze(db *sql.DB, src string, setup ...func(*SemanticAnalyzer)) []diagnostic.Diagnostic {
+	p := parser.New(lexer.New(src))
+	act := p.ParseAction()
+	if len(p.Errors()) != 0 {
+		return p.Diagnostics()
+	}
+	analyzer := NewSemanticAnalyzer(context.Background(), db, allowAll, nil, nil, false)
+	for _, f := range setup {
+		f(analyzer)
+	}
+	analyzer.Analyze(act)
+	return diagnostic.Errors(analyzer.Diagnostics)
+}
+
+func TestUnknownTimeZone(t *testing.T) {
+	diags := analyze(nil, "action \"Zone\"()\nstart\n\treturn #2024-01-15 10:00 Mars/Olympus#\nstop\n")
+	if len(diags) == 0 || !strings.Contains(diags[0].Message, "unknown time zone 'Mars/Olympus'") {
+		t.Fatalf("expected an unknown time zone error, got %v", diags)
+	}
+}
+
+func TestDateFunctionArguments(t *testing.T) {
+	for _, src := range []string{
+		"action \"Args\"()\nstart\n\treturn format_date(now())\nstop\n",
+		"action \"Args\"()\nstart\n\treturn convert_tz(now(), \"UTC\")\nstop\n",
+		"action \"Args\"()\nstart\n\treturn today(\"UTC\", \"fr\")\nstop\n",
+	} {
+		if diags := analyze(nil, src); len(diags) == 0 {
+			t.Errorf("expected an argument count error for %q", src)
+		}
+	}
+}
+
+func TestBadMap(t *testing.T) {
+	src := `action "BadMap"()
+		start
+			let m: map of string to integer = map{"a": 1}
+			let l: array of integer = [1, 2]
+			m[1] = 2
+			m["b"] = "deux"
+			let h = has_key(m, 3)
+			for let k, v of l {
+			}
+			return m
+		stop
+		`
+	if diags := analyze(nil, src); len(diags) != 4 {
+		t.Fatalf("expected 4 errors, got %v", diags)
+	}
+}
+
+func TestBadJSON(t *testing.T) {
+	src := `action "BadJSON"()
+		start
+			let s: string = "x"
+			let j: json = parsejson(s)
+			let a = s.$.x
+			let b = j.$[true]
+			return parsejson(1)
+		stop
+		`
+	if diags := analyze(nil, src); len(diags) != 3 {
+		t.Fatalf("expected 3 errors, got %v", diags)
+	}
+}
+
+func TestBadLambda(t *testing.T) {
+	src := `action "BadLambda"()
+		start
+			let l: array of integer = [1, 2]
+			let a = filter(l, function(x: string): boolean { return x == "1" })
+			let b = filter(l, function(x: integer): integer { return x })
+			let c = map(l, 3)
+			let f: function(integer): boolean = function(x: integer): boolean { return x > 1 }
+			let d = f("deux")
+			return l
+		stop
+		`
+	if diags := analyze(nil, src); len(diags) != 4 {
+		t.Fatalf("expected 4 errors, got %v", diags)
+	}
+}
+
+// modules fait charger à l'analyseur les modules de sources, désignés par leur chemin
+func modules(sources map[string]string) func(*SemanticAnalyzer) {
+	return func(sa *SemanticAnalyzer) {
+		sa.SetModuleLoader(func(ctx context.Context, path string) (string, error) {
+			if src, ok := sources[path]; ok {
+				return src, nil
+			}
+			return "", fmt.Errorf("unknown module '%s'", path)
+		})
+	}
+}
+
+func TestBadImport(t *testing.T) {
+	lib := modules(map[string]string{
+		"lib/finance": `module "finance"
+			type Pret struct {
+				montant: float,
+				taux: float,
+				duree: integer
+			}
+			function cout(p: Pret): float {
+				return p.montant * p.taux * p.duree
+			}`,
+		"a": `module "a"
+			import "b" as b`,
+		"b": `module "b"
+			import "a" as a`,
+	})
+	bad := map[string]string{
+		"expected Pret, got string": `action "Credit"()
+			import "lib/finance" as fin
+			start
+				return fin.cout("mille")
+			stop`,
+		"does not export a function 'inconnue'": `action "Credit"()
+			import "lib/finance" as fin
+			start
+				return fin.inconnue(1)
+			stop`,
+		"Import cycle: a -> b -> a": `action "Cycle"()
+			import "a" as a
+			start
+				return 1
+			stop`,
+	}
+	for want, src := range bad {
+		if diags := analyze(nil, src, lib); len(diags) != 1 || !strings.Contains(diags[0].String(), want) {
+			t.Errorf("%s: expected one error, got %v", want, diags)
+		}
+	}
+
+	src := `action "Dehors"()
+		import "../secret" as s
+		start
+			return 1
+		stop`
+	dir := func(sa *SemanticAnalyzer) { sa.SetModuleLoader(DirLoader(t.TempDir())) }
+	if diags := analyze(nil, src, dir); len(diags) != 1 || !strings.Contains(diags[0].String(), "stay inside the module directory") {
+		t.Errorf("expected a path outside the module directory to be refused, got %v", diags)
+	}
+	if diags := analyze(nil, src); len(diags) == 0 || !strings.Contains(diags[0].String(), "No module loader") {
+		t.Fatalf("expected a missing loader error, got %v", diags)
+	}
+}
+
+// actions fait charger à l'analyseur les actions de sources appelées par run, désignées par leur nom
+func actions(sources map[string]string) func(*SemanticAnalyzer) {
+	return func(sa *SemanticAnalyzer) {
+		sa.SetActionSource(func(ctx context.Context, name string) (string, error) {
+			if src, ok := sources[strings.ToLower(name)]; ok {
+				return src, nil
+			}
+			return "", fmt.Errorf("unknown action '%s'", name)
+		})
+	}
+}
+
+func TestBadRun(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE Journal (id INTEGER PRIMARY KEY, msg TEXT)")
+	source := actions(map[string]string{
+		"journaliser": `action "Journaliser"(id: integer, msg: string): integer
+			start
+				insert into Journal (id, msg) values (id, msg);
+				return id * 10
+			stop`,
+		"boucle": `action "Boucle"(n: integer)
+			start
+				return run "Boucle"(n: n + 1)
+			stop`,
+	})
+	bad := map[string]string{
+		"expected integer, got string":    `run "Journaliser"(id: "deux", msg: "x")`,
+		"does not have a parameter 'nom'": `run "Journaliser"(id: 1, nom: "x")`,
+		"Action cycle: Boucle -> Boucle":  `run "Boucle"(n: 1)`,
+		"unknown action 'Absente'":        `run "Absente"()`,
+	}
+	for want, call := range bad {
+		src := "action \"Appel\"()\n start\n return " + call + "\n stop"
+		if diags := analyze(db, src, source); len(diags) != 1 || !strings.Contains(diags[0].String(), want) {
+			t.Errorf("%s: expected one error, got %v", want, diags)
+		}
+	}
+}
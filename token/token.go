@@ -1,5 +1,7 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
@@ -24,7 +26,8 @@ const (
 	RETURN    = "RETURN"
 	CATCH     = "CATCH"
 	PROTECTED = "PROTECTED"
-	IIF	   = "IIF"
+	IIF       = "IIF"
+	IMPORT    = "IMPORT"
 	// WHILE    = "WHILE"
 	// FOREACH  = "FOREACH"
 
@@ -41,10 +44,12 @@ const (
 	IDENT        = "IDENT"
 	INT_LIT      = "INT_LIT"
 	FLOAT_LIT    = "FLOAT_LIT"
+	DECIMAL_LIT  = "DECIMAL_LIT"
 	STRING_LIT   = "STRING_LIT"
 	BOOL_LIT     = "BOOL_LIT"
 	TIME_LIT     = "TIME_LIT"
 	DATE_LIT     = "DATE_LIT"
+	DATETIME_LIT = "DATETIME_LIT"
 	DURATION_LIT = "DURATION_LIT"
 
 	// Opérateurs
@@ -72,6 +77,7 @@ const (
 	SEMICOLON = ";"
 	COLON     = ":"
 	DOT       = "."
+	DOLLAR    = "$"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -151,21 +157,21 @@ const (
 	// TIMESTAMP = "TIMESTAMP"
 	DATETIME = "DATETIME"
 	// TEXT      = "TEXT"
-	// JSON = "JSON"
+	JSON = "JSON"
 
 	// SQL récursif
-	WITH      = "WITH"
-	RECURSIVE = "RECURSIVE"
-	WINDOW    = "WINDOW"
-	OVER      = "OVER"
-	PARTITION = "PARTITION"
-	ROW       = "ROW"
-	ROWS      = "ROWS"
-	RANGE     = "RANGE"
-	PRECEDING = "PRECEDING"
-	FOLLOWING = "FOLLOWING"
-	CURRENT   = "CURRENT"
-	UNBOUNDED = "UNBOUNDED"
+	WITH        = "WITH"
+	RECURSIVE   = "RECURSIVE"
+	WINDOW      = "WINDOW"
+	OVER        = "OVER"
+	PARTITION   = "PARTITION"
+	ROW         = "ROW"
+	ROWS        = "ROWS"
+	RANGE       = "RANGE"
+	PRECEDING   = "PRECEDING"
+	FOLLOWING   = "FOLLOWING"
+	CURRENT     = "CURRENT"
+	UNBOUNDED   = "UNBOUNDED"
 	LAG         = "LAG"
 	LEAD        = "LEAD"
 	FIRST_VALUE = "FIRST_VALUE"
@@ -174,15 +180,16 @@ const (
 	DENSE_RANK  = "DENSE_RANK"
 	ROW_NUMBER  = "ROW_NUMBER"
 	NTILE       = "NTILE"
-	CONNECT  = "CONNECT"
-	PRIOR    = "PRIOR"
-	NOCYCLE  = "NOCYCLE"
-	SIBLINGS = "SIBLINGS"
-	CASCADE  = "CASCADE"
+	CONNECT     = "CONNECT"
+	PRIOR       = "PRIOR"
+	NOCYCLE     = "NOCYCLE"
+	SIBLINGS    = "SIBLINGS"
+	CASCADE     = "CASCADE"
 
-	// Tableaux
+	// Tableaux et dictionnaires
 	ARRAY = "ARRAY"
 	OF    = "OF"
+	MAP   = "MAP"
 
 	SWITCH      = "SWITCH"
 	CASE        = "CASE"
@@ -197,6 +204,7 @@ var keywords = map[string]TokenType{
 	"stop":      STOP,
 	"let":       LET,
 	"function":  FUNCTION,
+	"import":    IMPORT,
 	"struct":    STRUCT,
 	"type":      TYPE,
 	"for":       FOR,
@@ -276,7 +284,7 @@ var keywords = map[string]TokenType{
 	"nocycle":  NOCYCLE,
 	"siblings": SIBLINGS,
 	"cascade":  CASCADE,
-	"iif": IIF,
+	"iif":      IIF,
 	// // Types SQL
 	// "varchar":   VARCHAR,
 	// "char":      CHAR,
@@ -285,21 +293,21 @@ var keywords = map[string]TokenType{
 	// "timestamp": TIMESTAMP,
 	"datetime": DATETIME,
 	// "text":      TEXT,
-	// "json": JSON,
+	"json": JSON,
 
 	// SQL récursif et analytique
-	"with":      WITH,
-	"recursive": RECURSIVE,
-	"window":    WINDOW,
-	"over":      OVER,
-	"partition": PARTITION,
-	"row":       ROW,
-	"rows":      ROWS,
-	"range":     RANGE,
-	"preceding": PRECEDING,
-	"following": FOLLOWING,
-	"current":   CURRENT,
-	"unbounded": UNBOUNDED,
+	"with":        WITH,
+	"recursive":   RECURSIVE,
+	"window":      WINDOW,
+	"over":        OVER,
+	"partition":   PARTITION,
+	"row":         ROW,
+	"rows":        ROWS,
+	"range":       RANGE,
+	"preceding":   PRECEDING,
+	"following":   FOLLOWING,
+	"current":     CURRENT,
+	"unbounded":   UNBOUNDED,
 	"lag":         LAG,
 	"lead":        LEAD,
 	"first_value": FIRST_VALUE,
@@ -308,9 +316,10 @@ var keywords = map[string]TokenType{
 	"dense_rank":  DENSE_RANK,
 	"row_number":  ROW_NUMBER,
 	"ntile":       NTILE,
-	"array":    ARRAY,
-	"of":       OF,
-	"duration": DURATION,
+	"array":       ARRAY,
+	"of":          OF,
+	"map":         MAP,
+	"duration":    DURATION,
 
 	// Switch statement
 	"switch":      SWITCH,
@@ -326,3 +335,13 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// Keywords renvoie les mots-clés du langage, triés
+func Keywords() []string {
+	res := make([]string, 0, len(keywords))
+	for k := range keywords {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}